@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// alertMessage is the last battery alert that could not be raised, shown
+// under the start menu. It is set by the alerts and read when the menu is
+// drawn.
+var alertMessage atomic.Pointer[string]
+
+/****************************************************************************/
+/*                                  ALERTS                                  */
+/****************************************************************************/
+
+// alertFailed shows err under the start menu, the terminal is in raw mode
+// and not to be printed to.
+func alertFailed(err error) {
+	text := fmt.Sprintf("Battery alert: %s", err)
+	alertMessage.Store(&text)
+}
+
+// alertLabel is the line showing the last failed alert, empty until one
+// fails.
+func alertLabel() string {
+	if text := alertMessage.Load(); text != nil {
+		return *text
+	}
+	return ""
+}
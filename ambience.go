@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+// ambienceRow is a line of the ambience screen: the mode, the level or
+// balance of a mode, or the button loop.
+type ambienceRow struct {
+	kind string // mode, level, balance or loop
+	mode jabra.AmbienceMode
+}
+
+// ambienceSettings is the ambience state of the selected headset, read
+// when the screen opens and after every change.
+type ambienceSettings struct {
+	mode       jabra.AmbienceMode
+	modes      []jabra.AmbienceMode
+	level      map[jabra.AmbienceMode]uint8
+	maxLevel   map[jabra.AmbienceMode]uint8
+	balance    map[jabra.AmbienceMode]int8
+	maxBalance map[jabra.AmbienceMode]uint8
+	// loop is nil for a headset without a button loop
+	loop []jabra.AmbienceMode
+}
+
+// loopEntry is a mode of the button loop being edited.
+type loopEntry struct {
+	mode jabra.AmbienceMode
+	on   bool
+}
+
+var (
+	ambience     ambienceSettings
+	ambienceRows []ambienceRow
+	// loopEditor holds the button loop while it is edited, all modes of
+	// the headset in loop order
+	loopEditor []loopEntry
+
+	ambienceMessage string
+	// ambienceStale is set when the selected headset reports an ambience
+	// change, the screen reads the state again when it is drawn next
+	ambienceStale atomic.Bool
+)
+
+/****************************************************************************/
+/*                                 AMBIENCE                                 */
+/****************************************************************************/
+
+// loadAmbience reads the ambience state of the selected headset and lays
+// out the rows of the screen.
+func loadAmbience() {
+	ambience = ambienceSettings{
+		level:      make(map[jabra.AmbienceMode]uint8),
+		maxLevel:   make(map[jabra.AmbienceMode]uint8),
+		balance:    make(map[jabra.AmbienceMode]int8),
+		maxBalance: make(map[jabra.AmbienceMode]uint8),
+	}
+	ambienceRows = nil
+
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+	id := headset.DeviceID
+	mode, err := backend.AmbienceMode(id)
+	if err != nil {
+		ambienceMessage = fmt.Sprintf("Ambience of %s: %s", headset.DeviceName, err)
+		return
+	}
+	modes, err := backend.AmbienceModes(id)
+	if err != nil {
+		ambienceMessage = fmt.Sprintf("Ambience of %s: %s", headset.DeviceName, err)
+		return
+	}
+	ambience.mode, ambience.modes = mode, modes
+	ambienceRows = append(ambienceRows, ambienceRow{kind: "mode"})
+
+	// Modes without levels or balance, such as off, fail to read them
+	for _, mode := range modes {
+		if maxLevel, err := backend.AmbienceLevels(id, mode); err == nil {
+			if level, err := backend.AmbienceLevel(id, mode); err == nil {
+				ambience.level[mode], ambience.maxLevel[mode] = level, maxLevel
+				ambienceRows = append(ambienceRows, ambienceRow{kind: "level", mode: mode})
+			}
+		}
+		if maxBalance, err := backend.AmbienceBalanceRange(id, mode); err == nil && maxBalance > 0 {
+			if balance, err := backend.AmbienceBalance(id, mode); err == nil {
+				ambience.balance[mode], ambience.maxBalance[mode] = balance, maxBalance
+				ambienceRows = append(ambienceRows, ambienceRow{kind: "balance", mode: mode})
+			}
+		}
+	}
+
+	if headset.FeatureFlags != nil && headset.FeatureFlags.AmbienceModesLoop {
+		if loop, err := backend.AmbienceLoop(id); err == nil {
+			ambience.loop = append([]jabra.AmbienceMode{}, loop...)
+			ambienceRows = append(ambienceRows, ambienceRow{kind: "loop"})
+		}
+	}
+}
+
+// ambienceChanged handles an ambience change reported by a headset, made
+// with its button or by another application.
+func ambienceChanged(event registry.Event) {
+	selectionMu.Lock()
+	selected := event.Key == selectedHeadset
+	selectionMu.Unlock()
+
+	if selected {
+		ambienceStale.Store(true)
+	}
+}
+
+// ambienceLabel shows the value of row.
+func ambienceLabel(row ambienceRow) string {
+	switch row.kind {
+	case "mode":
+		return fmt.Sprintf("  Mode: ◂ %s ▸", ambience.mode)
+	case "level":
+		return fmt.Sprintf("  %s level: ◂ %d ▸  (0 strongest, %d weakest)", row.mode, ambience.level[row.mode], ambience.maxLevel[row.mode])
+	case "balance":
+		return fmt.Sprintf("  %s balance: ◂ %s ▸  %+d", row.mode, balanceBar(ambience.balance[row.mode], ambience.maxBalance[row.mode]), ambience.balance[row.mode])
+	case "loop":
+		if len(ambience.loop) == 0 {
+			return "  Button loop: none"
+		}
+		names := make([]string, 0, len(ambience.loop))
+		for _, mode := range ambience.loop {
+			names = append(names, mode.String())
+		}
+		return "  Button loop: " + strings.Join(names, " → ")
+	}
+	return ""
+}
+
+// balanceBar draws balance on a scale from -maxBalance, left, to
+// maxBalance, right.
+func balanceBar(balance int8, maxBalance uint8) string {
+	width := 2*int(maxBalance) + 1
+	position := int(balance) + int(maxBalance)
+	return "L " + strings.Repeat("─", position) + "●" + strings.Repeat("─", width-position-1) + " R"
+}
+
+func selectedAmbienceRow() (ambienceRow, bool) {
+	if currentSelection >= len(ambienceRows) {
+		return ambienceRow{}, false
+	}
+	return ambienceRows[currentSelection], true
+}
+
+// changeAmbience moves the value under the cursor by step: the next or
+// previous mode, a level or balance step, or the place of a mode in the
+// loop being edited. Levels and balance stop at the ends of their range.
+func changeAmbience(step int) {
+	if loopEditor != nil {
+		moveLoopEntry(step)
+		return
+	}
+	headset, exists := getSelectedHeadset()
+	row, ok := selectedAmbienceRow()
+	if !exists || !ok {
+		return
+	}
+
+	var err error
+	switch row.kind {
+	case "mode":
+		if len(ambience.modes) == 0 {
+			return
+		}
+		index := slices.Index(ambience.modes, ambience.mode)
+		next := ambience.modes[(index+step+len(ambience.modes))%len(ambience.modes)]
+		err = backend.SetAmbienceMode(headset.DeviceID, next)
+	case "level":
+		level := int(ambience.level[row.mode]) + step
+		if level < 0 || level > int(ambience.maxLevel[row.mode]) {
+			return
+		}
+		err = backend.SetAmbienceLevel(headset.DeviceID, row.mode, uint8(level))
+	case "balance":
+		balance := int(ambience.balance[row.mode]) + step
+		if limit := int(ambience.maxBalance[row.mode]); balance < -limit || balance > limit {
+			return
+		}
+		err = backend.SetAmbienceBalance(headset.DeviceID, row.mode, int8(balance))
+	default:
+		return
+	}
+	if err != nil {
+		ambienceMessage = fmt.Sprintf("Not applied: %s", err)
+	} else {
+		ambienceMessage = ""
+	}
+	loadAmbience()
+}
+
+// activateAmbience handles Enter: the mode steps on, the loop starts being
+// edited, and in the loop editor the mode under the cursor is taken in or
+// out of the loop.
+func activateAmbience() {
+	if loopEditor != nil {
+		if currentSelection < len(loopEditor) {
+			loopEditor[currentSelection].on = !loopEditor[currentSelection].on
+		}
+		return
+	}
+	row, ok := selectedAmbienceRow()
+	if !ok {
+		return
+	}
+	switch row.kind {
+	case "mode":
+		changeAmbience(1)
+	case "loop":
+		loopEditor = nil
+		for _, mode := range ambience.loop {
+			loopEditor = append(loopEditor, loopEntry{mode: mode, on: true})
+		}
+		for _, mode := range ambience.modes {
+			if !slices.Contains(ambience.loop, mode) {
+				loopEditor = append(loopEditor, loopEntry{mode: mode})
+			}
+		}
+		currentSelection = 0
+		ambienceMessage = "Enter takes a mode in or out, A/D or ◂ ▸ move it, Q saves, Esc cancels"
+	}
+}
+
+// moveLoopEntry moves the mode under the cursor step places in the loop,
+// the cursor follows it.
+func moveLoopEntry(step int) {
+	to := currentSelection + step
+	if currentSelection >= len(loopEditor) || to < 0 || to >= len(loopEditor) {
+		return
+	}
+	loopEditor[currentSelection], loopEditor[to] = loopEditor[to], loopEditor[currentSelection]
+	currentSelection = to
+}
+
+// closeLoopEditor leaves the loop editor, writing the loop when save is
+// set. It reports whether the editor was open.
+func closeLoopEditor(save bool) bool {
+	if loopEditor == nil {
+		return false
+	}
+	var loop []jabra.AmbienceMode
+	for _, entry := range loopEditor {
+		if entry.on {
+			loop = append(loop, entry.mode)
+		}
+	}
+	loopEditor = nil
+	currentSelection = slices.IndexFunc(ambienceRows, func(row ambienceRow) bool { return row.kind == "loop" })
+	ambienceMessage = ""
+	if !save {
+		return true
+	}
+
+	if headset, exists := getSelectedHeadset(); exists {
+		if err := backend.SetAmbienceLoop(headset.DeviceID, loop); err != nil {
+			ambienceMessage = fmt.Sprintf("Button loop not applied: %s", err)
+		}
+	}
+	loadAmbience()
+	return true
+}
+
+func ambienceScreen() {
+	if !resetCurrentSelection {
+		currentSelection = 0
+		resetCurrentSelection = true
+		loopEditor = nil
+		ambienceMessage = ""
+		ambienceStale.Store(false)
+		loadAmbience()
+	}
+	if _, exists := getSelectedHeadset(); !exists {
+		startMenuSelected = -1
+		return
+	}
+	if ambienceStale.Swap(false) && loopEditor == nil {
+		loadAmbience()
+		ambienceMessage = fmt.Sprintf("Changed on the headset, mode %s", ambience.mode)
+	}
+
+	drawingBox()
+
+	if loopEditor != nil {
+		for i, entry := range loopEditor {
+			check := "[ ]"
+			if entry.on {
+				check = "[x]"
+			}
+			label := fmt.Sprintf("  %s %s", check, entry.mode)
+			if i == currentSelection {
+				moveCursor(4+i, 9)
+				fmt.Println("\033[42m", label, "\033[0m")
+			} else {
+				moveCursor(4+i, 10)
+				fmt.Println(label)
+			}
+		}
+	} else {
+		for i, row := range ambienceRows {
+			label := ambienceLabel(row)
+			if i == currentSelection {
+				moveCursor(4+i, 9)
+				fmt.Println("\033[42m", label, "\033[0m")
+			} else {
+				moveCursor(4+i, 10)
+				fmt.Println(label)
+			}
+		}
+	}
+
+	if ambienceMessage != "" {
+		moveCursor(height-5, 7)
+		fmt.Printf("\033[33m%s\033[0m", truncate(ambienceMessage, width-14))
+	}
+
+	moveCursor(height-3, 7)
+	if loopEditor != nil {
+		fmt.Println("\033[42m", "Q Save", "\033[0m", "\033[42m", "Esc Cancel", "\033[0m")
+	} else {
+		fmt.Println("\033[42m", "Q Back", "\033[0m")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build nosdk
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// Built with -tags nosdk the binary does not link against libjabra, which is
+// handy in CI. Only the simulated backend is available then.
+func newSDKBackend() (jabra.Backend, error) {
+	return nil, fmt.Errorf("jlink was built without libjabra (nosdk), run it with --simulate <scenario>")
+}
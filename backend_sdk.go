@@ -0,0 +1,12 @@
+//go:build !nosdk
+
+package main
+
+import (
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/sdk"
+)
+
+func newSDKBackend() (jabra.Backend, error) {
+	return sdk.New(), nil
+}
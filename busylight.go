@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// busylightMessage is shown under the start menu when the busylight could
+// not be turned.
+var busylightMessage string
+
+/****************************************************************************/
+/*                                BUSYLIGHT                                 */
+/****************************************************************************/
+
+// busylightLabel is the start menu item of the busylight of device, which
+// shows whether it is on.
+func busylightLabel(device jabra.DeviceInfo) string {
+	if on, err := backend.Busylight(device.DeviceID); err == nil && on {
+		return "Busylight ON"
+	}
+	return "Busylight OFF"
+}
+
+// toggleBusylight turns the busylight of the selected headset on or off.
+func toggleBusylight() {
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+	on, err := backend.Busylight(headset.DeviceID)
+	if err == nil {
+		err = backend.SetBusylight(headset.DeviceID, !on)
+	}
+	if err != nil {
+		busylightMessage = fmt.Sprintf("Busylight of %s: %s", headset.DeviceName, err)
+	} else {
+		busylightMessage = ""
+	}
+	updateStartMenu()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/buttons"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+var (
+	// buttonRunner does what config.yaml maps the buttons to, nil when
+	// jlinkd does it or nothing is mapped
+	buttonRunner *buttons.Runner
+	// lastButton is the last button pressed on a device, shown under the
+	// start menu. It is set by the device events and read when the menu is
+	// drawn.
+	lastButton atomic.Pointer[string]
+)
+
+/****************************************************************************/
+/*                                 BUTTONS                                  */
+/****************************************************************************/
+
+// buttonPressed shows the button of event as the last one pressed, with
+// what the configuration maps it to, and does that. Releases are not shown.
+func buttonPressed(event registry.Event) {
+	name := event.Input.String()
+	switch {
+	case event.Input == jabra.HidOffHook && event.Value:
+		name += " (off hook)"
+	case event.Input == jabra.HidOffHook:
+		name += " (on hook)"
+	case !event.Value:
+		return
+	}
+
+	text := fmt.Sprintf("Last button: %s on %s at %s", name, event.Device.DeviceName, time.Now().Format(time.TimeOnly))
+	if button, ok := appConfig.Buttons[event.Input.String()]; ok {
+		if button.Action != "" {
+			text += " → " + button.Action
+		} else {
+			text += " → " + button.Command
+		}
+	}
+	shown := &text
+	lastButton.Store(shown)
+
+	if buttonRunner == nil {
+		return
+	}
+	if press, ok := buttonRunner.Handle(event); ok {
+		// A command may take a while, the device events go on meanwhile
+		go func() {
+			if err := buttonRunner.Do(context.Background(), press); err != nil {
+				// unless another button is shown by now
+				failed := fmt.Sprintf("Button failed: %s", err)
+				lastButton.CompareAndSwap(shown, &failed)
+			}
+			// The busylight and the ambience show what the action changed
+			ambienceStale.Store(true)
+			updateStartMenu()
+		}()
+	}
+}
+
+// lastButtonLabel is the line showing the last button, empty until one is
+// pressed.
+func lastButtonLabel() string {
+	if text := lastButton.Load(); text != nil {
+		return *text
+	}
+	return ""
+}
@@ -9,9 +9,13 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/sys/unix"
 	"golang.org/x/term"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
 )
 
 var (
@@ -37,7 +41,9 @@ var (
 	resetCurrentSelection = false
 	currentSelection      = 0
 	menuState             = 0
-	startMenuSelected     = -1
+	// startMenuSelected is the id of the start menu item whose screen is
+	// open, -1 for the start menu. Positions change as devices come and go.
+	startMenuSelected = -1
 
 	// selecet
 	selectedItemsPairedDevices = -1
@@ -48,10 +54,9 @@ var (
 )
 
 const (
-	batteryFullChar     = "◼"
-	batteryEmptyChar    = "◻"
-	batteryWidth        = 10
-	lowBatteryThreshold = 20
+	batteryFullChar  = "◼"
+	batteryEmptyChar = "◻"
+	batteryWidth     = 10
 )
 
 func enableRawMode() (*unix.Termios, error) {
@@ -93,9 +98,51 @@ func startKeysPressedListener() {
 		if n >= 3 && buf[0] == 0x1B && buf[1] == '[' {
 			switch buf[2] {
 			case 'A': // Up Arrow
-				handleUpKey()
+				if menuState == 7 && !showingPresets() {
+					changeGain(1)
+				} else {
+					handleUpKey()
+				}
 			case 'B': // Down Arrow
-				handleDownKey()
+				if menuState == 7 && !showingPresets() {
+					changeGain(-1)
+				} else {
+					handleDownKey()
+				}
+			case 'C': // Right Arrow
+				switch menuState {
+				case 5:
+					changeSettingOption(1)
+				case 6:
+					changeAmbience(1)
+				case 7:
+					selectBand(1)
+				}
+			case 'D': // Left Arrow
+				switch menuState {
+				case 5:
+					changeSettingOption(-1)
+				case 6:
+					changeAmbience(-1)
+				case 7:
+					selectBand(-1)
+				}
+			}
+			continue
+		}
+
+		// Text typed into a setting, up to 3 bytes at a time
+		if menuState == 5 && editingSettingText() {
+			for _, key := range buf[:n] {
+				editSettingText(key)
+			}
+			continue
+		}
+
+		// The name of a new equalizer preset
+		if menuState == 7 && namingPreset() {
+			for _, key := range buf[:n] {
+				editPresetName(key)
 			}
 			continue
 		}
@@ -110,7 +157,14 @@ func startKeysPressedListener() {
 			case 's': // Down
 				handleDownKey()
 			case '\r': // Enter
-				startMenuSelected = currentSelection
+				item, exists := menuItemAt(getStartMenu(), currentSelection)
+				switch {
+				case !exists:
+				case item.id == 8:
+					toggleBusylight()
+				default:
+					startMenuSelected = item.id
+				}
 			}
 		// ############## Search For New Devices #################
 		case 1:
@@ -122,7 +176,7 @@ func startKeysPressedListener() {
 				startMenuSelected = -1
 			case '1':
 				selectedItemsSearchForNewDevices = 1
-				if len(searchDeviceList.pairedDevices) != 0 {
+				if len(searchDeviceList.PairedDevices) != 0 {
 					if err := connectNewDevice(uint16(currentSelection)); err != nil {
 						fmt.Println(err) //  remember to add a error window in the ui
 					} else {
@@ -170,7 +224,11 @@ func startKeysPressedListener() {
 			case 's': // Down
 				handleDownKey()
 			case '\r': // Enter
-				switch dongleSettignsMenu[currentSelection].id {
+				item, exists := menuItemAt(getDongleSettignsMenu(), currentSelection)
+				if !exists {
+					break
+				}
+				switch item.id {
 				case 0:
 					getautoPairingState, _ := getAutoPairing()
 					if err := setAutoPairing(!getautoPairingState); err != nil {
@@ -178,12 +236,19 @@ func startKeysPressedListener() {
 					}
 					updateDongleSettignsMenu()
 				case 1:
-					if dongle, exists := deviceManager[selectedDongle]; exists {
-						if err := factoryReset(dongle.deviceID); err != nil {
+					if dongle, exists := getSelectedDongle(); exists {
+						if err := backend.FactoryReset(dongle.DeviceID); err != nil {
 							fmt.Println(err) //  remember to add a error window in the ui
 						}
 						startMenuSelected = -1
 					}
+				case 2:
+					if dongle, exists := getSelectedDongle(); exists {
+						if err := toggleFirmwareLock(dongle); err != nil {
+							fmt.Println(err) //  remember to add a error window in the ui
+						}
+					}
+					updateDongleSettignsMenu()
 				}
 			}
 		// ############# switch  device ##################
@@ -191,6 +256,100 @@ func startKeysPressedListener() {
 			switch key {
 			case 'q': // Back To Start Menu
 				startMenuSelected = -1
+			case 'w': // Up
+				handleUpKey()
+			case 's': // Down
+				handleDownKey()
+			case '\r': // Enter
+				if err := selectDevice(currentSelection); err != nil {
+					fmt.Println(err) //  remember to add a error window in the ui
+				}
+			}
+		// ############# HeadSet Settings ##################
+		case 5:
+			if showSettingsLog && key != 'q' && key != 'l' {
+				break // the change log takes no other keys
+			}
+			switch key {
+			case 'q': // Back To Start Menu, out of the option being chosen or the change log
+				switch {
+				case showSettingsLog:
+					toggleSettingsLog()
+				case !cancelSettingEdit():
+					startMenuSelected = -1
+				}
+			case 'l': // Change log
+				toggleSettingsLog()
+			case 0x1B: // Escape
+				cancelSettingEdit()
+			case 'w': // Up
+				handleUpKey()
+			case 's': // Down
+				handleDownKey()
+			case 'a': // Previous option
+				changeSettingOption(-1)
+			case 'd': // Next option
+				changeSettingOption(1)
+			case '\r': // Enter
+				activateHeadsetSetting()
+			}
+		// ############# Ambience ##################
+		case 6:
+			switch key {
+			case 'q': // Back To Start Menu, or save the loop being edited
+				if !closeLoopEditor(true) {
+					startMenuSelected = -1
+				}
+			case 0x1B: // Escape
+				closeLoopEditor(false)
+			case 'w': // Up
+				handleUpKey()
+			case 's': // Down
+				handleDownKey()
+			case 'a': // Previous value
+				changeAmbience(-1)
+			case 'd': // Next value
+				changeAmbience(1)
+			case '\r': // Enter
+				activateAmbience()
+			}
+		// ############# Equalizer ##################
+		case 7:
+			switch key {
+			case 'q': // Back To Start Menu, or out of the presets
+				if !closePresets() {
+					startMenuSelected = -1
+				}
+			case 'w': // Up, or a gain step up
+				if showingPresets() {
+					handleUpKey()
+				} else {
+					changeGain(1)
+				}
+			case 's': // Down, or a gain step down
+				if showingPresets() {
+					handleDownKey()
+				} else {
+					changeGain(-1)
+				}
+			case 'a': // Previous band
+				selectBand(-1)
+			case 'd': // Next band
+				selectBand(1)
+			case 'e': // Equalizer on or off
+				toggleEqualizer()
+			case 'p': // Presets
+				openPresets()
+			case 'n': // Save as a new preset
+				startNamingPreset()
+			case 'x': // Delete a preset
+				if showingPresets() {
+					deletePreset()
+				}
+			case '\r': // Enter
+				if showingPresets() {
+					loadPreset()
+				}
 			}
 		}
 	}
@@ -205,17 +364,37 @@ func handleUpKey() {
 func handleDownKey() {
 	switch menuState {
 	case 0: // StartMenu
-		if currentSelection < len(startMenu)-1 {
+		if currentSelection < len(getStartMenu())-1 {
 			currentSelection++
 		}
 	case 2: // See Remembered Paired Devices
-		if dongle, exists := deviceManager[selectedDongle]; exists {
-			if currentSelection < len(dongle.pairingList.pairedDevices)-1 {
+		if dongle, exists := getSelectedDongle(); exists && dongle.PairingList != nil {
+			if currentSelection < len(dongle.PairingList.PairedDevices)-1 {
 				currentSelection++
 			}
 		}
 	case 3: // Dongle Settings
-		if currentSelection < len(dongleSettignsMenu)-1 {
+		if currentSelection < len(getDongleSettignsMenu())-1 {
+			currentSelection++
+		}
+	case 4: // Switch Device
+		if currentSelection < len(deviceManager.Devices())-1 {
+			currentSelection++
+		}
+	case 5: // HeadSet Settings
+		if currentSelection < len(headsetSettingsMenu)-1 {
+			currentSelection++
+		}
+	case 6: // Ambience
+		rows := len(ambienceRows)
+		if loopEditor != nil {
+			rows = len(loopEditor)
+		}
+		if currentSelection < rows-1 {
+			currentSelection++
+		}
+	case 7: // Equalizer presets
+		if currentSelection < len(presetList)-1 {
 			currentSelection++
 		}
 	}
@@ -265,33 +444,49 @@ func drawingBox() {
 
 }
 
+// isLowBattery reports whether level is at or below the highest configured
+// alert threshold.
+func isLowBattery(level uint8) bool {
+	thresholds := appConfig.Alerts.Thresholds
+	return len(thresholds) > 0 && level <= thresholds[0]
+}
+
 func header() {
 	moveCursor(2, 5)
-	dongle, exists := deviceManager[selectedDongle]
-	if !exists {
+	dongle, exists := getSelectedDongle()
+	if exists {
+		fmt.Printf("%s", dongle.DeviceName)
+	} else {
+		// A headset on USB works without a dongle
 		fmt.Printf("Looking For Dongle %s", loading[loadingIndex])
-		loadingIndex = (loadingIndex + 1) % len(loading)
-		return
+		if len(deviceManager.Devices()) == 0 {
+			loadingIndex = (loadingIndex + 1) % len(loading)
+			return
+		}
 	}
-	fmt.Printf("%s", dongle.deviceName)
 
-	headset, exists := deviceManager[selectedHeadset]
+	headset, exists := getSelectedHeadset()
 	if !exists {
 		moveCursor(2, width-25)
 		fmt.Printf("Looking For HeadSet %s", loading[loadingIndex])
 		loadingIndex = (loadingIndex + 1) % len(loading)
 		return
 	}
-	if headset.batteryStatus == nil {
+	if headset.IsInFirmwareUpdateMode {
+		moveCursor(2, width-70)
+		fmt.Printf("\033[31m%s - firmware update mode, run jlink firmware update\033[0m", headset.DeviceName)
+		return
+	}
+	if headset.BatteryStatus == nil {
 		return
 	}
 
-	levelInPercent := headset.batteryStatus.levelInPercent
+	levelInPercent := headset.BatteryStatus.LevelInPercent
 	filledSegments := int(math.Round(float64(levelInPercent) / 100 * batteryWidth))
 	emptySegments := batteryWidth - filledSegments
 	var color string
 	switch {
-	case headset.batteryStatus.batteryLow:
+	case headset.BatteryStatus.BatteryLow || isLowBattery(levelInPercent):
 		color = "\033[31m" // Red for low battery
 	case levelInPercent <= 65:
 		color = "\033[33m" // Yellow for medium battery
@@ -304,19 +499,75 @@ func header() {
 		strings.Repeat(batteryEmptyChar, emptySegments) +
 		"\033[0m" // Reset color
 
-	if headset.batteryStatus.charging {
+	if headset.BatteryStatus.Charging {
 		moveCursor(2, width-50)
-		fmt.Printf("%s - Battery : [%s]🗲 %d%%", headset.deviceName, batteryBar, levelInPercent)
+		fmt.Printf("%s - Battery : [%s]🗲 %d%%", headset.DeviceName, batteryBar, levelInPercent)
 	} else {
 		moveCursor(2, width-48)
-		fmt.Printf("%s - Battery: [%s] %d%%", headset.deviceName, batteryBar, levelInPercent)
+		fmt.Printf("%s - Battery: [%s] %d%%", headset.DeviceName, batteryBar, levelInPercent)
+	}
+
+	// Earbuds, cradle and remote control have batteries of their own
+	status := batteryUnits(headset.BatteryStatus)
+	if estimate, ok := batteryHistory.Estimate(headset.SerialNumber); ok {
+		status = strings.TrimSpace(status + "  " + estimate.String())
+	}
+	if status != "" {
+		moveCursor(1, width-5-utf8.RuneCountInString(status))
+		fmt.Print(status)
+	}
+}
+
+// firmwareProgressBar draws the running firmware update above the header,
+// and how it ended for a while after.
+func firmwareProgressBar() {
+	update, exists := getFirmwareUpdate()
+	if !exists {
+		return
+	}
+
+	moveCursor(1, 5)
+	if update.progress.Status.Done() {
+		if err := update.progress.Status.Err(); err != nil {
+			fmt.Printf("\033[31m%s: %s\033[0m", update.deviceName, err)
+		} else {
+			fmt.Printf("%s: firmware update completed", update.deviceName)
+		}
+		return
+	}
+
+	filledSegments := int(math.Round(float64(update.progress.Percentage) / 100 * batteryWidth))
+	fmt.Printf("Updating %s [\033[34m%s%s\033[0m] %d%%", update.deviceName,
+		strings.Repeat(batteryFullChar, filledSegments),
+		strings.Repeat(batteryEmptyChar, batteryWidth-filledSegments),
+		update.progress.Percentage)
+}
+
+func batteryUnits(batteryStatus *jabra.BatteryStatus) string {
+	var units []string
+	for _, unit := range batteryStatus.ExtraUnits {
+		var label string
+		switch unit.Component {
+		case jabra.ComponentLeft:
+			label = "L"
+		case jabra.ComponentRight:
+			label = "R"
+		case jabra.ComponentCradle:
+			label = "Cradle"
+		case jabra.ComponentRemoteControl:
+			label = "Remote"
+		default:
+			continue
+		}
+		units = append(units, fmt.Sprintf("%s %d%%", label, unit.LevelInPercent))
 	}
+	return strings.Join(units, "  ")
 }
 
 func menu(width int) {
 	resetCurrentSelection = false // we can make a map to rember what was the last currentSelection
 	drawingBox()
-	for i, option := range startMenu {
+	for i, option := range getStartMenu() {
 		mid := (width - len(option.label)) / 2
 
 		if i == currentSelection {
@@ -327,6 +578,18 @@ func menu(width int) {
 			fmt.Println(option.label)
 		}
 	}
+	if label := alertLabel(); label != "" {
+		moveCursor(height-7, 7)
+		fmt.Printf("\033[33m%s\033[0m", truncate(label, width-14))
+	}
+	if label := lastButtonLabel(); label != "" {
+		moveCursor(height-6, 7)
+		fmt.Printf("\033[36m%s\033[0m", truncate(label, width-14))
+	}
+	if busylightMessage != "" {
+		moveCursor(height-5, 7)
+		fmt.Printf("\033[33m%s\033[0m", truncate(busylightMessage, width-14))
+	}
 }
 
 func updateSearchDeviceList() {
@@ -334,12 +597,12 @@ func updateSearchDeviceList() {
 		if menuState != 1 {
 			return
 		}
-		if dongle, exists := deviceManager[selectedDongle]; exists {
-			updateSearchDeviceLis := getSearchDeviceList(dongle.deviceID)
+		if dongle, exists := getSelectedDongle(); exists {
+			updateSearchDeviceLis := backend.SearchDeviceList(dongle.DeviceID)
 			if updateSearchDeviceLis != nil {
-				searchDeviceList.count = updateSearchDeviceLis.count
-				searchDeviceList.listType = updateSearchDeviceLis.listType
-				searchDeviceList.pairedDevices = updateSearchDeviceLis.pairedDevices
+				searchDeviceList.Count = updateSearchDeviceLis.Count
+				searchDeviceList.ListType = updateSearchDeviceLis.ListType
+				searchDeviceList.PairedDevices = updateSearchDeviceLis.PairedDevices
 			}
 		}
 		time.Sleep(time.Second)
@@ -358,10 +621,10 @@ func menuSearchForNewDevices() {
 
 	drawingBox()
 
-	if len(searchDeviceList.pairedDevices) != 0 {
-		for i, pairedDevice := range searchDeviceList.pairedDevices {
+	if len(searchDeviceList.PairedDevices) != 0 {
+		for i, pairedDevice := range searchDeviceList.PairedDevices {
 			moveCursor(4+i, 10)
-			device := fmt.Sprintf("%d %s", i+1, pairedDevice.deviceName)
+			device := fmt.Sprintf("%d %s", i+1, pairedDevice.DeviceName)
 			if i == currentSelection {
 				fmt.Println("\033[42m", device, "\033[0m")
 			} else {
@@ -396,11 +659,15 @@ func menuPairedDevices() {
 
 	drawingBox()
 
-	if dongle, exists := deviceManager[selectedDongle]; exists {
-		for i, pairedDevice := range dongle.pairingList.pairedDevices {
+	if dongle, exists := getSelectedDongle(); exists {
+		var pairedDevices []jabra.PairedDevice
+		if dongle.PairingList != nil {
+			pairedDevices = dongle.PairingList.PairedDevices
+		}
+		for i, pairedDevice := range pairedDevices {
 			moveCursor(4+i, 10)
-			device := fmt.Sprintf("%d %s", i+1, pairedDevice.deviceName)
-			if pairedDevice.isConnected {
+			device := fmt.Sprintf("%d %s", i+1, pairedDevice.DeviceName)
+			if pairedDevice.IsConnected {
 				device += " (Connected)"
 			}
 			if i == currentSelection {
@@ -439,7 +706,7 @@ func dongleSettigns() {
 
 	drawingBox()
 
-	for i, item := range dongleSettignsMenu {
+	for i, item := range getDongleSettignsMenu() {
 
 		if i == currentSelection {
 			moveCursor(4+i, 9)
@@ -454,6 +721,37 @@ func dongleSettigns() {
 	fmt.Println("\033[42m", "Q Back", "\033[0m")
 }
 
+func menuSwitchDevice() {
+	if !resetCurrentSelection {
+		currentSelection = 0
+		resetCurrentSelection = true
+	}
+
+	drawingBox()
+
+	for i, device := range sortedDevices() {
+		deviceType := "Headset"
+		if device.IsDongle {
+			deviceType = "Dongle "
+		}
+		label := fmt.Sprintf("%s  %s (%s, %s)", deviceType, device.DeviceName, device.DeviceConnection, device.SerialNumber)
+		if isSelected(registry.KeyOf(device)) {
+			label += " (Selected)"
+		}
+
+		if i == currentSelection {
+			moveCursor(4+i, 9)
+			fmt.Println("\033[42m", label, "\033[0m")
+		} else {
+			moveCursor(4+i, 10)
+			fmt.Println(label)
+		}
+	}
+
+	moveCursor(height-3, 7)
+	fmt.Println("\033[42m", "Q Back", "\033[0m")
+}
+
 func startUi() {
 	sigChan := make(chan os.Signal, 1)
 	go func() {
@@ -468,9 +766,10 @@ func startUi() {
 			clearScreen()
 			getScreenSize()
 			header()
+			firmwareProgressBar()
 
 			if startMenuSelected != -1 {
-				switch startMenu[startMenuSelected].id {
+				switch startMenuSelected {
 				case 0: // Search For New Devices
 					menuState = 1
 					menuSearchForNewDevices()
@@ -481,13 +780,19 @@ func startUi() {
 					menuState = 3
 					dongleSettigns()
 				case 3: // Switch Device
-					moveCursor(4, 5)
-					fmt.Println("Switch Device")
 					menuState = 4
+					menuSwitchDevice()
 				case 4: // HeadSet Settings
-					fmt.Println("HeadSet Settings")
+					menuState = 5
+					headsetSettings()
 				case 5: // Exit
 					return
+				case 6: // Ambience
+					menuState = 6
+					ambienceScreen()
+				case 7: // Equalizer
+					menuState = 7
+					equalizerScreen()
 				}
 			} else {
 				menuState = 0
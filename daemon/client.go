@@ -0,0 +1,591 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+var ErrClosed = errors.New("jlinkd: connection closed")
+
+// Client is a jabra.Backend that forwards every call to jlinkd, so the TUI
+// and the CLI share the daemon's session instead of opening their own.
+type Client struct {
+	netConn net.Conn
+
+	writeMu sync.Mutex
+	encoder *json.Encoder
+
+	mu        sync.Mutex
+	nextID    uint64
+	pending   map[uint64]chan message
+	callbacks jabra.Callbacks
+	err       error
+
+	// Notifications are delivered in order from their own goroutine, the
+	// callbacks are free to call back into the client.
+	eventsMu sync.Mutex
+	events   []func()
+	wake     chan struct{}
+	done     chan struct{}
+}
+
+// Dial connects to the daemon listening on path.
+func Dial(path string) (*Client, error) {
+	netConn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		netConn: netConn,
+		encoder: json.NewEncoder(netConn),
+		pending: make(map[uint64]chan message),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+	go c.dispatch()
+
+	return c, nil
+}
+
+// Close drops the connection to the daemon.
+func (c *Client) Close() error {
+	return c.netConn.Close()
+}
+
+func (c *Client) read() {
+	defer close(c.done)
+
+	scanner := bufio.NewScanner(c.netConn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+
+		if msg.Method != "" {
+			c.notification(msg)
+			continue
+		}
+		if msg.ID == nil {
+			continue
+		}
+
+		c.mu.Lock()
+		response, exists := c.pending[*msg.ID]
+		delete(c.pending, *msg.ID)
+		c.mu.Unlock()
+		if exists {
+			response <- msg
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = ErrClosed
+	for id, response := range c.pending {
+		close(response)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) notification(msg message) {
+	c.mu.Lock()
+	cb := c.callbacks
+	c.mu.Unlock()
+
+	var event func()
+	switch msg.Method {
+	case "firstScanDone":
+		if cb.FirstScanDone != nil {
+			event = cb.FirstScanDone
+		}
+	case "deviceAttached":
+		var p deviceAttachedParams
+		if cb.DeviceAttached != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.DeviceAttached(p.Device) }
+		}
+	case "deviceRemoved":
+		var p deviceRemovedParams
+		if cb.DeviceRemoved != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.DeviceRemoved(p.DeviceID) }
+		}
+	case "batteryChanged":
+		var p batteryChangedParams
+		if cb.BatteryStatusChanged != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.BatteryStatusChanged(p.DeviceID, p.BatteryStatus) }
+		}
+	case "firmwareProgress":
+		var p firmwareProgressParams
+		if cb.FirmwareProgress != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.FirmwareProgress(p.DeviceID, p.Progress) }
+		}
+	case "settingsChanged":
+		var p settingsChangedParams
+		if cb.SettingsChanged != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.SettingsChanged(p.DeviceID, p.Settings) }
+		}
+	case "ambienceChanged":
+		var p ambienceChangedParams
+		if cb.AmbienceChanged != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.AmbienceChanged(p.DeviceID, p.Event) }
+		}
+	case "busylightChanged":
+		var p busylightChangedParams
+		if cb.BusylightChanged != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.BusylightChanged(p.DeviceID, p.On) }
+		}
+	case "hidInput":
+		var p hidInputParams
+		if cb.HidInput != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.HidInput(p.DeviceID, p.Input, p.Value) }
+		}
+	case "rawHidInput":
+		var p rawHidInputParams
+		if cb.RawHidInput != nil && json.Unmarshal(msg.Params, &p) == nil {
+			event = func() { cb.RawHidInput(p.DeviceID, p.UsagePage, p.Usage, p.Value) }
+		}
+	}
+	if event == nil {
+		return
+	}
+
+	c.eventsMu.Lock()
+	c.events = append(c.events, event)
+	c.eventsMu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) dispatch() {
+	for {
+		select {
+		case <-c.wake:
+		case <-c.done:
+			return
+		}
+
+		for {
+			c.eventsMu.Lock()
+			if len(c.events) == 0 {
+				c.eventsMu.Unlock()
+				break
+			}
+			event := c.events[0]
+			c.events = c.events[1:]
+			c.eventsMu.Unlock()
+
+			event()
+		}
+	}
+}
+
+// call sends a request and decodes its result into result, which may be nil.
+func (c *Client) call(method string, p params, result any) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	response := make(chan message, 1)
+	c.pending[id] = response
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err = c.encoder.Encode(message{JSONRPC: jsonrpcVersion, ID: &id, Method: method, Params: data})
+	c.writeMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return err
+	}
+
+	msg, ok := <-response
+	if !ok {
+		return ErrClosed
+	}
+	if msg.Error != nil {
+		return fromRPCError(msg.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// Devices returns the devices currently attached to the daemon.
+func (c *Client) Devices() ([]jabra.DeviceInfo, error) {
+	var devices []jabra.DeviceInfo
+	err := c.call("devices", params{}, &devices)
+	return devices, err
+}
+
+/****************************************************************************/
+/*                              jabra.Backend                               */
+/****************************************************************************/
+
+func (c *Client) Initialize(appID string, cb jabra.Callbacks) error {
+	c.mu.Lock()
+	c.callbacks = cb
+	c.mu.Unlock()
+
+	return c.call("initialize", params{AppID: appID}, nil)
+}
+
+// Uninitialize stops the notifications and closes the connection, the
+// daemon keeps its own session running.
+func (c *Client) Uninitialize() error {
+	err := c.call("uninitialize", params{}, nil)
+
+	c.mu.Lock()
+	c.callbacks = jabra.Callbacks{}
+	c.mu.Unlock()
+
+	c.Close()
+	return err
+}
+
+func (c *Client) Version() (string, error) {
+	var version string
+	err := c.call("version", params{}, &version)
+	return version, err
+}
+
+func (c *Client) FactoryReset(deviceID uint16) error {
+	return c.call("factoryReset", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) FirmwareVersion(deviceID uint16) (string, error) {
+	var version string
+	err := c.call("firmwareVersion", params{DeviceID: deviceID}, &version)
+	return version, err
+}
+
+func (c *Client) PlayRingtone(deviceID uint16, level, ringtoneType uint8) error {
+	return c.call("playRingtone", params{DeviceID: deviceID, Level: level, Type: ringtoneType}, nil)
+}
+
+func (c *Client) FirmwareVersionBundle(deviceID uint16) (*jabra.FirmwareVersionBundle, error) {
+	var bundle *jabra.FirmwareVersionBundle
+	if err := c.call("firmwareVersionBundle", params{DeviceID: deviceID}, &bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func (c *Client) CheckForFirmwareUpdate(deviceID uint16, authorizationID string) (bool, error) {
+	var available bool
+	err := c.call("checkForFirmwareUpdate", params{DeviceID: deviceID, AuthorizationID: authorizationID}, &available)
+	return available, err
+}
+
+func (c *Client) LatestFirmwareInformation(deviceID uint16, authorizationID string) (*jabra.FirmwareInfo, error) {
+	var info *jabra.FirmwareInfo
+	if err := c.call("latestFirmwareInformation", params{DeviceID: deviceID, AuthorizationID: authorizationID}, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// UpdateFirmware passes path on to the daemon, which reads the package
+// itself, so relative paths are made absolute first.
+func (c *Client) UpdateFirmware(deviceID uint16, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return c.call("updateFirmware", params{DeviceID: deviceID, Path: path}, nil)
+}
+
+func (c *Client) FirmwareLock(deviceID uint16) (bool, error) {
+	var enabled bool
+	err := c.call("firmwareLock", params{DeviceID: deviceID}, &enabled)
+	return enabled, err
+}
+
+func (c *Client) SetFirmwareLock(deviceID uint16, enable bool) error {
+	return c.call("setFirmwareLock", params{DeviceID: deviceID, Enable: enable}, nil)
+}
+
+func (c *Client) BatteryStatus(deviceID uint16) (*jabra.BatteryStatus, error) {
+	var batteryStatus *jabra.BatteryStatus
+	if err := c.call("batteryStatus", params{DeviceID: deviceID}, &batteryStatus); err != nil {
+		return nil, err
+	}
+	return batteryStatus, nil
+}
+
+func (c *Client) SetBTPairing(deviceID uint16) error {
+	return c.call("setBTPairing", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) StopBTPairing(deviceID uint16) error {
+	return c.call("stopBTPairing", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) SearchNewDevices(deviceID uint16) error {
+	return c.call("searchNewDevices", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) SearchDeviceList(deviceID uint16) *jabra.PairingList {
+	var pairingList *jabra.PairingList
+	if err := c.call("searchDeviceList", params{DeviceID: deviceID}, &pairingList); err != nil {
+		return nil
+	}
+	return pairingList
+}
+
+// PairingList returns an empty list when the daemon cannot be reached, like
+// the SDK does when the dongle does not answer.
+func (c *Client) PairingList(deviceID uint16) *jabra.PairingList {
+	var pairingList *jabra.PairingList
+	if err := c.call("pairingList", params{DeviceID: deviceID}, &pairingList); err != nil || pairingList == nil {
+		return &jabra.PairingList{
+			Count:         0,
+			ListType:      -1,
+			PairedDevices: make([]jabra.PairedDevice, 0),
+		}
+	}
+	return pairingList
+}
+
+func (c *Client) ConnectNewDevice(deviceID uint16, device jabra.PairedDevice) error {
+	return c.call("connectNewDevice", params{DeviceID: deviceID, Device: &device}, nil)
+}
+
+func (c *Client) ConnectPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	return c.call("connectPairedDevice", params{DeviceID: deviceID, Device: &device}, nil)
+}
+
+func (c *Client) DisconnectPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	return c.call("disconnectPairedDevice", params{DeviceID: deviceID, Device: &device}, nil)
+}
+
+func (c *Client) ClearPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	return c.call("clearPairedDevice", params{DeviceID: deviceID, Device: &device}, nil)
+}
+
+func (c *Client) ClearPairingList(deviceID uint16) error {
+	return c.call("clearPairingList", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) ConnectBTDevice(deviceID uint16) error {
+	return c.call("connectBTDevice", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) DisconnectBTDevice(deviceID uint16) error {
+	return c.call("disconnectBTDevice", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) AutoPairing(deviceID uint16) (bool, error) {
+	var enabled bool
+	err := c.call("autoPairing", params{DeviceID: deviceID}, &enabled)
+	return enabled, err
+}
+
+func (c *Client) SetAutoPairing(deviceID uint16, enable bool) error {
+	return c.call("setAutoPairing", params{DeviceID: deviceID, Enable: enable}, nil)
+}
+
+func (c *Client) Settings(deviceID uint16) ([]jabra.Setting, error) {
+	var settings []jabra.Setting
+	if err := c.call("settings", params{DeviceID: deviceID}, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (c *Client) SetSettings(deviceID uint16, settings []jabra.Setting) error {
+	return c.call("setSettings", params{DeviceID: deviceID, Settings: settings}, nil)
+}
+
+func (c *Client) FailedSettingNames(deviceID uint16) []string {
+	var names []string
+	if err := c.call("failedSettingNames", params{DeviceID: deviceID}, &names); err != nil {
+		return nil
+	}
+	return names
+}
+
+// ListenSettings asks the daemon to forward the setting changes of the
+// device to this client.
+func (c *Client) ListenSettings(deviceID uint16, listen bool) error {
+	return c.call("listenSettings", params{DeviceID: deviceID, Enable: listen}, nil)
+}
+
+// SaveSettingsToFile and LoadSettingsFromFile make path absolute, the
+// daemon opens the file itself.
+func (c *Client) SaveSettingsToFile(deviceID uint16, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return c.call("saveSettingsToFile", params{DeviceID: deviceID, Path: path}, nil)
+}
+
+func (c *Client) LoadSettingsFromFile(deviceID uint16, path string, mode jabra.SettingsLoadMode) ([]jabra.Setting, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings []jabra.Setting
+	err = c.call("loadSettingsFromFile", params{DeviceID: deviceID, Path: path, LoadMode: mode}, &settings)
+	return settings, err
+}
+
+func (c *Client) InvalidSettings(deviceID uint16) (jabra.InvalidSettings, error) {
+	var invalid jabra.InvalidSettings
+	err := c.call("invalidSettings", params{DeviceID: deviceID}, &invalid)
+	return invalid, err
+}
+
+func (c *Client) AmbienceModes(deviceID uint16) ([]jabra.AmbienceMode, error) {
+	var modes []jabra.AmbienceMode
+	err := c.call("ambienceModes", params{DeviceID: deviceID}, &modes)
+	return modes, err
+}
+
+func (c *Client) AmbienceMode(deviceID uint16) (jabra.AmbienceMode, error) {
+	var mode jabra.AmbienceMode
+	err := c.call("ambienceMode", params{DeviceID: deviceID}, &mode)
+	return mode, err
+}
+
+func (c *Client) SetAmbienceMode(deviceID uint16, mode jabra.AmbienceMode) error {
+	return c.call("setAmbienceMode", params{DeviceID: deviceID, AmbienceMode: mode}, nil)
+}
+
+func (c *Client) AmbienceLevels(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	var levels uint8
+	err := c.call("ambienceLevels", params{DeviceID: deviceID, AmbienceMode: mode}, &levels)
+	return levels, err
+}
+
+func (c *Client) AmbienceLevel(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	var level uint8
+	err := c.call("ambienceLevel", params{DeviceID: deviceID, AmbienceMode: mode}, &level)
+	return level, err
+}
+
+func (c *Client) SetAmbienceLevel(deviceID uint16, mode jabra.AmbienceMode, level uint8) error {
+	return c.call("setAmbienceLevel", params{DeviceID: deviceID, AmbienceMode: mode, Level: level}, nil)
+}
+
+func (c *Client) AmbienceBalanceRange(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	var balance uint8
+	err := c.call("ambienceBalanceRange", params{DeviceID: deviceID, AmbienceMode: mode}, &balance)
+	return balance, err
+}
+
+func (c *Client) AmbienceBalance(deviceID uint16, mode jabra.AmbienceMode) (int8, error) {
+	var balance int8
+	err := c.call("ambienceBalance", params{DeviceID: deviceID, AmbienceMode: mode}, &balance)
+	return balance, err
+}
+
+func (c *Client) SetAmbienceBalance(deviceID uint16, mode jabra.AmbienceMode, balance int8) error {
+	return c.call("setAmbienceBalance", params{DeviceID: deviceID, AmbienceMode: mode, Balance: balance}, nil)
+}
+
+func (c *Client) AmbienceLoop(deviceID uint16) ([]jabra.AmbienceMode, error) {
+	var modes []jabra.AmbienceMode
+	err := c.call("ambienceLoop", params{DeviceID: deviceID}, &modes)
+	return modes, err
+}
+
+func (c *Client) SetAmbienceLoop(deviceID uint16, modes []jabra.AmbienceMode) error {
+	return c.call("setAmbienceLoop", params{DeviceID: deviceID, AmbienceModes: modes}, nil)
+}
+
+// ListenAmbience asks the daemon to forward the ambience changes of the
+// device to this client.
+func (c *Client) ListenAmbience(deviceID uint16, listen bool) error {
+	return c.call("listenAmbience", params{DeviceID: deviceID, Enable: listen}, nil)
+}
+
+func (c *Client) Busylight(deviceID uint16) (bool, error) {
+	var on bool
+	err := c.call("busylight", params{DeviceID: deviceID}, &on)
+	return on, err
+}
+
+func (c *Client) SetBusylight(deviceID uint16, on bool) error {
+	return c.call("setBusylight", params{DeviceID: deviceID, Enable: on}, nil)
+}
+
+// ListenBusylight asks the daemon to forward the busylight changes of the
+// device to this client.
+func (c *Client) ListenBusylight(deviceID uint16, listen bool) error {
+	return c.call("listenBusylight", params{DeviceID: deviceID, Enable: listen}, nil)
+}
+
+func (c *Client) EqualizerEnabled(deviceID uint16) (bool, error) {
+	var enabled bool
+	err := c.call("equalizerEnabled", params{DeviceID: deviceID}, &enabled)
+	return enabled, err
+}
+
+func (c *Client) EnableEqualizer(deviceID uint16, enable bool) error {
+	return c.call("enableEqualizer", params{DeviceID: deviceID, Enable: enable}, nil)
+}
+
+func (c *Client) EqualizerBands(deviceID uint16) ([]jabra.EqualizerBand, error) {
+	var bands []jabra.EqualizerBand
+	err := c.call("equalizerBands", params{DeviceID: deviceID}, &bands)
+	return bands, err
+}
+
+func (c *Client) SetEqualizerGains(deviceID uint16, gains []float32) error {
+	return c.call("setEqualizerGains", params{DeviceID: deviceID, Gains: gains}, nil)
+}
+
+// AcquireCallLock asks the daemon for the call lock of the device, it
+// holds it for this client until released or the client disconnects.
+func (c *Client) AcquireCallLock(deviceID uint16) error {
+	return c.call("acquireCallLock", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) ReleaseCallLock(deviceID uint16) error {
+	return c.call("releaseCallLock", params{DeviceID: deviceID}, nil)
+}
+
+func (c *Client) SetOffHook(deviceID uint16, offHook bool) error {
+	return c.call("setOffHook", params{DeviceID: deviceID, Enable: offHook}, nil)
+}
+
+func (c *Client) SetRinger(deviceID uint16, ringing bool) error {
+	return c.call("setRinger", params{DeviceID: deviceID, Enable: ringing}, nil)
+}
+
+func (c *Client) SetMute(deviceID uint16, mute bool) error {
+	return c.call("setMute", params{DeviceID: deviceID, Enable: mute}, nil)
+}
+
+func (c *Client) SetHold(deviceID uint16, hold bool) error {
+	return c.call("setHold", params{DeviceID: deviceID, Enable: hold}, nil)
+}
+
+func (c *Client) SetOnline(deviceID uint16, online bool) error {
+	return c.call("setOnline", params{DeviceID: deviceID, Enable: online}, nil)
+}
+
+var _ jabra.Backend = (*Client)(nil)
@@ -0,0 +1,515 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+const testScenario = `
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: DONGLE
+    dongle: true
+    features: [pairingList]
+    pairingList:
+      - name: Jabra Evolve2 85
+        address: 70:BF:92:4A:10:01
+        connected: true
+        device: 1
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: bt
+    features: [settingsChangeNotification]
+    firmware: 1.3.8
+    firmwareUpdate:
+      version: 1.5.4
+      duration: 100ms
+    battery:
+      level: 64
+    settings:
+      - guid: name
+        name: Headset name
+        type: text
+        value: Evolve
+        validation: {maxLength: 8}
+      - guid: auto-answer
+        name: Auto-answer
+        type: toggle
+        protected: true
+    ambience: {mode: anc}
+    equalizer: {}
+    telephony: {}
+`
+
+// startDaemon serves the test scenario on a socket in a temp dir.
+func startDaemon(t *testing.T) (*fake.Backend, string) {
+	t.Helper()
+
+	scenario, err := fake.Parse([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+
+	socket := filepath.Join(t.TempDir(), "jlinkd.sock")
+	listener, err := Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(backend)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- server.Serve(ctx, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+		server.Stop()
+	})
+
+	return backend, socket
+}
+
+// watcher records the callbacks a client receives.
+type watcher struct {
+	mu       sync.Mutex
+	devices  map[uint16]jabra.DeviceInfo
+	scanned  chan struct{}
+	changed  chan struct{}
+	battery  chan *jabra.BatteryStatus
+	firmware chan jabra.FirmwareProgress
+	settings chan []jabra.Setting
+	ambience chan jabra.AmbienceEvent
+	inputs   chan jabra.HidInput
+	usages   chan [2]uint16
+}
+
+func newWatcher() *watcher {
+	return &watcher{
+		devices:  make(map[uint16]jabra.DeviceInfo),
+		scanned:  make(chan struct{}),
+		changed:  make(chan struct{}, 100),
+		battery:  make(chan *jabra.BatteryStatus, 100),
+		firmware: make(chan jabra.FirmwareProgress, 100),
+		settings: make(chan []jabra.Setting, 100),
+		ambience: make(chan jabra.AmbienceEvent, 100),
+		inputs:   make(chan jabra.HidInput, 100),
+		usages:   make(chan [2]uint16, 100),
+	}
+}
+
+func (w *watcher) callbacks() jabra.Callbacks {
+	return jabra.Callbacks{
+		FirstScanDone: func() { close(w.scanned) },
+		DeviceAttached: func(deviceInfo jabra.DeviceInfo) {
+			w.mu.Lock()
+			w.devices[deviceInfo.DeviceID] = deviceInfo
+			w.mu.Unlock()
+			w.changed <- struct{}{}
+		},
+		DeviceRemoved: func(deviceID uint16) {
+			w.mu.Lock()
+			delete(w.devices, deviceID)
+			w.mu.Unlock()
+			w.changed <- struct{}{}
+		},
+		BatteryStatusChanged: func(deviceID uint16, batteryStatus *jabra.BatteryStatus) {
+			w.battery <- batteryStatus
+		},
+		FirmwareProgress: func(deviceID uint16, progress jabra.FirmwareProgress) {
+			w.firmware <- progress
+		},
+		SettingsChanged: func(deviceID uint16, settings []jabra.Setting) {
+			w.settings <- settings
+		},
+		AmbienceChanged: func(deviceID uint16, event jabra.AmbienceEvent) {
+			w.ambience <- event
+		},
+		HidInput: func(deviceID uint16, input jabra.HidInput, value bool) {
+			w.inputs <- input
+		},
+		RawHidInput: func(deviceID uint16, usagePage, usage uint16, value bool) {
+			w.usages <- [2]uint16{usagePage, usage}
+		},
+	}
+}
+
+// waitFor waits until the client has seen count devices.
+func (w *watcher) waitFor(t *testing.T, count int) {
+	t.Helper()
+	for {
+		w.mu.Lock()
+		n := len(w.devices)
+		w.mu.Unlock()
+		if n == count {
+			return
+		}
+
+		select {
+		case <-w.changed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("have %d devices, want %d", n, count)
+		}
+	}
+}
+
+func TestClientsShareSession(t *testing.T) {
+	backend, socket := startDaemon(t)
+
+	var watchers []*watcher
+	for range 2 {
+		client, err := Dial(socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newWatcher()
+		if err := client.Initialize("test", w.callbacks()); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Uninitialize()
+
+		select {
+		case <-w.scanned:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no firstScanDone")
+		}
+		w.waitFor(t, 2)
+		watchers = append(watchers, w)
+	}
+
+	// Both clients follow the daemon's devices.
+	backend.Detach(1)
+	for _, w := range watchers {
+		w.waitFor(t, 1)
+	}
+	backend.Attach(1)
+	for _, w := range watchers {
+		w.waitFor(t, 2)
+	}
+
+	watchers[0].mu.Lock()
+	headset := watchers[0].devices[1]
+	watchers[0].mu.Unlock()
+	if headset.SerialNumber != "HEADSET" || headset.DeviceConnection != jabra.ConnectionBT {
+		t.Errorf("headset = %+v", headset)
+	}
+
+	// Battery callbacks are relayed too.
+	backend.SetBatteryLevel(1, 40)
+	for _, w := range watchers {
+		select {
+		case batteryStatus := <-w.battery:
+			if batteryStatus.LevelInPercent != 40 {
+				t.Errorf("battery callback %+v", batteryStatus)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no battery callback")
+		}
+	}
+}
+
+func TestClientBackend(t *testing.T) {
+	backend, socket := startDaemon(t)
+
+	client, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWatcher()
+	if err := client.Initialize("test", w.callbacks()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Uninitialize()
+	w.waitFor(t, 2)
+
+	devices, err := client.Devices()
+	if err != nil || len(devices) != 2 || !devices[0].IsDongle || devices[0].FeatureFlags == nil || !devices[0].FeatureFlags.PairingList {
+		t.Fatalf("Devices() = %+v, %v", devices, err)
+	}
+
+	battery, err := client.BatteryStatus(1)
+	if err != nil || battery.LevelInPercent != 64 {
+		t.Fatalf("BatteryStatus(1) = %+v, %v", battery, err)
+	}
+
+	pairingList := client.PairingList(0)
+	if len(pairingList.PairedDevices) != 1 || pairingList.PairedDevices[0].Address() != "70:BF:92:4A:10:01" {
+		t.Fatalf("PairingList(0) = %+v", pairingList)
+	}
+
+	settings, err := client.Settings(1)
+	if err != nil || len(settings) != 2 || settings[0].Value() != "Evolve" || settings[0].Validation == nil || settings[1].Kind() != "toggle" {
+		t.Fatalf("Settings(1) = %+v, %v", settings, err)
+	}
+	if err := client.ListenSettings(1, true); err != nil {
+		t.Fatal(err)
+	}
+	settings[0].Text = "Evolve 2"
+	if err := client.SetSettings(1, settings); !errors.Is(err, jabra.ErrProtectedSettingWrite) {
+		t.Errorf("SetSettings with a protected setting = %v, want %v", err, jabra.ErrProtectedSettingWrite)
+	}
+	if failed := client.FailedSettingNames(1); len(failed) != 1 || failed[0] != "Auto-answer" {
+		t.Errorf("FailedSettingNames(1) = %v", failed)
+	}
+	if settings, _ = client.Settings(1); settings[0].Text != "Evolve 2" {
+		t.Errorf("headset name %q after SetSettings", settings[0].Text)
+	}
+	select {
+	case changed := <-w.settings:
+		if len(changed) != 1 || changed[0].Text != "Evolve 2" {
+			t.Errorf("settingsChanged %+v", changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no settingsChanged callback")
+	}
+	if err := client.ListenSettings(0, true); !errors.Is(err, jabra.ErrNotSupported) {
+		t.Errorf("ListenSettings(0) = %v, want %v", err, jabra.ErrNotSupported)
+	}
+
+	if err := client.SetAmbienceMode(1, jabra.AmbienceHearThrough); err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := client.AmbienceMode(1); err != nil || mode != jabra.AmbienceHearThrough {
+		t.Errorf("AmbienceMode(1) = %s, %v", mode, err)
+	}
+	if err := client.SetAmbienceBalance(1, jabra.AmbienceANC, -2); err != nil {
+		t.Fatal(err)
+	}
+	if balance, err := client.AmbienceBalance(1, jabra.AmbienceANC); err != nil || balance != -2 {
+		t.Errorf("AmbienceBalance(1) = %d, %v", balance, err)
+	}
+	if err := client.ListenAmbience(1, true); err != nil {
+		t.Fatal(err)
+	}
+	backend.SetAmbience(1, "anc")
+	select {
+	case event := <-w.ambience:
+		if event != jabra.AmbienceModeChanged {
+			t.Errorf("ambienceChanged %s", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ambienceChanged callback")
+	}
+	if err := client.SetEqualizerGains(1, []float32{1.5, 0, 0, 0, -2}); err != nil {
+		t.Fatal(err)
+	}
+	if bands, err := client.EqualizerBands(1); err != nil || len(bands) != 5 || bands[0].Gain != 1.5 || bands[4].Gain != -2 {
+		t.Errorf("EqualizerBands(1) = %+v, %v", bands, err)
+	}
+	if _, err := client.Busylight(1); !errors.Is(err, jabra.ErrNotSupported) {
+		t.Errorf("Busylight(1) = %v, want %v", err, jabra.ErrNotSupported)
+	}
+	if err := client.ListenBusylight(1, true); !errors.Is(err, jabra.ErrNotSupported) {
+		t.Errorf("ListenBusylight(1) = %v, want %v", err, jabra.ErrNotSupported)
+	}
+
+	// SDK errors keep their identity across the socket.
+	err = client.ClearPairedDevice(0, pairingList.PairedDevices[0])
+	if !errors.Is(err, jabra.ErrCannotClearDeviceConnected) {
+		t.Errorf("ClearPairedDevice of a connected device = %v, want %v", err, jabra.ErrCannotClearDeviceConnected)
+	}
+	if _, err := client.BatteryStatus(7); !errors.Is(err, jabra.ErrDeviceUnknown) {
+		t.Errorf("BatteryStatus(7) = %v, want %v", err, jabra.ErrDeviceUnknown)
+	}
+
+	if err := client.DisconnectPairedDevice(0, pairingList.PairedDevices[0]); err != nil {
+		t.Fatal(err)
+	}
+	w.waitFor(t, 1)
+}
+
+func TestCallLock(t *testing.T) {
+	backend, socket := startDaemon(t)
+
+	var clients []*Client
+	var watchers []*watcher
+	for range 2 {
+		client, err := Dial(socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newWatcher()
+		if err := client.Initialize("test", w.callbacks()); err != nil {
+			t.Fatal(err)
+		}
+		w.waitFor(t, 2)
+		clients, watchers = append(clients, client), append(watchers, w)
+	}
+	defer clients[1].Uninitialize()
+
+	// One client holds the lock at a time.
+	if err := clients[0].AcquireCallLock(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := clients[1].AcquireCallLock(1); !errors.Is(err, jabra.ErrDeviceLock) {
+		t.Errorf("second AcquireCallLock(1) = %v, want %v", err, jabra.ErrDeviceLock)
+	}
+	if err := clients[1].ReleaseCallLock(1); !errors.Is(err, jabra.ErrDeviceNotLock) {
+		t.Errorf("ReleaseCallLock(1) of another client = %v, want %v", err, jabra.ErrDeviceNotLock)
+	}
+	if err := clients[0].SetRinger(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if call, _ := backend.Telephony(1); !call.Locked || !call.Ringer {
+		t.Errorf("call state %+v", call)
+	}
+
+	// Buttons reach every client.
+	backend.PressButton(1, jabra.HidOffHook)
+	for _, w := range watchers {
+		select {
+		case input := <-w.inputs:
+			if input != jabra.HidOffHook {
+				t.Errorf("hidInput %s", input)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no hidInput callback")
+		}
+		select {
+		case usage := <-w.usages:
+			if usage != [2]uint16{0x0b, 0x20} {
+				t.Errorf("rawHidInput %#x", usage)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no rawHidInput callback")
+		}
+	}
+
+	// The lock is given back when its client leaves.
+	clients[0].Uninitialize()
+	for range 100 {
+		if call, _ := backend.Telephony(1); !call.Locked {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := clients[1].AcquireCallLock(1); err != nil {
+		t.Errorf("AcquireCallLock(1) after the holder left = %v", err)
+	}
+}
+
+func TestFirmwareUpdate(t *testing.T) {
+	_, socket := startDaemon(t)
+
+	client, err := Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWatcher()
+	if err := client.Initialize("test", w.callbacks()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Uninitialize()
+	w.waitFor(t, 2)
+
+	bundle, err := client.FirmwareVersionBundle(0)
+	if err != nil || bundle.Child != "1.3.8" {
+		t.Fatalf("FirmwareVersionBundle(0) = %+v, %v", bundle, err)
+	}
+
+	if err := client.SetFirmwareLock(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if locked, err := client.FirmwareLock(1); !locked || err != nil {
+		t.Errorf("FirmwareLock(1) = %v, %v after locking", locked, err)
+	}
+	if err := client.SetFirmwareLock(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetFirmwareLock(0, true); !errors.Is(err, jabra.ErrNotSupported) {
+		t.Errorf("SetFirmwareLock(0) of the dongle = %v", err)
+	}
+	if locked, err := client.FirmwareLock(0); locked || err != nil {
+		t.Errorf("FirmwareLock(0) of the dongle = %v, %v", locked, err)
+	}
+
+	if err := client.UpdateFirmware(1, filepath.Join(t.TempDir(), "missing.zip")); !errors.Is(err, jabra.ErrFileNotAccessible) {
+		t.Errorf("UpdateFirmware of a missing file = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "Jabra_Evolve2_85-v1.5.4.zip")
+	if err := os.WriteFile(path, []byte("PK"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateFirmware(1, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Progress is relayed until the update completes.
+	var percentages []uint16
+	for done := false; !done; {
+		select {
+		case progress := <-w.firmware:
+			percentages = append(percentages, progress.Percentage)
+			done = progress.Status.Done()
+			if err := progress.Status.Err(); err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no firmware progress after %v", percentages)
+		}
+	}
+	if len(percentages) < 3 || percentages[len(percentages)-1] != 100 {
+		t.Errorf("progress %v", percentages)
+	}
+
+	w.waitFor(t, 2)
+	if version, err := client.FirmwareVersion(1); err != nil || version != "1.5.4" {
+		t.Errorf("FirmwareVersion(1) = %q, %v after the update", version, err)
+	}
+}
+
+func TestRawRequests(t *testing.T) {
+	_, socket := startDaemon(t)
+
+	netConn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netConn.Close()
+	reader := bufio.NewReader(netConn)
+
+	for request, want := range map[string]string{
+		`{"jsonrpc":"2.0","id":1,"method":"version"}`:                               `{"jsonrpc":"2.0","id":1,"result":"simulated"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"nope"}`:                                  `"code":-32601`,
+		`{"jsonrpc":"2.0","id":3,"method":"batteryStatus","params":{"deviceId":9}}`: `"data":{"returnCode":1}`,
+		`not json`: `"code":-32700`,
+	} {
+		if _, err := netConn.Write([]byte(request + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(response, want) {
+			t.Errorf("%s: response %s, want %s", request, response, want)
+		}
+	}
+}
+
+func TestListenRefusesRunningDaemon(t *testing.T) {
+	_, socket := startDaemon(t)
+
+	if _, err := Listen(socket); err == nil {
+		t.Fatal("Listen on the socket of a running daemon succeeded")
+	}
+}
@@ -0,0 +1,167 @@
+// Package daemon implements jlinkd, the background process that owns the
+// single SDK session, and the client other jLink processes use to reach it.
+//
+// The API is JSON-RPC 2.0 over a Unix socket, one message per line. Methods
+// mirror jabra.Backend in lowerCamelCase (batteryStatus, pairingList,
+// setAutoPairing, ...) plus devices, which lists the attached devices.
+// Results are the jabra package types encoded as JSON. After initialize the
+// connection receives deviceAttached, deviceRemoved, batteryChanged,
+// firmwareProgress, hidInput, rawHidInput and firstScanDone notifications,
+// starting with the devices already attached.
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC error codes. Errors returned by the backend use codeBackendError
+// with the Jabra return code or error status in the error data.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeBackendError   = -32000
+)
+
+// message is a request, response or notification. Requests and
+// notifications carry a method, responses carry an id and a result or error.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *uint64         `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// params holds the arguments of every method, each method reads the fields it needs.
+type params struct {
+	AppID    string              `json:"appId,omitempty"`
+	DeviceID uint16              `json:"deviceId"`
+	Device   *jabra.PairedDevice `json:"device,omitempty"`
+	Enable   bool                `json:"enable,omitempty"`
+	Level    uint8               `json:"level,omitempty"`
+	Type     uint8               `json:"type,omitempty"`
+	// Path is a file of the daemon's host, absolute.
+	Path            string                 `json:"path,omitempty"`
+	AuthorizationID string                 `json:"authorizationId,omitempty"`
+	Settings        []jabra.Setting        `json:"settings,omitempty"`
+	LoadMode        jabra.SettingsLoadMode `json:"loadMode,omitempty"`
+	AmbienceMode    jabra.AmbienceMode     `json:"ambienceMode,omitempty"`
+	AmbienceModes   []jabra.AmbienceMode   `json:"ambienceModes,omitempty"`
+	Balance         int8                   `json:"balance,omitempty"`
+	Gains           []float32              `json:"gains,omitempty"`
+}
+
+// Notification parameters.
+type (
+	deviceAttachedParams struct {
+		Device jabra.DeviceInfo `json:"device"`
+	}
+	deviceRemovedParams struct {
+		DeviceID uint16 `json:"deviceId"`
+	}
+	batteryChangedParams struct {
+		DeviceID      uint16               `json:"deviceId"`
+		BatteryStatus *jabra.BatteryStatus `json:"batteryStatus"`
+	}
+	firmwareProgressParams struct {
+		DeviceID uint16                 `json:"deviceId"`
+		Progress jabra.FirmwareProgress `json:"progress"`
+	}
+	settingsChangedParams struct {
+		DeviceID uint16          `json:"deviceId"`
+		Settings []jabra.Setting `json:"settings"`
+	}
+	ambienceChangedParams struct {
+		DeviceID uint16              `json:"deviceId"`
+		Event    jabra.AmbienceEvent `json:"event"`
+	}
+	busylightChangedParams struct {
+		DeviceID uint16 `json:"deviceId"`
+		On       bool   `json:"on"`
+	}
+	hidInputParams struct {
+		DeviceID uint16         `json:"deviceId"`
+		Input    jabra.HidInput `json:"input"`
+		Value    bool           `json:"value"`
+	}
+	rawHidInputParams struct {
+		DeviceID  uint16 `json:"deviceId"`
+		UsagePage uint16 `json:"usagePage"`
+		Usage     uint16 `json:"usage"`
+		Value     bool   `json:"value"`
+	}
+)
+
+type rpcError struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *errorData `json:"data,omitempty"`
+}
+
+type errorData struct {
+	ReturnCode  *int                   `json:"returnCode,omitempty"`
+	ErrorStatus *jabra.ErrorStatusCode `json:"errorStatus,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jlinkd: %s", e.Message)
+}
+
+// toRPCError encodes err, keeping the SDK codes so clients get the same error values back.
+func toRPCError(err error) *rpcError {
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	e := &rpcError{Code: codeBackendError, Message: err.Error()}
+
+	var returnCodeError *jabra.ReturnCodeError
+	var errorStatus *jabra.JabraErrorStatusCode
+	switch {
+	case errors.As(err, &returnCodeError):
+		code := returnCodeError.Code()
+		e.Data = &errorData{ReturnCode: &code}
+	case errors.As(err, &errorStatus):
+		code := errorStatus.Code()
+		e.Data = &errorData{ErrorStatus: &code}
+	}
+	return e
+}
+
+// fromRPCError turns a received error back into the jabra error value when it carries an SDK code.
+func fromRPCError(e *rpcError) error {
+	if e.Data != nil {
+		switch {
+		case e.Data.ReturnCode != nil:
+			if err := jabra.ReturnCode(*e.Data.ReturnCode); err != nil {
+				return err
+			}
+		case e.Data.ErrorStatus != nil:
+			if err := jabra.CheckErrorStatus(*e.Data.ErrorStatus); err != nil {
+				return err
+			}
+		}
+	}
+	return e
+}
+
+// DefaultSocket is where jlinkd listens unless told otherwise:
+// $XDG_RUNTIME_DIR/jlinkd.sock, or a per-user path in the temp dir.
+func DefaultSocket() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "jlinkd.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("jlinkd-%d.sock", os.Getuid()))
+}
@@ -0,0 +1,614 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/Watchdog0x/jLink/internal/unixsock"
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// outgoingBuffer is how many messages may wait for a slow client before the
+// daemon gives up on it.
+const outgoingBuffer = 256
+
+// Server shares one backend session between any number of clients.
+type Server struct {
+	backend jabra.Backend
+
+	mu          sync.Mutex
+	devices     map[uint16]jabra.DeviceInfo
+	scanned     bool
+	subscribers map[*conn]bool
+	// listeners are the clients listening to each topic, the backend
+	// listens while there is one.
+	listeners map[topic]map[*conn]bool
+	// callLocks are the clients holding the call lock of each device, the
+	// backend holds it for them.
+	callLocks map[uint16]*conn
+}
+
+// topic is what of a device clients listen to, settings, ambience or
+// busylight.
+type topic struct {
+	deviceID uint16
+	name     string
+}
+
+func NewServer(backend jabra.Backend) *Server {
+	return &Server{
+		backend:     backend,
+		devices:     make(map[uint16]jabra.DeviceInfo),
+		subscribers: make(map[*conn]bool),
+		listeners:   make(map[topic]map[*conn]bool),
+		callLocks:   make(map[uint16]*conn),
+	}
+}
+
+// Start initializes the backend session the server hands out.
+func (s *Server) Start() error {
+	return s.backend.Initialize("jlinkd", jabra.Callbacks{
+		FirstScanDone:        s.firstScanDone,
+		DeviceAttached:       s.deviceAttached,
+		DeviceRemoved:        s.deviceRemoved,
+		BatteryStatusChanged: s.batteryChanged,
+		FirmwareProgress:     s.firmwareProgress,
+		SettingsChanged:      s.settingsChanged,
+		AmbienceChanged:      s.ambienceChanged,
+		BusylightChanged:     s.busylightChanged,
+		HidInput:             s.hidInput,
+		RawHidInput:          s.rawHidInput,
+	})
+}
+
+// Stop ends the backend session.
+func (s *Server) Stop() error {
+	return s.backend.Uninitialize()
+}
+
+// Listen creates the Unix socket at path, readable only by the current user.
+// A socket left behind by a daemon that is no longer running is replaced.
+func Listen(path string) (net.Listener, error) {
+	listener, err := unixsock.Listen(path)
+	if errors.Is(err, unixsock.ErrInUse) {
+		return nil, fmt.Errorf("jlinkd is already running on %s", path)
+	}
+	return listener, err
+}
+
+// Serve accepts clients on listener until ctx is done.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		c := newConn(netConn)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, c)
+		}()
+	}
+}
+
+/****************************************************************************/
+/*                            BACKEND CALLBACKS                             */
+/****************************************************************************/
+
+func (s *Server) firstScanDone() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scanned = true
+	s.broadcast("firstScanDone", nil)
+}
+
+func (s *Server) deviceAttached(deviceInfo jabra.DeviceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.devices[deviceInfo.DeviceID] = deviceInfo
+	s.broadcast("deviceAttached", deviceAttachedParams{Device: deviceInfo})
+}
+
+func (s *Server) deviceRemoved(deviceID uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.devices, deviceID)
+	for t := range s.listeners {
+		if t.deviceID == deviceID {
+			delete(s.listeners, t) // the backend stopped listening too
+		}
+	}
+	delete(s.callLocks, deviceID)
+	s.broadcast("deviceRemoved", deviceRemovedParams{DeviceID: deviceID})
+}
+
+func (s *Server) batteryChanged(deviceID uint16, batteryStatus *jabra.BatteryStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.broadcast("batteryChanged", batteryChangedParams{DeviceID: deviceID, BatteryStatus: batteryStatus})
+}
+
+func (s *Server) firmwareProgress(deviceID uint16, progress jabra.FirmwareProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.broadcast("firmwareProgress", firmwareProgressParams{DeviceID: deviceID, Progress: progress})
+}
+
+func (s *Server) settingsChanged(deviceID uint16, settings []jabra.Setting) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.listeners[topic{deviceID, "settings"}] {
+		c.notify("settingsChanged", settingsChangedParams{DeviceID: deviceID, Settings: settings})
+	}
+}
+
+func (s *Server) ambienceChanged(deviceID uint16, event jabra.AmbienceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.listeners[topic{deviceID, "ambience"}] {
+		c.notify("ambienceChanged", ambienceChangedParams{DeviceID: deviceID, Event: event})
+	}
+}
+
+func (s *Server) busylightChanged(deviceID uint16, on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.listeners[topic{deviceID, "busylight"}] {
+		c.notify("busylightChanged", busylightChangedParams{DeviceID: deviceID, On: on})
+	}
+}
+
+func (s *Server) hidInput(deviceID uint16, input jabra.HidInput, value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.broadcast("hidInput", hidInputParams{DeviceID: deviceID, Input: input, Value: value})
+}
+
+func (s *Server) rawHidInput(deviceID uint16, usagePage, usage uint16, value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.broadcast("rawHidInput", rawHidInputParams{DeviceID: deviceID, UsagePage: usagePage, Usage: usage, Value: value})
+}
+
+// broadcast notifies every initialized client. The caller holds s.mu.
+func (s *Server) broadcast(method string, params any) {
+	for c := range s.subscribers {
+		c.notify(method, params)
+	}
+}
+
+// subscribe replays the current devices to c and adds it to the subscribers.
+func (s *Server) subscribe(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, deviceInfo := range s.list() {
+		c.notify("deviceAttached", deviceAttachedParams{Device: deviceInfo})
+	}
+	if s.scanned {
+		c.notify("firstScanDone", nil)
+	}
+	s.subscribers[c] = true
+}
+
+func (s *Server) unsubscribe(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscribers, c)
+	for t, listeners := range s.listeners {
+		if listeners[c] {
+			s.listen(c, t, false)
+		}
+	}
+	for deviceID, holder := range s.callLocks {
+		if holder == c {
+			s.backend.ReleaseCallLock(deviceID)
+			delete(s.callLocks, deviceID)
+		}
+	}
+}
+
+// callLock takes the call lock of deviceID for c, or gives it back. One
+// client holds it at a time, like one application does on the host.
+func (s *Server) callLock(c *conn, deviceID uint16, lock bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	holder, held := s.callLocks[deviceID]
+	if !lock {
+		if holder != c {
+			return jabra.ErrDeviceNotLock
+		}
+		delete(s.callLocks, deviceID)
+		return s.backend.ReleaseCallLock(deviceID)
+	}
+	if held {
+		if holder == c {
+			return nil
+		}
+		return jabra.ErrDeviceLock
+	}
+	if err := s.backend.AcquireCallLock(deviceID); err != nil {
+		return err
+	}
+	s.callLocks[deviceID] = c
+	return nil
+}
+
+// listen adds c to or removes it from the listeners of t, starting or
+// stopping the backend's listener with the first or last of them. The
+// caller holds s.mu.
+func (s *Server) listen(c *conn, t topic, listen bool) error {
+	backendListen := s.backend.ListenSettings
+	switch t.name {
+	case "ambience":
+		backendListen = s.backend.ListenAmbience
+	case "busylight":
+		backendListen = s.backend.ListenBusylight
+	}
+
+	listeners := s.listeners[t]
+	if listen == listeners[c] {
+		return nil
+	}
+	if !listen {
+		delete(listeners, c)
+		if len(listeners) == 0 {
+			delete(s.listeners, t)
+			// An error means the device is gone, and no longer listened to.
+			backendListen(t.deviceID, false)
+		}
+		return nil
+	}
+	if len(listeners) == 0 {
+		if err := backendListen(t.deviceID, true); err != nil {
+			return err
+		}
+		listeners = make(map[*conn]bool)
+		s.listeners[t] = listeners
+	}
+	listeners[c] = true
+	return nil
+}
+
+// list returns the attached devices ordered by device ID. The caller holds s.mu.
+func (s *Server) list() []jabra.DeviceInfo {
+	devices := make([]jabra.DeviceInfo, 0, len(s.devices))
+	for _, deviceInfo := range s.devices {
+		devices = append(devices, deviceInfo)
+	}
+	slices.SortFunc(devices, func(a, b jabra.DeviceInfo) int { return int(a.DeviceID) - int(b.DeviceID) })
+	return devices
+}
+
+/****************************************************************************/
+/*                                 REQUESTS                                 */
+/****************************************************************************/
+
+func (s *Server) handle(ctx context.Context, c *conn) {
+	defer s.unsubscribe(c)
+	defer c.close()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.close()
+		case <-c.done:
+		}
+	}()
+
+	var requests sync.WaitGroup
+	defer requests.Wait()
+
+	scanner := bufio.NewScanner(c.netConn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var request message
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			c.respond(nil, nil, &rpcError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+
+		// Requests run concurrently, a factory reset must not hold up a battery read.
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			result, err := s.call(c, request)
+			if request.ID == nil {
+				return
+			}
+			if err != nil {
+				c.respond(request.ID, nil, toRPCError(err))
+				return
+			}
+			c.respond(request.ID, result, nil)
+		}()
+	}
+}
+
+// call runs a single request against the backend.
+func (s *Server) call(c *conn, request message) (any, error) {
+	if request.JSONRPC != jsonrpcVersion || request.Method == "" {
+		return nil, &rpcError{Code: codeInvalidRequest, Message: "not a JSON-RPC 2.0 request"}
+	}
+
+	var p params
+	if len(request.Params) > 0 {
+		if err := json.Unmarshal(request.Params, &p); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	}
+	device := func() (jabra.PairedDevice, error) {
+		if p.Device == nil {
+			return jabra.PairedDevice{}, &rpcError{Code: codeInvalidParams, Message: "missing device"}
+		}
+		return *p.Device, nil
+	}
+
+	switch request.Method {
+	case "initialize":
+		s.subscribe(c)
+		return true, nil
+	case "uninitialize":
+		s.unsubscribe(c)
+		return true, nil
+	case "version":
+		return s.backend.Version()
+	case "devices":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.list(), nil
+
+	// Device
+	case "factoryReset":
+		return true, s.backend.FactoryReset(p.DeviceID)
+	case "firmwareVersion":
+		return s.backend.FirmwareVersion(p.DeviceID)
+	case "playRingtone":
+		return true, s.backend.PlayRingtone(p.DeviceID, p.Level, p.Type)
+
+	// Firmware
+	case "firmwareVersionBundle":
+		return s.backend.FirmwareVersionBundle(p.DeviceID)
+	case "checkForFirmwareUpdate":
+		return s.backend.CheckForFirmwareUpdate(p.DeviceID, p.AuthorizationID)
+	case "latestFirmwareInformation":
+		return s.backend.LatestFirmwareInformation(p.DeviceID, p.AuthorizationID)
+	case "updateFirmware":
+		return true, s.backend.UpdateFirmware(p.DeviceID, p.Path)
+	case "firmwareLock":
+		return s.backend.FirmwareLock(p.DeviceID)
+	case "setFirmwareLock":
+		return true, s.backend.SetFirmwareLock(p.DeviceID, p.Enable)
+
+	// Battery Status
+	case "batteryStatus":
+		return s.backend.BatteryStatus(p.DeviceID)
+
+	// Bluetooth
+	case "setBTPairing":
+		return true, s.backend.SetBTPairing(p.DeviceID)
+	case "stopBTPairing":
+		return true, s.backend.StopBTPairing(p.DeviceID)
+	case "searchNewDevices":
+		return true, s.backend.SearchNewDevices(p.DeviceID)
+	case "searchDeviceList":
+		return s.backend.SearchDeviceList(p.DeviceID), nil
+	case "pairingList":
+		return s.backend.PairingList(p.DeviceID), nil
+	case "connectNewDevice", "connectPairedDevice", "disconnectPairedDevice", "clearPairedDevice":
+		pairedDevice, err := device()
+		if err != nil {
+			return nil, err
+		}
+		switch request.Method {
+		case "connectNewDevice":
+			return true, s.backend.ConnectNewDevice(p.DeviceID, pairedDevice)
+		case "connectPairedDevice":
+			return true, s.backend.ConnectPairedDevice(p.DeviceID, pairedDevice)
+		case "disconnectPairedDevice":
+			return true, s.backend.DisconnectPairedDevice(p.DeviceID, pairedDevice)
+		default:
+			return true, s.backend.ClearPairedDevice(p.DeviceID, pairedDevice)
+		}
+	case "clearPairingList":
+		return true, s.backend.ClearPairingList(p.DeviceID)
+	case "connectBTDevice":
+		return true, s.backend.ConnectBTDevice(p.DeviceID)
+	case "disconnectBTDevice":
+		return true, s.backend.DisconnectBTDevice(p.DeviceID)
+
+	// Settings
+	case "autoPairing":
+		return s.backend.AutoPairing(p.DeviceID)
+	case "setAutoPairing":
+		return true, s.backend.SetAutoPairing(p.DeviceID, p.Enable)
+	case "settings":
+		return s.backend.Settings(p.DeviceID)
+	case "setSettings":
+		return true, s.backend.SetSettings(p.DeviceID, p.Settings)
+	case "failedSettingNames":
+		return s.backend.FailedSettingNames(p.DeviceID), nil
+	case "listenSettings":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return true, s.listen(c, topic{p.DeviceID, "settings"}, p.Enable)
+	case "saveSettingsToFile":
+		return true, s.backend.SaveSettingsToFile(p.DeviceID, p.Path)
+	case "loadSettingsFromFile":
+		return s.backend.LoadSettingsFromFile(p.DeviceID, p.Path, p.LoadMode)
+	case "invalidSettings":
+		return s.backend.InvalidSettings(p.DeviceID)
+	case "ambienceModes":
+		return s.backend.AmbienceModes(p.DeviceID)
+	case "ambienceMode":
+		return s.backend.AmbienceMode(p.DeviceID)
+	case "setAmbienceMode":
+		return true, s.backend.SetAmbienceMode(p.DeviceID, p.AmbienceMode)
+	case "ambienceLevels":
+		return s.backend.AmbienceLevels(p.DeviceID, p.AmbienceMode)
+	case "ambienceLevel":
+		return s.backend.AmbienceLevel(p.DeviceID, p.AmbienceMode)
+	case "setAmbienceLevel":
+		return true, s.backend.SetAmbienceLevel(p.DeviceID, p.AmbienceMode, p.Level)
+	case "ambienceBalanceRange":
+		return s.backend.AmbienceBalanceRange(p.DeviceID, p.AmbienceMode)
+	case "ambienceBalance":
+		return s.backend.AmbienceBalance(p.DeviceID, p.AmbienceMode)
+	case "setAmbienceBalance":
+		return true, s.backend.SetAmbienceBalance(p.DeviceID, p.AmbienceMode, p.Balance)
+	case "ambienceLoop":
+		return s.backend.AmbienceLoop(p.DeviceID)
+	case "setAmbienceLoop":
+		return true, s.backend.SetAmbienceLoop(p.DeviceID, p.AmbienceModes)
+	case "listenAmbience":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return true, s.listen(c, topic{p.DeviceID, "ambience"}, p.Enable)
+	case "busylight":
+		return s.backend.Busylight(p.DeviceID)
+	case "setBusylight":
+		return true, s.backend.SetBusylight(p.DeviceID, p.Enable)
+	case "listenBusylight":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return true, s.listen(c, topic{p.DeviceID, "busylight"}, p.Enable)
+	case "equalizerEnabled":
+		return s.backend.EqualizerEnabled(p.DeviceID)
+	case "enableEqualizer":
+		return true, s.backend.EnableEqualizer(p.DeviceID, p.Enable)
+	case "equalizerBands":
+		return s.backend.EqualizerBands(p.DeviceID)
+	case "setEqualizerGains":
+		return true, s.backend.SetEqualizerGains(p.DeviceID, p.Gains)
+
+	// Telephony
+	case "acquireCallLock":
+		return true, s.callLock(c, p.DeviceID, true)
+	case "releaseCallLock":
+		return true, s.callLock(c, p.DeviceID, false)
+	case "setOffHook":
+		return true, s.backend.SetOffHook(p.DeviceID, p.Enable)
+	case "setRinger":
+		return true, s.backend.SetRinger(p.DeviceID, p.Enable)
+	case "setMute":
+		return true, s.backend.SetMute(p.DeviceID, p.Enable)
+	case "setHold":
+		return true, s.backend.SetHold(p.DeviceID, p.Enable)
+	case "setOnline":
+		return true, s.backend.SetOnline(p.DeviceID, p.Enable)
+	}
+
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("unknown method %q", request.Method)}
+}
+
+/****************************************************************************/
+/*                               CONNECTIONS                                */
+/****************************************************************************/
+
+// conn is one client. Responses and notifications are queued and written by
+// a single goroutine so a slow reader never blocks the backend callbacks.
+type conn struct {
+	netConn  net.Conn
+	outgoing chan message
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newConn(netConn net.Conn) *conn {
+	c := &conn{
+		netConn:  netConn,
+		outgoing: make(chan message, outgoingBuffer),
+		done:     make(chan struct{}),
+	}
+	go c.write()
+	return c
+}
+
+func (c *conn) write() {
+	encoder := json.NewEncoder(c.netConn)
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.outgoing:
+			if err := encoder.Encode(msg); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.netConn.Close()
+	})
+}
+
+func (c *conn) respond(id *uint64, result any, rpcErr *rpcError) {
+	msg := message{JSONRPC: jsonrpcVersion, ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &rpcError{Code: codeBackendError, Message: err.Error()}
+		} else {
+			msg.Result = data
+		}
+	}
+
+	select {
+	case c.outgoing <- msg:
+	case <-c.done:
+	}
+}
+
+// notify queues a notification, dropping the client if it stopped reading.
+func (c *conn) notify(method string, params any) {
+	msg := message{JSONRPC: jsonrpcVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return
+		}
+		msg.Params = data
+	}
+
+	select {
+	case c.outgoing <- msg:
+	case <-c.done:
+	default:
+		c.close()
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/config"
+	"github.com/Watchdog0x/jLink/internal/history"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+type menuItem struct {
+	id    int
+	label string
+}
+
+var (
+	backend jabra.Backend
+
+	// deviceManager
+	deviceManager   *registry.Registry
+	selectionMu     sync.Mutex
+	selectedHeadset registry.Key // "" when none
+	selectedDongle  registry.Key
+
+	// batteryHistory estimates the time left in the header
+	batteryHistory *history.Recorder
+
+	// appConfig is config.yaml, read at start
+	appConfig = config.Default()
+
+	// firmwareUpdate is the last firmware update reported by the registry,
+	// shown above the header
+	firmwareMu     sync.Mutex
+	firmwareUpdate *firmwareStatus
+
+	// Dynamic menu, rebuilt by the device events while the UI reads it,
+	// guarded by selectionMu
+	startMenu          = []menuItem{}
+	dongleSettignsMenu = []menuItem{}
+
+	// holding all the new devide found on BT
+	searchDeviceList *jabra.PairingList = &jabra.PairingList{
+		Count:         0,
+		ListType:      jabra.SearchResult,
+		PairedDevices: make([]jabra.PairedDevice, 0),
+	}
+)
+
+/****************************************************************************/
+/*                              DEVICE EVENTS                               */
+/****************************************************************************/
+
+// watchDevices keeps the selected devices and the menus in step with the
+// registry until the subscription is closed.
+func watchDevices(subscription *registry.Subscription) {
+	for event := range subscription.C {
+		switch event.Type {
+		case registry.Attached:
+			deviceAttached(event)
+		case registry.Removed:
+			deviceRemoved(event)
+		case registry.PairingListChanged:
+			// "See Remembered Paired Devices" depends on the list being empty
+			updateStartMenu()
+		case registry.FirmwareProgress:
+			firmwareProgress(event)
+		case registry.SettingsChanged:
+			settingsChanged(event)
+		case registry.AmbienceChanged:
+			ambienceChanged(event)
+		case registry.BusylightChanged:
+			// The label of the busylight item shows whether it is on
+			updateStartMenu()
+		case registry.HidInput:
+			buttonPressed(event)
+		}
+	}
+}
+
+func deviceAttached(event registry.Event) {
+	selectionMu.Lock()
+	if event.Device.IsDongle {
+		if selectedDongle == "" {
+			selectedDongle = event.Key
+		}
+	} else {
+		if selectedHeadset == "" {
+			selectedHeadset = event.Key
+		}
+	}
+	selectionMu.Unlock()
+
+	updateStartMenu()
+	updateDongleSettignsMenu()
+}
+
+func deviceRemoved(event registry.Event) {
+	selectionMu.Lock()
+	// Fall back to another device of the same kind
+	switch event.Key {
+	case selectedDongle:
+		selectedDongle = firstDevice(true)
+	case selectedHeadset:
+		selectedHeadset = firstDevice(false)
+	}
+	selectionMu.Unlock()
+
+	updateStartMenu()
+	updateDongleSettignsMenu()
+}
+
+// firmwareStatus is a firmware update as the header shows it. Updates
+// started by jlink firmware update through jlinkd are reported too.
+type firmwareStatus struct {
+	deviceName string
+	progress   jabra.FirmwareProgress
+	ended      time.Time
+}
+
+func firmwareProgress(event registry.Event) {
+	if event.Firmware.Type != jabra.FirmwareUpdate {
+		return
+	}
+
+	firmwareMu.Lock()
+	defer firmwareMu.Unlock()
+
+	deviceName := event.Device.DeviceName
+	if deviceName == "" && firmwareUpdate != nil {
+		// The device restarts during the update
+		deviceName = firmwareUpdate.deviceName
+	}
+	firmwareUpdate = &firmwareStatus{deviceName: deviceName, progress: *event.Firmware}
+	if event.Firmware.Status.Done() {
+		firmwareUpdate.ended = time.Now()
+	}
+}
+
+// getFirmwareUpdate returns the running firmware update, or one that ended
+// less than 10 seconds ago.
+func getFirmwareUpdate() (firmwareStatus, bool) {
+	firmwareMu.Lock()
+	defer firmwareMu.Unlock()
+
+	if firmwareUpdate == nil || (!firmwareUpdate.ended.IsZero() && time.Since(firmwareUpdate.ended) > 10*time.Second) {
+		return firmwareStatus{}, false
+	}
+	return *firmwareUpdate, true
+}
+
+/****************************************************************************/
+/*                           GENERAL UTILITES                               */
+/****************************************************************************/
+
+func updateDongleSettignsMenu() {
+	menu := []menuItem{}
+
+	if dongle, exists := getSelectedDongle(); exists {
+		getautoPairingState, _ := getAutoPairing()
+		if getautoPairingState {
+			menu = append(menu, menuItem{id: 0, label: "AutoPairing ON"})
+		} else {
+			menu = append(menu, menuItem{id: 0, label: "AutoPairing OFF"})
+		}
+
+		if dongle.FeatureFlags != nil && dongle.FeatureFlags.FactoryReset {
+			menu = append(menu, menuItem{id: 1, label: "Factory Reset"})
+		}
+
+		if item, supported := firmwareLockItem(2, dongle); supported {
+			menu = append(menu, item)
+		}
+	}
+
+	selectionMu.Lock()
+	dongleSettignsMenu = menu
+	selectionMu.Unlock()
+}
+
+// firmwareLockItem is the toggle of the firmware lock of device, unless the
+// lock cannot be read. The SDK reads devices without a lock as unlocked, they
+// refuse the toggle.
+func firmwareLockItem(id int, device jabra.DeviceInfo) (menuItem, bool) {
+	locked, err := backend.FirmwareLock(device.DeviceID)
+	if err != nil {
+		return menuItem{}, false
+	}
+	if locked {
+		return menuItem{id: id, label: "Firmware Lock ON"}, true
+	}
+	return menuItem{id: id, label: "Firmware Lock OFF"}, true
+}
+
+func updateStartMenu() {
+	menu := []menuItem{}
+
+	if dongle, dongleexists := getSelectedDongle(); dongleexists {
+		menu = append(menu, menuItem{id: 0, label: "Search For New Devices"})
+		if dongle.PairingList != nil && dongle.PairingList.Count != 0 {
+			menu = append(menu, menuItem{id: 1, label: "See Remembered Paired Devices"})
+		}
+		menu = append(menu, menuItem{id: 2, label: fmt.Sprintf("%s Settings", dongle.DeviceName)})
+	}
+
+	if countDevices(true) > 1 || countDevices(false) > 1 {
+		menu = append(menu, menuItem{id: 3, label: "Switch Device"})
+	}
+
+	if device, deviceexists := getSelectedHeadset(); deviceexists {
+		menu = append(menu, menuItem{id: 4, label: fmt.Sprintf("%s Settings", device.DeviceName)})
+		if device.FeatureFlags != nil && device.FeatureFlags.AmbienceModes {
+			menu = append(menu, menuItem{id: 6, label: "Ambience"})
+		}
+		if device.FeatureFlags != nil && device.FeatureFlags.MusicEqualizer {
+			menu = append(menu, menuItem{id: 7, label: "Equalizer"})
+		}
+		if device.FeatureFlags != nil && (device.FeatureFlags.BusyLight || device.FeatureFlags.ManualBusyLight) {
+			menu = append(menu, menuItem{id: 8, label: busylightLabel(device)})
+		}
+	}
+
+	menu = append(menu, menuItem{id: 5, label: "Exit"})
+
+	selectionMu.Lock()
+	startMenu = menu
+	selectionMu.Unlock()
+}
+
+// getStartMenu returns the items of the start menu as last rebuilt. The
+// menus are replaced, never changed, so the caller may keep the slice.
+func getStartMenu() []menuItem {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+
+	return startMenu
+}
+
+func getDongleSettignsMenu() []menuItem {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+
+	return dongleSettignsMenu
+}
+
+// menuItemAt returns the item at index of menu, false when the menu changed
+// under the selection and has no item there.
+func menuItemAt(menu []menuItem, index int) (menuItem, bool) {
+	if index < 0 || index >= len(menu) {
+		return menuItem{}, false
+	}
+	return menu[index], true
+}
+
+func getSelectedDongle() (jabra.DeviceInfo, bool) {
+	selectionMu.Lock()
+	key := selectedDongle
+	selectionMu.Unlock()
+
+	return deviceManager.Get(key)
+}
+
+func getSelectedHeadset() (jabra.DeviceInfo, bool) {
+	selectionMu.Lock()
+	key := selectedHeadset
+	selectionMu.Unlock()
+
+	return deviceManager.Get(key)
+}
+
+func isSelected(key registry.Key) bool {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+
+	return key == selectedDongle || key == selectedHeadset
+}
+
+// sortedDevices returns the attached devices, dongles first, then by name.
+func sortedDevices() []jabra.DeviceInfo {
+	devices := deviceManager.Devices()
+	slices.SortFunc(devices, func(a, b jabra.DeviceInfo) int {
+		switch {
+		case a.IsDongle != b.IsDongle:
+			if a.IsDongle {
+				return -1
+			}
+			return 1
+		case a.DeviceName != b.DeviceName:
+			return strings.Compare(a.DeviceName, b.DeviceName)
+		default:
+			return strings.Compare(string(registry.KeyOf(a)), string(registry.KeyOf(b)))
+		}
+	})
+	return devices
+}
+
+func firstDevice(dongle bool) registry.Key {
+	for _, device := range sortedDevices() {
+		if device.IsDongle == dongle {
+			return registry.KeyOf(device)
+		}
+	}
+	return ""
+}
+
+func countDevices(dongle bool) int {
+	count := 0
+	for _, device := range deviceManager.Devices() {
+		if device.IsDongle == dongle {
+			count++
+		}
+	}
+	return count
+}
+
+// selectDevice makes the device at index in sortedDevices() the active dongle or headset.
+func selectDevice(index int) error {
+	devices := sortedDevices()
+	if index < 0 || index >= len(devices) {
+		return fmt.Errorf("no device at index %d", index)
+	}
+
+	selectionMu.Lock()
+	if devices[index].IsDongle {
+		selectedDongle = registry.KeyOf(devices[index])
+	} else {
+		selectedHeadset = registry.KeyOf(devices[index])
+	}
+	selectionMu.Unlock()
+
+	updateStartMenu()
+	updateDongleSettignsMenu()
+	return nil
+}
+
+/****************************************************************************/
+/*                               BLUETOOTH                                  */
+/****************************************************************************/
+
+func searchForNewDevices() error {
+	if err := setDongleInBTPairing(true); err != nil {
+		return err
+	}
+
+	if dongle, exists := getSelectedDongle(); exists { // it take 20 Sec
+		if err := backend.SearchNewDevices(dongle.DeviceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setDongleInBTPairing(pairing bool) error {
+
+	if dongle, exists := getSelectedDongle(); exists {
+		if pairing {
+			if err := backend.SetBTPairing(dongle.DeviceID); err != nil {
+				return err
+			}
+		} else {
+			if err := backend.StopBTPairing(dongle.DeviceID); err != nil {
+				return err
+			}
+		}
+	} else {
+		return fmt.Errorf("no dongle found")
+	}
+
+	return nil
+}
+
+// Connect to a device from the search result list
+func connectNewDevice(pairingID uint16) error {
+	var returnErr error
+
+	if int(pairingID) >= len(searchDeviceList.PairedDevices) {
+		return fmt.Errorf("no device at index %d", pairingID)
+	}
+
+	dongle, exists := getSelectedDongle()
+	if !exists {
+		return fmt.Errorf("no dongle found")
+	}
+
+	if err := backend.ConnectNewDevice(dongle.DeviceID, searchDeviceList.PairedDevices[pairingID]); err != nil {
+		returnErr = err
+	}
+
+	if err := setDongleInBTPairing(false); err != nil {
+		returnErr = err
+	}
+
+	return returnErr
+}
+
+// pairedDevice returns the selected dongle and the entry at pairingID in its pairing list.
+func pairedDevice(pairingID uint16) (jabra.DeviceInfo, jabra.PairedDevice, error) {
+	dongle, exists := getSelectedDongle()
+	if !exists {
+		return jabra.DeviceInfo{}, jabra.PairedDevice{}, fmt.Errorf("no dongle found")
+	}
+
+	if dongle.PairingList == nil || int(pairingID) >= len(dongle.PairingList.PairedDevices) {
+		return jabra.DeviceInfo{}, jabra.PairedDevice{}, fmt.Errorf("no paired device at index %d", pairingID)
+	}
+
+	return dongle, dongle.PairingList.PairedDevices[pairingID], nil
+}
+
+// Clear the pairingList
+func clearPairingList() error {
+
+	if dongle, exists := getSelectedDongle(); exists {
+		if err := backend.ClearPairingList(dongle.DeviceID); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("no dongle found")
+	}
+
+	return nil
+}
+
+// Remove device from pairingList where deviceListType is pairedDevices
+func removeDeviceFromPairedlist(pairingID uint16) error {
+	dongle, device, err := pairedDevice(pairingID)
+	if err != nil {
+		return err
+	}
+
+	return backend.ClearPairedDevice(dongle.DeviceID, device)
+}
+
+// Connect from pairingList where deviceListType is pairedDevices
+func connectDeviceFromPairedlist(pairingID uint16) error {
+	dongle, device, err := pairedDevice(pairingID)
+	if err != nil {
+		return err
+	}
+
+	return backend.ConnectPairedDevice(dongle.DeviceID, device)
+}
+
+// Disconnect from pairingList where deviceListType is pairedDevices
+func disconnectDeviceFromPairedlist(pairingID uint16) error {
+	dongle, device, err := pairedDevice(pairingID)
+	if err != nil {
+		return err
+	}
+
+	return backend.DisconnectPairedDevice(dongle.DeviceID, device)
+}
+
+func reconnectToDevice() error {
+	if dongle, exists := getSelectedDongle(); exists {
+		if err := backend.ConnectBTDevice(dongle.DeviceID); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("no dongle found")
+	}
+
+	return nil
+}
+
+func disconnectBTDeviceFromDongle() error {
+
+	if dongle, exists := getSelectedDongle(); exists {
+		if err := backend.DisconnectBTDevice(dongle.DeviceID); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("no dongle found")
+	}
+
+	return nil
+}
+
+func getAutoPairing() (bool, error) {
+	if dongle, exists := getSelectedDongle(); exists {
+		return backend.AutoPairing(dongle.DeviceID)
+	}
+
+	return false, fmt.Errorf("no dongle")
+}
+
+func setAutoPairing(autoPairing bool) error {
+	if dongle, exists := getSelectedDongle(); exists {
+		if err := backend.SetAutoPairing(dongle.DeviceID, autoPairing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toggleFirmwareLock(device jabra.DeviceInfo) error {
+	locked, err := backend.FirmwareLock(device.DeviceID)
+	if err != nil {
+		return err
+	}
+	return backend.SetFirmwareLock(device.DeviceID, !locked)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Watchdog0x/jLink/internal/equalizer"
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+const (
+	// gainStep is how much W/S or ▴ ▾ move the gain of a band, in dB
+	gainStep = 0.5
+	// sliderRows is the height of a slider when the screen has room for it
+	sliderRows = 13
+	bandWidth  = 10
+)
+
+var (
+	equalizerBands   []jabra.EqualizerBand
+	equalizerEnabled bool
+	equalizerMessage string
+
+	// presets is the presets file, presetList its presets while they are
+	// listed, nil otherwise
+	presets    = equalizer.Open(equalizer.DefaultPath())
+	presetList []equalizer.Preset
+	// presetName is the name being typed for a new preset, nil otherwise
+	presetName []rune
+	// bandSelected is the band under the cursor while the presets are listed
+	bandSelected int
+)
+
+/****************************************************************************/
+/*                                EQUALIZER                                 */
+/****************************************************************************/
+
+// loadEqualizer reads the equalizer of the selected headset.
+func loadEqualizer() {
+	equalizerBands, equalizerEnabled = nil, false
+
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+	enabled, err := backend.EqualizerEnabled(headset.DeviceID)
+	if err != nil {
+		equalizerMessage = fmt.Sprintf("Equalizer of %s: %s", headset.DeviceName, err)
+		return
+	}
+	bands, err := backend.EqualizerBands(headset.DeviceID)
+	if err != nil {
+		equalizerMessage = fmt.Sprintf("Equalizer of %s: %s", headset.DeviceName, err)
+		return
+	}
+	equalizerBands, equalizerEnabled = bands, enabled
+	currentSelection = min(currentSelection, max(len(bands)-1, 0))
+}
+
+func showingPresets() bool {
+	return presetList != nil
+}
+
+// selectBand moves the cursor step bands to the right.
+func selectBand(step int) {
+	if band := currentSelection + step; !showingPresets() && band >= 0 && band < len(equalizerBands) {
+		currentSelection = band
+	}
+}
+
+// changeGain moves the gain of the band under the cursor by step gain
+// steps, stopping at the limits of the band, and writes the gains.
+func changeGain(step int) {
+	if showingPresets() || currentSelection >= len(equalizerBands) {
+		return
+	}
+	band := equalizerBands[currentSelection]
+	gain := max(-band.MaxGain, min(band.MaxGain, band.Gain+float32(step)*gainStep))
+	if gain == band.Gain {
+		return
+	}
+
+	gains := make([]float32, 0, len(equalizerBands))
+	for _, band := range equalizerBands {
+		gains = append(gains, band.Gain)
+	}
+	gains[currentSelection] = gain
+	writeGains(gains, "")
+}
+
+// writeGains sets the gains of the selected headset and reads them back,
+// done is shown when they were taken.
+func writeGains(gains []float32, done string) {
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+	if err := backend.SetEqualizerGains(headset.DeviceID, gains); err != nil {
+		equalizerMessage = fmt.Sprintf("Not applied: %s", err)
+	} else {
+		equalizerMessage = done
+	}
+	loadEqualizer()
+}
+
+// toggleEqualizer turns the equalizer of the selected headset on or off.
+func toggleEqualizer() {
+	headset, exists := getSelectedHeadset()
+	if !exists || showingPresets() {
+		return
+	}
+	if err := backend.EnableEqualizer(headset.DeviceID, !equalizerEnabled); err != nil {
+		equalizerMessage = fmt.Sprintf("Equalizer: %s", err)
+	} else {
+		equalizerMessage = ""
+	}
+	loadEqualizer()
+}
+
+// openPresets lists the saved presets.
+func openPresets() {
+	list, err := presets.List()
+	if err != nil {
+		equalizerMessage = err.Error()
+		return
+	}
+	if len(list) == 0 {
+		equalizerMessage = fmt.Sprintf("No presets in %s yet, N saves one", presets.Path())
+		return
+	}
+	presetList, bandSelected, currentSelection = list, currentSelection, 0
+	equalizerMessage = ""
+}
+
+// closePresets goes back to the sliders, it reports whether the presets
+// were listed.
+func closePresets() bool {
+	if !showingPresets() {
+		return false
+	}
+	presetList, currentSelection = nil, bandSelected
+	return true
+}
+
+// loadPreset sets the gains to the preset under the cursor and turns the
+// equalizer on.
+func loadPreset() {
+	if currentSelection >= len(presetList) {
+		return
+	}
+	preset := presetList[currentSelection]
+	closePresets()
+
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+	gains, err := preset.Gains(equalizerBands)
+	if err != nil {
+		equalizerMessage = fmt.Sprintf("Not applied: %s", err)
+		return
+	}
+	if !equalizerEnabled {
+		if err := backend.EnableEqualizer(headset.DeviceID, true); err != nil {
+			equalizerMessage = fmt.Sprintf("Equalizer: %s", err)
+			return
+		}
+	}
+	writeGains(gains, fmt.Sprintf("%s loaded", preset.Name))
+}
+
+// deletePreset deletes the preset under the cursor.
+func deletePreset() {
+	if currentSelection >= len(presetList) {
+		return
+	}
+	name := presetList[currentSelection].Name
+	if err := presets.Delete(name); err != nil {
+		equalizerMessage = err.Error()
+		return
+	}
+	equalizerMessage = fmt.Sprintf("%s deleted", name)
+
+	list, err := presets.List()
+	if err != nil || len(list) == 0 {
+		closePresets()
+		return
+	}
+	presetList = list
+	currentSelection = min(currentSelection, len(list)-1)
+}
+
+func namingPreset() bool {
+	return presetName != nil
+}
+
+// startNamingPreset starts typing the name to save the gains under.
+func startNamingPreset() {
+	if showingPresets() || len(equalizerBands) == 0 {
+		return
+	}
+	presetName = []rune{}
+	equalizerMessage = ""
+}
+
+// editPresetName adds a typed character to the name of the preset, Enter
+// saves it, Esc cancels.
+func editPresetName(key byte) {
+	switch {
+	case key == '\r':
+		name := strings.TrimSpace(string(presetName))
+		if name == "" {
+			return
+		}
+		presetName = nil
+		if err := presets.Save(equalizer.FromBands(name, equalizerBands)); err != nil {
+			equalizerMessage = err.Error()
+		} else {
+			equalizerMessage = fmt.Sprintf("Saved as %s", name)
+		}
+	case key == 0x1B: // Escape
+		presetName = nil
+	case key == 0x7F || key == 0x08: // Backspace
+		if len(presetName) > 0 {
+			presetName = presetName[:len(presetName)-1]
+		}
+	case key >= 0x20 && key < 0x7F:
+		presetName = append(presetName, rune(key))
+	}
+}
+
+// formatFrequency writes 250 as "250 Hz" and 4000 as "4 kHz".
+func formatFrequency(frequency int) string {
+	if frequency >= 1000 {
+		return strconv.FormatFloat(float64(frequency)/1000, 'g', -1, 64) + " kHz"
+	}
+	return fmt.Sprintf("%d Hz", frequency)
+}
+
+func formatPresetGains(preset equalizer.Preset) string {
+	gains := make([]string, 0, len(preset.Bands))
+	for _, band := range preset.Bands {
+		gains = append(gains, fmt.Sprintf("%+g", band.Gain))
+	}
+	return strings.Join(gains, " ") + " dB"
+}
+
+// sliderRow returns the row of a slider rows high that gain is drawn on,
+// 0 at the top for maxGain.
+func sliderRow(gain, maxGain float32, rows int) int {
+	if maxGain <= 0 {
+		return rows / 2
+	}
+	return int(math.Round(float64((maxGain - gain) / (2 * maxGain) * float32(rows-1))))
+}
+
+// drawBand draws band as a vertical slider in column col, with its gain
+// above and its frequency and limits below.
+func drawBand(band jabra.EqualizerBand, col, rows int, selected bool) {
+	label := func(row int, text string) {
+		moveCursor(row, col)
+		if selected {
+			fmt.Printf("\033[42m%-*s\033[0m", bandWidth-2, text)
+		} else {
+			fmt.Printf("%-*s", bandWidth-2, text)
+		}
+	}
+
+	label(5, fmt.Sprintf("%+.1f dB", band.Gain))
+	knob := sliderRow(band.Gain, band.MaxGain, rows)
+	zero := sliderRow(0, band.MaxGain, rows)
+	for row := range rows {
+		moveCursor(7+row, col+3)
+		switch {
+		case row == knob:
+			fmt.Print("█")
+		case row == zero:
+			fmt.Print("┼")
+		default:
+			fmt.Print("│")
+		}
+	}
+	label(8+rows, formatFrequency(band.CenterFrequency))
+	label(9+rows, fmt.Sprintf("±%g", band.MaxGain))
+}
+
+func equalizerScreen() {
+	if !resetCurrentSelection {
+		currentSelection = 0
+		resetCurrentSelection = true
+		presetList, presetName = nil, nil
+		equalizerMessage = ""
+		loadEqualizer()
+	}
+	if _, exists := getSelectedHeadset(); !exists {
+		startMenuSelected = -1
+		return
+	}
+
+	drawingBox()
+
+	if showingPresets() {
+		for i, preset := range presetList {
+			label := truncate(fmt.Sprintf("  %s  %s", preset.Name, formatPresetGains(preset)), width-20)
+			if i == currentSelection {
+				moveCursor(4+i, 9)
+				fmt.Println("\033[42m", label, "\033[0m")
+			} else {
+				moveCursor(4+i, 10)
+				fmt.Println(label)
+			}
+		}
+		if equalizerMessage != "" {
+			moveCursor(height-5, 7)
+			fmt.Printf("\033[33m%s\033[0m", truncate(equalizerMessage, width-14))
+		}
+		moveCursor(height-3, 7)
+		fmt.Println("\033[42m", "Enter Load", "\033[0m", "\033[42m", "X Delete", "\033[0m", "\033[42m", "Q Back", "\033[0m")
+		return
+	}
+
+	moveCursor(4, 10)
+	if equalizerEnabled {
+		fmt.Print("Equalizer ON")
+	} else {
+		fmt.Print("Equalizer OFF")
+	}
+	rows := min(sliderRows, height-17)
+	for i, band := range equalizerBands {
+		drawBand(band, 10+i*bandWidth, rows, i == currentSelection)
+	}
+
+	moveCursor(height-5, 7)
+	switch {
+	case namingPreset():
+		fmt.Printf("Save as: %s▏", string(presetName))
+	case equalizerMessage != "":
+		fmt.Printf("\033[33m%s\033[0m", truncate(equalizerMessage, width-14))
+	}
+
+	moveCursor(height-3, 7)
+	if namingPreset() {
+		fmt.Println("\033[42m", "Enter Save", "\033[0m", "\033[42m", "Esc Cancel", "\033[0m")
+	} else {
+		fmt.Println("\033[42m", "E On/Off", "\033[0m", "\033[42m", "P Presets", "\033[0m", "\033[42m", "N Save as", "\033[0m", "\033[42m", "Q Back", "\033[0m")
+	}
+}
@@ -5,3 +5,7 @@ go 1.23.2
 require golang.org/x/term v0.27.0
 
 require golang.org/x/sys v0.28.0
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/godbus/dbus/v5 v5.2.2
@@ -2,17 +2,27 @@
 #define WRAPPER_H
 
 #include "Common.h"
+#include "JabraDeviceConfig.h"
+#include "Interface_AmbienceModes.h"
 
-// extern void firstScanForDevicesDone(void);
+extern void firstScanForDevicesDone(void);
 
 extern void deviceAttachedFunc(Jabra_DeviceInfo deviceInfo);
 
 extern void deviceRemovedFunc(uint16_t deviceID);
 
-// extern void buttonInDataRawHidFunc(unsigned short deviceID, unsigned short usagePage, unsigned short usage, unsigned char buttonInData);
+extern void buttonInDataRawHidFunc(unsigned short deviceID, unsigned short usagePage, unsigned short usage, bool buttonInData);
 
-// extern void buttonInDataTranslatedFunc(unsigned short deviceID, Jabra_HidInput translatedInData, bool buttonInData);
+extern void buttonInDataTranslatedFunc(unsigned short deviceID, Jabra_HidInput translatedInData, bool buttonInData);
 
-// extern void batteryStatusUpdate(unsigned short deviceID, Jabra_BatteryStatus* batteryStatus);
+extern void batteryStatusUpdate(unsigned short deviceID, Jabra_BatteryStatus* batteryStatus);
+
+extern void firmwareProgress(unsigned short deviceID, Jabra_FirmwareEventType type, Jabra_FirmwareEventStatus status, unsigned short percentage);
+
+extern void settingsChanged(unsigned short deviceID, DeviceSettings* settings);
+
+extern void ambienceChanged(unsigned short deviceID, Jabra_AmbienceModeChangeEvent event);
+
+extern void busylightChanged(unsigned short deviceID, bool on);
 
 #endif
\ No newline at end of file
@@ -0,0 +1,172 @@
+// Package alert raises low battery and fully charged alerts from the
+// battery events of a device registry, as desktop notifications and
+// optionally as a ringtone on the headset.
+package alert
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Watchdog0x/jLink/internal/config"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+type Kind int
+
+const (
+	Low Kind = iota
+	FullyCharged
+)
+
+// Alert is raised for one device. Threshold is the low battery threshold
+// that was crossed.
+type Alert struct {
+	Kind      Kind
+	Key       registry.Key
+	Device    jabra.DeviceInfo
+	Level     uint8
+	Threshold uint8
+}
+
+func (a Alert) Summary() string {
+	if a.Kind == FullyCharged {
+		return fmt.Sprintf("%s is fully charged", a.Device.DeviceName)
+	}
+	return fmt.Sprintf("%s battery low", a.Device.DeviceName)
+}
+
+func (a Alert) Body() string {
+	if a.Kind == FullyCharged {
+		return "You can unplug the headset."
+	}
+	return fmt.Sprintf("%d%% left.", a.Level)
+}
+
+// Notifier shows an alert to the user.
+type Notifier interface {
+	Notify(a Alert) error
+}
+
+// Monitor decides when to alert. The zero state of a device is armed: a
+// headset attaching below a threshold alerts once.
+type Monitor struct {
+	// OnError is given the ringtones and notifications that failed, nil
+	// drops them. It is called from Run.
+	OnError func(error)
+
+	config   config.Alerts
+	notifier Notifier
+	backend  jabra.Backend
+	devices  map[registry.Key]*state
+}
+
+type state struct {
+	// fired holds the thresholds that alerted and were not rearmed yet.
+	fired map[uint8]bool
+	full  bool
+}
+
+// New returns a monitor for cfg. notifier may be nil when notifications
+// are off, backend plays the ringtone.
+func New(cfg config.Alerts, notifier Notifier, backend jabra.Backend) *Monitor {
+	return &Monitor{
+		config:   cfg,
+		notifier: notifier,
+		backend:  backend,
+		devices:  make(map[registry.Key]*state),
+	}
+}
+
+// Run alerts on the events of subscription until ctx is done or the
+// subscription is closed.
+func (m *Monitor) Run(ctx context.Context, subscription *registry.Subscription) {
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			for _, a := range m.Handle(event) {
+				m.raise(a)
+			}
+		}
+	}
+}
+
+// Handle returns the alerts event raises.
+func (m *Monitor) Handle(event registry.Event) []Alert {
+	switch event.Type {
+	case registry.Removed:
+		delete(m.devices, event.Key)
+		return nil
+	case registry.Attached, registry.BatteryChanged:
+	default:
+		return nil
+	}
+
+	batteryStatus := event.Device.BatteryStatus
+	if batteryStatus == nil {
+		return nil
+	}
+	s, exists := m.devices[event.Key]
+	if !exists {
+		s = &state{fired: make(map[uint8]bool)}
+		m.devices[event.Key] = s
+	}
+	level := batteryStatus.LevelInPercent
+	hysteresis := m.config.Hysteresis
+
+	var alerts []Alert
+
+	// Only the lowest threshold crossed alerts, a headset attaching at 4%
+	// raises one alert and not three.
+	low := Alert{Kind: Low, Key: event.Key, Device: event.Device, Level: level}
+	for _, threshold := range m.config.Thresholds {
+		switch {
+		case int(level) >= int(threshold)+int(hysteresis):
+			delete(s.fired, threshold)
+		case level <= threshold && !batteryStatus.Charging && !s.fired[threshold]:
+			s.fired[threshold] = true
+			low.Threshold = threshold
+		}
+	}
+	if low.Threshold != 0 {
+		alerts = append(alerts, low)
+	}
+
+	switch {
+	case int(level) <= 100-int(max(hysteresis, 1)):
+		s.full = false
+	case level == 100 && batteryStatus.Charging && !s.full:
+		s.full = true
+		if m.config.FullyCharged {
+			alerts = append(alerts, Alert{Kind: FullyCharged, Key: event.Key, Device: event.Device, Level: level})
+		}
+	}
+
+	return alerts
+}
+
+func (m *Monitor) raise(a Alert) {
+	if ringtone := m.config.Ringtone; ringtone != nil && a.Device.FeatureFlags != nil && a.Device.FeatureFlags.PlayRingtone {
+		if err := m.backend.PlayRingtone(a.Device.DeviceID, ringtone.Level, ringtone.Type); err != nil {
+			m.fail(fmt.Errorf("ringtone of %s: %w", a.Device.DeviceName, err))
+		}
+	}
+	if m.notifier != nil {
+		if err := m.notifier.Notify(a); err != nil {
+			m.fail(fmt.Errorf("notification for %s: %w", a.Device.DeviceName, err))
+		}
+	}
+}
+
+func (m *Monitor) fail(err error) {
+	if m.OnError != nil {
+		m.OnError(err)
+	}
+}
@@ -0,0 +1,174 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/Watchdog0x/jLink/internal/bustest"
+	"github.com/Watchdog0x/jLink/internal/config"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+func battery(level uint8, charging bool) registry.Event {
+	return registry.Event{
+		Type: registry.BatteryChanged,
+		Key:  "HEADSET/bt",
+		Device: jabra.DeviceInfo{
+			DeviceName:    "Jabra Evolve2 85",
+			BatteryStatus: &jabra.BatteryStatus{LevelInPercent: level, Charging: charging},
+		},
+	}
+}
+
+func TestHandle(t *testing.T) {
+	m := New(config.Default().Alerts, nil, nil)
+
+	steps := []struct {
+		level    uint8
+		charging bool
+		want     string // summary and body of the alerts raised
+	}{
+		{50, false, ""},
+		{20, false, "20: Jabra Evolve2 85 battery low: 20% left."},
+		{19, false, ""},
+		// Hovering around the threshold does not alert again.
+		{21, false, ""},
+		{20, false, ""},
+		{4, false, "5: Jabra Evolve2 85 battery low: 4% left."},
+		{3, true, ""},
+		{99, true, ""},
+		{100, true, "0: Jabra Evolve2 85 is fully charged: You can unplug the headset."},
+		{100, false, ""},
+		{99, true, ""},
+		{100, true, ""},
+		// 3% below full rearms the fully charged alert, 3% above a threshold the threshold.
+		{97, false, ""},
+		{100, true, "0: Jabra Evolve2 85 is fully charged: You can unplug the headset."},
+		// Only the lowest of the thresholds crossed at once alerts.
+		{10, false, "10: Jabra Evolve2 85 battery low: 10% left."},
+	}
+	for i, step := range steps {
+		got := ""
+		for _, a := range m.Handle(battery(step.level, step.charging)) {
+			got += fmt.Sprintf("%d: %s: %s", a.Threshold, a.Summary(), a.Body())
+		}
+		if got != step.want {
+			t.Errorf("step %d (%d%%, charging %v): got %q, want %q", i, step.level, step.charging, got, step.want)
+		}
+	}
+
+	// A headset that comes back starts armed.
+	m.Handle(registry.Event{Type: registry.Removed, Key: "HEADSET/bt"})
+	if alerts := m.Handle(battery(10, false)); len(alerts) != 1 || alerts[0].Threshold != 10 {
+		t.Errorf("after reattaching: %+v", alerts)
+	}
+}
+
+// notificationServer records the Notify calls it receives.
+type notificationServer struct {
+	calls chan []any
+}
+
+func (s *notificationServer) Notify(appName string, replacesID uint32, icon, summary, body string,
+	actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	s.calls <- []any{replacesID, icon, summary, body, hints["urgency"].Value()}
+	return 7, nil
+}
+
+func TestRun(t *testing.T) {
+	address := bustest.PrivateBus(t)
+	server := bustest.Connect(t, address)
+	notifications := &notificationServer{calls: make(chan []any, 10)}
+	if err := server.Export(notifications, notificationsPath, notificationsName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.RequestName(notificationsName, dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: bt
+    features: [playRingtone]
+    battery:
+      level: 50
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	devices := registry.New(backend)
+	subscription := devices.Subscribe()
+	if err := devices.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer devices.Stop()
+
+	cfg := config.Default().Alerts
+	cfg.Ringtone = &config.Ringtone{Level: 128, Type: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go New(cfg, NewDesktopNotifier(bustest.Connect(t, address)), backend).Run(ctx, subscription)
+
+	next := func() []any {
+		t.Helper()
+		select {
+		case call := <-notifications.calls:
+			return call
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+			return nil
+		}
+	}
+
+	backend.SetBatteryLevel(1, 15)
+	if call := next(); call[0] != uint32(0) || call[1] != "battery-caution" || call[2] != "Jabra Evolve2 85 battery low" || call[4] != urgencyCritical {
+		t.Errorf("low battery notification %v", call)
+	}
+
+	// The next alert replaces the notification on screen. The ringtone
+	// plays before each notification.
+	backend.SetBatteryLevel(1, 8)
+	if call := next(); call[0] != uint32(7) || call[3] != "8% left." {
+		t.Errorf("second notification %v", call)
+	}
+
+	if ringtones := backend.Ringtones(1); ringtones != 2 {
+		t.Errorf("%d ringtones played, want 2", ringtones)
+	}
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(a Alert) error {
+	return errors.New("no notification daemon")
+}
+
+func TestOnError(t *testing.T) {
+	m := New(config.Default().Alerts, failingNotifier{}, nil)
+	var failed []error
+	m.OnError = func(err error) { failed = append(failed, err) }
+
+	for _, a := range m.Handle(battery(20, false)) {
+		m.raise(a)
+	}
+	if len(failed) != 1 || failed[0].Error() != "notification for Jabra Evolve2 85: no notification daemon" {
+		t.Errorf("errors %v", failed)
+	}
+
+	// Without OnError the failures are dropped.
+	m.OnError = nil
+	for _, a := range m.Handle(battery(4, false)) {
+		m.raise(a)
+	}
+}
@@ -0,0 +1,61 @@
+package alert
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+const (
+	notificationsName = "org.freedesktop.Notifications"
+	notificationsPath = dbus.ObjectPath("/org/freedesktop/Notifications")
+)
+
+// Urgency levels of the notification spec.
+const (
+	urgencyNormal   byte = 1
+	urgencyCritical byte = 2
+)
+
+// DesktopNotifier sends alerts to the notification server of the desktop.
+// A new alert for a device replaces the one still on screen.
+type DesktopNotifier struct {
+	conn *dbus.Conn
+
+	mu  sync.Mutex
+	ids map[registry.Key]uint32
+}
+
+func NewDesktopNotifier(conn *dbus.Conn) *DesktopNotifier {
+	return &DesktopNotifier{conn: conn, ids: make(map[registry.Key]uint32)}
+}
+
+func (n *DesktopNotifier) Notify(a Alert) error {
+	icon, urgency := "battery-full-charged", urgencyNormal
+	if a.Kind == Low {
+		icon, urgency = "battery-caution", urgencyCritical
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var id uint32
+	err := n.conn.Object(notificationsName, notificationsPath).Call(notificationsName+".Notify", 0,
+		"jLink",
+		n.ids[a.Key], // replaces_id
+		icon,
+		a.Summary(),
+		a.Body(),
+		[]string{}, // actions
+		map[string]dbus.Variant{"urgency": dbus.MakeVariant(urgency)},
+		int32(-1), // expire_timeout, the server's default
+	).Store(&id)
+	if err != nil {
+		return err
+	}
+	n.ids[a.Key] = id
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+const (
+	bluezName                       = "org.bluez"
+	bluezDeviceInterface            = "org.bluez.Device1"
+	batteryProviderManagerInterface = "org.bluez.BatteryProviderManager1"
+	// BatteryProviderInterface is implemented by the batteries handed to
+	// BlueZ, one object per headset.
+	BatteryProviderInterface = "org.bluez.BatteryProvider1"
+
+	batteriesPath = RootPath + "/batteries"
+)
+
+// BatteryProvider hands the batteries of the headsets connected to the
+// computer's own Bluetooth adapter to BlueZ on the system bus. BlueZ shows
+// them as org.bluez.Battery1 on its device objects, where upowerd and with
+// it the desktop battery indicators find them. A headset behind a dongle is
+// handed over when it is also connected to the computer, as multipoint
+// headsets are; one only the dongle talks to has no BlueZ device to carry
+// its battery and stays out of the indicators.
+//
+// A headset is matched to the connected BlueZ device with its name, and
+// only when a single one has it. BlueZ has one battery per device, the
+// earbuds and cradles of a headset are not handed over.
+type BatteryProvider struct {
+	conn    *dbus.Conn
+	backend jabra.Backend
+
+	// adapters are the provider roots by adapter, set before the devices
+	// are watched
+	adapters map[dbus.ObjectPath]dbus.ObjectPath
+
+	mu        sync.Mutex
+	batteries map[registry.Key]*battery
+}
+
+// battery is the BatteryProviderInterface of one headset.
+type battery struct {
+	root  dbus.ObjectPath // the provider it belongs to
+	path  dbus.ObjectPath
+	props *prop.Properties
+}
+
+func NewBatteryProvider(conn *dbus.Conn, backend jabra.Backend) *BatteryProvider {
+	return &BatteryProvider{
+		conn:      conn,
+		backend:   backend,
+		adapters:  make(map[dbus.ObjectPath]dbus.ObjectPath),
+		batteries: make(map[registry.Key]*battery),
+	}
+}
+
+// Serve registers a battery provider with every Bluetooth adapter, starts a
+// backend session and keeps the batteries up to date until ctx is done.
+func (p *BatteryProvider) Serve(ctx context.Context) error {
+	objects, err := p.bluezObjects()
+	if err != nil {
+		return err
+	}
+	for object, interfaces := range objects {
+		if _, ok := interfaces[batteryProviderManagerInterface]; !ok {
+			continue
+		}
+		root := batteriesPath + "/" + dbus.ObjectPath(invalidPathChars.ReplaceAllString(path.Base(string(object)), "_"))
+		if err := p.conn.Export(providerManager{p, root}, root, objectManagerInterface); err != nil {
+			return err
+		}
+		if err := p.conn.Object(bluezName, object).Call(batteryProviderManagerInterface+".RegisterBatteryProvider", 0, root).Err; err != nil {
+			return err
+		}
+		defer p.conn.Object(bluezName, object).Call(batteryProviderManagerInterface+".UnregisterBatteryProvider", 0, root)
+		p.adapters[object] = root
+	}
+	if len(p.adapters) == 0 {
+		return errors.New("BlueZ takes no battery providers, bluetoothd may need --experimental")
+	}
+
+	devices := registry.New(p.backend)
+	devices.PollInterval = pollInterval
+	subscription := devices.Subscribe()
+	if err := devices.Start("JabraLink"); err != nil {
+		subscription.Close()
+		return err
+	}
+	defer devices.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-subscription.C:
+			switch event.Type {
+			case registry.Attached, registry.BatteryChanged:
+				p.update(event.Key, event.Device)
+			case registry.Removed:
+				p.remove(event.Key)
+			}
+		}
+	}
+}
+
+// bluezObjects are the objects of BlueZ with their interfaces.
+func (p *BatteryProvider) bluezObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, error) {
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err := p.conn.Object(bluezName, "/").Call(objectManagerInterface+".GetManagedObjects", 0).Store(&objects)
+	return objects, err
+}
+
+// bluezDevice is the connected BlueZ device named name on one of the
+// adapters, false unless there is exactly one.
+func (p *BatteryProvider) bluezDevice(name string) (device, adapter dbus.ObjectPath, ok bool) {
+	objects, err := p.bluezObjects()
+	if err != nil {
+		return "", "", false
+	}
+	for object, interfaces := range objects {
+		properties, isDevice := interfaces[bluezDeviceInterface]
+		if !isDevice {
+			continue
+		}
+		connected, _ := properties["Connected"].Value().(bool)
+		deviceName, _ := properties["Name"].Value().(string)
+		alias, _ := properties["Alias"].Value().(string)
+		deviceAdapter, _ := properties["Adapter"].Value().(dbus.ObjectPath)
+		if _, registered := p.adapters[deviceAdapter]; !connected || !registered || (deviceName != name && alias != name) {
+			continue
+		}
+		if ok {
+			return "", "", false
+		}
+		device, adapter, ok = object, deviceAdapter, true
+	}
+	return device, adapter, ok
+}
+
+/****************************************************************************/
+/*                              DEVICE EVENTS                               */
+/****************************************************************************/
+
+// update hands the battery of a headset to BlueZ, or sets its new level,
+// however the headset is attached here. A headset BlueZ does not know yet is
+// looked for again on its next battery change.
+func (p *BatteryProvider) update(key registry.Key, deviceInfo jabra.DeviceInfo) {
+	if deviceInfo.IsDongle || deviceInfo.BatteryStatus == nil {
+		return
+	}
+	percentage := deviceInfo.BatteryStatus.LevelInPercent
+
+	p.mu.Lock()
+	b, exists := p.batteries[key]
+	p.mu.Unlock()
+	if exists {
+		if b.props.GetMust(BatteryProviderInterface, "Percentage") != percentage {
+			b.props.SetMust(BatteryProviderInterface, "Percentage", percentage)
+		}
+		return
+	}
+
+	// BlueZ may read the batteries meanwhile, the lock is not held
+	device, adapter, ok := p.bluezDevice(deviceInfo.DeviceName)
+	if !ok {
+		return
+	}
+	b = &battery{root: p.adapters[adapter]}
+	b.path = b.root + "/" + dbus.ObjectPath(path.Base(string(device)))
+	props, err := prop.Export(p.conn, b.path, prop.Map{BatteryProviderInterface: {
+		"Device":     {Value: device, Emit: prop.EmitConst},
+		"Percentage": {Value: percentage, Emit: prop.EmitTrue},
+		"Source":     {Value: "jLink", Emit: prop.EmitConst},
+	}})
+	if err != nil {
+		return
+	}
+	b.props = props
+
+	p.mu.Lock()
+	p.batteries[key] = b
+	p.mu.Unlock()
+	p.conn.Emit(b.root, objectManagerInterface+".InterfacesAdded", b.path, b.interfaces())
+}
+
+func (p *BatteryProvider) remove(key registry.Key) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b, exists := p.batteries[key]
+	if !exists {
+		return
+	}
+	delete(p.batteries, key)
+	p.conn.Export(nil, b.path, "org.freedesktop.DBus.Properties")
+	p.conn.Emit(b.root, objectManagerInterface+".InterfacesRemoved", b.path, []string{BatteryProviderInterface})
+}
+
+// interfaces are the interfaces of the object of b with their properties.
+func (b *battery) interfaces() map[string]map[string]dbus.Variant {
+	properties, _ := b.props.GetAll(BatteryProviderInterface)
+	return map[string]map[string]dbus.Variant{BatteryProviderInterface: properties}
+}
+
+/****************************************************************************/
+/*                              OBJECT MANAGER                              */
+/****************************************************************************/
+
+// providerManager is the object manager BlueZ reads the batteries of one
+// adapter from.
+type providerManager struct {
+	p    *BatteryProvider
+	root dbus.ObjectPath
+}
+
+// GetManagedObjects implements org.freedesktop.DBus.ObjectManager.
+func (m providerManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	m.p.mu.Lock()
+	defer m.p.mu.Unlock()
+
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	for _, b := range m.p.batteries {
+		if b.root == m.root {
+			objects[b.path] = b.interfaces()
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,180 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/Watchdog0x/jLink/internal/bustest"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+// bluez is a mock bluetoothd with one adapter and the devices connected to
+// it. Its exported methods are the methods of the battery provider manager.
+type bluez struct {
+	devices map[dbus.ObjectPath]string // connected device, name
+
+	mu       sync.Mutex
+	provider dbus.Sender
+	root     dbus.ObjectPath
+}
+
+func newBluez(t *testing.T, address string, devices map[dbus.ObjectPath]string) *bluez {
+	t.Helper()
+
+	conn := bustest.Connect(t, address)
+	b := &bluez{devices: devices}
+	if err := conn.Export(bluezObjects{b}, "/", objectManagerInterface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(b, "/org/bluez/hci0", batteryProviderManagerInterface); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName(bluezName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName: %v, %v", reply, err)
+	}
+	return b
+}
+
+func (b *bluez) RegisterBatteryProvider(sender dbus.Sender, root dbus.ObjectPath) *dbus.Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.provider, b.root = sender, root
+	return nil
+}
+
+func (b *bluez) UnregisterBatteryProvider(root dbus.ObjectPath) *dbus.Error {
+	return nil
+}
+
+// registered is the provider registered with the adapter.
+func (b *bluez) registered() (dbus.Sender, dbus.ObjectPath) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.provider, b.root
+}
+
+type bluezObjects struct {
+	b *bluez
+}
+
+func (o bluezObjects) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		"/org/bluez/hci0": {"org.bluez.Adapter1": {}, batteryProviderManagerInterface: {}},
+	}
+	for path, name := range o.b.devices {
+		objects[path] = map[string]map[string]dbus.Variant{bluezDeviceInterface: {
+			"Name":      dbus.MakeVariant(name),
+			"Alias":     dbus.MakeVariant(name),
+			"Connected": dbus.MakeVariant(true),
+			"Adapter":   dbus.MakeVariant(dbus.ObjectPath("/org/bluez/hci0")),
+		}}
+	}
+	return objects, nil
+}
+
+func TestBatteryProvider(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	address := bustest.PrivateBus(t)
+
+	// The Evolve2 85 is connected to the computer, the Evolve2 65 to the
+	// dongle and the computer, the Evolve2 75 only to the dongle.
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: DONGLE
+    dongle: true
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: bt
+    battery:
+      level: 64
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: OTHER
+    connection: bt
+    parent: 0
+    battery:
+      level: 30
+  - id: 3
+    name: Jabra Evolve2 75
+    serial: THIRD
+    connection: bt
+    parent: 0
+    battery:
+      level: 40
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	bluetoothd := newBluez(t, address, map[dbus.ObjectPath]string{
+		"/org/bluez/hci0/dev_70_BF_92_4A_10_01": "Jabra Evolve2 85",
+		"/org/bluez/hci0/dev_70_BF_92_4A_10_02": "Jabra Evolve2 65",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- NewBatteryProvider(bustest.Connect(t, address), backend).Serve(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := bustest.Connect(t, address)
+	batteries := func() map[dbus.ObjectPath]map[string]map[string]dbus.Variant {
+		provider, root := bluetoothd.registered()
+		if provider == "" {
+			return nil
+		}
+		var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+		client.Object(string(provider), root).Call(objectManagerInterface+".GetManagedObjects", 0).Store(&objects)
+		return objects
+	}
+	waitForBattery := func(percentage uint8) map[string]dbus.Variant {
+		t.Helper()
+		var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			objects = batteries()
+			for _, interfaces := range objects {
+				if properties := interfaces[BatteryProviderInterface]; properties["Percentage"].Value() == percentage {
+					return properties
+				}
+			}
+		}
+		t.Fatalf("batteries %v, want one at %d%%", objects, percentage)
+		return nil
+	}
+
+	// Only the headsets BlueZ knows are handed over, behind the dongle too.
+	properties := waitForBattery(64)
+	if properties["Device"].Value() != dbus.ObjectPath("/org/bluez/hci0/dev_70_BF_92_4A_10_01") || properties["Source"].Value() != "jLink" {
+		t.Errorf("battery properties %v", properties)
+	}
+	if properties := waitForBattery(30); properties["Device"].Value() != dbus.ObjectPath("/org/bluez/hci0/dev_70_BF_92_4A_10_02") {
+		t.Errorf("battery properties %v", properties)
+	}
+	if objects := batteries(); len(objects) != 2 {
+		t.Errorf("batteries %v", objects)
+	}
+
+	backend.SetBatteryLevel(1, 50)
+	waitForBattery(50)
+
+	backend.Detach(1)
+	backend.Detach(2)
+	for deadline := time.Now().Add(5 * time.Second); len(batteries()) != 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("batteries %v after the headset detached", batteries())
+		}
+	}
+}
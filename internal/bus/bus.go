@@ -0,0 +1,252 @@
+// Package bus publishes the attached devices on the D-Bus session bus, one
+// object per device under /org/jlink/devices, for desktop extensions and
+// scripts. Battery and pairing state changes reported by the device registry
+// are announced with PropertiesChanged, devices coming and going with the
+// ObjectManager signals on /org/jlink. Headsets and their earbuds also
+// implement org.freedesktop.UPower.Device, for scripts and extensions that
+// read UPower-shaped devices from org.jlink; the desktop battery indicators
+// do not see them. BatteryProvider hands the batteries of the headsets
+// connected to the computer's Bluetooth adapter to BlueZ on the system bus
+// instead, where they do.
+package bus
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+const (
+	BusName = "org.jlink"
+	// DeviceInterface is implemented by every device object.
+	DeviceInterface = "org.jlink.Device"
+
+	RootPath    = dbus.ObjectPath("/org/jlink")
+	devicesPath = RootPath + "/devices"
+
+	objectManagerInterface = "org.freedesktop.DBus.ObjectManager"
+)
+
+// pollInterval is how often battery and pairing state is read, tests shorten it.
+var pollInterval = time.Second
+
+// Service owns the exported device objects.
+type Service struct {
+	conn    *dbus.Conn
+	backend jabra.Backend
+
+	mu      sync.Mutex
+	objects map[registry.Key]*device
+}
+
+func New(conn *dbus.Conn, backend jabra.Backend) *Service {
+	return &Service{
+		conn:    conn,
+		backend: backend,
+		objects: make(map[registry.Key]*device),
+	}
+}
+
+// Serve claims BusName, starts a backend session and keeps the device
+// objects up to date until ctx is done.
+func (s *Service) Serve(ctx context.Context) error {
+	if err := s.conn.Export(manager{s}, RootPath, objectManagerInterface); err != nil {
+		return err
+	}
+	for _, path := range []dbus.ObjectPath{RootPath, devicesPath} {
+		if err := s.conn.Export(tree{s, path}, path, "org.freedesktop.DBus.Introspectable"); err != nil {
+			return err
+		}
+	}
+
+	reply, err := s.conn.RequestName(BusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("%s is already owned by another process", BusName)
+	}
+	defer s.conn.ReleaseName(BusName)
+
+	devices := registry.New(s.backend)
+	devices.PollInterval = pollInterval
+	subscription := devices.Subscribe()
+	if err := devices.Start("JabraLink"); err != nil {
+		subscription.Close()
+		return err
+	}
+	defer devices.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-subscription.C:
+			switch event.Type {
+			case registry.Attached:
+				s.deviceAttached(event.Key, event.Device)
+			case registry.Removed:
+				s.deviceRemoved(event.Key)
+			case registry.BatteryChanged, registry.PairingListChanged:
+				if d := s.object(event.Key); d != nil {
+					d.update(event.Device)
+				}
+			}
+		}
+	}
+}
+
+func (s *Service) object(key registry.Key) *device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.objects[key]
+}
+
+func (s *Service) devices() []*device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices := make([]*device, 0, len(s.objects))
+	for _, d := range s.objects {
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+/****************************************************************************/
+/*                              DEVICE EVENTS                               */
+/****************************************************************************/
+
+func (s *Service) deviceAttached(key registry.Key, deviceInfo jabra.DeviceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, exists := s.objects[key]; exists {
+		s.unexport(old)
+		delete(s.objects, key)
+	}
+
+	d, err := newDevice(s, deviceInfo, s.objectPath(deviceInfo))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	s.objects[key] = d
+
+	for path, interfaces := range d.managedObjects() {
+		s.conn.Emit(RootPath, objectManagerInterface+".InterfacesAdded", path, interfaces)
+	}
+}
+
+func (s *Service) deviceRemoved(key registry.Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, exists := s.objects[key]; exists {
+		s.unexport(d)
+		delete(s.objects, key)
+	}
+}
+
+// unexport removes the object of d and the objects of its extra batteries
+// from the bus. The caller holds s.mu.
+func (s *Service) unexport(d *device) {
+	d.mu.Lock()
+	for component, extra := range d.extras {
+		s.unexportPower(extra)
+		delete(d.extras, component)
+	}
+	d.mu.Unlock()
+
+	interfaces := []string{DeviceInterface}
+	if d.power != nil {
+		interfaces = append(interfaces, PowerInterface)
+	}
+	for _, iface := range append(interfaces, "org.freedesktop.DBus.Properties", "org.freedesktop.DBus.Introspectable") {
+		s.conn.Export(nil, d.path, iface)
+	}
+	s.conn.Emit(RootPath, objectManagerInterface+".InterfacesRemoved", d.path, interfaces)
+}
+
+// unexportPower removes the object of an extra battery from the bus.
+func (s *Service) unexportPower(p *power) {
+	for _, iface := range []string{PowerInterface, "org.freedesktop.DBus.Properties", "org.freedesktop.DBus.Introspectable"} {
+		s.conn.Export(nil, p.path, iface)
+	}
+	s.conn.Emit(RootPath, objectManagerInterface+".InterfacesRemoved", p.path, []string{PowerInterface})
+}
+
+var invalidPathChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// objectPath names the object after the serial number so it stays the same
+// across reconnects. The caller holds s.mu.
+func (s *Service) objectPath(deviceInfo jabra.DeviceInfo) dbus.ObjectPath {
+	name := invalidPathChars.ReplaceAllString(deviceInfo.SerialNumber, "_")
+	if name == "" {
+		name = fmt.Sprintf("device%d", deviceInfo.DeviceID)
+	}
+	path := devicesPath + "/" + dbus.ObjectPath(name)
+
+	for _, d := range s.objects {
+		if d.path == path {
+			return dbus.ObjectPath(fmt.Sprintf("%s_%d", path, deviceInfo.DeviceID))
+		}
+	}
+	return path
+}
+
+/****************************************************************************/
+/*                              OBJECT MANAGER                              */
+/****************************************************************************/
+
+type manager struct {
+	s *Service
+}
+
+// GetManagedObjects implements org.freedesktop.DBus.ObjectManager.
+func (m manager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	for _, d := range m.s.devices() {
+		for path, interfaces := range d.managedObjects() {
+			objects[path] = interfaces
+		}
+	}
+	return objects, nil
+}
+
+// tree introspects the paths above the device objects so the devices show
+// up in tools like busctl tree.
+type tree struct {
+	s    *Service
+	path dbus.ObjectPath
+}
+
+func (t tree) Introspect() (string, *dbus.Error) {
+	node := &introspect.Node{Name: string(t.path)}
+	if t.path == RootPath {
+		node.Interfaces = []introspect.Interface{{
+			Name:    objectManagerInterface,
+			Methods: introspect.Methods(manager{}),
+			Signals: []introspect.Signal{
+				{Name: "InterfacesAdded", Args: []introspect.Arg{{Name: "object", Type: "o"}, {Name: "interfaces", Type: "a{sa{sv}}"}}},
+				{Name: "InterfacesRemoved", Args: []introspect.Arg{{Name: "object", Type: "o"}, {Name: "interfaces", Type: "as"}}},
+			},
+		}}
+		node.Children = []introspect.Node{{Name: "devices"}}
+	} else {
+		for _, d := range t.s.devices() {
+			node.Children = append(node.Children, introspect.Node{Name: strings.TrimPrefix(string(d.path), string(devicesPath)+"/")})
+		}
+	}
+	return introspect.NewIntrospectable(node).Introspect()
+}
@@ -0,0 +1,240 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/Watchdog0x/jLink/internal/bustest"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+const testScenario = `
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: 2F9A-4C1B
+    dongle: true
+    features: [pairingList]
+    pairingList:
+      - name: Jabra Evolve2 85
+        address: 70:BF:92:4A:10:01
+        connected: true
+        device: 1
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: bt
+    battery:
+      level: 64
+      charging: true
+`
+
+func TestService(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	address := bustest.PrivateBus(t)
+
+	scenario, err := fake.Parse([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- New(bustest.Connect(t, address), backend).Serve(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := bustest.Connect(t, address)
+	signals := make(chan *dbus.Signal, 100)
+	client.Signal(signals)
+	if err := client.AddMatchSignal(dbus.WithMatchSender(BusName)); err != nil {
+		t.Fatal(err)
+	}
+
+	dongle := client.Object(BusName, "/org/jlink/devices/2F9A_4C1B")
+	headset := client.Object(BusName, "/org/jlink/devices/HEADSET")
+
+	// Wait until both devices are exported.
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	for deadline := time.Now().Add(5 * time.Second); len(objects) != 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("managed objects %v", objects)
+		}
+		client.Object(BusName, RootPath).Call(objectManagerInterface+".GetManagedObjects", 0).Store(&objects)
+	}
+
+	properties := objects[headset.Path()][DeviceInterface]
+	if properties["Name"].Value() != "Jabra Evolve2 85" || properties["Connection"].Value() != "bt" ||
+		properties["BatteryLevel"].Value() != uint8(64) || properties["Charging"].Value() != true {
+		t.Errorf("headset properties %v", properties)
+	}
+
+	var levels map[string]uint8
+	if err := headset.StoreProperty(DeviceInterface+".BatteryLevels", &levels); err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 1 || levels["headband"] != 64 {
+		t.Errorf("BatteryLevels = %v", levels)
+	}
+
+	var pairingList []PairedDevice
+	if err := dongle.StoreProperty(DeviceInterface+".PairingList", &pairingList); err != nil {
+		t.Fatal(err)
+	}
+	if len(pairingList) != 1 || pairingList[0] != (PairedDevice{"Jabra Evolve2 85", "70:BF:92:4A:10:01", true}) {
+		t.Errorf("PairingList = %v", pairingList)
+	}
+
+	// Battery changes are announced.
+	backend.SetCharging(1, false)
+	waitForSignal(t, signals, func(signal *dbus.Signal) bool {
+		if signal.Path != headset.Path() || signal.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" {
+			return false
+		}
+		charging, ok := signal.Body[1].(map[string]dbus.Variant)["Charging"]
+		return ok && charging.Value() == false
+	})
+
+	// SDK errors keep their return code.
+	call := dongle.Call(DeviceInterface+".ClearPairedDevice", 0, "70:BF:92:4A:10:01")
+	if dbusErr, ok := call.Err.(dbus.Error); !ok || dbusErr.Name != BusName+".Error.ReturnCode" || dbusErr.Body[1] != int32(23) {
+		t.Errorf("ClearPairedDevice of a connected device: %v", call.Err)
+	}
+	call = dongle.Call(DeviceInterface+".ConnectPairedDevice", 0, "11:22:33:44:55:66")
+	if dbusErr, ok := call.Err.(dbus.Error); !ok || dbusErr.Name != BusName+".Error.NotPaired" {
+		t.Errorf("ConnectPairedDevice of an unknown address: %v", call.Err)
+	}
+
+	// Disconnecting the headset removes its object and updates the pairing list.
+	if err := dongle.Call(DeviceInterface+".DisconnectPairedDevice", 0, "70:BF:92:4A:10:01").Err; err != nil {
+		t.Fatal(err)
+	}
+	waitForSignal(t, signals, func(signal *dbus.Signal) bool {
+		return signal.Name == objectManagerInterface+".InterfacesRemoved" && signal.Body[0] == headset.Path()
+	})
+	waitForSignal(t, signals, func(signal *dbus.Signal) bool {
+		if signal.Path != dongle.Path() || signal.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" {
+			return false
+		}
+		_, ok := signal.Body[1].(map[string]dbus.Variant)["PairingList"]
+		return ok
+	})
+}
+
+func TestPower(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	address := bustest.PrivateBus(t)
+
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Elite 85t
+    serial: EARBUDS
+    connection: bt
+    battery:
+      level: 60
+      charging: true
+      extraUnits:
+        - component: left
+          level: 40
+        - component: right
+          level: 80
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- New(bustest.Connect(t, address), backend).Serve(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := bustest.Connect(t, address)
+	signals := make(chan *dbus.Signal, 100)
+	client.Signal(signals)
+	if err := client.AddMatchSignal(dbus.WithMatchSender(BusName)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The earbuds are objects of their own.
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	for deadline := time.Now().Add(5 * time.Second); len(objects) != 3; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("managed objects %v", objects)
+		}
+		client.Object(BusName, RootPath).Call(objectManagerInterface+".GetManagedObjects", 0).Store(&objects)
+	}
+
+	for path, want := range map[dbus.ObjectPath]struct {
+		model      string
+		percentage float64
+	}{
+		"/org/jlink/devices/EARBUDS":       {"Jabra Elite 85t", 60},
+		"/org/jlink/devices/EARBUDS/left":  {"Jabra Elite 85t (left)", 40},
+		"/org/jlink/devices/EARBUDS/right": {"Jabra Elite 85t (right)", 80},
+	} {
+		properties := objects[path][PowerInterface]
+		if properties["Model"].Value() != want.model || properties["Percentage"].Value() != want.percentage ||
+			properties["Type"].Value() != upowerKindHeadset || properties["State"].Value() != upowerStateCharging ||
+			properties["IsPresent"].Value() != true {
+			t.Errorf("%s: %v", path, properties)
+		}
+	}
+
+	var icon string
+	if err := client.Object(BusName, "/org/jlink/devices/EARBUDS/left").StoreProperty(PowerInterface+".IconName", &icon); err != nil {
+		t.Fatal(err)
+	}
+	if icon != "battery-good-charging-symbolic" {
+		t.Errorf("IconName = %q", icon)
+	}
+
+	backend.SetCharging(1, false)
+	waitForSignal(t, signals, func(signal *dbus.Signal) bool {
+		if signal.Path != "/org/jlink/devices/EARBUDS/right" || signal.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" ||
+			signal.Body[0] != PowerInterface {
+			return false
+		}
+		state, ok := signal.Body[1].(map[string]dbus.Variant)["State"]
+		return ok && state.Value() == upowerStateDischarging
+	})
+
+	if err := client.Object(BusName, "/org/jlink/devices/EARBUDS").Call(PowerInterface+".Refresh", 0).Err; err != nil {
+		t.Error(err)
+	}
+
+	// Removing the headset removes the earbuds.
+	backend.Detach(1)
+	waitForSignal(t, signals, func(signal *dbus.Signal) bool {
+		return signal.Name == objectManagerInterface+".InterfacesRemoved" && signal.Body[0] == dbus.ObjectPath("/org/jlink/devices/EARBUDS/left")
+	})
+}
+
+func waitForSignal(t *testing.T, signals chan *dbus.Signal, match func(*dbus.Signal) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case signal := <-signals:
+			if match(signal) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for signal")
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// PairedDevice is an entry of the PairingList property, signature (ssb).
+type PairedDevice struct {
+	Name      string
+	Address   string
+	Connected bool
+}
+
+// device is the object of one attached device. Its exported methods are the
+// methods of DeviceInterface.
+type device struct {
+	service    *Service
+	deviceInfo jabra.DeviceInfo
+	path       dbus.ObjectPath
+	props      *prop.Properties
+
+	// power is the PowerInterface of a headset, nil for dongles.
+	power *power
+
+	mu     sync.Mutex
+	extras map[jabra.BatteryComponent]*power
+}
+
+func newDevice(s *Service, deviceInfo jabra.DeviceInfo, path dbus.ObjectPath) (*device, error) {
+	d := &device{service: s, deviceInfo: deviceInfo, path: path}
+
+	firmwareVersion, _ := s.backend.FirmwareVersion(deviceInfo.DeviceID)
+	constant := func(value any) *prop.Prop { return &prop.Prop{Value: value, Emit: prop.EmitConst} }
+	changing := func(value any) *prop.Prop { return &prop.Prop{Value: value, Emit: prop.EmitTrue} }
+
+	properties := map[string]*prop.Prop{
+		"Name":            constant(deviceInfo.DeviceName),
+		"Serial":          constant(deviceInfo.SerialNumber),
+		"Connection":      constant(deviceInfo.DeviceConnection.String()),
+		"Dongle":          constant(deviceInfo.IsDongle),
+		"VendorID":        constant(deviceInfo.VendorID),
+		"ProductID":       constant(deviceInfo.ProductID),
+		"FirmwareVersion": constant(firmwareVersion),
+		"BatteryLevel":    changing(uint8(0)),
+		"Charging":        changing(false),
+		"BatteryLow":      changing(false),
+		"BatteryLevels":   changing(map[string]uint8{}),
+		"PairingList":     changing([]PairedDevice{}),
+	}
+	if batteryStatus := deviceInfo.BatteryStatus; batteryStatus != nil {
+		properties["BatteryLevel"].Value = batteryStatus.LevelInPercent
+		properties["Charging"].Value = batteryStatus.Charging
+		properties["BatteryLow"].Value = batteryStatus.BatteryLow
+		properties["BatteryLevels"].Value = batteryLevels(batteryStatus)
+	}
+	if deviceInfo.PairingList != nil {
+		properties["PairingList"].Value = pairedDevices(deviceInfo.PairingList)
+	}
+
+	interfaces := prop.Map{DeviceInterface: properties}
+	if !deviceInfo.IsDongle {
+		interfaces[PowerInterface] = powerProperties(deviceInfo, jabra.ComponentUnknown)
+	}
+	props, err := prop.Export(s.conn, path, interfaces)
+	if err != nil {
+		return nil, err
+	}
+	d.props = props
+
+	if err := s.conn.Export(d, path, DeviceInterface); err != nil {
+		return nil, err
+	}
+	introspection := []introspect.Interface{
+		prop.IntrospectData,
+		{
+			Name:       DeviceInterface,
+			Methods:    introspect.Methods(d),
+			Properties: props.Introspection(DeviceInterface),
+		},
+	}
+	if !deviceInfo.IsDongle {
+		d.power = &power{device: d, path: path, props: props}
+		if err := s.conn.Export(d.power, path, PowerInterface); err != nil {
+			return nil, err
+		}
+		introspection = append(introspection, introspect.Interface{
+			Name:       PowerInterface,
+			Methods:    introspect.Methods(d.power),
+			Properties: props.Introspection(PowerInterface),
+		})
+	}
+	if err := s.conn.Export(deviceNode{d, introspection}, path, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return nil, err
+	}
+
+	d.extras = make(map[jabra.BatteryComponent]*power)
+	for _, component := range extraBatteries(deviceInfo.BatteryStatus) {
+		extra, err := newExtraBattery(d, component)
+		if err != nil {
+			return nil, err
+		}
+		d.extras[component] = extra
+	}
+
+	return d, nil
+}
+
+// deviceNode introspects the object of a device, with the objects of its
+// extra batteries as children.
+type deviceNode struct {
+	d          *device
+	interfaces []introspect.Interface
+}
+
+func (n deviceNode) Introspect() (string, *dbus.Error) {
+	node := &introspect.Node{Name: string(n.d.path), Interfaces: n.interfaces}
+
+	n.d.mu.Lock()
+	for _, extra := range n.d.extras {
+		node.Children = append(node.Children, introspect.Node{Name: strings.TrimPrefix(string(extra.path), string(n.d.path)+"/")})
+	}
+	n.d.mu.Unlock()
+
+	return introspect.NewIntrospectable(node).Introspect()
+}
+
+// interfaces are the interfaces of the object of d with their properties.
+func (d *device) interfaces() map[string]map[string]dbus.Variant {
+	interfaces := make(map[string]map[string]dbus.Variant)
+	properties, _ := d.props.GetAll(DeviceInterface)
+	interfaces[DeviceInterface] = properties
+	if d.power != nil {
+		properties, _ := d.props.GetAll(PowerInterface)
+		interfaces[PowerInterface] = properties
+	}
+	return interfaces
+}
+
+// managedObjects are the object of d and the objects of its extra batteries,
+// as GetManagedObjects reports them.
+func (d *device) managedObjects() map[dbus.ObjectPath]map[string]map[string]dbus.Variant {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{d.path: d.interfaces()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, extra := range d.extras {
+		properties, _ := extra.props.GetAll(PowerInterface)
+		objects[extra.path] = map[string]map[string]dbus.Variant{PowerInterface: properties}
+	}
+	return objects
+}
+
+// update takes the battery and pairing list from deviceInfo,
+// PropertiesChanged is emitted for the values that differ.
+func (d *device) update(deviceInfo jabra.DeviceInfo) {
+	if batteryStatus := deviceInfo.BatteryStatus; batteryStatus != nil {
+		d.set("BatteryLevel", batteryStatus.LevelInPercent)
+		d.set("Charging", batteryStatus.Charging)
+		d.set("BatteryLow", batteryStatus.BatteryLow)
+		d.set("BatteryLevels", batteryLevels(batteryStatus))
+		if d.power != nil {
+			d.power.update(batteryStatus)
+			d.updateExtras(batteryStatus)
+		}
+	}
+	if deviceInfo.PairingList != nil {
+		d.set("PairingList", pairedDevices(deviceInfo.PairingList))
+	}
+}
+
+// updateExtras exports the extra batteries that appeared in batteryStatus,
+// removes the ones that are gone and updates the rest.
+func (d *device) updateExtras(batteryStatus *jabra.BatteryStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	components := extraBatteries(batteryStatus)
+	for component, extra := range d.extras {
+		if !slices.Contains(components, component) {
+			d.service.unexportPower(extra)
+			delete(d.extras, component)
+		}
+	}
+	for _, component := range components {
+		if extra, exists := d.extras[component]; exists {
+			extra.update(batteryStatus)
+			continue
+		}
+		extra, err := newExtraBattery(d, component)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		d.extras[component] = extra
+		properties, _ := extra.props.GetAll(PowerInterface)
+		d.service.conn.Emit(RootPath, objectManagerInterface+".InterfacesAdded", extra.path, map[string]map[string]dbus.Variant{
+			PowerInterface: properties,
+		})
+	}
+}
+
+func (d *device) set(property string, value any) {
+	if reflect.DeepEqual(d.props.GetMust(DeviceInterface, property), value) {
+		return
+	}
+	d.props.SetMust(DeviceInterface, property, value)
+}
+
+// batteryLevels is the BatteryLevels property, signature a{sy}: the level of
+// every battery by component, e.g. left and right for earbuds.
+func batteryLevels(batteryStatus *jabra.BatteryStatus) map[string]uint8 {
+	levels := make(map[string]uint8)
+	for component, level := range batteryStatus.Levels() {
+		levels[component.String()] = level
+	}
+	return levels
+}
+
+func pairedDevices(pairingList *jabra.PairingList) []PairedDevice {
+	pairedDevices := make([]PairedDevice, 0, len(pairingList.PairedDevices))
+	for _, pairedDevice := range pairingList.PairedDevices {
+		pairedDevices = append(pairedDevices, PairedDevice{
+			Name:      pairedDevice.DeviceName,
+			Address:   pairedDevice.Address(),
+			Connected: pairedDevice.IsConnected,
+		})
+	}
+	return pairedDevices
+}
+
+// pairedDevice finds address in the pairing list of the dongle.
+func (d *device) pairedDevice(address string) (jabra.PairedDevice, *dbus.Error) {
+	btAddr, err := jabra.ParseBTAddr(address)
+	if err != nil {
+		return jabra.PairedDevice{}, dbus.MakeFailedError(err)
+	}
+	for _, pairedDevice := range d.service.backend.PairingList(d.deviceInfo.DeviceID).PairedDevices {
+		if pairedDevice.DeviceBTAddr == btAddr {
+			return pairedDevice, nil
+		}
+	}
+	return jabra.PairedDevice{}, dbus.NewError(BusName+".Error.NotPaired", []any{fmt.Sprintf("%s is not in the pairing list", address)})
+}
+
+// toDBusError reports SDK failures as org.jlink.Error.ReturnCode with the
+// message and the Jabra_ReturnCode.
+func toDBusError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	var returnCodeError *jabra.ReturnCodeError
+	if errors.As(err, &returnCodeError) {
+		return dbus.NewError(BusName+".Error.ReturnCode", []any{err.Error(), int32(returnCodeError.Code())})
+	}
+	return dbus.MakeFailedError(err)
+}
+
+/****************************************************************************/
+/*                                 METHODS                                  */
+/****************************************************************************/
+
+func (d *device) FactoryReset() *dbus.Error {
+	return toDBusError(d.service.backend.FactoryReset(d.deviceInfo.DeviceID))
+}
+
+func (d *device) ConnectPairedDevice(address string) *dbus.Error {
+	pairedDevice, err := d.pairedDevice(address)
+	if err != nil {
+		return err
+	}
+	return toDBusError(d.service.backend.ConnectPairedDevice(d.deviceInfo.DeviceID, pairedDevice))
+}
+
+func (d *device) DisconnectPairedDevice(address string) *dbus.Error {
+	pairedDevice, err := d.pairedDevice(address)
+	if err != nil {
+		return err
+	}
+	return toDBusError(d.service.backend.DisconnectPairedDevice(d.deviceInfo.DeviceID, pairedDevice))
+}
+
+func (d *device) ClearPairedDevice(address string) *dbus.Error {
+	pairedDevice, err := d.pairedDevice(address)
+	if err != nil {
+		return err
+	}
+	return toDBusError(d.service.backend.ClearPairedDevice(d.deviceInfo.DeviceID, pairedDevice))
+}
+
+func (d *device) ClearPairingList() *dbus.Error {
+	return toDBusError(d.service.backend.ClearPairingList(d.deviceInfo.DeviceID))
+}
@@ -0,0 +1,230 @@
+package bus
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// PowerInterface is the device interface of UPower. Headset objects
+// implement it next to DeviceInterface, and every extra battery (earbuds,
+// cradle, remote control) gets a child object of its own implementing it,
+// e.g. /org/jlink/devices/<serial>/left.
+const PowerInterface = "org.freedesktop.UPower.Device"
+
+// Values of the UPower enums.
+const (
+	upowerKindHeadset uint32 = 17
+
+	upowerStateUnknown      uint32 = 0
+	upowerStateCharging     uint32 = 1
+	upowerStateDischarging  uint32 = 2
+	upowerStateFullyCharged uint32 = 4
+
+	upowerWarningNone uint32 = 1
+	upowerWarningLow  uint32 = 3
+
+	// upowerLevelNone means the battery reports percentages, not coarse levels.
+	upowerLevelNone uint32 = 1
+)
+
+// power is the PowerInterface of a headset or of one of its extra batteries.
+// Its exported methods are the methods of PowerInterface.
+type power struct {
+	device    *device
+	component jabra.BatteryComponent // ComponentUnknown for the headset itself
+	path      dbus.ObjectPath
+	props     *prop.Properties
+}
+
+// powerProperties are the properties of PowerInterface for the battery of
+// deviceInfo, or for its extra battery component.
+func powerProperties(deviceInfo jabra.DeviceInfo, component jabra.BatteryComponent) map[string]*prop.Prop {
+	constant := func(value any) *prop.Prop { return &prop.Prop{Value: value, Emit: prop.EmitConst} }
+	changing := func(value any) *prop.Prop { return &prop.Prop{Value: value, Emit: prop.EmitTrue} }
+
+	model := deviceInfo.DeviceName
+	nativePath := "jlink/" + deviceInfo.SerialNumber
+	if component != jabra.ComponentUnknown {
+		model = fmt.Sprintf("%s (%s)", deviceInfo.DeviceName, component)
+		nativePath += "/" + component.String()
+	}
+
+	properties := map[string]*prop.Prop{
+		"NativePath":     constant(nativePath),
+		"Vendor":         constant("Jabra"),
+		"Model":          constant(model),
+		"Serial":         constant(deviceInfo.SerialNumber),
+		"Type":           constant(upowerKindHeadset),
+		"PowerSupply":    constant(false),
+		"HasHistory":     constant(false),
+		"HasStatistics":  constant(false),
+		"IsRechargeable": constant(true),
+		"Online":         constant(false),
+		"Energy":         constant(0.0),
+		"EnergyEmpty":    constant(0.0),
+		"EnergyFull":     constant(0.0),
+		"EnergyRate":     constant(0.0),
+		"Voltage":        constant(0.0),
+		"TimeToEmpty":    constant(int64(0)),
+		"TimeToFull":     constant(int64(0)),
+		"BatteryLevel":   constant(upowerLevelNone),
+	}
+	for name, value := range powerState(deviceInfo.BatteryStatus, component) {
+		properties[name] = changing(value)
+	}
+	return properties
+}
+
+// powerState are the changing properties of PowerInterface. Extra batteries
+// share the charging state of the headset, the SDK only reports their level.
+func powerState(batteryStatus *jabra.BatteryStatus, component jabra.BatteryComponent) map[string]any {
+	if batteryStatus == nil {
+		return map[string]any{
+			"IsPresent":    false,
+			"Percentage":   0.0,
+			"State":        upowerStateUnknown,
+			"WarningLevel": upowerWarningNone,
+			"IconName":     "battery-missing-symbolic",
+			"UpdateTime":   uint64(time.Now().Unix()),
+		}
+	}
+
+	level, present := batteryStatus.LevelInPercent, true
+	if component != jabra.ComponentUnknown {
+		level, present = batteryStatus.Levels()[component]
+	}
+	state := upowerStateDischarging
+	switch {
+	case batteryStatus.Charging && level == 100:
+		state = upowerStateFullyCharged
+	case batteryStatus.Charging:
+		state = upowerStateCharging
+	}
+	warningLevel := upowerWarningNone
+	if batteryStatus.BatteryLow && component == jabra.ComponentUnknown {
+		warningLevel = upowerWarningLow
+	}
+
+	return map[string]any{
+		"IsPresent":    present,
+		"Percentage":   float64(level),
+		"State":        state,
+		"WarningLevel": warningLevel,
+		"IconName":     batteryIcon(level, state),
+		"UpdateTime":   uint64(time.Now().Unix()),
+	}
+}
+
+// batteryIcon picks the icon like UPower does for batteries with a percentage.
+func batteryIcon(level uint8, state uint32) string {
+	if state == upowerStateFullyCharged {
+		return "battery-full-charged-symbolic"
+	}
+
+	var icon string
+	switch {
+	case level < 10:
+		icon = "battery-caution"
+	case level < 30:
+		icon = "battery-low"
+	case level < 60:
+		icon = "battery-good"
+	default:
+		icon = "battery-full"
+	}
+	if state == upowerStateCharging {
+		icon += "-charging"
+	}
+	return icon + "-symbolic"
+}
+
+// extraBatteries are the components of the extra batteries in batteryStatus,
+// in the order the SDK reports them.
+func extraBatteries(batteryStatus *jabra.BatteryStatus) []jabra.BatteryComponent {
+	if batteryStatus == nil {
+		return nil
+	}
+	components := make([]jabra.BatteryComponent, 0, len(batteryStatus.ExtraUnits))
+	for _, unit := range batteryStatus.ExtraUnits {
+		components = append(components, unit.Component)
+	}
+	return components
+}
+
+// newExtraBattery exports the child object of an extra battery of d.
+func newExtraBattery(d *device, component jabra.BatteryComponent) (*power, error) {
+	p := &power{
+		device:    d,
+		component: component,
+		path:      d.path + "/" + dbus.ObjectPath(invalidPathChars.ReplaceAllString(component.String(), "_")),
+	}
+
+	props, err := prop.Export(d.service.conn, p.path, prop.Map{PowerInterface: powerProperties(d.deviceInfo, component)})
+	if err != nil {
+		return nil, err
+	}
+	p.props = props
+
+	if err := d.service.conn.Export(p, p.path, PowerInterface); err != nil {
+		return nil, err
+	}
+	node := introspect.NewIntrospectable(&introspect.Node{
+		Name: string(p.path),
+		Interfaces: []introspect.Interface{
+			prop.IntrospectData,
+			{
+				Name:       PowerInterface,
+				Methods:    introspect.Methods(p),
+				Properties: props.Introspection(PowerInterface),
+			},
+		},
+	})
+	if err := d.service.conn.Export(node, p.path, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// update sets the changing properties from batteryStatus,
+// PropertiesChanged is emitted for the values that differ.
+func (p *power) update(batteryStatus *jabra.BatteryStatus) {
+	state := powerState(batteryStatus, p.component)
+	updateTime := state["UpdateTime"]
+	delete(state, "UpdateTime")
+
+	changed := false
+	for name, value := range state {
+		if reflect.DeepEqual(p.props.GetMust(PowerInterface, name), value) {
+			continue
+		}
+		p.props.SetMust(PowerInterface, name, value)
+		changed = true
+	}
+	if changed {
+		p.props.SetMust(PowerInterface, "UpdateTime", updateTime)
+	}
+}
+
+/****************************************************************************/
+/*                                 METHODS                                  */
+/****************************************************************************/
+
+// Refresh reads the battery from the headset.
+func (p *power) Refresh() *dbus.Error {
+	batteryStatus, err := p.device.service.backend.BatteryStatus(p.device.deviceInfo.DeviceID)
+	if err != nil {
+		return toDBusError(err)
+	}
+	deviceInfo := p.device.deviceInfo
+	deviceInfo.BatteryStatus = batteryStatus
+	p.device.update(deviceInfo)
+	return nil
+}
@@ -0,0 +1,178 @@
+// Package buttons does what the configuration maps the buttons of a headset
+// to, from the HidInput events of a device registry: runs a shell command
+// or one of the built-in actions on the device.
+package buttons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/Watchdog0x/jLink/internal/config"
+	"github.com/Watchdog0x/jLink/internal/mpris"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+var errNoMedia = errors.New("no session bus for the media players")
+
+// Press is a mapped button pressed on a device.
+type Press struct {
+	Key    registry.Key
+	Device jabra.DeviceInfo
+	Input  jabra.HidInput
+	Button config.Button
+}
+
+func (p Press) String() string {
+	if p.Button.Action != "" {
+		return fmt.Sprintf("%s: %s", p.Input, p.Button.Action)
+	}
+	return fmt.Sprintf("%s: %s", p.Input, p.Button.Command)
+}
+
+// Media is the media player the playPause, next and previous actions
+// control, Call takes the MPRIS method.
+type Media interface {
+	Call(method string) error
+}
+
+// mediaMethods are the MPRIS methods of the media actions.
+var mediaMethods = map[string]string{
+	"playPause": mpris.PlayPause,
+	"next":      mpris.Next,
+	"previous":  mpris.Previous,
+}
+
+// Runner does the presses of the buttons config.Config.Buttons maps.
+type Runner struct {
+	// Media does the media actions, without one they fail. Set it before
+	// Run.
+	Media Media
+
+	buttons map[string]config.Button
+	backend jabra.Backend
+}
+
+// New returns a runner for buttons, backend does the built-in actions.
+func New(buttons map[string]config.Button, backend jabra.Backend) *Runner {
+	return &Runner{buttons: buttons, backend: backend}
+}
+
+// Run does the presses of the events of subscription until ctx is done or
+// the subscription is closed. Commands run in the background, a slow one
+// does not hold back the next press.
+func (r *Runner) Run(ctx context.Context, subscription *registry.Subscription) {
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			press, ok := r.Handle(event)
+			if !ok {
+				continue
+			}
+			if press.Button.Command != "" {
+				go func() {
+					if err := r.Do(ctx, press); err != nil {
+						fmt.Println(err)
+					}
+				}()
+			} else if err := r.Do(ctx, press); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+// Handle returns the press event is, when it presses a mapped button.
+// Releases do nothing.
+func (r *Runner) Handle(event registry.Event) (Press, bool) {
+	if event.Type != registry.HidInput || !event.Value {
+		return Press{}, false
+	}
+	button, ok := r.buttons[event.Input.String()]
+	if !ok {
+		return Press{}, false
+	}
+	return Press{Key: event.Key, Device: event.Device, Input: event.Input, Button: button}, true
+}
+
+// Do runs the command of p until it exits, or does its action. The command
+// finds the input, device name and serial number in $JLINK_INPUT,
+// $JLINK_DEVICE and $JLINK_SERIAL.
+func (r *Runner) Do(ctx context.Context, p Press) error {
+	var err error
+	switch p.Button.Action {
+	case "":
+		cmd := exec.CommandContext(ctx, "sh", "-c", p.Button.Command)
+		cmd.Env = append(os.Environ(),
+			"JLINK_INPUT="+p.Input.String(),
+			"JLINK_DEVICE="+p.Device.DeviceName,
+			"JLINK_SERIAL="+p.Device.SerialNumber,
+		)
+		err = cmd.Run()
+	case "busylight":
+		err = r.toggleBusylight(p.Device.DeviceID)
+	case "ambience":
+		err = r.nextAmbience(p.Device.DeviceID)
+	case "equalizer":
+		err = r.toggleEqualizer(p.Device.DeviceID)
+	case "playPause", "next", "previous":
+		err = errNoMedia
+		if r.Media != nil {
+			err = r.Media.Call(mediaMethods[p.Button.Action])
+		}
+	default:
+		err = fmt.Errorf("unknown action %q", p.Button.Action)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", p.Device.DeviceName, p, err)
+	}
+	return nil
+}
+
+func (r *Runner) toggleBusylight(deviceID uint16) error {
+	on, err := r.backend.Busylight(deviceID)
+	if err != nil {
+		return err
+	}
+	return r.backend.SetBusylight(deviceID, !on)
+}
+
+// nextAmbience steps to the mode after the current one in the loop of the
+// device's ambience button, or in all its modes when it has no loop.
+func (r *Runner) nextAmbience(deviceID uint16) error {
+	modes, err := r.backend.AmbienceLoop(deviceID)
+	if err != nil || len(modes) == 0 {
+		if modes, err = r.backend.AmbienceModes(deviceID); err != nil {
+			return err
+		}
+	}
+	if len(modes) == 0 {
+		return jabra.ErrNotSupported
+	}
+	current, err := r.backend.AmbienceMode(deviceID)
+	if err != nil {
+		return err
+	}
+	// A mode outside the loop steps to its first one.
+	next := modes[(slices.Index(modes, current)+1)%len(modes)]
+	return r.backend.SetAmbienceMode(deviceID, next)
+}
+
+func (r *Runner) toggleEqualizer(deviceID uint16) error {
+	enabled, err := r.backend.EqualizerEnabled(deviceID)
+	if err != nil {
+		return err
+	}
+	return r.backend.EnableEqualizer(deviceID, !enabled)
+}
@@ -0,0 +1,210 @@
+package buttons
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/Watchdog0x/jLink/internal/bustest"
+	"github.com/Watchdog0x/jLink/internal/config"
+	"github.com/Watchdog0x/jLink/internal/mpris"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+func headset() jabra.DeviceInfo {
+	return jabra.DeviceInfo{DeviceID: 1, DeviceName: "Jabra Evolve2 85", SerialNumber: "HEADSET"}
+}
+
+func TestHandle(t *testing.T) {
+	r := New(map[string]config.Button{"mute": {Command: "true"}}, nil)
+
+	for _, step := range []struct {
+		event registry.Event
+		want  bool
+	}{
+		{registry.Event{Type: registry.HidInput, Input: jabra.HidMute, Value: true}, true},
+		{registry.Event{Type: registry.HidInput, Input: jabra.HidMute}, false}, // the release
+		{registry.Event{Type: registry.HidInput, Input: jabra.HidFlash, Value: true}, false},
+		{registry.Event{Type: registry.BusylightChanged, Busylight: true}, false},
+	} {
+		press, ok := r.Handle(step.event)
+		if ok != step.want || (ok && press.Button.Command != "true") {
+			t.Errorf("%v %s %t: %+v, %t", step.event.Type, step.event.Input, step.event.Value, press, ok)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	r := New(nil, nil)
+	press := Press{Device: headset(), Input: jabra.HidButton2, Button: config.Button{Command: `echo "$JLINK_INPUT $JLINK_DEVICE $JLINK_SERIAL" > ` + out}}
+	if err := r.Do(context.Background(), press); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "button2 Jabra Evolve2 85 HEADSET\n" {
+		t.Errorf("command saw %q", data)
+	}
+
+	press.Button.Command = "exit 3"
+	if err := r.Do(context.Background(), press); err == nil || err.Error() != "Jabra Evolve2 85: button2: exit 3: exit status 3" {
+		t.Errorf("failing command: %v", err)
+	}
+}
+
+func TestActions(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    features: [busyLight, musicEqualizer, ambienceModes]
+    ambience: {mode: anc, loop: [anc, hearThrough]}
+    busylight: {}
+    equalizer: {}
+    telephony: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	devices := registry.New(backend)
+	subscription := devices.Subscribe()
+	if err := devices.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer devices.Stop()
+	<-devices.Scanned()
+
+	r := New(map[string]config.Button{
+		"button1": {Action: "busylight"},
+		"button2": {Action: "ambience"},
+		"button3": {Action: "equalizer"},
+	}, backend)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, subscription)
+
+	backend.PressButton(1, jabra.HidButton1)
+	backend.PressButton(1, jabra.HidButton2)
+	backend.PressButton(1, jabra.HidButton3)
+	for range 100 {
+		busylight, _ := backend.Busylight(1)
+		mode, _ := backend.AmbienceMode(1)
+		equalizer, _ := backend.EqualizerEnabled(1)
+		if busylight && mode == jabra.AmbienceHearThrough && equalizer {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	busylight, _ := backend.Busylight(1)
+	mode, _ := backend.AmbienceMode(1)
+	equalizer, _ := backend.EqualizerEnabled(1)
+	t.Errorf("busylight %t, ambience %s, equalizer %t, want on, hearThrough, on", busylight, mode, equalizer)
+}
+
+type media []string
+
+func (m *media) Call(method string) error {
+	*m = append(*m, method)
+	return nil
+}
+
+func TestMedia(t *testing.T) {
+	r := New(nil, nil)
+	press := Press{Device: headset(), Input: jabra.HidFlash, Button: config.Button{Action: "playPause"}}
+	if err := r.Do(context.Background(), press); !errors.Is(err, errNoMedia) {
+		t.Errorf("without a session bus: %v", err)
+	}
+
+	var called media
+	r.Media = &called
+	for _, action := range []string{"playPause", "next", "previous"} {
+		press.Button.Action = action
+		if err := r.Do(context.Background(), press); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(called, []string{"PlayPause", "Next", "Previous"}) {
+		t.Errorf("called %v", called)
+	}
+}
+
+// player is a mock MPRIS player that records the methods called.
+type player struct {
+	calls chan string
+}
+
+func (p *player) PlayPause() *dbus.Error {
+	p.calls <- mpris.PlayPause
+	return nil
+}
+
+func TestMPRIS(t *testing.T) {
+	address := bustest.PrivateBus(t)
+	spotify := &player{calls: make(chan string, 10)}
+	conn := bustest.Connect(t, address)
+	if err := conn.Export(spotify, mpris.Path, mpris.PlayerInterface); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.RequestName("org.mpris.MediaPlayer2.spotify", dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    telephony: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	devices := registry.New(backend)
+	subscription := devices.Subscribe()
+	if err := devices.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer devices.Stop()
+	<-devices.Scanned()
+
+	// The default mapping plays and pauses the music with the headset.
+	r := New(config.Default().Buttons, backend)
+	r.Media = mpris.New(bustest.Connect(t, address))
+	backend.PressButton(1, jabra.HidFlash)
+	timeout := time.After(5 * time.Second)
+	for pressed := false; !pressed; {
+		select {
+		case event := <-subscription.C:
+			press, ok := r.Handle(event)
+			if !ok {
+				continue
+			}
+			if err := r.Do(context.Background(), press); err != nil {
+				t.Fatal(err)
+			}
+			pressed = true
+		case <-timeout:
+			t.Fatal("flash was not pressed")
+		}
+	}
+	select {
+	case method := <-spotify.calls:
+		if method != mpris.PlayPause {
+			t.Errorf("player called with %s, want %s", method, mpris.PlayPause)
+		}
+	default:
+		t.Error("the player was not called")
+	}
+}
@@ -0,0 +1,235 @@
+package callcontrol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Watchdog0x/jLink/internal/unixsock"
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// Change is a change of the call, Button is set when a button of the device
+// asked for it, and not a softphone.
+type Change struct {
+	Event  string
+	State  State
+	Button bool
+}
+
+// Bridge serves a Machine to softphones on a Unix socket, one line per
+// message:
+//
+//   - a softphone sends an event (incoming, outgoing, answer, reject, end,
+//     mute, unmute, hold or resume) or state, and is answered with
+//     "state <state>" or "error: <message>"
+//   - every other softphone is sent "state <state>" when the call changes
+//   - a button of the device is sent to every softphone as "event <event>",
+//     followed by "state <state>"
+type Bridge struct {
+	machine *Machine
+	changes chan<- Change
+
+	mu      sync.Mutex
+	clients map[*client]bool
+}
+
+// outgoingBuffer is how many lines may wait for a slow softphone before the
+// bridge gives up on it.
+const outgoingBuffer = 64
+
+// NewBridge serves machine, every change is sent on changes if it has room.
+func NewBridge(machine *Machine, changes chan<- Change) *Bridge {
+	return &Bridge{machine: machine, changes: changes, clients: make(map[*client]bool)}
+}
+
+// DefaultSocket is $XDG_RUNTIME_DIR/jlink-call.sock, or a per-user path in
+// the temp dir.
+func DefaultSocket() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "jlink-call.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("jlink-call-%d.sock", os.Getuid()))
+}
+
+// Listen creates the Unix socket at path, readable only by the current user.
+// A socket left behind by a bridge that is no longer running is replaced.
+func Listen(path string) (net.Listener, error) {
+	listener, err := unixsock.Listen(path)
+	if errors.Is(err, unixsock.ErrInUse) {
+		return nil, fmt.Errorf("a call bridge is already running on %s", path)
+	}
+	return listener, err
+}
+
+// Serve accepts softphones on listener until ctx is done.
+func (b *Bridge) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		b.mu.Lock()
+		for c := range b.clients {
+			c.close()
+		}
+		b.mu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		c := newClient(conn)
+		b.mu.Lock()
+		b.clients[c] = true
+		b.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.handle(c)
+		}()
+	}
+}
+
+func (b *Bridge) handle(c *client) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		c.close()
+	}()
+
+	scanner := bufio.NewScanner(c.netConn)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if line == "state" {
+			c.respond(fmt.Sprintf("state %s", b.machine.State()))
+			continue
+		}
+
+		from, state, err := b.machine.Do(line)
+		if err != nil {
+			c.respond(fmt.Sprintf("error: %s", err))
+		}
+		if state == from {
+			if err == nil {
+				c.respond(fmt.Sprintf("state %s", state))
+			}
+			continue
+		}
+		b.changed(Change{Event: line, State: state})
+		b.broadcast(fmt.Sprintf("state %s", state))
+	}
+}
+
+// Input hands a button of the device to the machine, and the event it asks
+// for to the softphones.
+func (b *Bridge) Input(input jabra.HidInput, value bool) error {
+	event, state, err := b.machine.Input(input, value)
+	if event == "" {
+		return err
+	}
+	b.changed(Change{Event: event, State: state, Button: true})
+	b.broadcast(fmt.Sprintf("event %s", event), fmt.Sprintf("state %s", state))
+	return err
+}
+
+// broadcast queues lines for every softphone.
+func (b *Bridge) broadcast(lines ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		c.notify(lines...)
+	}
+}
+
+func (b *Bridge) changed(change Change) {
+	select {
+	case b.changes <- change:
+	default:
+	}
+}
+
+/****************************************************************************/
+/*                                SOFTPHONES                                */
+/****************************************************************************/
+
+// client is one softphone. Its lines are queued and written by a single
+// goroutine, so a softphone that stops reading holds back neither the
+// others nor the buttons.
+type client struct {
+	netConn  net.Conn
+	outgoing chan string
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newClient(netConn net.Conn) *client {
+	c := &client{
+		netConn:  netConn,
+		outgoing: make(chan string, outgoingBuffer),
+		done:     make(chan struct{}),
+	}
+	go c.write()
+	return c
+}
+
+func (c *client) write() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case line := <-c.outgoing:
+			if _, err := fmt.Fprintln(c.netConn, line); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.netConn.Close()
+	})
+}
+
+// respond queues the answer to a line of the softphone.
+func (c *client) respond(line string) {
+	select {
+	case c.outgoing <- line:
+	case <-c.done:
+	}
+}
+
+// notify queues lines, dropping the softphone if it stopped reading.
+func (c *client) notify(lines ...string) {
+	for _, line := range lines {
+		select {
+		case c.outgoing <- line:
+		case <-c.done:
+			return
+		default:
+			c.close()
+			return
+		}
+	}
+}
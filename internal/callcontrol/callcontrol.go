@@ -0,0 +1,228 @@
+// Package callcontrol keeps the state of a call for softphones without Jabra
+// support: the softphone tells it about the call, it shows the call on the
+// headset with the HID telephony methods, and it turns the buttons of the
+// headset into answer, reject, mute and hold events for the softphone.
+package callcontrol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// State is the state of the call.
+type State int
+
+const (
+	Idle State = iota
+	Ringing
+	Active
+	Muted
+	Held
+)
+
+func (s State) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case Ringing:
+		return "ringing"
+	case Active:
+		return "active"
+	case Muted:
+		return "muted"
+	case Held:
+		return "held"
+	default:
+		return "unknown"
+	}
+}
+
+// Events move the call from one state to another. The softphone sends them
+// for what happens in it, the headset's buttons ask for answer, reject,
+// end, mute, unmute, hold and resume.
+const (
+	Incoming = "incoming"
+	Outgoing = "outgoing"
+	Answer   = "answer"
+	Reject   = "reject"
+	End      = "end"
+	Mute     = "mute"
+	Unmute   = "unmute"
+	Hold     = "hold"
+	Resume   = "resume"
+)
+
+// transitions holds the state each event leads to from the states it is
+// allowed in.
+var transitions = map[string]map[State]State{
+	Incoming: {Idle: Ringing},
+	Outgoing: {Idle: Active},
+	Answer:   {Ringing: Active},
+	Reject:   {Ringing: Idle},
+	End:      {Ringing: Idle, Active: Idle, Muted: Idle, Held: Idle},
+	Mute:     {Active: Muted},
+	Unmute:   {Muted: Active},
+	Hold:     {Active: Held, Muted: Held},
+	Resume:   {Held: Active},
+}
+
+var ErrTransition = errors.New("not possible now")
+
+// shown is how the device shows each state.
+type shown struct {
+	online, ringer, offHook, mute, hold bool
+}
+
+var states = map[State]shown{
+	Idle:    {},
+	Ringing: {online: true, ringer: true},
+	Active:  {online: true, offHook: true},
+	Muted:   {online: true, offHook: true, mute: true},
+	Held:    {online: true, offHook: true, hold: true},
+}
+
+// Telephony is the part of jabra.Backend that shows the call.
+type Telephony interface {
+	SetOffHook(deviceID uint16, offHook bool) error
+	SetRinger(deviceID uint16, ringing bool) error
+	SetMute(deviceID uint16, mute bool) error
+	SetHold(deviceID uint16, hold bool) error
+	SetOnline(deviceID uint16, online bool) error
+}
+
+// Machine is the state of the call and the device showing it. It is safe
+// for concurrent use.
+type Machine struct {
+	telephony Telephony
+
+	mu       sync.Mutex
+	state    State
+	deviceID uint16
+	attached bool
+}
+
+// New returns an idle machine without a device.
+func New(telephony Telephony) *Machine {
+	return &Machine{telephony: telephony}
+}
+
+func (m *Machine) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state
+}
+
+// Attach makes deviceID show the call, from now on and as it is now. The
+// caller holds its call lock.
+func (m *Machine) Attach(deviceID uint16) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deviceID, m.attached = deviceID, true
+	return m.show(shown{}, states[m.state])
+}
+
+// Detach leaves the call without a device, the state is kept.
+func (m *Machine) Detach() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attached = false
+}
+
+// Do moves the call on by event and returns the state it was in and the one
+// it is in now. Events not allowed in the current state return
+// ErrTransition. The state changes even when the device could not show it,
+// the error is returned then.
+func (m *Machine) Do(event string) (from, to State, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from = m.state
+	to, err = m.do(event)
+	return from, to, err
+}
+
+// Input turns a button of the device into the event it asks for in the
+// current state and does it. Inputs meaning nothing now return no event.
+func (m *Machine) Input(input jabra.HidInput, value bool) (string, State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event := eventOf(m.state, input, value)
+	if event == "" {
+		return "", m.state, nil
+	}
+	state, err := m.do(event)
+	return event, state, err
+}
+
+func eventOf(state State, input jabra.HidInput, value bool) string {
+	inCall := state == Active || state == Muted || state == Held
+	switch {
+	case input == jabra.HidOffHook && value && state == Ringing:
+		return Answer
+	case input == jabra.HidOffHook && !value && inCall:
+		return End
+	case input == jabra.HidRejectCall && value && state == Ringing:
+		return Reject
+	case input == jabra.HidMute && value && state == Active:
+		return Mute
+	case input == jabra.HidMute && value && state == Muted:
+		return Unmute
+	case input == jabra.HidFlash && value && (state == Active || state == Muted):
+		return Hold
+	case input == jabra.HidFlash && value && state == Held:
+		return Resume
+	default:
+		return ""
+	}
+}
+
+// do is Do for callers holding m.mu.
+func (m *Machine) do(event string) (State, error) {
+	next, ok := transitions[event][m.state]
+	if !ok {
+		if _, known := transitions[event]; !known {
+			return m.state, fmt.Errorf("unknown event %q", event)
+		}
+		return m.state, fmt.Errorf("%s while %s: %w", event, m.state, ErrTransition)
+	}
+	from := m.state
+	m.state = next
+	if !m.attached {
+		return next, nil
+	}
+	return next, m.show(states[from], states[next])
+}
+
+// show sets what differs between from and to on the device, the link is
+// opened first and closed last. Devices without one of the functions show
+// the call without it.
+func (m *Machine) show(from, to shown) error {
+	id := m.deviceID
+	var errs []error
+	set := func(set func(uint16, bool) error, was, is bool) {
+		if was == is {
+			return
+		}
+		if err := set(id, is); err != nil && !errors.Is(err, jabra.ErrNotSupported) {
+			errs = append(errs, err)
+		}
+	}
+	if to.online {
+		set(m.telephony.SetOnline, from.online, true)
+	}
+	set(m.telephony.SetRinger, from.ringer, to.ringer)
+	set(m.telephony.SetOffHook, from.offHook, to.offHook)
+	set(m.telephony.SetMute, from.mute, to.mute)
+	set(m.telephony.SetHold, from.hold, to.hold)
+	if !to.online {
+		set(m.telephony.SetOnline, from.online, false)
+	}
+	return errors.Join(errs...)
+}
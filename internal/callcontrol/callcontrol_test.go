@@ -0,0 +1,229 @@
+package callcontrol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+// headset returns a fake with a telephony headset, its call lock taken.
+func headset(t *testing.T) *fake.Backend {
+	t.Helper()
+
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    connection: usb
+    telephony: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	scanned := make(chan struct{})
+	if err := backend.Initialize("test", jabra.Callbacks{FirstScanDone: func() { close(scanned) }}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { backend.Uninitialize() })
+	<-scanned
+	if err := backend.AcquireCallLock(1); err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestMachine(t *testing.T) {
+	backend := headset(t)
+	machine := New(backend)
+	if err := machine.Attach(1); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := Idle
+	for _, step := range []struct {
+		event string
+		want  State
+		call  fake.TelephonyState
+	}{
+		{Incoming, Ringing, fake.TelephonyState{Online: true, Ringer: true}},
+		{Answer, Active, fake.TelephonyState{Online: true, OffHook: true}},
+		{Mute, Muted, fake.TelephonyState{Online: true, OffHook: true, Mute: true}},
+		{Hold, Held, fake.TelephonyState{Online: true, OffHook: true, Hold: true}},
+		{Resume, Active, fake.TelephonyState{Online: true, OffHook: true}},
+		{End, Idle, fake.TelephonyState{}},
+	} {
+		from, state, err := machine.Do(step.event)
+		if err != nil || from != previous || state != step.want {
+			t.Fatalf("%s: %s to %s, %v, want %s to %s", step.event, from, state, err, previous, step.want)
+		}
+		previous = state
+		step.call.Locked = true
+		if call, _ := backend.Telephony(1); call != step.call {
+			t.Errorf("%s: device shows %+v, want %+v", step.event, call, step.call)
+		}
+	}
+
+	if _, _, err := machine.Do(Answer); !errors.Is(err, ErrTransition) {
+		t.Errorf("answer while idle: %v", err)
+	}
+	if _, _, err := machine.Do("dance"); err == nil || errors.Is(err, ErrTransition) {
+		t.Errorf("unknown event: %v", err)
+	}
+}
+
+func TestMachineInput(t *testing.T) {
+	backend := headset(t)
+	machine := New(backend)
+	if err := machine.Attach(1); err != nil {
+		t.Fatal(err)
+	}
+
+	machine.Do(Incoming)
+	for _, step := range []struct {
+		input jabra.HidInput
+		value bool
+		event string
+		want  State
+	}{
+		{jabra.HidMute, true, "", Ringing},
+		{jabra.HidOffHook, true, Answer, Active},
+		{jabra.HidMute, true, Mute, Muted},
+		{jabra.HidMute, false, "", Muted}, // the release
+		{jabra.HidMute, true, Unmute, Active},
+		{jabra.HidFlash, true, Hold, Held},
+		{jabra.HidFlash, true, Resume, Active},
+		{jabra.HidOffHook, false, End, Idle},
+		{jabra.HidRejectCall, true, "", Idle},
+	} {
+		event, state, err := machine.Input(step.input, step.value)
+		if err != nil || event != step.event || state != step.want {
+			t.Errorf("%s %t: %q, %s, %v, want %q, %s", step.input, step.value, event, state, err, step.event, step.want)
+		}
+	}
+
+	machine.Do(Incoming)
+	if event, state, _ := machine.Input(jabra.HidRejectCall, true); event != Reject || state != Idle {
+		t.Errorf("reject: %q, %s", event, state)
+	}
+
+	// A device that attaches during a call shows it.
+	machine.Do(Outgoing)
+	machine.Detach()
+	backend.Detach(1)
+	backend.Attach(1)
+	backend.AcquireCallLock(1)
+	if err := machine.Attach(1); err != nil {
+		t.Fatal(err)
+	}
+	if call, _ := backend.Telephony(1); !call.OffHook || !call.Online {
+		t.Errorf("reattached device shows %+v", call)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	backend := headset(t)
+	machine := New(backend)
+	machine.Attach(1)
+	changes := make(chan Change, 10)
+	bridge := NewBridge(machine, changes)
+
+	path := filepath.Join(t.TempDir(), "call.sock")
+	listener, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- bridge.Serve(ctx, listener) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	dial := func() (net.Conn, *bufio.Scanner) {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn, bufio.NewScanner(conn)
+	}
+	expect := func(lines *bufio.Scanner, want ...string) {
+		t.Helper()
+		for _, want := range want {
+			if !lines.Scan() || lines.Text() != want {
+				t.Fatalf("got %q, want %q", lines.Text(), want)
+			}
+		}
+	}
+	softphone, replies := dial()
+	other, otherReplies := dial()
+	// Both are served once they are answered.
+	fmt.Fprintln(softphone, "state")
+	expect(replies, "state idle")
+	fmt.Fprintln(other, "state")
+	expect(otherReplies, "state idle")
+
+	fmt.Fprintln(softphone, "incoming")
+	expect(replies, "state ringing")
+	expect(otherReplies, "state ringing")
+	fmt.Fprintln(softphone, "hold")
+	expect(replies, "error: hold while ringing: not possible now")
+
+	// The headset's button answers.
+	if err := bridge.Input(jabra.HidOffHook, true); err != nil {
+		t.Fatal(err)
+	}
+	expect(replies, "event answer", "state active")
+	expect(otherReplies, "event answer", "state active")
+	fmt.Fprintln(other, "STATE")
+	expect(otherReplies, "state active")
+
+	for _, want := range []Change{{Incoming, Ringing, false}, {Answer, Active, true}} {
+		select {
+		case change := <-changes:
+			if change != want {
+				t.Errorf("change %+v, want %+v", change, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change")
+		}
+	}
+
+	if _, err := Listen(path); err == nil {
+		t.Error("second bridge on the same socket")
+	}
+}
+
+func TestSlowSoftphone(t *testing.T) {
+	// A pipe takes nothing until it is read, like a softphone that hangs.
+	conn, softphone := net.Pipe()
+	defer softphone.Close()
+	c := newClient(conn)
+
+	done := make(chan struct{})
+	go func() {
+		for range outgoingBuffer + 2 {
+			c.notify("state ringing")
+		}
+		close(done)
+	}()
+	for _, ch := range []chan struct{}{done, c.done} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("a softphone that does not read held up the bridge")
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var ancMode string
+
+func init() {
+	register(&command{
+		name:      "anc get",
+		args:      "[serial]",
+		help:      "Print the ambience mode, levels, balance and button loop of a headset, the only one by default",
+		run:       runANCGet,
+		flags:     outputFlags,
+		textWatch: true,
+	})
+	register(&command{
+		name: "anc set",
+		args: "<mode> [serial]",
+		help: "Change the ambience mode of a headset to off, hearThrough or anc",
+		run:  runANCSet,
+	})
+	register(&command{
+		name:  "anc level",
+		args:  "<level> [serial]",
+		help:  "Change the level of an ambience mode, 0 is the strongest",
+		run:   runANCLevel,
+		flags: ancModeFlags,
+	})
+	register(&command{
+		name:  "anc balance",
+		args:  "<balance> [serial]",
+		help:  "Change the left-right balance of an ambience mode, negative is left (after --)",
+		run:   runANCBalance,
+		flags: ancModeFlags,
+	})
+	register(&command{
+		name: "anc loop",
+		args: "<mode,...|none> [serial]",
+		help: "Change the modes the button of a headset steps through, in order",
+		run:  runANCLoop,
+	})
+}
+
+func ancModeFlags(fs *flag.FlagSet) {
+	fs.StringVar(&ancMode, "mode", "", "the ambience mode to change, the current one by default")
+}
+
+// ancHeadset returns the headset of args[from:], which must have ambience
+// modes.
+func (s *session) ancHeadset(args []string, from int) (jabra.DeviceInfo, error) {
+	if len(args) < from || len(args) > from+1 {
+		if from == 0 {
+			return jabra.DeviceInfo{}, usageError("expected at most a serial number")
+		}
+		return jabra.DeviceInfo{}, usageError("expected a value and optionally a serial number")
+	}
+	device, err := s.headset(strings.Join(args[from:], ""))
+	if err != nil {
+		return jabra.DeviceInfo{}, err
+	}
+	if device.FeatureFlags == nil || !device.FeatureFlags.AmbienceModes {
+		return jabra.DeviceInfo{}, fmt.Errorf("%s: %w", device.DeviceName, jabra.ErrNotSupported)
+	}
+	return device, nil
+}
+
+// ancModeOf returns the mode given with --mode, or the current one.
+func (s *session) ancModeOf(device jabra.DeviceInfo) (jabra.AmbienceMode, error) {
+	if ancMode != "" {
+		mode, err := jabra.ParseAmbienceMode(ancMode)
+		if err != nil {
+			return 0, usageError("%s", err)
+		}
+		return mode, nil
+	}
+	mode, err := s.backend.AmbienceMode(device.DeviceID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return mode, nil
+}
+
+// ambience reads the ambience state of device.
+func (s *session) ambience(device jabra.DeviceInfo) (schema.Ambience, error) {
+	id := device.DeviceID
+	document := schema.Ambience{SchemaVersion: schema.Version, Time: now(), Device: schema.NewDeviceRef(device)}
+	mode, err := s.backend.AmbienceMode(id)
+	if err != nil {
+		return document, fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	modes, err := s.backend.AmbienceModes(id)
+	if err != nil {
+		return document, fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	document.Mode = mode.String()
+
+	// Modes without levels or balance fail to read them.
+	ptr := func(v int) *int { return &v }
+	for _, mode := range modes {
+		state := schema.AmbienceModeState{Mode: mode.String()}
+		maxLevel, err := s.backend.AmbienceLevels(id, mode)
+		if level, levelErr := s.backend.AmbienceLevel(id, mode); err == nil && levelErr == nil {
+			state.Level, state.MaxLevel = ptr(int(level)), ptr(int(maxLevel))
+		}
+		maxBalance, err := s.backend.AmbienceBalanceRange(id, mode)
+		if balance, balanceErr := s.backend.AmbienceBalance(id, mode); err == nil && balanceErr == nil && maxBalance > 0 {
+			state.Balance, state.MaxBalance = ptr(int(balance)), ptr(int(maxBalance))
+		}
+		document.Modes = append(document.Modes, state)
+	}
+
+	if device.FeatureFlags.AmbienceModesLoop {
+		loop, err := s.backend.AmbienceLoop(id)
+		if err != nil {
+			return document, fmt.Errorf("%s: %w", device.DeviceName, err)
+		}
+		document.Loop = make([]string, 0, len(loop))
+		for _, mode := range loop {
+			document.Loop = append(document.Loop, mode.String())
+		}
+	}
+	return document, nil
+}
+
+func (s *session) printAmbience(document schema.Ambience) {
+	fmt.Fprintf(s.stdout, "%s (%s): %s\n", document.Device.Name, document.Device.Serial, document.Mode)
+	w := tabwriter.NewWriter(s.stdout, 0, 0, 2, ' ', 0)
+	for _, state := range document.Modes {
+		fmt.Fprintf(w, "  %s", state.Mode)
+		if state.Level != nil {
+			fmt.Fprintf(w, "\tlevel %d (0-%d)", *state.Level, *state.MaxLevel)
+		}
+		if state.Balance != nil {
+			fmt.Fprintf(w, "\tbalance %d (-%d to %d)", *state.Balance, *state.MaxBalance, *state.MaxBalance)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	if document.Loop != nil {
+		loop := strings.Join(document.Loop, ", ")
+		if loop == "" {
+			loop = "none"
+		}
+		fmt.Fprintf(s.stdout, "  Button loop: %s\n", loop)
+	}
+}
+
+func runANCGet(s *session, args []string) error {
+	device, err := s.ancHeadset(args, 0)
+	if err != nil {
+		return err
+	}
+	if watchMode {
+		return s.ambienceWatch(device)
+	}
+	document, err := s.ambience(device)
+	if err != nil {
+		return err
+	}
+	return s.emit(document, func() { s.printAmbience(document) })
+}
+
+// ambienceWatch prints the ambience state of device every time it attaches,
+// the first scan included, and every time it reports a change, until the
+// session context is done.
+func (s *session) ambienceWatch(device jabra.DeviceInfo) error {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case attached := <-s.attached:
+			if attached.SerialNumber != device.SerialNumber {
+				continue
+			}
+			device = attached
+			// Listening ends when the device detaches.
+			if err := s.backend.ListenAmbience(device.DeviceID, true); err != nil {
+				continue
+			}
+		case changed := <-s.ambienceChanged:
+			if changed.deviceID != device.DeviceID {
+				continue
+			}
+		}
+
+		document, err := s.ambience(device)
+		if err != nil {
+			continue // detached, printed again when it is back
+		}
+		if err := s.emit(document, func() {
+			fmt.Fprintf(s.stdout, "%s ", document.Time.Format(time.TimeOnly))
+			s.printAmbience(document)
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func runANCSet(s *session, args []string) error {
+	device, err := s.ancHeadset(args, 1)
+	if err != nil {
+		return err
+	}
+	mode, err := jabra.ParseAmbienceMode(args[0])
+	if err != nil {
+		return usageError("%s", err)
+	}
+	if err := s.backend.SetAmbienceMode(device.DeviceID, mode); err != nil {
+		if errors.Is(err, jabra.ErrReturnParameterFail) {
+			return fmt.Errorf("%s has no ambience mode %s", device.DeviceName, mode)
+		}
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return nil
+}
+
+func runANCLevel(s *session, args []string) error {
+	device, err := s.ancHeadset(args, 1)
+	if err != nil {
+		return err
+	}
+	level, err := strconv.ParseUint(args[0], 10, 8)
+	if err != nil {
+		return usageError("level %q is not a number from 0 up", args[0])
+	}
+	mode, err := s.ancModeOf(device)
+	if err != nil {
+		return err
+	}
+	maxLevel, err := s.backend.AmbienceLevels(device.DeviceID, mode)
+	if errors.Is(err, jabra.ErrReturnParameterFail) {
+		return fmt.Errorf("%s has no levels for %s", device.DeviceName, mode)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	if uint8(level) > maxLevel {
+		return usageError("%s of %s takes levels 0 to %d", mode, device.DeviceName, maxLevel)
+	}
+	if err := s.backend.SetAmbienceLevel(device.DeviceID, mode, uint8(level)); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return nil
+}
+
+func runANCBalance(s *session, args []string) error {
+	device, err := s.ancHeadset(args, 1)
+	if err != nil {
+		return err
+	}
+	balance, err := strconv.ParseInt(args[0], 10, 8)
+	if err != nil {
+		return usageError("balance %q is not a number", args[0])
+	}
+	mode, err := s.ancModeOf(device)
+	if err != nil {
+		return err
+	}
+	maxBalance, err := s.backend.AmbienceBalanceRange(device.DeviceID, mode)
+	if errors.Is(err, jabra.ErrReturnParameterFail) || (err == nil && maxBalance == 0) {
+		return fmt.Errorf("%s has no balance for %s", device.DeviceName, mode)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	if balance > int64(maxBalance) || balance < -int64(maxBalance) {
+		return usageError("%s of %s takes a balance from -%d to %d", mode, device.DeviceName, maxBalance, maxBalance)
+	}
+	if err := s.backend.SetAmbienceBalance(device.DeviceID, mode, int8(balance)); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return nil
+}
+
+func runANCLoop(s *session, args []string) error {
+	device, err := s.ancHeadset(args, 1)
+	if err != nil {
+		return err
+	}
+	var loop []jabra.AmbienceMode
+	if args[0] != "none" {
+		for _, name := range strings.Split(args[0], ",") {
+			mode, err := jabra.ParseAmbienceMode(strings.TrimSpace(name))
+			if err != nil {
+				return usageError("%s", err)
+			}
+			loop = append(loop, mode)
+		}
+	}
+	if !device.FeatureFlags.AmbienceModesLoop {
+		return fmt.Errorf("%s: the button loop: %w", device.DeviceName, jabra.ErrNotSupported)
+	}
+	if err := s.backend.SetAmbienceLoop(device.DeviceID, loop); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return nil
+}
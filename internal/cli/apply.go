@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/desired"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var (
+	configPath  string
+	driftPolicy string
+)
+
+func init() {
+	register(&command{
+		name:  "plan",
+		args:  "[serial]",
+		help:  "Show what apply would change to bring the devices to the state of jlink.yaml",
+		run:   runPlan,
+		flags: flagSets(configFlags, outputFlags),
+	})
+	register(&command{
+		name:      "apply",
+		args:      "[serial]",
+		help:      "Bring the devices to the state of jlink.yaml, with --watch every time one attaches",
+		run:       runApply,
+		flags:     flagSets(configFlags, driftFlags, outputFlags),
+		textWatch: true,
+	})
+}
+
+func configFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configPath, "config", "jlink.yaml", "the desired state of the devices")
+}
+
+func driftFlags(fs *flag.FlagSet) {
+	fs.StringVar(&driftPolicy, "drift", "", "with --watch, report or revert a device that drifted, overrides jlink.yaml")
+}
+
+// plans works out the plan of every device selected by args that jlink.yaml
+// has a product for.
+func (s *session) plans(config *desired.Config, args []string) ([]*desired.DevicePlan, error) {
+	if len(args) > 1 {
+		return nil, usageError("expected at most a serial number")
+	}
+
+	devices := s.list()
+	if len(args) == 1 {
+		device, err := s.bySerial(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := config.Product(device.ProductID); !ok {
+			return nil, fmt.Errorf("%w: %s has no product %04x", errNoDevice, configPath, device.ProductID)
+		}
+		devices = []jabra.DeviceInfo{device}
+	}
+
+	var plans []*desired.DevicePlan
+	for _, device := range devices {
+		product, ok := config.Product(device.ProductID)
+		if !ok {
+			continue
+		}
+		plan, err := desired.Plan(s.backend, device, product)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", device.DeviceName, err)
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("%w: none of the attached devices is a product of %s", errNoDevice, configPath)
+	}
+	return plans, nil
+}
+
+func devicePlan(plan *desired.DevicePlan) schema.DevicePlan {
+	document := schema.DevicePlan{
+		Device:  schema.NewDeviceRef(plan.Device),
+		Changes: make([]schema.StateChange, 0, len(plan.Changes)),
+		Invalid: invalidSettings(plan.Invalid),
+	}
+	for _, change := range plan.Changes {
+		entry := schema.StateChange{Property: change.Property, Name: change.Name, From: change.From, To: change.To}
+		if change.Err != nil {
+			entry.Error = change.Err.Error()
+		}
+		document.Changes = append(document.Changes, entry)
+	}
+	return document
+}
+
+// printPlan writes a device plan as text, verb says what happened to the
+// changes.
+func (s *session) printPlan(plan schema.DevicePlan, verb string) {
+	if len(plan.Changes) == 0 && len(plan.Invalid) == 0 {
+		fmt.Fprintf(s.stdout, "%s (%s) is in the desired state\n", plan.Device.Name, plan.Device.Serial)
+		return
+	}
+	fmt.Fprintf(s.stdout, "%s (%s)\n", plan.Device.Name, plan.Device.Serial)
+	for _, change := range plan.Changes {
+		if change.Error != "" {
+			fmt.Fprintf(s.stdout, "  Failed %s: %s -> %s: %s\n", change.Name, change.From, change.To, change.Error)
+		} else {
+			fmt.Fprintf(s.stdout, "  %s %s: %s -> %s\n", verb, change.Name, change.From, change.To)
+		}
+	}
+	for _, invalid := range plan.Invalid {
+		fmt.Fprintf(s.stdout, "  Not applicable %s: %s\n", invalid.Name, invalid.Message)
+	}
+}
+
+func runPlan(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	config, err := desired.Load(configPath)
+	if err != nil {
+		return err
+	}
+	plans, err := s.plans(config, args)
+	if err != nil {
+		return err
+	}
+
+	document := schema.Plan{SchemaVersion: schema.Version, Config: configPath, Devices: make([]schema.DevicePlan, 0, len(plans))}
+	differ := 0
+	for _, plan := range plans {
+		document.Devices = append(document.Devices, devicePlan(plan))
+		if len(plan.Changes) > 0 || len(plan.Invalid) > 0 {
+			differ++
+		}
+	}
+	if err := s.emit(document, func() {
+		for _, plan := range document.Devices {
+			s.printPlan(plan, "Would change")
+		}
+	}); err != nil {
+		return err
+	}
+	if differ > 0 {
+		return fmt.Errorf("%d of the devices differ from %s", differ, configPath)
+	}
+	return nil
+}
+
+func runApply(s *session, args []string) error {
+	config, err := desired.Load(configPath)
+	if err != nil {
+		return err
+	}
+	switch driftPolicy {
+	case "":
+	case desired.DriftReport, desired.DriftRevert:
+		config.Drift = driftPolicy
+	default:
+		return usageError("--drift is report or revert")
+	}
+	if watchMode {
+		return s.applyWatch(config, args)
+	}
+
+	plans, err := s.plans(config, args)
+	if err != nil {
+		return err
+	}
+	document := schema.Plan{SchemaVersion: schema.Version, Config: configPath, Applied: true, Devices: make([]schema.DevicePlan, 0, len(plans))}
+	skipped := 0
+	for _, plan := range plans {
+		skipped += plan.Apply(s.backend) + len(plan.Invalid)
+		document.Devices = append(document.Devices, devicePlan(plan))
+	}
+	if err := s.emit(document, func() {
+		for _, plan := range document.Devices {
+			s.printPlan(plan, "Changed")
+		}
+	}); err != nil {
+		return err
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%d of the changes of %s did not apply", skipped, configPath)
+	}
+	return nil
+}
+
+// applyWatch brings every device of config to its desired state when it
+// attaches, until the session context is done. The first time a device
+// is seen it is applied, after that a difference is drift and handled as
+// the policy says.
+func (s *session) applyWatch(config *desired.Config, args []string) error {
+	if len(args) > 1 {
+		return usageError("expected at most a serial number")
+	}
+	serial := strings.Join(args, "")
+	seen := make(map[string]bool)
+
+	for {
+		var device jabra.DeviceInfo
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case device = <-s.attached:
+		}
+		product, ok := config.Product(device.ProductID)
+		if !ok || (serial != "" && device.SerialNumber != serial) {
+			continue
+		}
+
+		plan, err := desired.Plan(s.backend, device, product)
+		if err != nil {
+			// The device went again before it could be read, it is
+			// planned on its next attach.
+			continue
+		}
+		first := !seen[device.SerialNumber]
+		seen[device.SerialNumber] = true
+		if !first {
+			// What the device cannot take was reported when it was first seen.
+			plan.Invalid = nil
+		}
+		if len(plan.Changes) == 0 && len(plan.Invalid) == 0 {
+			continue
+		}
+
+		action, verb := "applied", "Changed"
+		switch {
+		case !first && config.Drift == desired.DriftReport:
+			action, verb = "reported", "Would revert"
+		case !first:
+			action, verb = "reverted", "Reverted"
+		}
+		if action != "reported" {
+			plan.Apply(s.backend)
+		}
+
+		changes := devicePlan(plan)
+		document := schema.Drift{
+			SchemaVersion: schema.Version,
+			Time:          now(),
+			Device:        changes.Device,
+			Action:        action,
+			Changes:       changes.Changes,
+			Invalid:       changes.Invalid,
+		}
+		if err := s.emit(document, func() {
+			fmt.Fprintf(s.stdout, "%s ", document.Time.Format(time.TimeOnly))
+			s.printPlan(changes, verb)
+		}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/presence"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var (
+	presenceFile     string
+	presenceSocket   string
+	presenceAudio    bool
+	presenceInterval time.Duration
+)
+
+func init() {
+	register(&command{
+		name:      "busylight status",
+		args:      "[serial]",
+		help:      "Print whether the busylight of a device is on, the only device with one by default",
+		run:       runBusylightStatus,
+		flags:     outputFlags,
+		textWatch: true,
+	})
+	register(&command{
+		name: "busylight on",
+		args: "[serial]",
+		help: "Turn the busylight of a device on",
+		run:  runBusylightOn,
+	})
+	register(&command{
+		name: "busylight off",
+		args: "[serial]",
+		help: "Turn the busylight of a device off",
+		run:  runBusylightOff,
+	})
+	register(&command{
+		name:  "busylight auto",
+		args:  "[serial]",
+		help:  "Keep the busylights, or the one with serial, on while a presence source is busy",
+		run:   runBusylightAuto,
+		flags: flagSets(presenceFlags, outputFlags),
+	})
+}
+
+func presenceFlags(fs *flag.FlagSet) {
+	fs.StringVar(&presenceFile, "file", "", "busy while the file says busy, on or 1")
+	fs.StringVar(&presenceSocket, "socket", "", "listen on a Unix socket for lines of busy, available or toggle")
+	fs.BoolVar(&presenceAudio, "audio", false, "busy while a sound card plays or records")
+	fs.DurationVar(&presenceInterval, "interval", 2*time.Second, "how often --file and --audio are read")
+}
+
+func hasBusylight(device jabra.DeviceInfo) bool {
+	return device.FeatureFlags != nil && (device.FeatureFlags.BusyLight || device.FeatureFlags.ManualBusyLight)
+}
+
+// busylightDevice returns the device with serial, which must have a
+// busylight, or the only device with one when serial is empty.
+func (s *session) busylightDevice(args []string) (jabra.DeviceInfo, error) {
+	if len(args) > 1 {
+		return jabra.DeviceInfo{}, usageError("expected at most a serial number")
+	}
+	if len(args) == 1 {
+		device, err := s.bySerial(args[0])
+		if err != nil {
+			return jabra.DeviceInfo{}, err
+		}
+		if !hasBusylight(device) {
+			return jabra.DeviceInfo{}, fmt.Errorf("%s: %w", device.DeviceName, jabra.ErrNotSupported)
+		}
+		return device, nil
+	}
+
+	devices := slices.DeleteFunc(s.list(), func(device jabra.DeviceInfo) bool { return !hasBusylight(device) })
+	switch len(devices) {
+	case 0:
+		return jabra.DeviceInfo{}, fmt.Errorf("%w: no device with a busylight attached", errNoDevice)
+	case 1:
+		return devices[0], nil
+	default:
+		return jabra.DeviceInfo{}, usageError("%d devices with a busylight attached, choose one by serial number", len(devices))
+	}
+}
+
+func (s *session) emitBusylight(document schema.Busylight, watching bool) error {
+	return s.emit(document, func() {
+		if watching {
+			fmt.Fprintf(s.stdout, "%s ", document.Time.Format(time.TimeOnly))
+		}
+		fmt.Fprintf(s.stdout, "%s (%s): busylight %s", document.Device.Name, document.Device.Serial, onOff(document.On))
+		if document.Source != "" {
+			fmt.Fprintf(s.stdout, " (%s)", document.Source)
+		}
+		fmt.Fprintln(s.stdout)
+	})
+}
+
+func runBusylightStatus(s *session, args []string) error {
+	device, err := s.busylightDevice(args)
+	if err != nil {
+		return err
+	}
+	if watchMode {
+		return s.busylightWatch(device)
+	}
+	on, err := s.backend.Busylight(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return s.emitBusylight(schema.Busylight{SchemaVersion: schema.Version, Time: now(), Device: schema.NewDeviceRef(device), On: on}, false)
+}
+
+// busylightWatch prints the busylight of device every time it attaches, the
+// first scan included, and every time it turns on or off, until the session
+// context is done.
+func (s *session) busylightWatch(device jabra.DeviceInfo) error {
+	for {
+		var on bool
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case attached := <-s.attached:
+			if attached.SerialNumber != device.SerialNumber {
+				continue
+			}
+			device = attached
+			// Listening ends when the device detaches.
+			if err := s.backend.ListenBusylight(device.DeviceID, true); err != nil {
+				continue
+			}
+			var err error
+			if on, err = s.backend.Busylight(device.DeviceID); err != nil {
+				continue // detached, printed again when it is back
+			}
+		case changed := <-s.busylightChanged:
+			if changed.deviceID != device.DeviceID {
+				continue
+			}
+			on = changed.on
+		}
+
+		if err := s.emitBusylight(schema.Busylight{SchemaVersion: schema.Version, Time: now(), Device: schema.NewDeviceRef(device), On: on}, true); err != nil {
+			return err
+		}
+	}
+}
+
+func runBusylightOn(s *session, args []string) error {
+	return s.setBusylight(args, true)
+}
+
+func runBusylightOff(s *session, args []string) error {
+	return s.setBusylight(args, false)
+}
+
+func (s *session) setBusylight(args []string, on bool) error {
+	device, err := s.busylightDevice(args)
+	if err != nil {
+		return err
+	}
+	if err := s.backend.SetBusylight(device.DeviceID, on); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return nil
+}
+
+// runBusylightAuto turns the busylights on and off as the presence sources
+// change, and sets those that attach to the current state, until the
+// session context is done or a source fails.
+func runBusylightAuto(s *session, args []string) error {
+	if watchMode || outputFormat == outputJSON {
+		return usageError("busylight auto streams its changes, use --output ndjson for JSON")
+	}
+	if len(args) > 1 {
+		return usageError("expected at most a serial number")
+	}
+	serial := strings.Join(args, "")
+	if serial != "" {
+		if _, err := s.busylightDevice(args); err != nil {
+			return err
+		}
+	}
+	if presenceInterval <= 0 {
+		return usageError("--interval must be positive")
+	}
+	sources := make(map[string]presence.Source)
+	if presenceFile != "" {
+		sources["file"] = presence.File{Path: presenceFile, Interval: presenceInterval}
+	}
+	if presenceSocket != "" {
+		sources["socket"] = presence.Socket{Path: presenceSocket}
+	}
+	if presenceAudio {
+		sources["audio"] = presence.Audio{Dir: "/proc/asound", Interval: presenceInterval}
+	}
+	if len(sources) == 0 {
+		return usageError("expected at least one of --file, --socket and --audio")
+	}
+
+	updates := make(chan presence.Update)
+	failed := make(chan error, 1)
+	go func() { failed <- presence.Merge(s.ctx, sources, updates) }()
+
+	var current *presence.Update
+	// apply sets the busylight of device to the current state, if it is
+	// not already.
+	apply := func(device jabra.DeviceInfo) error {
+		if current == nil || (serial != "" && device.SerialNumber != serial) || !hasBusylight(device) {
+			return nil
+		}
+		if on, err := s.backend.Busylight(device.DeviceID); err != nil || on == current.Busy {
+			return nil // detached, set when it is back
+		}
+		if err := s.backend.SetBusylight(device.DeviceID, current.Busy); err != nil {
+			return nil
+		}
+		return s.emitBusylight(schema.Busylight{SchemaVersion: schema.Version, Time: now(), Device: schema.NewDeviceRef(device), On: current.Busy, Source: current.Source}, true)
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case err := <-failed:
+			return err
+		case device := <-s.attached:
+			if err := apply(device); err != nil {
+				return err
+			}
+		case update := <-updates:
+			current = &update
+			for _, device := range s.list() {
+				if err := apply(device); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
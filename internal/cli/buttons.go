@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var buttonsRaw bool
+
+func init() {
+	register(&command{
+		name:  "buttons watch",
+		args:  "[serial]",
+		help:  "Print every button pressed on the devices, or on the one with serial",
+		run:   runButtonsWatch,
+		flags: flagSets(buttonsFlags, outputFlags),
+	})
+}
+
+func buttonsFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&buttonsRaw, "raw", false, "also print the HID usage page and usage of every button")
+}
+
+// runButtonsWatch prints the buttons pressed and released until the session
+// context is done.
+func runButtonsWatch(s *session, args []string) error {
+	if watchMode || outputFormat == outputJSON {
+		return usageError("buttons watch streams its buttons, use --output ndjson for JSON")
+	}
+	if len(args) > 1 {
+		return usageError("expected at most a serial number")
+	}
+	serial := strings.Join(args, "")
+	if serial != "" {
+		if _, err := s.bySerial(serial); err != nil {
+			return err
+		}
+	}
+
+	rawInput := s.rawHidInput
+	if !buttonsRaw {
+		rawInput = nil
+	}
+	for {
+		var (
+			deviceID uint16
+			document = schema.ButtonInput{SchemaVersion: schema.Version, Time: now()}
+			what     string
+		)
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case input := <-s.hidInput:
+			deviceID, document.Input, document.Value = input.deviceID, input.input.String(), input.value
+			switch {
+			case input.input == jabra.HidOffHook && input.value:
+				what = "offHook, off hook"
+			case input.input == jabra.HidOffHook:
+				what = "offHook, on hook"
+			case input.value:
+				what = document.Input + " pressed"
+			default:
+				what = document.Input + " released"
+			}
+		case input := <-rawInput:
+			deviceID, document.UsagePage, document.Usage, document.Value = input.deviceID, input.usagePage, input.usage, input.value
+			what = fmt.Sprintf("usage 0x%02x/0x%02x released", input.usagePage, input.usage)
+			if input.value {
+				what = fmt.Sprintf("usage 0x%02x/0x%02x pressed", input.usagePage, input.usage)
+			}
+		}
+
+		device, ok := s.byID(deviceID)
+		if !ok || (serial != "" && device.SerialNumber != serial) {
+			continue
+		}
+		document.Device = schema.NewDeviceRef(device)
+		if err := s.emit(document, func() {
+			fmt.Fprintf(s.stdout, "%s %s (%s): %s\n", document.Time.Format(time.TimeOnly), device.DeviceName, device.SerialNumber, what)
+		}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/callcontrol"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var callSocket string
+
+func init() {
+	register(&command{
+		name:  "call bridge",
+		args:  "[serial]",
+		help:  "Show the calls of softphones on a device and send them its buttons, over a Unix socket",
+		run:   runCallBridge,
+		flags: flagSets(callSocketFlags, outputFlags),
+	})
+}
+
+func callSocketFlags(fs *flag.FlagSet) {
+	fs.StringVar(&callSocket, "socket", callcontrol.DefaultSocket(), "the socket softphones connect to")
+}
+
+// callDevice returns the device with serial, or the device calls go
+// through: the only dongle, which the headsets behind it use, or else the
+// only headset.
+func (s *session) callDevice(serial string) (jabra.DeviceInfo, error) {
+	if serial != "" {
+		return s.bySerial(serial)
+	}
+	if dongle, err := s.dongle(); err == nil {
+		return dongle, nil
+	}
+	return s.headset("")
+}
+
+// runCallBridge holds the call lock of the device and serves the call to
+// softphones until the session context is done. A device that attaches
+// again is given the lock and the call back.
+func runCallBridge(s *session, args []string) error {
+	if watchMode || outputFormat == outputJSON {
+		return usageError("call bridge streams its changes, use --output ndjson for JSON")
+	}
+	if len(args) > 1 {
+		return usageError("expected at most a serial number")
+	}
+	device, err := s.callDevice(strings.Join(args, ""))
+	if err != nil {
+		return err
+	}
+	if err := s.backend.AcquireCallLock(device.DeviceID); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	attached := true
+	defer func() {
+		if attached {
+			s.backend.ReleaseCallLock(device.DeviceID)
+		}
+	}()
+
+	machine := callcontrol.New(s.backend)
+	if err := machine.Attach(device.DeviceID); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	listener, err := callcontrol.Listen(callSocket)
+	if err != nil {
+		return err
+	}
+	changes := make(chan callcontrol.Change, 100)
+	bridge := callcontrol.NewBridge(machine, changes)
+	ctx, cancel := context.WithCancel(s.ctx)
+	served := make(chan error, 1)
+	go func() { served <- bridge.Serve(ctx, listener) }()
+	defer func() {
+		cancel()
+		if served != nil {
+			<-served
+		}
+	}()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case err := <-served:
+			served = nil
+			return err
+		case deviceID := <-s.removed:
+			if attached && deviceID == device.DeviceID {
+				attached = false
+				machine.Detach()
+			}
+		case info := <-s.attached:
+			if attached || info.SerialNumber != device.SerialNumber {
+				continue
+			}
+			if err := s.backend.AcquireCallLock(info.DeviceID); err != nil {
+				continue // another application took the call control
+			}
+			device, attached = info, true
+			machine.Attach(device.DeviceID)
+		case input := <-s.hidInput:
+			if attached && input.deviceID == device.DeviceID {
+				bridge.Input(input.input, input.value)
+			}
+		case change := <-changes:
+			document := schema.CallState{
+				SchemaVersion: schema.Version,
+				Time:          now(),
+				Device:        schema.NewDeviceRef(device),
+				Event:         change.Event,
+				State:         change.State.String(),
+				Button:        change.Button,
+			}
+			if err := s.emit(document, func() {
+				by := "softphone"
+				if change.Button {
+					by = "button"
+				}
+				fmt.Fprintf(s.stdout, "%s %s (%s): %s, %s by the %s\n", document.Time.Format(time.TimeOnly), device.DeviceName, device.SerialNumber, document.State, document.Event, by)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
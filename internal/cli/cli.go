@@ -0,0 +1,168 @@
+// Package cli implements the non-interactive jlink subcommands. Every command
+// talks to a jabra.Backend, so they run the same against libjabra and the
+// simulated backend.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// Exit codes. Errors coming from the SDK exit with ExitReturnCode plus the
+// Jabra_ReturnCode value, e.g. 35 for Return_NotSupported (3).
+const (
+	ExitOK         = 0
+	ExitFailure    = 1
+	ExitUsage      = 2
+	ExitNoDevice   = 3
+	ExitReturnCode = 32
+)
+
+var (
+	errNoDevice = errors.New("no matching device found")
+	errUsage    = errors.New("usage")
+)
+
+type command struct {
+	name  string
+	args  string
+	help  string
+	run   func(s *session, args []string) error
+	flags func(fs *flag.FlagSet)
+	// textWatch lets --watch print text, for commands whose stream reads
+	// well as lines.
+	textWatch bool
+}
+
+// commands is filled by the init functions of the files implementing them.
+var commands []*command
+
+func register(c *command) {
+	commands = append(commands, c)
+}
+
+// flagSets combines the flag registrations of a command.
+func flagSets(sets ...func(fs *flag.FlagSet)) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		for _, set := range sets {
+			set(fs)
+		}
+	}
+}
+
+// Usage prints the list of subcommands to w.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-32s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+	}
+}
+
+// Run executes the subcommand in args against backend and returns the exit
+// code for the process. Cancelling ctx ends --watch streams.
+func Run(ctx context.Context, backend jabra.Backend, args []string, stdout, stderr io.Writer) int {
+	c, rest := lookup(args)
+	if c == nil {
+		fmt.Fprintf(stderr, "jlink: unknown command %q\n", strings.Join(args, " "))
+		Usage(stderr)
+		return ExitUsage
+	}
+
+	resetFlags()
+
+	fs := flag.NewFlagSet("jlink "+c.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: jlink %s %s\n  %s\n", c.name, c.args, c.help)
+		fs.PrintDefaults()
+	}
+	if c.flags != nil {
+		c.flags(fs)
+	}
+	if err := fs.Parse(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if err := checkOutputFlags(c.textWatch); err != nil {
+		fmt.Fprintf(stderr, "jlink %s: %s\n", c.name, err)
+		return ExitUsage
+	}
+
+	s, err := openSession(ctx, backend, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, "jlink:", err)
+		return exitCode(err)
+	}
+	defer s.close()
+
+	if err := c.run(s, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "jlink %s: %s\n", c.name, err)
+		if errors.Is(err, errUsage) {
+			fs.Usage()
+		}
+		return exitCode(err)
+	}
+
+	return ExitOK
+}
+
+// resetFlags sets the flags of every command to their default, so that none
+// keeps the value of an earlier Run, also those the next command does not
+// register. Registering a flag sets its default.
+func resetFlags() {
+	for _, c := range commands {
+		if c.flags != nil {
+			c.flags(flag.NewFlagSet(c.name, flag.ContinueOnError))
+		}
+	}
+}
+
+// lookup finds the longest command name matching the start of args.
+func lookup(args []string) (*command, []string) {
+	var (
+		found *command
+		words int
+	)
+	for _, c := range commands {
+		name := strings.Fields(c.name)
+		if len(name) <= words || len(name) > len(args) {
+			continue
+		}
+		if strings.Join(args[:len(name)], " ") == c.name {
+			found, words = c, len(name)
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return found, args[words:]
+}
+
+func exitCode(err error) int {
+	var returnCodeError *jabra.ReturnCodeError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	case errors.Is(err, errNoDevice):
+		return ExitNoDevice
+	case errors.As(err, &returnCodeError):
+		return ExitReturnCode + returnCodeError.Code()
+	default:
+		return ExitFailure
+	}
+}
+
+func usageError(format string, a ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{errUsage}, a...)...)
+}
@@ -0,0 +1,1092 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/firmware"
+	"github.com/Watchdog0x/jLink/internal/history"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+const testScenario = `
+searchDuration: 50ms
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: DONGLE
+    dongle: true
+    features: [pairingList, factoryReset]
+    pairingList:
+      - name: Jabra Evolve2 85
+        address: 70:BF:92:4A:10:01
+        connected: true
+        device: 1
+      - name: Jabra Evolve2 65
+        address: 70:BF:92:4A:10:02
+    searchResults:
+      - name: Jabra Elite 85t
+        address: 50:C2:ED:11:22:33
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: bt
+    battery:
+      level: 64
+      charging: true
+      extraUnits:
+        - component: cradle
+          level: 90
+`
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func init() {
+	settleTime = 0
+	pollInterval = 10 * time.Millisecond
+	now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+}
+
+func run(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	return runContext(t, context.Background(), testScenario, args...)
+}
+
+func runContext(t *testing.T, ctx context.Context, scenarioYAML string, args ...string) (string, string, int) {
+	t.Helper()
+
+	scenario, err := fake.Parse([]byte(scenarioYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := Run(ctx, fake.New(scenario), args, &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+// golden compares got with testdata/name, or rewrites it with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s mismatch, run go test -update to accept\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestList(t *testing.T) {
+	stdout, _, code := run(t, "list")
+	if code != ExitOK {
+		t.Fatalf("exit code = %d, want %d", code, ExitOK)
+	}
+
+	want := "ID  NAME              TYPE     CONNECTION  VID:PID    SERIAL\n" +
+		"0   Jabra Link 380    dongle   usb         0b0e:0000  DONGLE\n" +
+		"1   Jabra Evolve2 85  headset  bt          0b0e:0000  HEADSET\n"
+	if stdout != want {
+		t.Fatalf("list output:\n%s\nwant:\n%s", stdout, want)
+	}
+}
+
+func TestBattery(t *testing.T) {
+	stdout, _, code := run(t, "battery")
+	if code != ExitOK {
+		t.Fatalf("exit code = %d, want %d", code, ExitOK)
+	}
+	if want := "Jabra Evolve2 85: 64% charging\n  cradle: 90%\n"; stdout != want {
+		t.Fatalf("battery output %q, want %q", stdout, want)
+	}
+}
+
+func TestPairCommands(t *testing.T) {
+	stdout, _, code := run(t, "pair", "list")
+	if code != ExitOK || !strings.Contains(stdout, "70:BF:92:4A:10:01  Jabra Evolve2 85 (Connected)") {
+		t.Fatalf("pair list exit %d output %q", code, stdout)
+	}
+
+	stdout, _, code = run(t, "pair", "connect", "50:c2:ed:11:22:33")
+	if code != ExitOK || stdout != "Connected Jabra Elite 85t\n" {
+		t.Fatalf("pair connect exit %d output %q", code, stdout)
+	}
+
+	if _, _, code = run(t, "pair", "remove", "70:BF:92:4A:10:02"); code != ExitOK {
+		t.Fatalf("pair remove exit code = %d", code)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"unknown"}, ExitUsage},
+		{[]string{"pair", "connect"}, ExitUsage},
+		{[]string{"pair", "connect", "not-an-address"}, ExitUsage},
+		{[]string{"dongle", "autopairing", "maybe"}, ExitUsage},
+		{[]string{"factory-reset", "NOPE"}, ExitNoDevice},
+		// Return_NotSupported (3)
+		{[]string{"factory-reset", "HEADSET"}, ExitReturnCode + 3},
+		{[]string{"pair", "disconnect", "11:22:33:44:55:66"}, ExitNoDevice},
+		// Return_CannotClearDeviceConnected (23)
+		{[]string{"pair", "remove", "70:BF:92:4A:10:01"}, ExitReturnCode + 23},
+		// Return_DeviceNotConnected (22)
+		{[]string{"pair", "disconnect", "70:BF:92:4A:10:02"}, ExitReturnCode + 22},
+	} {
+		if _, stderr, code := run(t, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code = %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	for _, test := range []struct {
+		golden string
+		args   []string
+	}{
+		{"version.json", []string{"version", "--output", "json"}},
+		{"list.json", []string{"list", "--output", "json"}},
+		{"battery.json", []string{"battery", "--output", "json"}},
+		{"pair-list.json", []string{"pair", "list", "--output", "json"}},
+		{"pair-search.json", []string{"pair", "search", "--output", "json"}},
+		{"pair-search.ndjson", []string{"pair", "search", "--output", "ndjson"}},
+	} {
+		stdout, stderr, code := run(t, test.args...)
+		if code != ExitOK {
+			t.Errorf("jlink %s: exit code %d (stderr %q)", strings.Join(test.args, " "), code, stderr)
+			continue
+		}
+		golden(t, test.golden, stdout)
+	}
+}
+
+func TestRunResetsFlags(t *testing.T) {
+	// jlink runs one command per process, the tests and callers embedding
+	// the CLI run more: no flag of one command is left for the next.
+	run(t, "firmware", "add", "--repository", t.TempDir(), "--product", "24BB", "--version", "9.9.9", "missing.zip")
+	run(t, "battery", "--history", "--days", "2", "--output", "ndjson")
+	run(t, "pair", "search", "--dongle", "DONGLE", "--timeout", "1s")
+
+	stdout, stderr, code := run(t, "battery", "--output", "json")
+	if code != ExitOK {
+		t.Fatalf("battery after other commands: exit code %d (stderr %q)", code, stderr)
+	}
+	golden(t, "battery.json", stdout)
+
+	if repositoryDir != firmware.DefaultRepository() || packageProduct != "" || packageVersion != "" ||
+		historyMode || historyDays != 7 || dongleSerial != "" || searchTimeout != 30*time.Second {
+		t.Errorf("flags of earlier commands kept: repository %q, product %q, version %q, history %v, days %d, dongle %q, timeout %s",
+			repositoryDir, packageProduct, packageVersion, historyMode, historyDays, dongleSerial, searchTimeout)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	const scenario = testScenario + `
+events:
+  - at: 50ms
+    device: 1
+    action: discharge
+  - at: 100ms
+    device: 0
+    action: detach
+  - at: 150ms
+    device: 1
+    action: detach
+`
+	for _, test := range []struct {
+		golden string
+		args   []string
+	}{
+		{"watch-list.ndjson", []string{"list", "--output", "ndjson", "--watch"}},
+		{"watch-battery.ndjson", []string{"battery", "--output", "ndjson", "--watch"}},
+		{"watch-pair-list.ndjson", []string{"pair", "list", "--output", "ndjson", "--watch"}},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		stdout, stderr, code := runContext(t, ctx, scenario, test.args...)
+		cancel()
+		if code != ExitOK {
+			t.Errorf("jlink %s: exit code %d (stderr %q)", strings.Join(test.args, " "), code, stderr)
+			continue
+		}
+		golden(t, test.golden, stdout)
+	}
+
+	if _, _, code := run(t, "battery", "--watch"); code != ExitUsage {
+		t.Errorf("--watch without ndjson: exit code %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestMultipleDongles(t *testing.T) {
+	const scenario = testScenario + `
+  - id: 2
+    name: Jabra Link 380
+    serial: SECOND
+    dongle: true
+    features: [pairingList]
+    pairingList:
+      - name: Jabra Speak 750
+        address: 50:C2:ED:00:00:01
+  - id: 3
+    name: Jabra Evolve2 65
+    serial: WIRED
+    battery:
+      level: 30
+`
+	ctx := context.Background()
+
+	if _, _, code := runContext(t, ctx, scenario, "pair", "list"); code != ExitUsage {
+		t.Errorf("pair list with two dongles: exit code %d, want %d", code, ExitUsage)
+	}
+
+	stdout, _, code := runContext(t, ctx, scenario, "pair", "list", "--dongle", "SECOND")
+	if code != ExitOK || stdout != "50:C2:ED:00:00:01  Jabra Speak 750\n" {
+		t.Errorf("pair list --dongle SECOND: exit code %d, output %q", code, stdout)
+	}
+
+	if _, _, code := runContext(t, ctx, scenario, "pair", "clear", "--dongle", "HEADSET"); code != ExitNoDevice {
+		t.Errorf("pair clear --dongle HEADSET: exit code %d, want %d", code, ExitNoDevice)
+	}
+
+	stdout, _, code = runContext(t, ctx, scenario, "battery")
+	if code != ExitOK || !strings.Contains(stdout, "Jabra Evolve2 85: 64%") || !strings.Contains(stdout, "Jabra Evolve2 65: 30%") {
+		t.Errorf("battery: exit code %d, output %q", code, stdout)
+	}
+}
+
+func TestBatteryHistory(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	if _, _, code := run(t, "battery", "--history"); code != ExitNoDevice {
+		t.Errorf("battery --history without history: exit code %d, want %d", code, ExitNoDevice)
+	}
+
+	store := history.NewStore(history.DefaultDir())
+	at := func(hour int) time.Time { return now().Add(time.Duration(hour) * time.Hour) }
+	for _, sample := range []history.Sample{
+		{Time: at(-20), Level: 40, Charging: true},
+		{Time: at(-19), Level: 70, Charging: true},
+		{Time: at(-18), Level: 100, Charging: true},
+		{Time: at(-4), Level: 100},
+		{Time: at(-3), Level: 90},
+		{Time: at(-1), Level: 70},
+	} {
+		sample.Serial, sample.Name = "HEADSET", "Jabra Evolve2 85"
+		if err := store.Append(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, _, code := run(t, "battery", "--history", "--days", "2")
+	if code != ExitOK {
+		t.Fatalf("exit code = %d, want %d", code, ExitOK)
+	}
+	golden(t, "battery-history.txt", stdout)
+
+	stdout, _, code = run(t, "battery", "--history", "--days", "2", "--output", "json")
+	if code != ExitOK {
+		t.Fatalf("exit code = %d, want %d", code, ExitOK)
+	}
+	golden(t, "battery-history.json", stdout)
+}
+
+const firmwareScenario = `
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: DONGLE
+    dongle: true
+    firmware: 2.5.1
+    latestFirmware: 2.5.1
+  - id: 1
+    name: Jabra Evolve2 85
+    productID: 0x24ba
+    serial: HEADSET
+    connection: bt
+    parent: 0
+    firmware: 1.3.8
+    latestFirmware: 1.5.4
+    features: [needsExplicitRebootAfterOta]
+    firmwareUpdate:
+      version: 1.5.4
+      duration: 50ms
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: RECOVERY
+    connection: usb
+    firmwareUpdateMode: true
+    firmwareUpdate:
+      duration: 50ms
+      fail: updateError
+`
+
+// firmwarePackage writes a firmware package named name, holding a file
+// with its name so that packages differ.
+func firmwarePackage(t *testing.T, name string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	if w, err := archive.Create("firmware.dfu"); err != nil {
+		t.Fatal(err)
+	} else {
+		w.Write([]byte(name))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFirmware(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	ctx := context.Background()
+
+	stdout, _, code := runContext(t, ctx, firmwareScenario, "firmware", "info")
+	if code != ExitOK {
+		t.Fatalf("firmware info: exit code %d", code)
+	}
+	golden(t, "firmware-info.txt", stdout)
+
+	stdout, _, code = runContext(t, ctx, firmwareScenario, "firmware", "check", "--auth", "secret", "--output", "json")
+	if code != ExitOK {
+		t.Fatalf("firmware check: exit code %d", code)
+	}
+	golden(t, "firmware-check.json", stdout)
+	if _, _, code := runContext(t, ctx, firmwareScenario, "firmware", "check"); code != ExitUsage {
+		t.Errorf("firmware check without --auth: exit code %d, want %d", code, ExitUsage)
+	}
+
+	path := firmwarePackage(t, "Jabra_Evolve2_85-v1.5.4-ev285t-vector.zip")
+	if _, _, code := runContext(t, ctx, firmwareScenario, "firmware", "update", path); code != ExitUsage {
+		t.Errorf("firmware update with two headsets: exit code %d, want %d", code, ExitUsage)
+	}
+	stdout, _, code = runContext(t, ctx, firmwareScenario, "firmware", "update", path, "HEADSET")
+	if code != ExitOK {
+		t.Fatalf("firmware update: exit code %d", code)
+	}
+	golden(t, "firmware-update.txt", stdout)
+
+	stdout, _, code = runContext(t, ctx, firmwareScenario, "firmware", "update", "--output", "ndjson", path, "HEADSET")
+	if code != ExitOK {
+		t.Fatalf("firmware update --output ndjson: exit code %d", code)
+	}
+	golden(t, "firmware-update.ndjson", stdout)
+
+	for _, test := range []struct {
+		args   []string
+		want   int
+		stderr string
+	}{
+		// Return_FirmwareUpToDate (16)
+		{[]string{firmwarePackage(t, "Jabra_Evolve2_85-v1.3.8.zip"), "HEADSET"}, ExitReturnCode + 16, "the device already runs this firmware"},
+		// Return_FileNotAccessible (15)
+		{[]string{filepath.Join(t.TempDir(), "missing.zip"), "HEADSET"}, ExitReturnCode + 15, "is not a firmware package"},
+		// Return_NotSupported (3)
+		{[]string{"--yes", path, "DONGLE"}, ExitReturnCode + 3, "the device does not support firmware updates"},
+		{[]string{path, "RECOVERY"}, ExitFailure, "the device rejected the firmware update"},
+	} {
+		args := append([]string{"firmware", "update"}, test.args...)
+		_, stderr, code := runContext(t, ctx, firmwareScenario, args...)
+		if code != test.want || !strings.Contains(stderr, test.stderr) {
+			t.Errorf("jlink %s: exit code %d, stderr %q", strings.Join(args, " "), code, stderr)
+		}
+	}
+
+	// A package that is not identified is only flashed when confirmed.
+	t.Cleanup(func() { stdin = os.Stdin })
+	unidentified := firmwarePackage(t, "evolve2-85.zip")
+	stdin = strings.NewReader("n\n")
+	if _, stderr, code := runContext(t, ctx, firmwareScenario, "firmware", "update", unidentified, "HEADSET"); code != ExitFailure || !strings.Contains(stderr, "not confirmed") {
+		t.Errorf("unidentified package answered no: exit code %d, stderr %q", code, stderr)
+	}
+	if _, _, code := runContext(t, ctx, firmwareScenario, "firmware", "update", "--output", "json", unidentified, "HEADSET"); code != ExitUsage {
+		t.Errorf("unidentified package with --output json and without --yes: exit code %d, want %d", code, ExitUsage)
+	}
+	if _, stderr, code := runContext(t, ctx, firmwareScenario, "firmware", "update", "--yes", unidentified, "HEADSET"); code != ExitOK {
+		t.Errorf("unidentified package with --yes: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestFirmwareRepository(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	ctx := context.Background()
+	const scenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    productID: 0x24ba
+    variant: UC
+    serial: HEADSET
+    connection: usb
+    firmware: 1.5.4
+    firmwareUpdate:
+      duration: 50ms
+`
+
+	for _, args := range [][]string{
+		{"firmware", "add", firmwarePackage(t, "Jabra_Evolve2_85-v1.5.4-ev285t-vector.zip")},
+		{"firmware", "add", firmwarePackage(t, "Jabra_Evolve2_85-v1.3.8-ev285t-vector.zip"), "HEADSET"},
+		{"firmware", "add", "--product", "24BB", firmwarePackage(t, "Jabra_Evolve2_65-v3.0.0.zip")},
+		{"firmware", "add", "--version", "1.1.0", firmwarePackage(t, "evolve2-85.zip")},
+	} {
+		if _, stderr, code := runContext(t, ctx, scenario, args...); code != ExitOK {
+			t.Fatalf("jlink %s: exit code %d (stderr %q)", strings.Join(args, " "), code, stderr)
+		}
+	}
+	if _, _, code := runContext(t, ctx, scenario, "firmware", "add", firmwarePackage(t, "evolve2-85.zip")); code != ExitFailure {
+		t.Errorf("adding a package without a version: exit code %d, want %d", code, ExitFailure)
+	}
+
+	stdout, _, code := runContext(t, ctx, scenario, "firmware", "packages")
+	if code != ExitOK {
+		t.Fatalf("firmware packages: exit code %d", code)
+	}
+	golden(t, "firmware-packages.txt", stdout)
+
+	// A package of the repository has to fit the device, wherever it is.
+	_, stderr, code := runContext(t, ctx, scenario, "firmware", "update", firmwarePackage(t, "Jabra_Evolve2_65-v3.0.0.zip"))
+	if want := "Jabra_Evolve2_65-v3.0.0.zip is for product 24bb, Jabra Evolve2 85 is product 24ba variant UC"; code != ExitFailure || !strings.Contains(stderr, want) {
+		t.Errorf("mismatched package: exit code %d, stderr %q", code, stderr)
+	}
+	if _, stderr, code := runContext(t, ctx, scenario, "firmware", "update", "2.0.0"); code != ExitFailure || !strings.Contains(stderr, "has no firmware 2.0.0") {
+		t.Errorf("unknown version: exit code %d, stderr %q", code, stderr)
+	}
+
+	// Downgrades need a confirmation.
+	if _, _, code := runContext(t, ctx, scenario, "firmware", "rollback"); code != ExitFailure {
+		t.Errorf("rollback without a recorded update: exit code %d, want %d", code, ExitFailure)
+	}
+	t.Cleanup(func() { stdin = os.Stdin })
+	repository := firmware.OpenRepository(firmware.DefaultRepository())
+	if err := repository.Audit(firmware.Record{Serial: "HEADSET", From: "1.3.8", To: "1.5.4", Result: "completed"}); err != nil {
+		t.Fatal(err)
+	}
+	stdin = strings.NewReader("n\n")
+	if _, _, code := runContext(t, ctx, scenario, "firmware", "rollback"); code != ExitFailure {
+		t.Errorf("rollback answered no: exit code %d, want %d", code, ExitFailure)
+	}
+	if _, _, code := runContext(t, ctx, scenario, "firmware", "update", "--output", "json", "1.1.0"); code != ExitUsage {
+		t.Errorf("downgrade with --output json and without --yes: exit code %d, want %d", code, ExitUsage)
+	}
+	stdin = strings.NewReader("y\n")
+	stdout, _, code = runContext(t, ctx, scenario, "firmware", "rollback")
+	if code != ExitOK {
+		t.Fatalf("firmware rollback: exit code %d", code)
+	}
+	golden(t, "firmware-rollback.txt", stdout)
+
+	records, err := repository.Records("HEADSET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := records[len(records)-1]
+	if len(records) != 2 || last.From != "1.5.4" || last.To != "1.3.8" || !last.Downgrade || last.Result != "completed" || last.SHA256 == "" {
+		t.Errorf("audit records %+v", records)
+	}
+}
+
+func TestFirmwareLock(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	scenario := strings.Replace(firmwareScenario, "    firmware: 1.3.8\n", "    firmware: 1.3.8\n    firmwareLock: true\n", 1)
+
+	stdout, _, code := runContext(t, ctx, scenario, "firmware", "lock", "status")
+	// The dongle has no lock, it reads off like with the SDK.
+	if want := "Jabra Link 380 (DONGLE): off\nJabra Evolve2 85 (HEADSET): on\nJabra Evolve2 65 (RECOVERY): off\n"; code != ExitOK || stdout != want {
+		t.Errorf("firmware lock status: exit code %d, output %q, want %q", code, stdout, want)
+	}
+
+	path := firmwarePackage(t, "Jabra_Evolve2_85-v1.5.4-ev285t-vector.zip")
+	_, stderr, code := runContext(t, ctx, scenario, "firmware", "update", path, "HEADSET")
+	if code != ExitFailure || !strings.Contains(stderr, "jlink firmware lock off") {
+		t.Errorf("update of a locked headset: exit code %d, stderr %q", code, stderr)
+	}
+	if records, err := firmware.OpenRepository(firmware.DefaultRepository()).Records(""); err != nil || len(records) != 0 {
+		t.Errorf("refused update recorded: %+v, %v", records, err)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"firmware", "lock", "off", "HEADSET"}, ExitOK},
+		{[]string{"firmware", "lock", "on", "RECOVERY"}, ExitOK},
+		{[]string{"firmware", "lock", "on"}, ExitUsage}, // two headsets
+		{[]string{"firmware", "lock", "maybe"}, ExitUsage},
+		// Return_NotSupported (3)
+		{[]string{"firmware", "lock", "on", "DONGLE"}, ExitReturnCode + 3},
+		{[]string{"firmware", "lock", "status", "DONGLE"}, ExitOK},
+	} {
+		if _, stderr, code := runContext(t, ctx, scenario, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+const settingsScenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    settings:
+      - guid: ringtone
+        name: Ringtone
+        type: list
+        value: Tone 2
+        options: [{key: 0, value: Tone 1}, {key: 1, value: Tone 2}]
+      - guid: name
+        name: Headset name
+        type: text
+        value: Evolve
+      - guid: protection
+        name: Hearing protection
+        type: list
+        fail: true
+        options: [{key: 0, value: Standard}, {key: 1, value: NIOSH}]
+`
+
+func TestSettings(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	exported := filepath.Join(dir, "exported.yaml")
+
+	stdout, _, code := runContext(t, ctx, settingsScenario, "settings", "export", exported)
+	if want := "Saved 3 settings of Jabra Evolve2 85 to " + exported + "\n"; code != ExitOK || stdout != want {
+		t.Fatalf("settings export: exit code %d, output %q", code, stdout)
+	}
+	if _, _, code := runContext(t, ctx, settingsScenario, "settings", "diff", "HEADSET", exported); code != ExitOK {
+		t.Errorf("diff with the exported file: exit code %d", code)
+	}
+
+	edited := filepath.Join(dir, "edited.yaml")
+	if err := os.WriteFile(edited, []byte(`
+settings:
+  - name: ringtone
+    value: tone 1
+  - guid: protection
+    value: NIOSH
+  - name: Busylight
+    value: "On"
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runContext(t, ctx, settingsScenario, "settings", "import", "--mode", "retrieve", edited)
+	want := "Would change Ringtone: Tone 2 -> Tone 1\n" +
+		"Would change Hearing protection: Standard -> NIOSH\n" +
+		"Not applicable Busylight: the device has no such setting\n"
+	if code != ExitFailure || stdout != want || !strings.Contains(stderr, "1 of the settings in "+edited+" did not apply") {
+		t.Errorf("settings import --mode retrieve: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	stdout, _, code = runContext(t, ctx, settingsScenario, "settings", "import", edited, "HEADSET")
+	want = "Changed Ringtone: Tone 2 -> Tone 1\n" +
+		"Not written Hearing protection: the device refused it\n" +
+		"Not applicable Busylight: the device has no such setting\n"
+	if code != ExitFailure || stdout != want {
+		t.Errorf("settings import: exit code %d, output %q", code, stdout)
+	}
+
+	stdout, _, code = runContext(t, ctx, settingsScenario, "settings", "diff", "HEADSET", edited)
+	want = "SETTING             HEADSET    " + edited + "\n" +
+		"Ringtone            Tone 2     Tone 1\n" +
+		"Headset name        Evolve     (missing)\n" +
+		"Hearing protection  Standard   NIOSH\n" +
+		"Busylight           (missing)  On\n" +
+		"Not applicable Busylight: the device has no such setting\n"
+	if code != ExitFailure || stdout != want {
+		t.Errorf("settings diff: exit code %d, output\n%s\nwant\n%s", code, stdout, want)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"settings", "diff", "HEADSET"}, ExitUsage},
+		{[]string{"settings", "diff", "HEADSET", filepath.Join(dir, "missing.yaml")}, ExitNoDevice},
+		{[]string{"settings", "import", "--mode", "later", edited}, ExitUsage},
+		// Return_NotSupported (3), libjabra no longer writes its settings files
+		{[]string{"settings", "export", "--sdk", filepath.Join(dir, "settings.xml")}, ExitReturnCode + 3},
+	} {
+		if _, stderr, code := runContext(t, ctx, settingsScenario, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+func TestSettingsWatch(t *testing.T) {
+	const scenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    features: [settingsChangeNotification]
+    settings:
+      - guid: ringtone
+        name: Ringtone
+        type: list
+        options: [{key: 0, value: Tone 1}, {key: 1, value: Tone 2}]
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: OTHER
+    connection: usb
+events:
+  - at: 50ms
+    device: 1
+    action: setting
+    setting: ringtone
+    value: Tone 2
+  - at: 100ms
+    device: 1
+    action: detach
+  - at: 150ms
+    device: 1
+    action: attach
+  - at: 200ms
+    device: 1
+    action: setting
+    setting: ringtone
+    value: Tone 1
+`
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	stdout, stderr, code := runContext(t, ctx, scenario, "settings", "watch")
+	cancel()
+	want := "12:00:00 Jabra Evolve2 85: Ringtone Tone 1 -> Tone 2\n" +
+		"12:00:00 Jabra Evolve2 85: Ringtone Tone 2 -> Tone 1\n"
+	if code != ExitOK || stdout != want {
+		t.Errorf("settings watch: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	stdout, _, code = runContext(t, ctx, scenario, "settings", "watch", "--output", "ndjson", "HEADSET")
+	cancel()
+	if code != ExitOK || !strings.Contains(stdout, `"guid":"ringtone","name":"Ringtone","from":"Tone 1","to":"Tone 2"`) {
+		t.Errorf("settings watch --output ndjson: exit code %d, output %q", code, stdout)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"settings", "watch", "--output", "json"}, ExitUsage},
+		// Return_NotSupported (3)
+		{[]string{"settings", "watch", "OTHER"}, ExitReturnCode + 3},
+	} {
+		if _, stderr, code := runContext(t, context.Background(), scenario, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+func TestANC(t *testing.T) {
+	const scenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    ambience: {modes: [off, hearThrough, anc], mode: anc, levels: 4, balance: 2, loop: [anc, hearThrough]}
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: OTHER
+    connection: usb
+events:
+  - at: 50ms
+    device: 1
+    action: ambience
+`
+	stdout, stderr, code := runContext(t, context.Background(), scenario, "anc", "get", "HEADSET")
+	want := "Jabra Evolve2 85 (HEADSET): anc\n" +
+		"  off\n" +
+		"  hearThrough  level 0 (0-4)  balance 0 (-2 to 2)\n" +
+		"  anc          level 0 (0-4)  balance 0 (-2 to 2)\n" +
+		"  Button loop: anc, hearThrough\n"
+	if code != ExitOK || stdout != want {
+		t.Errorf("anc get: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	// The button switches to the next mode of the loop.
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	stdout, _, code = runContext(t, ctx, scenario, "anc", "get", "--watch", "--output", "ndjson", "HEADSET")
+	cancel()
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if code != ExitOK || len(lines) != 2 || !strings.Contains(lines[0], `"mode":"anc","modes"`) || !strings.Contains(lines[1], `"mode":"hearThrough","modes"`) {
+		t.Errorf("anc get --watch: exit code %d, output %q", code, stdout)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"anc", "set", "hearThrough", "HEADSET"}, ExitOK},
+		{[]string{"anc", "set", "loud", "HEADSET"}, ExitUsage},
+		{[]string{"anc", "level", "4", "HEADSET"}, ExitOK},
+		{[]string{"anc", "level", "5", "HEADSET"}, ExitUsage},
+		{[]string{"anc", "level", "--mode", "off", "1", "HEADSET"}, ExitFailure},
+		{[]string{"anc", "balance", "--mode", "hearThrough", "--", "-2", "HEADSET"}, ExitOK},
+		{[]string{"anc", "balance", "3", "HEADSET"}, ExitUsage},
+		{[]string{"anc", "loop", "off,anc", "HEADSET"}, ExitOK},
+		{[]string{"anc", "loop", "none", "HEADSET"}, ExitOK},
+		// Device_WriteFail (8), the loop is longer than the modes
+		{[]string{"anc", "loop", "off,anc,hearThrough,off", "HEADSET"}, ExitReturnCode + 8},
+		// Return_NotSupported (3)
+		{[]string{"anc", "get", "OTHER"}, ExitReturnCode + 3},
+		{[]string{"anc", "get"}, ExitUsage}, // two headsets
+	} {
+		if _, stderr, code := runContext(t, context.Background(), scenario, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+const applyScenario = `
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: DONGLE
+    productID: 0x24f1
+    dongle: true
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    productID: 0x24f2
+    connection: usb
+    busylight: {}
+    settings:
+      - guid: ringtone
+        name: Ringtone
+        type: list
+        options: [{key: 0, value: Tone 1}, {key: 1, value: Tone 2}]
+events:
+  - at: 100ms
+    device: 1
+    action: setting
+    setting: ringtone
+    value: Tone 1
+  - at: 120ms
+    device: 1
+    action: detach
+  - at: 140ms
+    device: 1
+    action: attach
+`
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join(t.TempDir(), "jlink.yaml")
+	if err := os.WriteFile(config, []byte(`
+products:
+  - productID: 0x24f2
+    busylight: true
+    ambience: anc
+    settings:
+      - guid: ringtone
+        value: Tone 2
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runContext(t, ctx, applyScenario, "plan", "--config", config)
+	want := "Jabra Evolve2 85 (HEADSET)\n" +
+		"  Would change Busylight: off -> on\n" +
+		"  Would change Ringtone: Tone 1 -> Tone 2\n" +
+		"  Not applicable Ambience mode: the device does not support it\n"
+	if code != ExitFailure || stdout != want || !strings.Contains(stderr, "1 of the devices differ from "+config) {
+		t.Errorf("plan: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	stdout, _, code = runContext(t, ctx, applyScenario, "apply", "--config", config, "--output", "json", "HEADSET")
+	for _, part := range []string{`"applied": true`, `"property": "busylight"`, `"to": "Tone 2"`, `"name": "Ambience mode"`} {
+		if code != ExitFailure || !strings.Contains(stdout, part) {
+			t.Errorf("apply --output json: exit code %d, output lacks %s:\n%s", code, part, stdout)
+		}
+	}
+
+	for _, test := range []struct {
+		drift string
+		want  string
+	}{
+		{"report", "12:00:00 Jabra Evolve2 85 (HEADSET)\n" +
+			"  Would revert Ringtone: Tone 1 -> Tone 2\n"},
+		{"revert", "12:00:00 Jabra Evolve2 85 (HEADSET)\n" +
+			"  Reverted Ringtone: Tone 1 -> Tone 2\n"},
+	} {
+		ctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+		stdout, stderr, code := runContext(t, ctx, applyScenario, "apply", "--config", config, "--watch", "--drift", test.drift)
+		cancel()
+		want := "12:00:00 Jabra Evolve2 85 (HEADSET)\n" +
+			"  Changed Busylight: off -> on\n" +
+			"  Changed Ringtone: Tone 1 -> Tone 2\n" +
+			"  Not applicable Ambience mode: the device does not support it\n" + test.want
+		if code != ExitOK || stdout != want {
+			t.Errorf("apply --watch --drift %s: exit code %d, output\n%s\nwant\n%s\nstderr %q", test.drift, code, stdout, want, stderr)
+		}
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"plan", "--config", config, "DONGLE"}, ExitNoDevice},
+		{[]string{"plan", "--config", filepath.Join(t.TempDir(), "missing.yaml")}, ExitFailure},
+		{[]string{"apply", "--config", config, "--drift", "ignore"}, ExitUsage},
+		{[]string{"plan", "--config", config, "--watch"}, ExitUsage},
+	} {
+		if _, stderr, code := runContext(t, ctx, applyScenario, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+func TestEqualizer(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	const scenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    equalizer:
+      bands:
+        - {frequency: 250, gain: 3}
+        - {frequency: 1000, gain: -1.5}
+        - {frequency: 4000, maxGain: 3}
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: OTHER
+    connection: usb
+    equalizer: {enabled: true}
+`
+	stdout, stderr, code := runContext(t, context.Background(), scenario, "equalizer", "get", "HEADSET")
+	want := "Jabra Evolve2 85 (HEADSET): equalizer off\n" +
+		"   250 Hz    +3 dB  (±6)\n" +
+		"  1000 Hz  -1.5 dB  (±6)\n" +
+		"  4000 Hz     0 dB  (±3)\n"
+	if code != ExitOK || stdout != want {
+		t.Errorf("equalizer get: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	if _, stderr, code := runContext(t, context.Background(), scenario, "equalizer", "save", "Bass boost", "HEADSET"); code != ExitOK {
+		t.Fatalf("equalizer save: exit code %d, stderr %q", code, stderr)
+	}
+	stdout, _, code = runContext(t, context.Background(), scenario, "equalizer", "presets")
+	if want := "Bass boost  250 Hz +3, 1000 Hz -1.5, 4000 Hz 0 dB\n"; code != ExitOK || stdout != want {
+		t.Errorf("equalizer presets: exit code %d, output %q", code, stdout)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"equalizer", "load", "bass boost", "HEADSET"}, ExitOK},
+		{[]string{"equalizer", "load", "Podcast", "HEADSET"}, ExitUsage},
+		// OTHER has the five default bands.
+		{[]string{"equalizer", "load", "Bass boost", "OTHER"}, ExitFailure},
+		{[]string{"equalizer", "set", "--", "-6,0,3", "HEADSET"}, ExitOK},
+		{[]string{"equalizer", "set", "0,0,4", "HEADSET"}, ExitUsage},
+		{[]string{"equalizer", "set", "0,0", "HEADSET"}, ExitUsage},
+		{[]string{"equalizer", "off", "OTHER"}, ExitOK},
+		{[]string{"equalizer", "get"}, ExitUsage}, // two headsets
+		{[]string{"equalizer", "delete", "Bass Boost"}, ExitOK},
+		{[]string{"equalizer", "delete", "Bass Boost"}, ExitUsage},
+	} {
+		if _, stderr, code := runContext(t, context.Background(), scenario, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+func TestBusylight(t *testing.T) {
+	const scenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    busylight: {manual: true}
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: OTHER
+    connection: usb
+events:
+  - at: 50ms
+    device: 1
+    action: busylight
+`
+	stdout, stderr, code := runContext(t, context.Background(), scenario, "busylight", "status")
+	if code != ExitOK || stdout != "Jabra Evolve2 85 (HEADSET): busylight off\n" {
+		t.Errorf("busylight status: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	// The button turns it on.
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	stdout, _, code = runContext(t, ctx, scenario, "busylight", "status", "--watch")
+	cancel()
+	want := "12:00:00 Jabra Evolve2 85 (HEADSET): busylight off\n" +
+		"12:00:00 Jabra Evolve2 85 (HEADSET): busylight on\n"
+	if code != ExitOK || stdout != want {
+		t.Errorf("busylight status --watch: exit code %d, output %q", code, stdout)
+	}
+
+	path := filepath.Join(t.TempDir(), "presence")
+	if err := os.WriteFile(path, []byte("busy\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 150*time.Millisecond)
+	stdout, stderr, code = runContext(t, ctx, scenario, "busylight", "auto", "--file", path, "--interval", "10ms", "--output", "ndjson")
+	cancel()
+	if code != ExitOK || strings.Count(stdout, "\n") != 1 || !strings.Contains(stdout, `"on":true,"source":"file"`) {
+		t.Errorf("busylight auto: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"busylight", "on"}, ExitOK},
+		{[]string{"busylight", "off", "HEADSET"}, ExitOK},
+		{[]string{"busylight", "on", "NOBODY"}, ExitNoDevice},
+		{[]string{"busylight", "auto"}, ExitUsage},
+		{[]string{"busylight", "auto", "--file", path, "--watch"}, ExitUsage},
+		// Return_NotSupported (3)
+		{[]string{"busylight", "status", "OTHER"}, ExitReturnCode + 3},
+	} {
+		if _, stderr, code := runContext(t, context.Background(), scenario, test.args...); code != test.want {
+			t.Errorf("jlink %s: exit code %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
+
+func TestCallBridge(t *testing.T) {
+	const scenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    telephony: {}
+events:
+  - at: 300ms
+    device: 1
+    action: button
+    value: offHook
+`
+	socket := filepath.Join(t.TempDir(), "call.sock")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	go func() {
+		var conn net.Conn
+		for ctx.Err() == nil {
+			var err error
+			if conn, err = net.Dial("unix", socket); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, "incoming")
+		<-ctx.Done()
+	}()
+	stdout, stderr, code := runContext(t, ctx, scenario, "call", "bridge", "--socket", socket)
+	want := "12:00:00 Jabra Evolve2 85 (HEADSET): ringing, incoming by the softphone\n" +
+		"12:00:00 Jabra Evolve2 85 (HEADSET): active, answer by the button\n"
+	if code != ExitOK || stdout != want {
+		t.Errorf("call bridge: exit code %d, output %q, stderr %q", code, stdout, stderr)
+	}
+
+	const locked = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    telephony: {locked: true}
+`
+	// Device_Lock (30)
+	if _, stderr, code := runContext(t, context.Background(), locked, "call", "bridge", "--socket", socket); code != ExitReturnCode+30 {
+		t.Errorf("call bridge of a locked device: exit code %d (stderr %q)", code, stderr)
+	}
+}
+
+func TestButtonsWatch(t *testing.T) {
+	const scenario = `
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    telephony: {}
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: OTHER
+    connection: usb
+    telephony: {}
+events:
+  - {at: 100ms, device: 1, action: button, value: mute}
+  - {at: 150ms, device: 2, action: button, value: button1}
+  - {at: 200ms, device: 1, action: button, value: offHook}
+`
+	run := func(args ...string) string {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+		defer cancel()
+		stdout, stderr, code := runContext(t, ctx, scenario, append([]string{"buttons", "watch"}, args...)...)
+		if code != ExitOK {
+			t.Errorf("buttons watch %v: exit code %d (stderr %q)", args, code, stderr)
+		}
+		return stdout
+	}
+
+	want := "12:00:00 Jabra Evolve2 85 (HEADSET): mute pressed\n" +
+		"12:00:00 Jabra Evolve2 85 (HEADSET): offHook, off hook\n"
+	if got := run("HEADSET"); got != want {
+		t.Errorf("buttons watch HEADSET:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Raw inputs come apart from the translated ones, in any order.
+	lines := strings.Split(strings.TrimSpace(run("--raw", "--output", "ndjson", "OTHER")), "\n")
+	slices.Sort(lines)
+	wantLines := []string{
+		`{"schemaVersion":1,"time":"2024-01-01T12:00:00Z","device":{"id":2,"name":"Jabra Evolve2 65","serial":"OTHER"},"input":"button1","value":true}`,
+		`{"schemaVersion":1,"time":"2024-01-01T12:00:00Z","device":{"id":2,"name":"Jabra Evolve2 65","serial":"OTHER"},"usagePage":9,"usage":1,"value":true}`,
+	}
+	if !slices.Equal(lines, wantLines) {
+		t.Errorf("buttons watch --raw:\n%s", strings.Join(lines, "\n"))
+	}
+
+	if _, _, code := runContext(t, context.Background(), scenario, "buttons", "watch", "--output", "json"); code != ExitUsage {
+		t.Errorf("buttons watch --output json: exit code %d", code)
+	}
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+func init() {
+	register(&command{name: "version", help: "Print the Jabra SDK version", run: runVersion, flags: outputFlags})
+	register(&command{name: "list", help: "List attached dongles and headsets", run: runList, flags: outputFlags})
+	register(&command{
+		name:  "battery",
+		help:  "Print the battery status of the attached headsets",
+		run:   runBattery,
+		flags: flagSets(outputFlags, historyFlags),
+	})
+	register(&command{
+		name: "factory-reset",
+		args: "<serial>",
+		help: "Factory reset the device with the given serial number",
+		run:  runFactoryReset,
+	})
+}
+
+func runVersion(s *session, args []string) error {
+	version, err := s.backend.Version()
+	if err != nil {
+		return err
+	}
+
+	return s.emit(schema.SDKVersion{SchemaVersion: schema.Version, SDKVersion: version}, func() {
+		fmt.Fprintln(s.stdout, version)
+	})
+}
+
+func runList(s *session, args []string) error {
+	if watchMode {
+		return s.watch(schema.EventAttached, schema.EventRemoved)
+	}
+
+	devices := s.list()
+	if len(devices) == 0 {
+		return errNoDevice
+	}
+
+	document := schema.DeviceList{SchemaVersion: schema.Version, Devices: make([]schema.Device, 0, len(devices))}
+	for _, device := range devices {
+		document.Devices = append(document.Devices, s.device(device))
+	}
+
+	return s.emit(document, func() {
+		w := tabwriter.NewWriter(s.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tCONNECTION\tVID:PID\tSERIAL")
+		for _, device := range devices {
+			deviceType := "headset"
+			if device.IsDongle {
+				deviceType = "dongle"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%04x:%04x\t%s\n",
+				device.DeviceID, device.DeviceName, deviceType, device.DeviceConnection,
+				device.VendorID, device.ProductID, device.SerialNumber)
+		}
+		w.Flush()
+	})
+}
+
+func runBattery(s *session, args []string) error {
+	if historyMode {
+		return runBatteryHistory(s)
+	}
+	if watchMode {
+		return s.watch(schema.EventBattery, schema.EventRemoved)
+	}
+
+	headsets := s.headsets()
+	if len(headsets) == 0 {
+		return fmt.Errorf("%w: no headset attached", errNoDevice)
+	}
+
+	var lastErr error
+	document := schema.BatteryList{SchemaVersion: schema.Version, Batteries: make([]schema.Battery, 0, len(headsets))}
+	for _, headset := range headsets {
+		battery, err := s.backend.BatteryStatus(headset.DeviceID)
+		if errors.Is(err, jabra.ErrNotSupported) {
+			continue // e.g. a speakerphone
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", headset.DeviceName, err)
+			continue
+		}
+		document.Batteries = append(document.Batteries, schema.NewBattery(headset, battery))
+	}
+
+	if err := s.emit(document, func() {
+		for _, battery := range document.Batteries {
+			state := ""
+			if battery.Charging {
+				state += " charging"
+			}
+			if battery.BatteryLow {
+				state += " low"
+			}
+			fmt.Fprintf(s.stdout, "%s: %d%%%s\n", battery.Device.Name, battery.LevelInPercent, state)
+			for _, unit := range battery.ExtraUnits {
+				fmt.Fprintf(s.stdout, "  %s: %d%%\n", unit.Component, unit.LevelInPercent)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+
+	return lastErr
+}
+
+func runFactoryReset(s *session, args []string) error {
+	if len(args) != 1 {
+		return usageError("expected a serial number")
+	}
+
+	device, err := s.bySerial(args[0])
+	if err != nil {
+		return err
+	}
+	if device.FeatureFlags == nil || !device.FeatureFlags.FactoryReset {
+		return fmt.Errorf("%s: factory reset: %w", device.DeviceName, jabra.ErrNotSupported)
+	}
+	if err := s.backend.FactoryReset(device.DeviceID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.stdout, "%s has been reset to factory settings\n", device.DeviceName)
+	return nil
+}
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Watchdog0x/jLink/internal/equalizer"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var presetsPath string
+
+func init() {
+	register(&command{
+		name:  "equalizer get",
+		args:  "[serial]",
+		help:  "Print the equalizer bands of a headset, the only one by default",
+		run:   runEqualizerGet,
+		flags: outputFlags,
+	})
+	register(&command{
+		name: "equalizer set",
+		args: "<gain,...> [serial]",
+		help: "Set the gain in dB of every band, lowest first, and turn the equalizer on (negative gains after --)",
+		run:  runEqualizerSet,
+	})
+	register(&command{
+		name: "equalizer on",
+		args: "[serial]",
+		help: "Turn the equalizer of a headset on",
+		run:  runEqualizerOn,
+	})
+	register(&command{
+		name: "equalizer off",
+		args: "[serial]",
+		help: "Turn the equalizer of a headset off",
+		run:  runEqualizerOff,
+	})
+	register(&command{
+		name:  "equalizer presets",
+		help:  "List the saved equalizer presets",
+		run:   runEqualizerPresets,
+		flags: flagSets(presetsFlags, outputFlags),
+	})
+	register(&command{
+		name:  "equalizer save",
+		args:  "<name> [serial]",
+		help:  "Save the gains of a headset as a preset, replacing one of the same name",
+		run:   runEqualizerSave,
+		flags: presetsFlags,
+	})
+	register(&command{
+		name:  "equalizer load",
+		args:  "<name> [serial]",
+		help:  "Set the gains of a headset to a preset and turn the equalizer on",
+		run:   runEqualizerLoad,
+		flags: presetsFlags,
+	})
+	register(&command{
+		name:  "equalizer delete",
+		args:  "<name>",
+		help:  "Delete a preset",
+		run:   runEqualizerDelete,
+		flags: presetsFlags,
+	})
+}
+
+func presetsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&presetsPath, "presets", equalizer.DefaultPath(), "file of the equalizer presets")
+}
+
+// equalizerHeadset returns the headset of args[from:], which must have an
+// equalizer.
+func (s *session) equalizerHeadset(args []string, from int) (jabra.DeviceInfo, error) {
+	if len(args) < from || len(args) > from+1 {
+		if from == 0 {
+			return jabra.DeviceInfo{}, usageError("expected at most a serial number")
+		}
+		return jabra.DeviceInfo{}, usageError("expected a value and optionally a serial number")
+	}
+	device, err := s.headset(strings.Join(args[from:], ""))
+	if err != nil {
+		return jabra.DeviceInfo{}, err
+	}
+	if device.FeatureFlags == nil || !device.FeatureFlags.MusicEqualizer {
+		return jabra.DeviceInfo{}, fmt.Errorf("%s: %w", device.DeviceName, jabra.ErrNotSupported)
+	}
+	return device, nil
+}
+
+// setGains writes gains to device and turns its equalizer on.
+func (s *session) setGains(device jabra.DeviceInfo, gains []float32) error {
+	if err := s.backend.SetEqualizerGains(device.DeviceID, gains); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	if err := s.backend.EnableEqualizer(device.DeviceID, true); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return nil
+}
+
+func equalizerBands(bands []jabra.EqualizerBand) []schema.EqualizerBand {
+	document := make([]schema.EqualizerBand, 0, len(bands))
+	for _, band := range bands {
+		document = append(document, schema.EqualizerBand{Frequency: band.CenterFrequency, Gain: band.Gain, MaxGain: &band.MaxGain})
+	}
+	return document
+}
+
+func presetBands(bands []equalizer.Band) []schema.EqualizerBand {
+	document := make([]schema.EqualizerBand, 0, len(bands))
+	for _, band := range bands {
+		document = append(document, schema.EqualizerBand{Frequency: band.Frequency, Gain: band.Gain})
+	}
+	return document
+}
+
+// formatBands writes bands as "250 Hz +3, 500 Hz 0, ... dB".
+func formatBands(bands []schema.EqualizerBand) string {
+	formatted := make([]string, 0, len(bands))
+	for _, band := range bands {
+		formatted = append(formatted, fmt.Sprintf("%d Hz %s", band.Frequency, formatGain(band.Gain)))
+	}
+	return strings.Join(formatted, ", ") + " dB"
+}
+
+func formatGain(gain float32) string {
+	if gain > 0 {
+		return "+" + strconv.FormatFloat(float64(gain), 'g', -1, 32)
+	}
+	return strconv.FormatFloat(float64(gain), 'g', -1, 32)
+}
+
+func runEqualizerGet(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	device, err := s.equalizerHeadset(args, 0)
+	if err != nil {
+		return err
+	}
+	enabled, err := s.backend.EqualizerEnabled(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	bands, err := s.backend.EqualizerBands(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+
+	document := schema.Equalizer{SchemaVersion: schema.Version, Device: schema.NewDeviceRef(device), Enabled: enabled, Bands: equalizerBands(bands)}
+	return s.emit(document, func() {
+		fmt.Fprintf(s.stdout, "%s (%s): equalizer %s\n", device.DeviceName, device.SerialNumber, onOff(enabled))
+		w := tabwriter.NewWriter(s.stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, band := range document.Bands {
+			fmt.Fprintf(w, "%d Hz\t%s dB\t(±%g)\t\n", band.Frequency, formatGain(band.Gain), *band.MaxGain)
+		}
+		w.Flush()
+	})
+}
+
+func runEqualizerSet(s *session, args []string) error {
+	device, err := s.equalizerHeadset(args, 1)
+	if err != nil {
+		return err
+	}
+	var gains []float32
+	for _, field := range strings.Split(args[0], ",") {
+		gain, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+		if err != nil {
+			return usageError("gain %q is not a number", field)
+		}
+		gains = append(gains, float32(gain))
+	}
+
+	bands, err := s.backend.EqualizerBands(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	if len(gains) != len(bands) {
+		return usageError("%s has %d bands, not %d", device.DeviceName, len(bands), len(gains))
+	}
+	for i, band := range bands {
+		if gains[i] > band.MaxGain || gains[i] < -band.MaxGain {
+			return usageError("the %d Hz band of %s takes -%g to %g dB", band.CenterFrequency, device.DeviceName, band.MaxGain, band.MaxGain)
+		}
+	}
+	return s.setGains(device, gains)
+}
+
+func runEqualizerOn(s *session, args []string) error {
+	return s.enableEqualizer(args, true)
+}
+
+func runEqualizerOff(s *session, args []string) error {
+	return s.enableEqualizer(args, false)
+}
+
+func (s *session) enableEqualizer(args []string, enable bool) error {
+	device, err := s.equalizerHeadset(args, 0)
+	if err != nil {
+		return err
+	}
+	if err := s.backend.EnableEqualizer(device.DeviceID, enable); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return nil
+}
+
+func runEqualizerPresets(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	if len(args) > 0 {
+		return usageError("expected no arguments")
+	}
+	presets, err := equalizer.Open(presetsPath).List()
+	if err != nil {
+		return err
+	}
+
+	document := schema.EqualizerPresets{SchemaVersion: schema.Version, File: presetsPath, Presets: make([]schema.EqualizerPreset, 0, len(presets))}
+	for _, preset := range presets {
+		document.Presets = append(document.Presets, schema.EqualizerPreset{Name: preset.Name, Bands: presetBands(preset.Bands)})
+	}
+	return s.emit(document, func() {
+		if len(document.Presets) == 0 {
+			fmt.Fprintf(s.stdout, "No presets in %s\n", presetsPath)
+			return
+		}
+		w := tabwriter.NewWriter(s.stdout, 0, 0, 2, ' ', 0)
+		for _, preset := range document.Presets {
+			fmt.Fprintf(w, "%s\t%s\n", preset.Name, formatBands(preset.Bands))
+		}
+		w.Flush()
+	})
+}
+
+func runEqualizerSave(s *session, args []string) error {
+	device, err := s.equalizerHeadset(args, 1)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(args[0]) == "" {
+		return usageError("a preset needs a name")
+	}
+	bands, err := s.backend.EqualizerBands(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return equalizer.Open(presetsPath).Save(equalizer.FromBands(args[0], bands))
+}
+
+func runEqualizerLoad(s *session, args []string) error {
+	device, err := s.equalizerHeadset(args, 1)
+	if err != nil {
+		return err
+	}
+	preset, err := equalizer.Open(presetsPath).Get(args[0])
+	if errors.Is(err, equalizer.ErrNoPreset) {
+		return usageError("%s", err)
+	}
+	if err != nil {
+		return err
+	}
+	bands, err := s.backend.EqualizerBands(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	gains, err := preset.Gains(bands)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	return s.setGains(device, gains)
+}
+
+func runEqualizerDelete(s *session, args []string) error {
+	if len(args) != 1 {
+		return usageError("expected the name of a preset")
+	}
+	err := equalizer.Open(presetsPath).Delete(args[0])
+	if errors.Is(err, equalizer.ErrNoPreset) {
+		return usageError("%s", err)
+	}
+	return err
+}
@@ -0,0 +1,549 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Watchdog0x/jLink/internal/firmware"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var (
+	errNotConfirmed = errors.New("not confirmed")
+
+	authorizationID string
+	repositoryDir   string
+	assumeYes       bool
+	packageProduct  string
+	packageVariant  string
+	packageVersion  string
+
+	// stdin answers the confirmations, tests replace it.
+	stdin io.Reader = os.Stdin
+)
+
+func init() {
+	register(&command{
+		name:  "firmware info",
+		args:  "[serial]",
+		help:  "Print the firmware of the attached devices",
+		run:   runFirmwareInfo,
+		flags: outputFlags,
+	})
+	register(&command{
+		name:  "firmware check",
+		args:  "[serial]",
+		help:  "Ask the Jabra cloud for newer firmware",
+		run:   runFirmwareCheck,
+		flags: flagSets(authFlags, outputFlags),
+	})
+	register(&command{
+		name:  "firmware update",
+		args:  "<zip|version> [serial]",
+		help:  "Update a device with a firmware package or a version from the repository, the only headset by default",
+		run:   runFirmwareUpdate,
+		flags: flagSets(repositoryFlags, confirmFlags, outputFlags),
+	})
+	register(&command{
+		name:  "firmware rollback",
+		args:  "[serial]",
+		help:  "Go back to the firmware a device ran before its last update",
+		run:   runFirmwareRollback,
+		flags: flagSets(repositoryFlags, confirmFlags, outputFlags),
+	})
+	register(&command{
+		name:  "firmware add",
+		args:  "<zip> [serial]",
+		help:  "Add a firmware package to the repository, for the model of the only headset by default",
+		run:   runFirmwareAdd,
+		flags: flagSets(repositoryFlags, packageFlags, outputFlags),
+	})
+	register(&command{
+		name:  "firmware packages",
+		args:  "[serial]",
+		help:  "List the packages of the repository that fit the attached devices",
+		run:   runFirmwarePackages,
+		flags: flagSets(repositoryFlags, outputFlags),
+	})
+	register(&command{
+		name:  "firmware lock",
+		args:  "on|off|status [serial]",
+		help:  "Lock the firmware of a device against updates, the only headset by default",
+		run:   runFirmwareLock,
+		flags: outputFlags,
+	})
+}
+
+func authFlags(fs *flag.FlagSet) {
+	fs.StringVar(&authorizationID, "auth", "", "authorization ID for the Jabra cloud")
+}
+
+func repositoryFlags(fs *flag.FlagSet) {
+	fs.StringVar(&repositoryDir, "repository", firmware.DefaultRepository(), "directory of the offline firmware repository")
+}
+
+func confirmFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&assumeYes, "yes", false, "downgrade or install an unidentified package without asking")
+}
+
+func packageFlags(fs *flag.FlagSet) {
+	fs.StringVar(&packageProduct, "product", "", "hexadecimal product ID the package is for, instead of the headset's")
+	fs.StringVar(&packageVariant, "variant", "", "variant the package is for, default the headset's")
+	fs.StringVar(&packageVersion, "version", "", "firmware version of the package, default the one in its name")
+}
+
+// firmwareDevices returns the device chosen by serial in args, or all of them.
+func firmwareDevices(s *session, args []string) ([]jabra.DeviceInfo, error) {
+	switch len(args) {
+	case 0:
+		devices := s.list()
+		if len(devices) == 0 {
+			return nil, errNoDevice
+		}
+		return devices, nil
+	case 1:
+		device, err := s.bySerial(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []jabra.DeviceInfo{device}, nil
+	default:
+		return nil, usageError("expected at most one serial number")
+	}
+}
+
+func runFirmwareInfo(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	devices, err := firmwareDevices(s, args)
+	if err != nil {
+		return err
+	}
+
+	document := schema.FirmwareList{SchemaVersion: schema.Version, Devices: make([]schema.Firmware, 0, len(devices))}
+	for _, device := range devices {
+		version, err := s.backend.FirmwareVersion(device.DeviceID)
+		if err != nil && !device.IsInFirmwareUpdateMode {
+			return fmt.Errorf("%s: %w", device.DeviceName, err)
+		}
+		info := schema.Firmware{
+			Device:     schema.NewDeviceRef(device),
+			Version:    version,
+			UpdateMode: device.IsInFirmwareUpdateMode,
+		}
+		if device.IsDongle {
+			if bundle, err := s.backend.FirmwareVersionBundle(device.DeviceID); err == nil {
+				info.ChildVersion = bundle.Child
+			}
+		}
+		if device.FeatureFlags != nil {
+			info.NeedsPowerCycle = device.FeatureFlags.NeedsExplicitRebootAfterOta
+			info.NeedsCradle = device.FeatureFlags.NeedsToBePutInCradleToCompleteFwu
+		}
+		document.Devices = append(document.Devices, info)
+	}
+
+	return s.emit(document, func() {
+		for _, info := range document.Devices {
+			state := info.Version
+			if info.UpdateMode {
+				state = strings.TrimSpace(state + " in firmware update mode, run jlink firmware update to recover it")
+			}
+			fmt.Fprintf(s.stdout, "%s (%s): %s\n", info.Device.Name, info.Device.Serial, state)
+			if info.ChildVersion != "" {
+				fmt.Fprintf(s.stdout, "  connected headset: %s\n", info.ChildVersion)
+			}
+			if info.NeedsPowerCycle {
+				fmt.Fprintln(s.stdout, "  updates finish after turning it off and on again")
+			}
+			if info.NeedsCradle {
+				fmt.Fprintln(s.stdout, "  updates finish in the cradle")
+			}
+		}
+	})
+}
+
+func runFirmwareCheck(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	if authorizationID == "" {
+		return usageError("--auth is required, the Jabra cloud needs an authorization ID")
+	}
+	devices, err := firmwareDevices(s, args)
+	if err != nil {
+		return err
+	}
+
+	document := schema.FirmwareReleaseList{SchemaVersion: schema.Version, Releases: make([]schema.FirmwareRelease, 0, len(devices))}
+	for _, device := range devices {
+		latest, err := s.backend.LatestFirmwareInformation(device.DeviceID, authorizationID)
+		if errors.Is(err, jabra.ErrNoInformation) && len(args) == 0 {
+			continue // e.g. a dongle the cloud has nothing for
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", device.DeviceName, firmware.Explain(err))
+		}
+		available, err := s.backend.CheckForFirmwareUpdate(device.DeviceID, authorizationID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", device.DeviceName, firmware.Explain(err))
+		}
+		version, _ := s.backend.FirmwareVersion(device.DeviceID)
+		document.Releases = append(document.Releases, schema.FirmwareRelease{
+			Device:          schema.NewDeviceRef(device),
+			Version:         version,
+			Latest:          latest.Version,
+			UpdateAvailable: available,
+			ReleaseDate:     latest.ReleaseDate,
+			Stage:           latest.Stage,
+			ReleaseNotes:    latest.ReleaseNotes,
+		})
+	}
+
+	return s.emit(document, func() {
+		for _, release := range document.Releases {
+			if release.UpdateAvailable {
+				fmt.Fprintf(s.stdout, "%s: %s available, %s installed\n", release.Device.Name, release.Latest, release.Version)
+			} else {
+				fmt.Fprintf(s.stdout, "%s: %s is up to date\n", release.Device.Name, release.Version)
+			}
+		}
+	})
+}
+
+func runFirmwareUpdate(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported, progress is streamed by --output ndjson")
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected a firmware package or version and optionally a serial number")
+	}
+	serial := ""
+	if len(args) == 2 {
+		serial = args[1]
+	}
+
+	device, err := s.headset(serial)
+	if err != nil {
+		return err
+	}
+	repository := firmware.OpenRepository(repositoryDir)
+
+	// A version is looked up in the repository, a package found in it
+	// has to fit the device.
+	path := args[0]
+	to, known := firmware.PackageVersion(path)
+	if !strings.HasSuffix(path, ".zip") && !strings.ContainsRune(path, filepath.Separator) {
+		p, err := repository.Find(device, path)
+		if err != nil {
+			return err
+		}
+		path, to, known = repository.Path(p), p.Version, true
+	} else if p, found, err := repository.Identify(path); err != nil {
+		return err
+	} else if found {
+		if !p.Fits(device) {
+			return &firmware.MismatchError{Package: p, Device: device}
+		}
+		to, known = p.Version, true
+	}
+
+	return installFirmware(s, repository, device, path, to, known)
+}
+
+func runFirmwareRollback(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported, progress is streamed by --output ndjson")
+	}
+	if len(args) > 1 {
+		return usageError("expected at most one serial number")
+	}
+	device, err := s.headset(strings.Join(args, ""))
+	if err != nil {
+		return err
+	}
+
+	repository := firmware.OpenRepository(repositoryDir)
+	current, err := s.backend.FirmwareVersion(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	previous, found, err := repository.PreviousVersion(device.SerialNumber, current)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no update of %s to %s is recorded in %s, install the version to go back to with jlink firmware update <version>",
+			device.DeviceName, current, repository.Dir())
+	}
+	p, err := repository.Find(device, previous)
+	if err != nil {
+		return err
+	}
+
+	return installFirmware(s, repository, device, repository.Path(p), p.Version, true)
+}
+
+// installFirmware updates device with the package at path, asking first
+// when it installs an older version than the one running, or a package
+// whose version and product are unknown and so were not checked. Every
+// update started is recorded in the audit log of repository.
+func installFirmware(s *session, repository *firmware.Repository, device jabra.DeviceInfo, path, to string, known bool) error {
+	from, _ := s.backend.FirmwareVersion(device.DeviceID)
+	if known && to == from && !device.IsInFirmwareUpdateMode {
+		return firmware.Explain(jabra.ErrFirmwareUpToDate)
+	}
+	if err := firmware.CheckLock(s.backend, device.DeviceID); err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	if !known {
+		// Nothing to ask about a file that is no package at all
+		if err := firmware.CheckPackage(path); err != nil {
+			return err
+		}
+		if err := confirm(s, fmt.Sprintf("%s is not identified, its version and product are not checked. Install it on %s anyway?",
+			filepath.Base(path), device.DeviceName)); err != nil {
+			return err
+		}
+		to = "?"
+	}
+	downgrade := known && from != "" && firmware.CompareVersions(to, from) < 0
+	if downgrade {
+		if err := confirm(s, fmt.Sprintf("Downgrade %s from %s to %s?", device.DeviceName, from, to)); err != nil {
+			return err
+		}
+	}
+
+	ref := schema.NewDeviceRef(device)
+	progressShown := false
+	err := firmware.Update(s.ctx, s.backend, device.DeviceID, path, s.firmware, func(progress jabra.FirmwareProgress) {
+		switch outputFormat {
+		case outputNDJSON:
+			s.emit(schema.FirmwareProgress{SchemaVersion: schema.Version, Device: ref, Status: progress.Status.String(), Percentage: progress.Percentage}, nil)
+		case outputJSON:
+		default:
+			// Redraw one line, like the progress of the Jabra updater.
+			fmt.Fprintf(s.stdout, "\r%3d%% complete   %s -> %s   [%04x:%04x] %s",
+				progress.Percentage, from, to, device.VendorID, device.ProductID, device.DeviceName)
+			progressShown = true
+		}
+	})
+	if progressShown {
+		fmt.Fprintln(s.stdout)
+	}
+	if err == nil && !known {
+		// The device reattached with the new firmware.
+		if updated, err := s.bySerial(device.SerialNumber); err == nil {
+			to, _ = s.backend.FirmwareVersion(updated.DeviceID)
+		}
+	}
+
+	record := firmware.Record{
+		Time:      now(),
+		Serial:    device.SerialNumber,
+		Device:    device.DeviceName,
+		ProductID: device.ProductID,
+		From:      from,
+		To:        to,
+		Package:   path,
+		Downgrade: downgrade,
+		Result:    "completed",
+	}
+	if err != nil {
+		record.Result = err.Error()
+	}
+	if auditErr := repository.Audit(record); auditErr != nil {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%s was updated, but the audit record was not written: %w", device.DeviceName, auditErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	document := schema.FirmwareUpdate{
+		SchemaVersion: schema.Version,
+		Device:        ref,
+		From:          from,
+		To:            to,
+		Downgrade:     downgrade,
+		FollowUps:     firmware.FollowUps(device.FeatureFlags),
+	}
+	return s.emit(document, func() {
+		fmt.Fprintf(s.stdout, "%s updated to %s\n", device.DeviceName, to)
+		for _, followUp := range document.FollowUps {
+			fmt.Fprintln(s.stdout, followUp)
+		}
+	})
+}
+
+// confirm asks question on stdin, unless --yes answered it already.
+func confirm(s *session, question string) error {
+	if assumeYes {
+		return nil
+	}
+	if outputFormat != outputText {
+		return usageError("%s Answer with --yes", question)
+	}
+
+	fmt.Fprintf(s.stdout, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return errNotConfirmed
+	}
+}
+
+func runFirmwareAdd(s *session, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected a firmware package and optionally a serial number")
+	}
+
+	var (
+		productID uint16
+		variant   = packageVariant
+	)
+	if packageProduct != "" {
+		id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(packageProduct), "0x"), 16, 16)
+		if err != nil {
+			return usageError("--product %s is not a hexadecimal product ID", packageProduct)
+		}
+		productID = uint16(id)
+	} else {
+		// The package is for the model of the device.
+		device, err := s.headset(strings.Join(args[1:], ""))
+		if err != nil {
+			return err
+		}
+		productID = device.ProductID
+		if variant == "" {
+			variant = device.Variant
+		}
+	}
+
+	repository := firmware.OpenRepository(repositoryDir)
+	p, err := repository.Add(args[0], productID, variant, packageVersion)
+	if err != nil {
+		return err
+	}
+
+	return s.emit(schema.FirmwarePackageAdded{SchemaVersion: schema.Version, Repository: repository.Dir(), Package: newFirmwarePackage(p, "")}, func() {
+		fmt.Fprintf(s.stdout, "Added %s, firmware %s for product %04x", p.File, p.Version, p.ProductID)
+		if p.Variant != "" {
+			fmt.Fprintf(s.stdout, " variant %s", p.Variant)
+		}
+		fmt.Fprintln(s.stdout)
+	})
+}
+
+func runFirmwarePackages(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	devices, err := firmwareDevices(s, args)
+	if err != nil {
+		return err
+	}
+
+	repository := firmware.OpenRepository(repositoryDir)
+	document := schema.FirmwarePackageList{SchemaVersion: schema.Version, Repository: repository.Dir(), Devices: make([]schema.DevicePackages, 0, len(devices))}
+	for _, device := range devices {
+		packages, err := repository.Applicable(device)
+		if err != nil {
+			return err
+		}
+		version, _ := s.backend.FirmwareVersion(device.DeviceID)
+		entry := schema.DevicePackages{Device: schema.NewDeviceRef(device), Version: version, Packages: make([]schema.FirmwarePackage, 0, len(packages))}
+		for _, p := range packages {
+			status := "installed"
+			switch compared := firmware.CompareVersions(p.Version, version); {
+			case compared > 0:
+				status = "newer"
+			case compared < 0:
+				status = "older"
+			}
+			entry.Packages = append(entry.Packages, newFirmwarePackage(p, status))
+		}
+		document.Devices = append(document.Devices, entry)
+	}
+
+	return s.emit(document, func() {
+		w := tabwriter.NewWriter(s.stdout, 0, 0, 2, ' ', 0)
+		for _, entry := range document.Devices {
+			fmt.Fprintf(w, "%s (%s), %s installed\n", entry.Device.Name, entry.Device.Serial, entry.Version)
+			if len(entry.Packages) == 0 {
+				fmt.Fprintln(w, "  no packages")
+			}
+			for _, p := range entry.Packages {
+				fmt.Fprintf(w, "  %s\t%s\t%s\n", p.Version, p.Status, p.File)
+			}
+		}
+		w.Flush()
+	})
+}
+
+func newFirmwarePackage(p firmware.Package, status string) schema.FirmwarePackage {
+	return schema.FirmwarePackage{
+		File:      p.File,
+		ProductID: p.ProductID,
+		Variant:   p.Variant,
+		Version:   p.Version,
+		Status:    status,
+	}
+}
+
+func runFirmwareLock(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected on, off or status and optionally a serial number")
+	}
+
+	switch args[0] {
+	case "on", "off":
+		device, err := s.headset(strings.Join(args[1:], ""))
+		if err != nil {
+			return err
+		}
+		if err := s.backend.SetFirmwareLock(device.DeviceID, args[0] == "on"); err != nil {
+			return fmt.Errorf("%s: %w", device.DeviceName, err)
+		}
+		return nil
+	case "status":
+	default:
+		return usageError("expected on, off or status")
+	}
+
+	devices, err := firmwareDevices(s, args[1:])
+	if err != nil {
+		return err
+	}
+	document := schema.FirmwareLockList{SchemaVersion: schema.Version, Devices: make([]schema.FirmwareLock, 0, len(devices))}
+	for _, device := range devices {
+		locked, err := s.backend.FirmwareLock(device.DeviceID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", device.DeviceName, err)
+		}
+		document.Devices = append(document.Devices, schema.FirmwareLock{Device: schema.NewDeviceRef(device), Locked: locked})
+	}
+
+	return s.emit(document, func() {
+		for _, lock := range document.Devices {
+			fmt.Fprintf(s.stdout, "%s (%s): %s\n", lock.Device.Name, lock.Device.Serial, onOff(lock.Locked))
+		}
+	})
+}
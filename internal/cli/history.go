@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"slices"
+
+	"github.com/Watchdog0x/jLink/internal/history"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var (
+	historyMode bool
+	historyDays int
+)
+
+func historyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&historyMode, "history", false, "print the recorded battery history with rates and estimates instead")
+	fs.IntVar(&historyDays, "days", 7, "days shown by --history")
+}
+
+// runBatteryHistory reports what jlinkd or the UI recorded, the headsets do
+// not need to be attached.
+func runBatteryHistory(s *session) error {
+	if watchMode {
+		return usageError("--history cannot be watched")
+	}
+	if historyDays < 1 {
+		return usageError("--days must be at least 1")
+	}
+
+	samples, err := history.NewStore(history.DefaultDir()).Samples("")
+	if err != nil {
+		return err
+	}
+	bySerial := make(map[string][]history.Sample)
+	for _, sample := range samples {
+		bySerial[sample.Serial] = append(bySerial[sample.Serial], sample)
+	}
+	if len(bySerial) == 0 {
+		return fmt.Errorf("%w: no battery history recorded in %s", errNoDevice, history.DefaultDir())
+	}
+
+	to := now()
+	from := to.AddDate(0, 0, 1-historyDays)
+
+	document := schema.BatteryHistory{SchemaVersion: schema.Version, Devices: make([]schema.DeviceHistory, 0, len(bySerial))}
+	for serial, samples := range bySerial {
+		last := samples[len(samples)-1]
+		rates := history.RatesOf(samples)
+		device := schema.DeviceHistory{
+			Name:           last.Name,
+			Serial:         serial,
+			LevelInPercent: last.Level,
+			Charging:       last.Charging,
+			DischargeRate:  rates.Discharge,
+			ChargeRate:     rates.Charge,
+		}
+		if estimate, ok := history.EstimateOf(samples); ok {
+			minutes := int(estimate.Remaining.Minutes())
+			device.RemainingMinutes = &minutes
+		}
+		for _, day := range history.Days(samples, from, to) {
+			device.Days = append(device.Days, schema.HistoryDay{Date: day.Date.Format("2006-01-02"), Hours: day.Hours})
+		}
+		document.Devices = append(document.Devices, device)
+	}
+	slices.SortFunc(document.Devices, func(a, b schema.DeviceHistory) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Serial, b.Serial))
+	})
+
+	return s.emit(document, func() {
+		for _, device := range document.Devices {
+			state := ""
+			if device.Charging {
+				state = " charging"
+			}
+			fmt.Fprintf(s.stdout, "%s (%s): %d%%%s", device.Name, device.Serial, device.LevelInPercent, state)
+			if estimate, ok := history.EstimateOf(bySerial[device.Serial]); ok {
+				fmt.Fprintf(s.stdout, ", %s", estimate)
+			}
+			fmt.Fprintln(s.stdout)
+			fmt.Fprintf(s.stdout, "  discharge %.1f%%/h, charge %.1f%%/h\n", device.DischargeRate, device.ChargeRate)
+			for _, day := range device.Days {
+				fmt.Fprintf(s.stdout, "  %s |%s|\n", day.Date, history.Sparkline(day.Hours[:]))
+			}
+		}
+	})
+}
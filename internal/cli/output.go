@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+var (
+	outputFormat string
+	watchMode    bool
+
+	// now stamps watch events, tests replace it.
+	now = time.Now
+)
+
+// outputFlags registers --output and --watch for commands that read state.
+func outputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&outputFormat, "output", outputText, "output format: text, json or ndjson")
+	fs.BoolVar(&watchMode, "watch", false, "keep running and print an event per change (needs --output ndjson)")
+}
+
+// checkOutputFlags validates --output and --watch, textWatch allows
+// --watch with text output.
+func checkOutputFlags(textWatch bool) error {
+	switch outputFormat {
+	case "", outputText, outputJSON, outputNDJSON:
+	default:
+		return fmt.Errorf("unknown output format %q", outputFormat)
+	}
+	if watchMode && outputFormat != outputNDJSON && !(textWatch && outputFormat == outputText) {
+		return fmt.Errorf("--watch needs --output ndjson")
+	}
+	return nil
+}
+
+// emit writes document as JSON for --output json/ndjson, otherwise it calls text.
+func (s *session) emit(document any, text func()) error {
+	switch outputFormat {
+	case outputJSON:
+		encoder := json.NewEncoder(s.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document)
+	case outputNDJSON:
+		return json.NewEncoder(s.stdout).Encode(document)
+	default:
+		text()
+		return nil
+	}
+}
+
+// watch polls the backend and streams an event for each change of the given
+// types until the session context is done. The current state is reported
+// first, as if every device had just attached.
+func (s *session) watch(types ...schema.EventType) error {
+	var (
+		encoder      = json.NewEncoder(s.stdout)
+		devices      = make(map[uint16]schema.Device)
+		batteries    = make(map[uint16]schema.Battery)
+		pairingLists = make(map[uint16]schema.PairingList)
+	)
+
+	send := func(event schema.Event) error {
+		if !slices.Contains(types, event.Type) {
+			return nil
+		}
+		event.SchemaVersion = schema.Version
+		event.Time = now()
+		return encoder.Encode(event)
+	}
+
+	for {
+		current := s.list()
+
+		for _, deviceInfo := range current {
+			device, known := devices[deviceInfo.DeviceID]
+			if !known {
+				device = s.device(deviceInfo)
+				devices[deviceInfo.DeviceID] = device
+				if err := send(schema.Event{Type: schema.EventAttached, Device: device}); err != nil {
+					return err
+				}
+			}
+
+			if battery, ok := s.battery(deviceInfo); ok && !reflect.DeepEqual(battery, batteries[deviceInfo.DeviceID]) {
+				batteries[deviceInfo.DeviceID] = battery
+				if err := send(schema.Event{Type: schema.EventBattery, Device: device, Battery: &battery}); err != nil {
+					return err
+				}
+			}
+
+			if pairingList, ok := s.pairingList(deviceInfo); ok && !reflect.DeepEqual(pairingList, pairingLists[deviceInfo.DeviceID]) {
+				pairingLists[deviceInfo.DeviceID] = pairingList
+				if err := send(schema.Event{Type: schema.EventPairingList, Device: device, PairingList: &pairingList}); err != nil {
+					return err
+				}
+			}
+		}
+
+		for id, device := range devices {
+			if slices.ContainsFunc(current, func(deviceInfo jabra.DeviceInfo) bool { return deviceInfo.DeviceID == id }) {
+				continue
+			}
+			delete(devices, id)
+			delete(batteries, id)
+			delete(pairingLists, id)
+			if err := send(schema.Event{Type: schema.EventRemoved, Device: device}); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// device builds the schema.Device for deviceInfo, including its firmware version when available.
+func (s *session) device(deviceInfo jabra.DeviceInfo) schema.Device {
+	firmwareVersion, _ := s.backend.FirmwareVersion(deviceInfo.DeviceID)
+	return schema.NewDevice(deviceInfo, firmwareVersion)
+}
+
+func (s *session) battery(deviceInfo jabra.DeviceInfo) (schema.Battery, bool) {
+	if deviceInfo.IsDongle {
+		return schema.Battery{}, false
+	}
+	batteryStatus, err := s.backend.BatteryStatus(deviceInfo.DeviceID)
+	if err != nil {
+		return schema.Battery{}, false
+	}
+	return schema.NewBattery(deviceInfo, batteryStatus), true
+}
+
+func (s *session) pairingList(deviceInfo jabra.DeviceInfo) (schema.PairingList, bool) {
+	if !deviceInfo.IsDongle || deviceInfo.FeatureFlags == nil || !deviceInfo.FeatureFlags.PairingList {
+		return schema.PairingList{}, false
+	}
+	return schema.NewPairingList(deviceInfo, s.backend.PairingList(deviceInfo.DeviceID)), true
+}
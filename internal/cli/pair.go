@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var (
+	errNotPaired = fmt.Errorf("is not in the pairing list: %w", errNoDevice)
+
+	searchTimeout time.Duration
+	dongleSerial  string
+)
+
+func init() {
+	register(&command{
+		name:  "pair list",
+		help:  "List the devices remembered by the dongle",
+		run:   runPairList,
+		flags: flagSets(dongleFlags, outputFlags),
+	})
+	register(&command{
+		name:  "pair search",
+		help:  "Search for new Bluetooth devices",
+		run:   runPairSearch,
+		flags: flagSets(dongleFlags, searchFlags, outputFlags),
+	})
+	register(&command{
+		name:  "pair connect",
+		args:  "<addr>",
+		help:  "Connect a remembered device, or pair a new one found by searching",
+		run:   runPairConnect,
+		flags: flagSets(dongleFlags, searchFlags),
+	})
+	register(&command{name: "pair disconnect", args: "<addr>", help: "Disconnect a remembered device", run: runPairDisconnect, flags: dongleFlags})
+	register(&command{name: "pair remove", args: "<addr>", help: "Remove a device from the pairing list", run: runPairRemove, flags: dongleFlags})
+	register(&command{name: "pair clear", help: "Clear the pairing list of the dongle", run: runPairClear, flags: dongleFlags})
+	register(&command{
+		name:  "dongle autopairing",
+		args:  "[on|off]",
+		help:  "Print or change the auto pairing setting of the dongle",
+		run:   runDongleAutoPairing,
+		flags: dongleFlags,
+	})
+}
+
+// dongleFlags registers --dongle for commands that act on a dongle.
+func dongleFlags(fs *flag.FlagSet) {
+	fs.StringVar(&dongleSerial, "dongle", "", "serial number of the dongle to use when several are attached")
+}
+
+func searchFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&searchTimeout, "timeout", 30*time.Second, "give up searching after this long")
+}
+
+func runPairList(s *session, args []string) error {
+	if watchMode {
+		return s.watch(schema.EventPairingList, schema.EventRemoved)
+	}
+
+	dongle, err := s.dongle()
+	if err != nil {
+		return err
+	}
+	pairingList, ok := s.pairingList(dongle)
+	if !ok {
+		return jabra.ErrNotSupported
+	}
+
+	return s.emit(schema.PairingListDocument{SchemaVersion: schema.Version, PairingList: pairingList}, func() {
+		for _, device := range pairingList.Devices {
+			printPairedDevice(s, device)
+		}
+	})
+}
+
+func runPairSearch(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported, search results are streamed by --output ndjson")
+	}
+
+	dongle, err := s.dongle()
+	if err != nil {
+		return err
+	}
+
+	// Text and ndjson stream each device as it is found, json prints the list once the search ends.
+	found := schema.PairingList{Dongle: schema.NewDeviceRef(dongle), ListType: jabra.SearchComplete.String(), Devices: []schema.PairedDevice{}}
+	if _, err = search(s, dongle, func(device jabra.PairedDevice) bool {
+		pairedDevice := schema.NewPairedDevice(device)
+		found.Devices = append(found.Devices, pairedDevice)
+		if outputFormat != outputJSON {
+			s.emit(schema.SearchResult{SchemaVersion: schema.Version, Dongle: found.Dongle, Device: pairedDevice}, func() {
+				printPairedDevice(s, pairedDevice)
+			})
+		}
+		return false
+	}); err != nil {
+		return err
+	}
+
+	if outputFormat == outputJSON {
+		return s.emit(schema.PairingListDocument{SchemaVersion: schema.Version, PairingList: found}, nil)
+	}
+	return nil
+}
+
+func runPairConnect(s *session, args []string) error {
+	dongle, device, err := pairedDevice(s, args)
+	if err == nil {
+		return s.backend.ConnectPairedDevice(dongle.DeviceID, device)
+	}
+	if !errors.Is(err, errNotPaired) {
+		return err
+	}
+
+	// Not remembered by the dongle, look for it among new devices.
+	btAddr, _ := jabra.ParseBTAddr(args[0])
+	found, err := search(s, dongle, func(device jabra.PairedDevice) bool {
+		return device.DeviceBTAddr == btAddr
+	})
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return fmt.Errorf("%w: %s was not found while searching", errNoDevice, args[0])
+	}
+
+	if err := s.backend.ConnectNewDevice(dongle.DeviceID, *found); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.stdout, "Connected %s\n", found.DeviceName)
+	return nil
+}
+
+func runPairDisconnect(s *session, args []string) error {
+	dongle, device, err := pairedDevice(s, args)
+	if err != nil {
+		return err
+	}
+	return s.backend.DisconnectPairedDevice(dongle.DeviceID, device)
+}
+
+func runPairRemove(s *session, args []string) error {
+	dongle, device, err := pairedDevice(s, args)
+	if err != nil {
+		return err
+	}
+	return s.backend.ClearPairedDevice(dongle.DeviceID, device)
+}
+
+func runPairClear(s *session, args []string) error {
+	dongle, err := s.dongle()
+	if err != nil {
+		return err
+	}
+	return s.backend.ClearPairingList(dongle.DeviceID)
+}
+
+func runDongleAutoPairing(s *session, args []string) error {
+	dongle, err := s.dongle()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 0:
+		enabled, err := s.backend.AutoPairing(dongle.DeviceID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.stdout, onOff(enabled))
+		return nil
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		return s.backend.SetAutoPairing(dongle.DeviceID, args[0] == "on")
+	default:
+		return usageError("expected on or off")
+	}
+}
+
+// pairedDevice resolves the address in args to an entry of the dongle's
+// pairing list. The dongle is returned along with errNotPaired when the
+// address is not in the list.
+func pairedDevice(s *session, args []string) (jabra.DeviceInfo, jabra.PairedDevice, error) {
+	if len(args) != 1 {
+		return jabra.DeviceInfo{}, jabra.PairedDevice{}, usageError("expected a bluetooth address")
+	}
+	btAddr, err := jabra.ParseBTAddr(args[0])
+	if err != nil {
+		return jabra.DeviceInfo{}, jabra.PairedDevice{}, usageError("%s", err)
+	}
+
+	dongle, err := s.dongle()
+	if err != nil {
+		return jabra.DeviceInfo{}, jabra.PairedDevice{}, err
+	}
+
+	pairedDevices := s.backend.PairingList(dongle.DeviceID).PairedDevices
+	index := slices.IndexFunc(pairedDevices, func(device jabra.PairedDevice) bool { return device.DeviceBTAddr == btAddr })
+	if index == -1 {
+		return dongle, jabra.PairedDevice{}, fmt.Errorf("%s %w", args[0], errNotPaired)
+	}
+
+	return dongle, pairedDevices[index], nil
+}
+
+// search puts the dongle in pairing mode and reports each newly found device
+// to found until it returns true, the search completes or searchTimeout passes.
+func search(s *session, dongle jabra.DeviceInfo, found func(device jabra.PairedDevice) bool) (*jabra.PairedDevice, error) {
+	if err := s.backend.SetBTPairing(dongle.DeviceID); err != nil {
+		return nil, err
+	}
+	defer s.backend.StopBTPairing(dongle.DeviceID)
+
+	if err := s.backend.SearchNewDevices(dongle.DeviceID); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[[6]byte]bool)
+	deadline := time.Now().Add(searchTimeout)
+	for time.Now().Before(deadline) {
+		searchDeviceList := s.backend.SearchDeviceList(dongle.DeviceID)
+		if searchDeviceList != nil {
+			for _, device := range searchDeviceList.PairedDevices {
+				if seen[device.DeviceBTAddr] {
+					continue
+				}
+				seen[device.DeviceBTAddr] = true
+				if found(device) {
+					return &device, nil
+				}
+			}
+			if searchDeviceList.ListType == jabra.SearchComplete {
+				return nil, nil
+			}
+		}
+		time.Sleep(pollInterval)
+	}
+
+	return nil, nil
+}
+
+func printPairedDevice(s *session, device schema.PairedDevice) {
+	connected := ""
+	if device.Connected {
+		connected = " (Connected)"
+	}
+	fmt.Fprintf(s.stdout, "%s  %s%s\n", device.Address, device.Name, connected)
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/firmware"
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+var (
+	// scanTimeout bounds the wait for the backend's first scan.
+	scanTimeout = 10 * time.Second
+	// settleTime is waited after the first scan, headsets behind a dongle
+	// are reported shortly after the dongle itself.
+	settleTime = time.Second
+	// pollInterval is how often state the SDK does not push is read.
+	pollInterval = time.Second
+)
+
+// session is a short lived backend session for a single command.
+type session struct {
+	ctx     context.Context
+	backend jabra.Backend
+	stdout  io.Writer
+
+	mu      sync.Mutex
+	devices map[uint16]jabra.DeviceInfo
+
+	// firmware receives the FirmwareProgress callbacks, reports that find
+	// it full are dropped.
+	firmware chan firmware.Event
+	// attached receives every DeviceAttached callback, including those of
+	// the first scan. Devices that find it full are dropped.
+	attached chan jabra.DeviceInfo
+	// removed receives the DeviceRemoved callbacks, like attached.
+	removed chan uint16
+	// settingsChanged receives the SettingsChanged callbacks, like firmware.
+	settingsChanged chan settingsChange
+	// ambienceChanged receives the AmbienceChanged callbacks, like firmware.
+	ambienceChanged chan ambienceChange
+	// busylightChanged receives the BusylightChanged callbacks, like
+	// firmware.
+	busylightChanged chan busylightChange
+	// hidInput receives the HidInput callbacks, like firmware.
+	hidInput chan hidInput
+	// rawHidInput receives the RawHidInput callbacks, like firmware.
+	rawHidInput chan rawHidInput
+}
+
+type settingsChange struct {
+	deviceID uint16
+	settings []jabra.Setting
+}
+
+type ambienceChange struct {
+	deviceID uint16
+	event    jabra.AmbienceEvent
+}
+
+type busylightChange struct {
+	deviceID uint16
+	on       bool
+}
+
+type hidInput struct {
+	deviceID uint16
+	input    jabra.HidInput
+	value    bool
+}
+
+type rawHidInput struct {
+	deviceID  uint16
+	usagePage uint16
+	usage     uint16
+	value     bool
+}
+
+func openSession(ctx context.Context, backend jabra.Backend, stdout io.Writer) (*session, error) {
+	s := &session{
+		ctx:              ctx,
+		backend:          backend,
+		stdout:           stdout,
+		devices:          make(map[uint16]jabra.DeviceInfo),
+		firmware:         make(chan firmware.Event, 100),
+		attached:         make(chan jabra.DeviceInfo, 100),
+		removed:          make(chan uint16, 100),
+		settingsChanged:  make(chan settingsChange, 100),
+		ambienceChanged:  make(chan ambienceChange, 100),
+		busylightChanged: make(chan busylightChange, 100),
+		hidInput:         make(chan hidInput, 100),
+		rawHidInput:      make(chan rawHidInput, 100),
+	}
+
+	scanned := make(chan struct{})
+	var once sync.Once
+	if err := backend.Initialize("JabraLink", jabra.Callbacks{
+		FirstScanDone: func() { once.Do(func() { close(scanned) }) },
+		DeviceAttached: func(deviceInfo jabra.DeviceInfo) {
+			s.mu.Lock()
+			s.devices[deviceInfo.DeviceID] = deviceInfo
+			s.mu.Unlock()
+			select {
+			case s.attached <- deviceInfo:
+			default:
+			}
+		},
+		DeviceRemoved: func(deviceID uint16) {
+			s.mu.Lock()
+			delete(s.devices, deviceID)
+			s.mu.Unlock()
+			select {
+			case s.removed <- deviceID:
+			default:
+			}
+		},
+		FirmwareProgress: func(deviceID uint16, progress jabra.FirmwareProgress) {
+			select {
+			case s.firmware <- firmware.Event{DeviceID: deviceID, Progress: progress}:
+			default:
+			}
+		},
+		SettingsChanged: func(deviceID uint16, settings []jabra.Setting) {
+			select {
+			case s.settingsChanged <- settingsChange{deviceID: deviceID, settings: settings}:
+			default:
+			}
+		},
+		AmbienceChanged: func(deviceID uint16, event jabra.AmbienceEvent) {
+			select {
+			case s.ambienceChanged <- ambienceChange{deviceID: deviceID, event: event}:
+			default:
+			}
+		},
+		BusylightChanged: func(deviceID uint16, on bool) {
+			select {
+			case s.busylightChanged <- busylightChange{deviceID: deviceID, on: on}:
+			default:
+			}
+		},
+		HidInput: func(deviceID uint16, input jabra.HidInput, value bool) {
+			select {
+			case s.hidInput <- hidInput{deviceID: deviceID, input: input, value: value}:
+			default:
+			}
+		},
+		RawHidInput: func(deviceID uint16, usagePage, usage uint16, value bool) {
+			select {
+			case s.rawHidInput <- rawHidInput{deviceID: deviceID, usagePage: usagePage, usage: usage, value: value}:
+			default:
+			}
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-scanned:
+	case <-time.After(scanTimeout):
+	}
+	time.Sleep(settleTime)
+
+	return s, nil
+}
+
+func (s *session) close() {
+	s.backend.Uninitialize()
+}
+
+// list returns the attached devices ordered by device ID.
+func (s *session) list() []jabra.DeviceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices := make([]jabra.DeviceInfo, 0, len(s.devices))
+	for _, device := range s.devices {
+		devices = append(devices, device)
+	}
+	slices.SortFunc(devices, func(a, b jabra.DeviceInfo) int { return int(a.DeviceID) - int(b.DeviceID) })
+
+	return devices
+}
+
+// dongle returns the dongle chosen with --dongle, or the only one attached.
+func (s *session) dongle() (jabra.DeviceInfo, error) {
+	if dongleSerial != "" {
+		device, err := s.bySerial(dongleSerial)
+		if err != nil {
+			return jabra.DeviceInfo{}, err
+		}
+		if !device.IsDongle {
+			return jabra.DeviceInfo{}, fmt.Errorf("%w: %s is not a dongle", errNoDevice, device.DeviceName)
+		}
+		return device, nil
+	}
+
+	dongles := slices.DeleteFunc(s.list(), func(device jabra.DeviceInfo) bool { return !device.IsDongle })
+	switch len(dongles) {
+	case 0:
+		return jabra.DeviceInfo{}, fmt.Errorf("%w: no dongle attached", errNoDevice)
+	case 1:
+		return dongles[0], nil
+	default:
+		return jabra.DeviceInfo{}, usageError("%d dongles attached, choose one with --dongle <serial>", len(dongles))
+	}
+}
+
+func (s *session) headsets() []jabra.DeviceInfo {
+	return slices.DeleteFunc(s.list(), func(device jabra.DeviceInfo) bool { return device.IsDongle })
+}
+
+// headset returns the device with serial, or the only headset attached
+// when serial is empty.
+func (s *session) headset(serial string) (jabra.DeviceInfo, error) {
+	if serial != "" {
+		return s.bySerial(serial)
+	}
+
+	headsets := s.headsets()
+	switch len(headsets) {
+	case 0:
+		return jabra.DeviceInfo{}, fmt.Errorf("%w: no headset attached", errNoDevice)
+	case 1:
+		return headsets[0], nil
+	default:
+		return jabra.DeviceInfo{}, usageError("%d headsets attached, choose one by serial number", len(headsets))
+	}
+}
+
+// byID returns the attached device with deviceID.
+func (s *session) byID(deviceID uint16) (jabra.DeviceInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	device, ok := s.devices[deviceID]
+	return device, ok
+}
+
+func (s *session) bySerial(serial string) (jabra.DeviceInfo, error) {
+	for _, device := range s.list() {
+		if device.SerialNumber == serial {
+			return device, nil
+		}
+	}
+	return jabra.DeviceInfo{}, fmt.Errorf("%w: no device with serial %s", errNoDevice, serial)
+}
@@ -0,0 +1,440 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/settings"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/schema"
+)
+
+var (
+	sdkFormat bool
+	loadMode  string
+)
+
+func init() {
+	register(&command{
+		name:  "settings export",
+		args:  "<file> [serial]",
+		help:  "Save the settings of a device to a YAML file, - for stdout, the only headset by default",
+		run:   runSettingsExport,
+		flags: flagSets(formatFlags, outputFlags),
+	})
+	register(&command{
+		name:  "settings import",
+		args:  "<file> [serial]",
+		help:  "Write the settings of a file to a device, the only headset by default",
+		run:   runSettingsImport,
+		flags: flagSets(formatFlags, loadModeFlags, outputFlags),
+	})
+	register(&command{
+		name:  "settings diff",
+		args:  "<serial|file> <serial|file>",
+		help:  "Show the settings two devices or files disagree on",
+		run:   runSettingsDiff,
+		flags: flagSets(formatFlags, outputFlags),
+	})
+	register(&command{
+		name:  "settings watch",
+		args:  "[serial]",
+		help:  "Print every setting that changes on the devices, or on the one with serial",
+		run:   runSettingsWatch,
+		flags: outputFlags,
+	})
+}
+
+func formatFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&sdkFormat, "sdk", false, "use the settings file format of libjabra instead of YAML")
+}
+
+func loadModeFlags(fs *flag.FlagSet) {
+	fs.StringVar(&loadMode, "mode", "express", "express writes the settings, retrieve only shows what would change")
+}
+
+// explainSettingsFile points at the YAML format when libjabra turns down
+// its own settings files, which current versions only keep as stubs.
+func explainSettingsFile(err error) error {
+	if errors.Is(err, jabra.ErrNotSupported) || errors.Is(err, jabra.ErrOtherError) {
+		return fmt.Errorf("%w, this version of libjabra does not handle settings files, leave out --sdk to use YAML", err)
+	}
+	return err
+}
+
+func runSettingsExport(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected a file and optionally a serial number")
+	}
+	path := args[0]
+	device, err := s.headset(strings.Join(args[1:], ""))
+	if err != nil {
+		return err
+	}
+
+	document := schema.SettingsExport{SchemaVersion: schema.Version, Device: schema.NewDeviceRef(device), File: path, Format: "yaml"}
+	if sdkFormat {
+		if path == "-" {
+			return usageError("the sdk format is only written to files")
+		}
+		if err := s.backend.SaveSettingsToFile(device.DeviceID, path); err != nil {
+			return fmt.Errorf("%s: %w", device.DeviceName, explainSettingsFile(err))
+		}
+		document.Format = "sdk"
+		return s.emit(document, func() {
+			fmt.Fprintf(s.stdout, "Saved the settings of %s to %s\n", device.DeviceName, path)
+		})
+	}
+
+	file, err := s.settingsFile(device)
+	if err != nil {
+		return err
+	}
+	document.Settings = len(file.Settings)
+	if path == "-" {
+		data, err := file.Marshal()
+		if err != nil {
+			return err
+		}
+		_, err = s.stdout.Write(data)
+		return err
+	}
+	if err := file.Write(path); err != nil {
+		return err
+	}
+	return s.emit(document, func() {
+		fmt.Fprintf(s.stdout, "Saved %d settings of %s to %s\n", document.Settings, device.DeviceName, path)
+	})
+}
+
+// settingsFile reads the settings of device as they are exported.
+func (s *session) settingsFile(device jabra.DeviceInfo) (settings.File, error) {
+	current, err := s.backend.Settings(device.DeviceID)
+	if err != nil {
+		return settings.File{}, fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+	version, _ := s.backend.FirmwareVersion(device.DeviceID)
+	return settings.FromDevice(device, version, current), nil
+}
+
+func runSettingsImport(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected a file and optionally a serial number")
+	}
+	var mode jabra.SettingsLoadMode
+	switch loadMode {
+	case "express":
+		mode = jabra.LoadExpress
+	case "retrieve":
+		mode = jabra.LoadRetrieve
+	default:
+		return usageError("--mode is express or retrieve")
+	}
+	path := args[0]
+	device, err := s.headset(strings.Join(args[1:], ""))
+	if err != nil {
+		return err
+	}
+	current, err := s.backend.Settings(device.DeviceID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device.DeviceName, err)
+	}
+
+	document := schema.SettingsImport{
+		SchemaVersion: schema.Version,
+		Device:        schema.NewDeviceRef(device),
+		File:          path,
+		Mode:          loadMode,
+		Changes:       []schema.SettingChange{},
+		Invalid:       []schema.InvalidSetting{},
+		Failed:        []string{},
+	}
+	if sdkFormat {
+		loaded, err := s.backend.LoadSettingsFromFile(device.DeviceID, path, mode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", device.DeviceName, explainSettingsFile(err))
+		}
+		// The SDK wrote the file in express mode already, the changes are
+		// what it loaded compared with the settings before.
+		changes, _ := settings.Plan(settings.FromDevice(device, "", loaded), current)
+		document.Changes = settingChanges(changes)
+		invalid, err := s.backend.InvalidSettings(device.DeviceID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", device.DeviceName, err)
+		}
+		document.Invalid = invalidSettings(invalid.Settings)
+	} else {
+		file, err := settings.Read(path)
+		if err != nil {
+			return err
+		}
+		changes, invalid := settings.Plan(file, current)
+		document.Changes = settingChanges(changes)
+		document.Invalid = invalidSettings(invalid)
+
+		if mode == jabra.LoadExpress && len(changes) > 0 {
+			written := make([]jabra.Setting, 0, len(changes))
+			for _, change := range changes {
+				written = append(written, change.Setting)
+			}
+			if err := s.backend.SetSettings(device.DeviceID, written); err != nil {
+				document.Failed = s.backend.FailedSettingNames(device.DeviceID)
+				if len(document.Failed) == 0 {
+					return fmt.Errorf("%s: %w", device.DeviceName, err)
+				}
+			}
+		}
+	}
+
+	if err := s.emit(document, func() {
+		verb := "Changed"
+		if mode == jabra.LoadRetrieve {
+			verb = "Would change"
+		}
+		if len(document.Changes) == 0 {
+			fmt.Fprintf(s.stdout, "%s already has the settings of %s\n", device.DeviceName, path)
+		}
+		for _, change := range document.Changes {
+			if !slices.Contains(document.Failed, change.Name) {
+				fmt.Fprintf(s.stdout, "%s %s: %s -> %s\n", verb, change.Name, change.From, change.To)
+			}
+		}
+		for _, name := range document.Failed {
+			fmt.Fprintf(s.stdout, "Not written %s: the device refused it\n", name)
+		}
+		for _, invalid := range document.Invalid {
+			fmt.Fprintf(s.stdout, "Not applicable %s: %s\n", invalid.Name, invalid.Message)
+		}
+	}); err != nil {
+		return err
+	}
+	if skipped := len(document.Invalid) + len(document.Failed); skipped > 0 {
+		return fmt.Errorf("%d of the settings in %s did not apply to %s", skipped, path, device.DeviceName)
+	}
+	return nil
+}
+
+func settingChanges(changes []settings.Change) []schema.SettingChange {
+	list := make([]schema.SettingChange, 0, len(changes))
+	for _, change := range changes {
+		list = append(list, schema.SettingChange{GUID: change.Setting.GUID, Name: change.Setting.Name, From: change.From, To: change.Setting.Value()})
+	}
+	return list
+}
+
+func invalidSettings(invalid []jabra.InvalidSetting) []schema.InvalidSetting {
+	list := make([]schema.InvalidSetting, 0, len(invalid))
+	for _, setting := range invalid {
+		list = append(list, schema.InvalidSetting{GUID: setting.GUID, Name: setting.Name, Message: setting.Message})
+	}
+	return list
+}
+
+// settingsSide is one of the two things `settings diff` compares.
+type settingsSide struct {
+	label   string
+	device  *jabra.DeviceInfo
+	current []jabra.Setting
+	file    settings.File
+}
+
+// settingsSideOf reads the device with serial arg, or else the file at arg.
+// An sdk file is loaded against other, it has to be a device.
+func (s *session) settingsSideOf(arg string, other *settingsSide) (*settingsSide, []jabra.InvalidSetting, error) {
+	if device, err := s.bySerial(arg); err == nil {
+		current, err := s.backend.Settings(device.DeviceID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", device.DeviceName, err)
+		}
+		version, _ := s.backend.FirmwareVersion(device.DeviceID)
+		return &settingsSide{label: arg, device: &device, current: current, file: settings.FromDevice(device, version, current)}, nil, nil
+	}
+	if _, err := os.Stat(arg); err != nil {
+		return nil, nil, fmt.Errorf("%w and no file %s", errNoDevice, arg)
+	}
+
+	if !sdkFormat {
+		file, err := settings.Read(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &settingsSide{label: arg, file: file}, nil, nil
+	}
+	if other == nil || other.device == nil {
+		return nil, nil, usageError("an sdk file is compared with a device")
+	}
+	loaded, err := s.backend.LoadSettingsFromFile(other.device.DeviceID, arg, jabra.LoadRetrieve)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", arg, explainSettingsFile(err))
+	}
+	invalid, err := s.backend.InvalidSettings(other.device.DeviceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", arg, err)
+	}
+	return &settingsSide{label: arg, file: settings.FromDevice(*other.device, "", loaded)}, invalid.Settings, nil
+}
+
+func runSettingsDiff(s *session, args []string) error {
+	if watchMode {
+		return usageError("--watch is not supported")
+	}
+	if len(args) != 2 {
+		return usageError("expected two serial numbers or files")
+	}
+
+	// A device is read first, an sdk file needs it.
+	first, second := 0, 1
+	if _, err := s.bySerial(args[0]); err != nil {
+		first, second = 1, 0
+	}
+	sides := make([]*settingsSide, 2)
+	var invalid []jabra.InvalidSetting
+	for _, i := range []int{first, second} {
+		side, sdkInvalid, err := s.settingsSideOf(args[i], sides[first])
+		if err != nil {
+			return err
+		}
+		sides[i] = side
+		invalid = append(invalid, sdkInvalid...)
+	}
+
+	// A YAML file is compared as the device on the other side would take it.
+	a, b := sides[0], sides[1]
+	for _, pair := range [][2]*settingsSide{{a, b}, {b, a}} {
+		file, device := pair[0], pair[1]
+		if file.device != nil || device.device == nil || sdkFormat {
+			continue
+		}
+		_, fileInvalid := settings.Plan(file.file, device.current)
+		invalid = append(invalid, fileInvalid...)
+		file.file = file.file.Canonical(device.current)
+	}
+
+	differences := settings.Diff(a.file, b.file)
+	document := schema.SettingsDiff{
+		SchemaVersion: schema.Version,
+		A:             a.label,
+		B:             b.label,
+		Differences:   make([]schema.SettingDifference, 0, len(differences)),
+		Invalid:       invalidSettings(invalid),
+	}
+	for _, difference := range differences {
+		entry := schema.SettingDifference{GUID: difference.GUID, Name: difference.Name}
+		if difference.InA {
+			entry.A = &difference.A
+		}
+		if difference.InB {
+			entry.B = &difference.B
+		}
+		document.Differences = append(document.Differences, entry)
+	}
+
+	if err := s.emit(document, func() {
+		value := func(v *string) string {
+			if v == nil {
+				return "(missing)"
+			}
+			return *v
+		}
+		if len(document.Differences) == 0 {
+			fmt.Fprintf(s.stdout, "%s and %s have the same settings\n", a.label, b.label)
+		} else {
+			w := tabwriter.NewWriter(s.stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "SETTING\t%s\t%s\n", a.label, b.label)
+			for _, difference := range document.Differences {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", difference.Name, value(difference.A), value(difference.B))
+			}
+			w.Flush()
+		}
+		for _, setting := range document.Invalid {
+			fmt.Fprintf(s.stdout, "Not applicable %s: %s\n", setting.Name, setting.Message)
+		}
+	}); err != nil {
+		return err
+	}
+	if len(document.Differences) > 0 {
+		return fmt.Errorf("%d of the settings differ", len(document.Differences))
+	}
+	return nil
+}
+
+// runSettingsWatch listens to the settings of every device that reports
+// their changes, starting again each time one attaches, until the session
+// context is done.
+func runSettingsWatch(s *session, args []string) error {
+	if watchMode || outputFormat == outputJSON {
+		return usageError("settings watch streams its changes, use --output ndjson for JSON")
+	}
+	if len(args) > 1 {
+		return usageError("expected at most a serial number")
+	}
+	serial := strings.Join(args, "")
+	if serial != "" {
+		device, err := s.bySerial(serial)
+		if err != nil {
+			return err
+		}
+		if device.FeatureFlags == nil || !device.FeatureFlags.SettingsChangeNotification {
+			return fmt.Errorf("%s: %w", device.DeviceName, jabra.ErrNotSupported)
+		}
+	}
+
+	type watched struct {
+		device   jabra.DeviceInfo
+		settings []jabra.Setting
+	}
+	devices := make(map[uint16]*watched)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case device := <-s.attached:
+			if (serial != "" && device.SerialNumber != serial) || device.FeatureFlags == nil || !device.FeatureFlags.SettingsChangeNotification {
+				continue
+			}
+			current, err := s.backend.Settings(device.DeviceID)
+			if err != nil {
+				continue
+			}
+			if err := s.backend.ListenSettings(device.DeviceID, true); err != nil {
+				continue
+			}
+			devices[device.DeviceID] = &watched{device: device, settings: current}
+		case changed := <-s.settingsChanged:
+			w, ok := devices[changed.deviceID]
+			if !ok {
+				continue
+			}
+			var changes []jabra.SettingChange
+			w.settings, changes = jabra.UpdateSettings(w.settings, changed.settings)
+			for _, change := range changes {
+				document := schema.SettingChanged{
+					SchemaVersion: schema.Version,
+					Time:          now(),
+					Device:        schema.NewDeviceRef(w.device),
+					GUID:          change.GUID,
+					Name:          change.Name,
+					From:          change.From,
+					To:            change.To,
+				}
+				if err := s.emit(document, func() {
+					fmt.Fprintf(s.stdout, "%s %s: %s %s -> %s\n", document.Time.Format(time.TimeOnly), w.device.DeviceName, change.Name, change.From, change.To)
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
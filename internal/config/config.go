@@ -0,0 +1,153 @@
+// Package config reads the jLink configuration file,
+// $XDG_CONFIG_HOME/jlink/config.yaml. Every setting has a default, the file
+// only needs the ones that differ.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+type Config struct {
+	Alerts Alerts `yaml:"alerts"`
+	// Buttons maps the hidInput names of headset buttons, mute, flash,
+	// redial, button1 to button3, volumeUp, volumeDown and the others, to
+	// what pressing them does. A buttons section in the file replaces the
+	// default mapping, an empty one maps nothing.
+	Buttons map[string]Button `yaml:"buttons"`
+}
+
+// Alerts configures the battery alerts.
+type Alerts struct {
+	// Thresholds are the levels in percent at which a discharging battery
+	// raises a low battery alert.
+	Thresholds []uint8 `yaml:"thresholds"`
+	// Hysteresis is how many percent the level has to climb back above a
+	// threshold before that threshold alerts again. The fully charged alert
+	// rearms once the level dropped as much below 100.
+	Hysteresis   uint8 `yaml:"hysteresis"`
+	FullyCharged bool  `yaml:"fullyCharged"`
+	// Notifications are sent through org.freedesktop.Notifications.
+	Notifications bool `yaml:"notifications"`
+	// Ringtone also plays a tone on the headset, when it supports it.
+	Ringtone *Ringtone `yaml:"ringtone"`
+}
+
+// Ringtone are the Jabra_PlayRingtone arguments.
+type Ringtone struct {
+	Level uint8 `yaml:"level"`
+	Type  uint8 `yaml:"type"`
+}
+
+// Button is what pressing a button does: Command is run with sh -c, Action
+// is one of Actions, done to the device the button was pressed on. Exactly
+// one of the two is set.
+type Button struct {
+	Command string `yaml:"command"`
+	Action  string `yaml:"action"`
+}
+
+// Actions are the built-in actions: toggle the busylight, step to the next
+// ambience mode, turn the equalizer on or off, and play or pause, skip to
+// the next or the previous track of the media player.
+var Actions = []string{"busylight", "ambience", "equalizer", "playPause", "next", "previous"}
+
+func Default() *Config {
+	return &Config{
+		Alerts: Alerts{
+			Thresholds:    []uint8{20, 10, 5},
+			Hysteresis:    3,
+			FullyCharged:  true,
+			Notifications: true,
+		},
+		// The flash button plays and pauses the music
+		Buttons: map[string]Button{
+			jabra.HidFlash.String(): {Action: "playPause"},
+		},
+	}
+}
+
+// DefaultPath is $XDG_CONFIG_HOME/jlink/config.yaml, or ~/.config/jlink/config.yaml.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = filepath.Join(os.TempDir(), ".config")
+	}
+	return filepath.Join(dir, "jlink", "config.yaml")
+}
+
+// Load reads the file at path on top of the defaults. A missing file is
+// not an error.
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoded into the defaults the buttons of the file would only add to
+	// them.
+	defaultButtons := config.Buttons
+	config.Buttons = nil
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if config.Buttons == nil {
+		config.Buttons = defaultButtons
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	for _, threshold := range c.Alerts.Thresholds {
+		if threshold < 1 || threshold > 99 {
+			return fmt.Errorf("alerts: threshold %d is not between 1 and 99", threshold)
+		}
+	}
+	if c.Alerts.Hysteresis > 50 {
+		return fmt.Errorf("alerts: hysteresis %d is above 50", c.Alerts.Hysteresis)
+	}
+	// Highest first, the alerts rely on it.
+	slices.Sort(c.Alerts.Thresholds)
+	slices.Reverse(c.Alerts.Thresholds)
+	c.Alerts.Thresholds = slices.Compact(c.Alerts.Thresholds)
+
+	// Keyed by the names as the inputs print them, whatever the case.
+	buttons := make(map[string]Button, len(c.Buttons))
+	for name, button := range c.Buttons {
+		input, err := jabra.ParseHidInput(name)
+		if err != nil {
+			return fmt.Errorf("buttons: %w", err)
+		}
+		if input == jabra.HidOffHook {
+			return fmt.Errorf("buttons: %s reports the hook state, not a press", input)
+		}
+		switch {
+		case (button.Command == "") == (button.Action == ""):
+			return fmt.Errorf("buttons: %s needs either a command or an action", input)
+		case button.Action != "" && !slices.Contains(Actions, button.Action):
+			return fmt.Errorf("buttons: %s: unknown action %q, expected %s", input, button.Action, strings.Join(Actions, ", "))
+		}
+		buttons[input.String()] = button
+	}
+	c.Buttons = buttons
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func write(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	config, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Alerts.Thresholds, []uint8{20, 10, 5}) || config.Alerts.Hysteresis != 3 || !config.Alerts.Notifications {
+		t.Errorf("defaults %+v", config.Alerts)
+	}
+	if len(config.Buttons) != 1 || config.Buttons["flash"] != (Button{Action: "playPause"}) {
+		t.Errorf("default buttons %+v", config.Buttons)
+	}
+
+	config, err = Load(write(t, `
+alerts:
+  thresholds: [5, 30, 15, 30]
+  notifications: false
+  ringtone:
+    level: 200
+    type: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := config.Alerts
+	if !slices.Equal(alerts.Thresholds, []uint8{30, 15, 5}) {
+		t.Errorf("thresholds %v", alerts.Thresholds)
+	}
+	if alerts.Notifications || !alerts.FullyCharged || alerts.Hysteresis != 3 {
+		t.Errorf("alerts %+v", alerts)
+	}
+	if alerts.Ringtone == nil || *alerts.Ringtone != (Ringtone{Level: 200, Type: 2}) {
+		t.Errorf("ringtone %+v", alerts.Ringtone)
+	}
+
+	config, err = Load(write(t, `
+buttons:
+  Mute:
+    command: pactl set-source-mute @DEFAULT_SOURCE@ toggle
+  button1:
+    action: busylight
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Buttons) != 2 || config.Buttons["mute"].Command == "" || config.Buttons["button1"] != (Button{Action: "busylight"}) {
+		t.Errorf("buttons %+v", config.Buttons)
+	}
+	// Only an empty buttons section turns the default mapping off.
+	if config, err := Load(write(t, "alerts:\n  hysteresis: 5\n")); err != nil || len(config.Buttons) != 1 {
+		t.Errorf("buttons without a section %+v, %v", config.Buttons, err)
+	}
+	if config, err := Load(write(t, "buttons: {}\n")); err != nil || len(config.Buttons) != 0 {
+		t.Errorf("empty buttons %+v, %v", config.Buttons, err)
+	}
+
+	for _, invalid := range []string{
+		"alerts:\n  thresholds: [0]\n",
+		"alerts:\n  thresholds: [100]\n",
+		"alerts:\n  hysteresis: 60\n",
+		"alerts: [",
+		"buttons:\n  sneeze: {action: busylight}\n",
+		"buttons:\n  offHook: {action: busylight}\n",
+		"buttons:\n  mute: {}\n",
+		"buttons:\n  mute: {action: busylight, command: 'true'}\n",
+		"buttons:\n  mute: {action: dance}\n",
+	} {
+		if _, err := Load(write(t, invalid)); err == nil {
+			t.Errorf("%q loaded", invalid)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package desired reads jlink.yaml, the state devices should be in per
+// product, and works out and applies the changes that bring a device there.
+package desired
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Watchdog0x/jLink/internal/settings"
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// Drift policies, what `apply --watch` does about a device that no longer
+// matches its desired state.
+const (
+	DriftReport = "report"
+	DriftRevert = "revert"
+)
+
+// Config is the content of jlink.yaml.
+type Config struct {
+	Drift    string    `yaml:"drift"` // report or revert, default report
+	Products []Product `yaml:"products"`
+}
+
+// Product is the desired state of the devices with ProductID. What is left
+// out is left as it is.
+type Product struct {
+	ProductID uint16 `yaml:"productID"`
+	// Name is only for the reader of the file.
+	Name        string           `yaml:"name"`
+	AutoPairing *bool            `yaml:"autoPairing"` // dongles only
+	Ambience    string           `yaml:"ambience"`    // off, hearThrough or anc
+	Busylight   *bool            `yaml:"busylight"`
+	Equalizer   *Equalizer       `yaml:"equalizer"`
+	Settings    []settings.Entry `yaml:"settings"`
+}
+
+type Equalizer struct {
+	Enabled *bool `yaml:"enabled"`
+	// Gains are in dB, one per band from the lowest frequency up.
+	Gains []float32 `yaml:"gains"`
+}
+
+// Load reads and checks the configuration at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &config, nil
+}
+
+func (c *Config) validate() error {
+	switch c.Drift {
+	case "":
+		c.Drift = DriftReport
+	case DriftReport, DriftRevert:
+	default:
+		return fmt.Errorf("drift is %q, expected report or revert", c.Drift)
+	}
+
+	products := make(map[uint16]bool)
+	for _, product := range c.Products {
+		if product.ProductID == 0 {
+			return fmt.Errorf("product %q has no productID", product.Name)
+		}
+		if products[product.ProductID] {
+			return fmt.Errorf("product %04x is listed twice", product.ProductID)
+		}
+		products[product.ProductID] = true
+
+		if product.Ambience != "" {
+			if _, err := jabra.ParseAmbienceMode(product.Ambience); err != nil {
+				return fmt.Errorf("product %04x: %w", product.ProductID, err)
+			}
+		}
+		for i, entry := range product.Settings {
+			if entry.GUID == "" && entry.Name == "" {
+				return fmt.Errorf("product %04x: setting %d has neither a guid nor a name", product.ProductID, i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// Product returns the desired state of the devices with productID.
+func (c *Config) Product(productID uint16) (Product, bool) {
+	index := slices.IndexFunc(c.Products, func(product Product) bool { return product.ProductID == productID })
+	if index == -1 {
+		return Product{}, false
+	}
+	return c.Products[index], true
+}
+
+// Change is a property of a device that differs from its desired state.
+type Change struct {
+	// Property is autoPairing, ambience, busylight, equalizer,
+	// equalizerGains or setting.
+	Property string
+	// Name is what the user knows the property as, for a setting its name.
+	Name     string
+	From, To string
+	// Err is set by Apply when the change failed.
+	Err error
+
+	apply   func(backend jabra.Backend, deviceID uint16) error
+	setting *jabra.Setting // written together with the other settings
+}
+
+// DevicePlan are the changes that bring a device to its desired state, and
+// what of the state the device cannot take.
+type DevicePlan struct {
+	Device  jabra.DeviceInfo
+	Changes []Change
+	Invalid []jabra.InvalidSetting
+}
+
+// Plan compares device with product.
+func Plan(backend jabra.Backend, device jabra.DeviceInfo, product Product) (*DevicePlan, error) {
+	plan := &DevicePlan{Device: device}
+	id := device.DeviceID
+	unsupported := func(name string, err error) error {
+		if errors.Is(err, jabra.ErrNotSupported) {
+			plan.Invalid = append(plan.Invalid, jabra.InvalidSetting{Name: name, Message: "the device does not support it"})
+			return nil
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if product.AutoPairing != nil {
+		if !device.IsDongle {
+			plan.Invalid = append(plan.Invalid, jabra.InvalidSetting{Name: "Auto-pairing", Message: "only dongles pair automatically"})
+		} else if current, err := backend.AutoPairing(id); err != nil {
+			return nil, unsupported("Auto-pairing", err)
+		} else if current != *product.AutoPairing {
+			want := *product.AutoPairing
+			plan.add(Change{Property: "autoPairing", Name: "Auto-pairing", From: onOff(current), To: onOff(want), apply: func(backend jabra.Backend, id uint16) error {
+				return backend.SetAutoPairing(id, want)
+			}})
+		}
+	}
+
+	if product.Ambience != "" {
+		want, _ := jabra.ParseAmbienceMode(product.Ambience)
+		current, err := backend.AmbienceMode(id)
+		if err != nil {
+			if err := unsupported("Ambience mode", err); err != nil {
+				return nil, err
+			}
+		} else if modes, err := backend.AmbienceModes(id); err == nil && !slices.Contains(modes, want) {
+			plan.Invalid = append(plan.Invalid, jabra.InvalidSetting{Name: "Ambience mode", Message: fmt.Sprintf("the device has no mode %s", want)})
+		} else if current != want {
+			plan.add(Change{Property: "ambience", Name: "Ambience mode", From: current.String(), To: want.String(), apply: func(backend jabra.Backend, id uint16) error {
+				return backend.SetAmbienceMode(id, want)
+			}})
+		}
+	}
+
+	if product.Busylight != nil {
+		current, err := backend.Busylight(id)
+		if err != nil {
+			if err := unsupported("Busylight", err); err != nil {
+				return nil, err
+			}
+		} else if want := *product.Busylight; current != want {
+			plan.add(Change{Property: "busylight", Name: "Busylight", From: onOff(current), To: onOff(want), apply: func(backend jabra.Backend, id uint16) error {
+				return backend.SetBusylight(id, want)
+			}})
+		}
+	}
+
+	if product.Equalizer != nil {
+		if err := plan.equalizer(backend, *product.Equalizer); err != nil {
+			if err := unsupported("Equalizer", err); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(product.Settings) > 0 {
+		current, err := backend.Settings(id)
+		if err != nil {
+			if err := unsupported("Settings", err); err != nil {
+				return nil, err
+			}
+			return plan, nil
+		}
+		changes, invalid := settings.Plan(settings.File{Settings: product.Settings}, current)
+		for _, change := range changes {
+			plan.add(Change{Property: "setting", Name: change.Setting.Name, From: change.From, To: change.Setting.Value(), setting: &change.Setting})
+		}
+		plan.Invalid = append(plan.Invalid, invalid...)
+	}
+	return plan, nil
+}
+
+func (p *DevicePlan) equalizer(backend jabra.Backend, want Equalizer) error {
+	id := p.Device.DeviceID
+	enabled, err := backend.EqualizerEnabled(id)
+	if err != nil {
+		return err
+	}
+	if want.Enabled != nil && enabled != *want.Enabled {
+		enable := *want.Enabled
+		p.add(Change{Property: "equalizer", Name: "Equalizer", From: onOff(enabled), To: onOff(enable), apply: func(backend jabra.Backend, id uint16) error {
+			return backend.EnableEqualizer(id, enable)
+		}})
+	}
+	if len(want.Gains) == 0 {
+		return nil
+	}
+
+	bands, err := backend.EqualizerBands(id)
+	if err != nil {
+		return err
+	}
+	if len(bands) != len(want.Gains) {
+		p.Invalid = append(p.Invalid, jabra.InvalidSetting{Name: "Equalizer gains", Message: fmt.Sprintf("the device has %d bands, not %d", len(bands), len(want.Gains))})
+		return nil
+	}
+	current := make([]float32, 0, len(bands))
+	for i, band := range bands {
+		if gain := want.Gains[i]; gain > band.MaxGain || gain < -band.MaxGain {
+			p.Invalid = append(p.Invalid, jabra.InvalidSetting{Name: "Equalizer gains", Message: fmt.Sprintf("the %d Hz band takes -%g to %g dB", band.CenterFrequency, band.MaxGain, band.MaxGain)})
+			return nil
+		}
+		current = append(current, band.Gain)
+	}
+	if !slices.Equal(current, want.Gains) {
+		gains := want.Gains
+		p.add(Change{Property: "equalizerGains", Name: "Equalizer gains", From: formatGains(current), To: formatGains(gains), apply: func(backend jabra.Backend, id uint16) error {
+			return backend.SetEqualizerGains(id, gains)
+		}})
+	}
+	return nil
+}
+
+func (p *DevicePlan) add(change Change) {
+	p.Changes = append(p.Changes, change)
+}
+
+// Apply makes the changes of the plan, settings last since some restart the
+// device. Failed changes get their Err set, Apply returns how many failed.
+func (p *DevicePlan) Apply(backend jabra.Backend) int {
+	id := p.Device.DeviceID
+	failed := 0
+	var written []jabra.Setting
+	for i := range p.Changes {
+		change := &p.Changes[i]
+		if change.setting != nil {
+			written = append(written, *change.setting)
+			continue
+		}
+		if change.Err = change.apply(backend, id); change.Err != nil {
+			failed++
+		}
+	}
+	if len(written) == 0 {
+		return failed
+	}
+
+	err := backend.SetSettings(id, written)
+	if err == nil {
+		return failed
+	}
+	names := backend.FailedSettingNames(id)
+	for i := range p.Changes {
+		change := &p.Changes[i]
+		if change.setting != nil && (len(names) == 0 || slices.Contains(names, change.Name)) {
+			change.Err = err
+			failed++
+		}
+	}
+	return failed
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func formatGains(gains []float32) string {
+	formatted := make([]string, 0, len(gains))
+	for _, gain := range gains {
+		formatted = append(formatted, strconv.FormatFloat(float64(gain), 'g', -1, 32))
+	}
+	return strings.Join(formatted, " ") + " dB"
+}
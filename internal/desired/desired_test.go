@@ -0,0 +1,161 @@
+package desired
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+const scenario = `
+devices:
+  - id: 0
+    name: Jabra Link 380
+    productID: 0x24f1
+    dongle: true
+  - id: 1
+    name: Jabra Evolve2 85
+    productID: 0x24f2
+    connection: usb
+    ambience: {modes: [off, anc]}
+    busylight: {}
+    equalizer: {}
+    settings:
+      - guid: ringtone
+        name: Ringtone
+        type: list
+        options: [{key: 0, value: Tone 1}, {key: 1, value: Tone 2}]
+      - guid: protection
+        name: Hearing protection
+        type: list
+        fail: true
+        options: [{key: 0, value: Standard}, {key: 1, value: NIOSH}]
+`
+
+const config = `
+products:
+  - productID: 0x24f1
+    autoPairing: true
+  - productID: 0x24f2
+    name: Evolve2 85
+    autoPairing: true
+    ambience: anc
+    busylight: false
+    equalizer:
+      enabled: true
+      gains: [0, 1.5, 3, 1.5, 0]
+    settings:
+      - name: ringtone
+        value: Tone 2
+      - guid: protection
+        value: NIOSH
+      - guid: volume
+        value: "7"
+`
+
+func load(t *testing.T, data string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jlink.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoad(t *testing.T) {
+	c, err := load(t, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Drift != DriftReport || len(c.Products) != 2 {
+		t.Errorf("loaded %+v", c)
+	}
+	if product, ok := c.Product(0x24f2); !ok || product.Name != "Evolve2 85" || len(product.Equalizer.Gains) != 5 {
+		t.Errorf("Product(0x24f2) = %+v, %v", product, ok)
+	}
+
+	for _, invalid := range []string{
+		"drift: ignore",
+		"products: [{name: Evolve}]",
+		"products: [{productID: 1}, {productID: 1}]",
+		"products: [{productID: 1, ambience: loud}]",
+		"products: [{productID: 1, settings: [{value: x}]}]",
+	} {
+		if _, err := load(t, invalid); err == nil {
+			t.Errorf("loaded %q", invalid)
+		}
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	parsed, err := fake.Parse([]byte(scenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(parsed)
+	attached := make(chan jabra.DeviceInfo, 2)
+	if err := backend.Initialize("test", jabra.Callbacks{
+		DeviceAttached: func(deviceInfo jabra.DeviceInfo) { attached <- deviceInfo },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { backend.Uninitialize() })
+	devices := make(map[uint16]jabra.DeviceInfo)
+	for len(devices) < 2 {
+		select {
+		case device := <-attached:
+			devices[device.DeviceID] = device
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the devices")
+		}
+	}
+
+	c, err := load(t, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product, _ := c.Product(0x24f2)
+	plan, err := Plan(backend, devices[1], product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type change struct{ Property, Name, From, To string }
+	var changes []change
+	for _, c := range plan.Changes {
+		changes = append(changes, change{c.Property, c.Name, c.From, c.To})
+	}
+	want := []change{
+		{"ambience", "Ambience mode", "off", "anc"},
+		{"equalizer", "Equalizer", "off", "on"},
+		{"equalizerGains", "Equalizer gains", "0 0 0 0 0 dB", "0 1.5 3 1.5 0 dB"},
+		{"setting", "Ringtone", "Tone 1", "Tone 2"},
+		{"setting", "Hearing protection", "Standard", "NIOSH"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes %+v, want %+v", changes, want)
+	}
+	if len(plan.Invalid) != 2 || plan.Invalid[0].Name != "Auto-pairing" || plan.Invalid[1].GUID != "volume" {
+		t.Errorf("invalid %+v", plan.Invalid)
+	}
+
+	if failed := plan.Apply(backend); failed != 1 || plan.Changes[4].Err == nil {
+		t.Errorf("Apply failed %d changes, %+v", failed, plan.Changes)
+	}
+	plan, err = Plan(backend, devices[1], product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Name != "Hearing protection" {
+		t.Errorf("changes left after Apply %+v", plan.Changes)
+	}
+
+	// The dongle has no ambience, busylight or equalizer to plan.
+	product, _ = c.Product(0x24f1)
+	if plan, err = Plan(backend, devices[0], product); err != nil || len(plan.Changes) != 1 || plan.Changes[0].Property != "autoPairing" {
+		t.Errorf("dongle plan %+v, %v", plan, err)
+	}
+}
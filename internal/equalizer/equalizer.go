@@ -0,0 +1,213 @@
+// Package equalizer keeps named equalizer presets in
+// $XDG_CONFIG_HOME/jlink/equalizer.yaml. A preset applies to every headset
+// with the bands it was saved from.
+package equalizer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+var ErrNoPreset = errors.New("no such preset")
+
+// Band is a band of a preset, the gain is in dB.
+type Band struct {
+	Frequency int     `yaml:"frequency"` // Hz
+	Gain      float32 `yaml:"gain"`
+}
+
+// Preset is a named set of gains, such as "Podcast" or "Bass boost".
+type Preset struct {
+	Name  string `yaml:"name"`
+	Bands []Band `yaml:"bands"`
+}
+
+// FromBands makes a preset of the current gains of bands.
+func FromBands(name string, bands []jabra.EqualizerBand) Preset {
+	preset := Preset{Name: name, Bands: make([]Band, 0, len(bands))}
+	for _, band := range bands {
+		preset.Bands = append(preset.Bands, Band{Frequency: band.CenterFrequency, Gain: band.Gain})
+	}
+	return preset
+}
+
+// Gains returns the gains of the preset for a device with bands, in the
+// order SetEqualizerGains takes them. The device has to have the bands of
+// the preset, and take its gains.
+func (p Preset) Gains(bands []jabra.EqualizerBand) ([]float32, error) {
+	if len(bands) != len(p.Bands) {
+		return nil, fmt.Errorf("%s has %d bands, the device %d", p.Name, len(p.Bands), len(bands))
+	}
+	gains := make([]float32, 0, len(bands))
+	for i, band := range bands {
+		want := p.Bands[i]
+		if want.Frequency != band.CenterFrequency {
+			return nil, fmt.Errorf("%s has a %d Hz band where the device has %d Hz", p.Name, want.Frequency, band.CenterFrequency)
+		}
+		if want.Gain > band.MaxGain || want.Gain < -band.MaxGain {
+			return nil, fmt.Errorf("%s sets %g dB, the %d Hz band takes -%g to %g dB", p.Name, want.Gain, band.CenterFrequency, band.MaxGain, band.MaxGain)
+		}
+		gains = append(gains, want.Gain)
+	}
+	return gains, nil
+}
+
+// DefaultPath is $XDG_CONFIG_HOME/jlink/equalizer.yaml, or ~/.config/jlink/equalizer.yaml.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = filepath.Join(os.TempDir(), ".config")
+	}
+	return filepath.Join(dir, "jlink", "equalizer.yaml")
+}
+
+// Presets is the file of presets. Names are matched without regard to
+// case. It is safe for concurrent use within a process.
+type Presets struct {
+	path string
+	mu   sync.Mutex
+}
+
+func Open(path string) *Presets {
+	return &Presets{path: path}
+}
+
+func (p *Presets) Path() string {
+	return p.path
+}
+
+// List returns the presets ordered by name. A missing file has none.
+func (p *Presets) List() ([]Preset, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.read()
+}
+
+// Get returns the preset called name.
+func (p *Presets) Get(name string) (Preset, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	presets, err := p.read()
+	if err != nil {
+		return Preset{}, err
+	}
+	i := index(presets, name)
+	if i < 0 {
+		return Preset{}, fmt.Errorf("%w %q in %s", ErrNoPreset, name, p.path)
+	}
+	return presets[i], nil
+}
+
+// Save adds preset, replacing the one with the same name.
+func (p *Presets) Save(preset Preset) error {
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" {
+		return errors.New("a preset needs a name")
+	}
+	if len(preset.Bands) == 0 {
+		return fmt.Errorf("%s has no bands", preset.Name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	presets, err := p.read()
+	if err != nil {
+		return err
+	}
+	if i := index(presets, preset.Name); i >= 0 {
+		presets[i] = preset
+	} else {
+		presets = append(presets, preset)
+	}
+	return p.write(presets)
+}
+
+// Delete removes the preset called name.
+func (p *Presets) Delete(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	presets, err := p.read()
+	if err != nil {
+		return err
+	}
+	i := index(presets, name)
+	if i < 0 {
+		return fmt.Errorf("%w %q in %s", ErrNoPreset, name, p.path)
+	}
+	return p.write(slices.Delete(presets, i, i+1))
+}
+
+func index(presets []Preset, name string) int {
+	return slices.IndexFunc(presets, func(preset Preset) bool {
+		return strings.EqualFold(preset.Name, strings.TrimSpace(name))
+	})
+}
+
+// read is List for callers holding p.mu.
+func (p *Presets) read() ([]Preset, error) {
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Presets []Preset `yaml:"presets"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.path, err)
+	}
+	for i, preset := range file.Presets {
+		if strings.TrimSpace(preset.Name) == "" {
+			return nil, fmt.Errorf("%s: preset %d has no name", p.path, i+1)
+		}
+		if index(file.Presets[:i], preset.Name) >= 0 {
+			return nil, fmt.Errorf("%s: preset %s is there twice", p.path, preset.Name)
+		}
+	}
+	slices.SortFunc(file.Presets, func(a, b Preset) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return file.Presets, nil
+}
+
+// write replaces the file. The caller holds p.mu.
+func (p *Presets) write(presets []Preset) error {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(struct {
+		Presets []Preset `yaml:"presets"`
+	}{presets}); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return err
+	}
+	temporary := p.path + ".tmp"
+	if err := os.WriteFile(temporary, buffer.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, p.path)
+}
@@ -0,0 +1,76 @@
+package equalizer
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+var bands = []jabra.EqualizerBand{
+	{MaxGain: 6, CenterFrequency: 250, Gain: 3},
+	{MaxGain: 6, CenterFrequency: 1000, Gain: 0},
+	{MaxGain: 6, CenterFrequency: 4000, Gain: -1.5},
+}
+
+func TestPresets(t *testing.T) {
+	presets := Open(filepath.Join(t.TempDir(), "jlink", "equalizer.yaml"))
+	if list, err := presets.List(); err != nil || len(list) != 0 {
+		t.Fatalf("missing file: %v, %v", list, err)
+	}
+
+	if err := presets.Save(FromBands("Podcast", bands)); err != nil {
+		t.Fatal(err)
+	}
+	if err := presets.Save(FromBands("bass boost", bands)); err != nil {
+		t.Fatal(err)
+	}
+	louder := slices.Clone(bands)
+	louder[0].Gain = 6
+	if err := presets.Save(FromBands("podcast", louder)); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := presets.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "bass boost" || list[1].Name != "podcast" {
+		t.Fatalf("presets %+v", list)
+	}
+	preset, err := presets.Get("PODCAST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gains, err := preset.Gains(bands); err != nil || !slices.Equal(gains, []float32{6, 0, -1.5}) {
+		t.Errorf("gains %v, %v", gains, err)
+	}
+
+	if err := presets.Delete("Bass Boost"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := presets.Get("bass boost"); !errors.Is(err, ErrNoPreset) {
+		t.Errorf("deleted preset: %v", err)
+	}
+	if err := presets.Delete("bass boost"); !errors.Is(err, ErrNoPreset) {
+		t.Errorf("deleted twice: %v", err)
+	}
+	if err := presets.Save(FromBands(" ", bands)); err == nil {
+		t.Error("saved a preset without a name")
+	}
+}
+
+func TestGains(t *testing.T) {
+	preset := FromBands("Podcast", bands)
+	for _, other := range [][]jabra.EqualizerBand{
+		bands[:2],
+		{bands[0], bands[1], {MaxGain: 6, CenterFrequency: 8000}},
+		{{MaxGain: 2, CenterFrequency: 250}, bands[1], bands[2]},
+	} {
+		if gains, err := preset.Gains(other); err == nil {
+			t.Errorf("%+v took %v", other, gains)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package firmware
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+const auditName = "audit.jsonl"
+
+// Record is one line of the audit log of a repository, written for every
+// update jLink starts.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Host      string    `json:"host"`
+	User      string    `json:"user"`
+	Serial    string    `json:"serial"`
+	Device    string    `json:"device"`
+	ProductID uint16    `json:"productId"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Package   string    `json:"package"` // path of the file installed
+	SHA256    string    `json:"sha256,omitempty"`
+	// Downgrade is set when the update went to an older version and was
+	// confirmed.
+	Downgrade bool   `json:"downgrade"`
+	Result    string `json:"result"` // completed, or why the update failed
+}
+
+// Audit appends record to the audit log, filling in the host, the user and
+// the checksum of the package.
+func (r *Repository) Audit(record Record) error {
+	if record.SHA256 == "" {
+		record.SHA256, _ = checksum(record.Package)
+	}
+	if record.Host == "" {
+		record.Host, _ = os.Hostname()
+	}
+	if record.User == "" {
+		if current, err := user.Current(); err == nil {
+			record.User = current.Username
+		}
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(r.dir, auditName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Records returns the audit log of the device with serial, oldest first. An
+// empty serial returns the records of all devices.
+func (r *Repository) Records(serial string) ([]Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.Open(filepath.Join(r.dir, auditName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file.Name(), line, err)
+		}
+		if serial == "" || record.Serial == serial {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// PreviousVersion returns the version the device with serial ran before it
+// was updated to current.
+func (r *Repository) PreviousVersion(serial, current string) (string, bool, error) {
+	records, err := r.Records(serial)
+	if err != nil {
+		return "", false, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Result == "completed" && records[i].To == current && records[i].From != "" {
+			return records[i].From, true, nil
+		}
+	}
+	return "", false, nil
+}
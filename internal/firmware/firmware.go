@@ -0,0 +1,165 @@
+// Package firmware updates the firmware of Jabra devices from the packages
+// Jabra publishes, e.g. Jabra_Evolve2_85-v1.5.4-ev285t-vector.zip, and
+// explains the outcome in terms a user can act on.
+package firmware
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// ErrLocked is returned for updates of a device whose firmware lock is on.
+var ErrLocked = errors.New("the firmware lock is on")
+
+// Event is a FirmwareProgress callback of a backend session.
+type Event struct {
+	DeviceID uint16
+	Progress jabra.FirmwareProgress
+}
+
+var packageVersion = regexp.MustCompile(`-v(\d+(?:\.\d+)+)(?:-|\.zip$)`)
+
+// PackageVersion returns the firmware version in the file name of a package.
+func PackageVersion(path string) (string, bool) {
+	match := packageVersion.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// CheckPackage makes sure path is a zip archive before it is handed to the
+// device, the SDK only reports a bad file once the update is under way.
+func CheckPackage(path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return &explainedError{message: fmt.Sprintf("%s is not a firmware package: %s", path, err), err: jabra.ErrFileNotAccessible}
+	}
+	defer archive.Close()
+
+	if len(archive.File) == 0 {
+		return &explainedError{message: fmt.Sprintf("%s is not a firmware package: the archive is empty", path), err: jabra.ErrFileNotAccessible}
+	}
+	return nil
+}
+
+// CheckLock returns an error wrapping ErrLocked when the firmware lock of
+// deviceID is on. Devices without a lock pass.
+func CheckLock(backend jabra.Backend, deviceID uint16) error {
+	if locked, err := backend.FirmwareLock(deviceID); err == nil && locked {
+		return lockedError()
+	}
+	return nil
+}
+
+func lockedError() error {
+	return &explainedError{
+		message: "the firmware lock of the device is on, it takes no other firmware until jlink firmware lock off turns the lock off",
+		err:     ErrLocked,
+	}
+}
+
+// Update starts the update of deviceID with the package at path and waits
+// for it to end. events delivers the FirmwareProgress callbacks of the
+// session, report is called for each one about the update of deviceID.
+// Devices with their firmware lock on are refused.
+func Update(ctx context.Context, backend jabra.Backend, deviceID uint16, path string, events <-chan Event, report func(progress jabra.FirmwareProgress)) error {
+	if err := CheckPackage(path); err != nil {
+		return err
+	}
+	if err := CheckLock(backend, deviceID); err != nil {
+		return err
+	}
+	if err := backend.UpdateFirmware(deviceID, path); err != nil {
+		return Explain(err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-events:
+			if event.DeviceID != deviceID || event.Progress.Type != jabra.FirmwareUpdate {
+				continue
+			}
+			report(event.Progress)
+			if event.Progress.Status == jabra.FirmwareNotAllowed {
+				// The lock may have been turned on after CheckLock.
+				if err := CheckLock(backend, deviceID); err != nil {
+					return err
+				}
+			}
+			if event.Progress.Status.Done() {
+				return event.Progress.Status.Err()
+			}
+		}
+	}
+}
+
+// FollowUps lists what is left to do after an update of a device with
+// featureFlags, the SDK cannot finish it on its own.
+func FollowUps(featureFlags *jabra.FeatureFlags) []string {
+	followUps := make([]string, 0)
+	if featureFlags == nil {
+		return followUps
+	}
+	if featureFlags.NeedsExplicitRebootAfterOta {
+		followUps = append(followUps, "Turn the headset off and on again to finish the update.")
+	}
+	if featureFlags.NeedsToBePutInCradleToCompleteFwu {
+		followUps = append(followUps, "Put the headset in its cradle to finish the update.")
+	}
+	return followUps
+}
+
+/****************************************************************************/
+/*                                 ERRORS                                   */
+/****************************************************************************/
+
+// explainedError keeps the error it explains in the chain, so the exit code
+// still follows the Jabra_ReturnCode.
+type explainedError struct {
+	message string
+	err     error
+}
+
+func (e *explainedError) Error() string { return e.message }
+func (e *explainedError) Unwrap() error { return e.err }
+
+var explanations = []struct {
+	err     error
+	message string
+}{
+	{jabra.ErrFirmwareUpToDate, "the device already runs this firmware"},
+	{jabra.ErrSdkTooOldForFwUpdate, "libjabra is too old for this firmware, update the Jabra SDK and try again"},
+	{jabra.ErrFWUApplicationNotAvailable, "the firmware updater of libjabra is not installed"},
+	{jabra.ErrFileNotAccessible, "the firmware package cannot be read, download it again"},
+	{jabra.ErrNoOtaUpdateSupport, "the device cannot be updated over the air, connect it with USB"},
+	{jabra.ErrDeviceLock, "the firmware of the device is locked"},
+	{jabra.ErrDeviceBadState, "the device is busy, wait for the running update to end"},
+	{jabra.ErrUploadAlreadyInProgress, "the device is busy, wait for the running update to end"},
+	{jabra.ErrInvalidAuthorization, "the Jabra cloud rejected the authorization ID"},
+	{jabra.ErrNetworkRequestFail, "the Jabra cloud cannot be reached"},
+	{jabra.ErrNotSupported, "the device does not support firmware updates"},
+}
+
+// Explain returns err with a message that says what went wrong and what to
+// do about it, or err itself when there is nothing to add.
+func Explain(err error) error {
+	var explained *explainedError
+	if err == nil || errors.As(err, &explained) {
+		return err
+	}
+	for _, explanation := range explanations {
+		if errors.Is(err, explanation.err) {
+			return &explainedError{message: explanation.message, err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,249 @@
+package firmware
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+func TestPackageVersion(t *testing.T) {
+	for _, test := range []struct {
+		path, want string
+	}{
+		{"Jabra_Evolve2_85-v1.5.4-ev285t-vector.zip", "1.5.4"},
+		{"/tmp/Jabra_Link_380-v2.16.0.zip", "2.16.0"},
+		{"Jabra_Evolve2_85-vector.zip", ""},
+		{"firmware-v2.zip", ""},
+	} {
+		if got, _ := PackageVersion(test.path); got != test.want {
+			t.Errorf("PackageVersion(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+// writePackage writes a zip with one file to dir. The file holds name, so
+// packages with different names differ.
+func writePackage(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	dfu, err := archive.Create("firmware.dfu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dfu.Write([]byte(name)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckPackage(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckPackage(writePackage(t, dir, "good.zip")); err != nil {
+		t.Errorf("valid package: %v", err)
+	}
+
+	notZip := filepath.Join(dir, "bad.zip")
+	if err := os.WriteFile(notZip, []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{notZip, filepath.Join(dir, "missing.zip")} {
+		if err := CheckPackage(path); !errors.Is(err, jabra.ErrFileNotAccessible) {
+			t.Errorf("CheckPackage(%s) = %v", path, err)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    firmware: 1.3.8
+    firmwareUpdate:
+      version: 1.5.4
+      duration: 50ms
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: BROKEN
+    connection: usb
+    firmwareUpdate:
+      duration: 50ms
+      fail: updateError
+  - id: 3
+    name: Jabra Evolve2 75
+    serial: LOCKED
+    connection: usb
+    firmwareLock: true
+    firmwareUpdate:
+      duration: 50ms
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	events := make(chan Event, 100)
+	scanned := make(chan struct{})
+	if err := backend.Initialize("test", jabra.Callbacks{
+		FirstScanDone: func() { close(scanned) },
+		FirmwareProgress: func(deviceID uint16, progress jabra.FirmwareProgress) {
+			events <- Event{DeviceID: deviceID, Progress: progress}
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Uninitialize()
+	<-scanned
+
+	path := writePackage(t, t.TempDir(), "Jabra_Evolve2_85-v1.5.4.zip")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var last jabra.FirmwareProgress
+	if err := Update(ctx, backend, 1, path, events, func(progress jabra.FirmwareProgress) { last = progress }); err != nil {
+		t.Fatal(err)
+	}
+	if last.Status != jabra.FirmwareCompleted || last.Percentage != 100 {
+		t.Errorf("last progress %+v", last)
+	}
+	if version, _ := backend.FirmwareVersion(1); version != "1.5.4" {
+		t.Errorf("firmware %s after the update", version)
+	}
+
+	var statusError *jabra.FirmwareStatusError
+	err = Update(ctx, backend, 2, path, events, func(jabra.FirmwareProgress) {})
+	if !errors.As(err, &statusError) || statusError.Status != jabra.FirmwareUpdateError {
+		t.Errorf("failing update: %v", err)
+	}
+
+	if err := Update(ctx, backend, 3, path, events, func(jabra.FirmwareProgress) {}); !errors.Is(err, ErrLocked) {
+		t.Errorf("update of a locked device: %v", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	err := Explain(jabra.ErrSdkTooOldForFwUpdate)
+	if !errors.Is(err, jabra.ErrSdkTooOldForFwUpdate) {
+		t.Errorf("%v does not wrap the return code", err)
+	}
+	if want := "libjabra is too old for this firmware, update the Jabra SDK and try again"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if again := Explain(err); again != err {
+		t.Errorf("explained twice: %v", again)
+	}
+	if err := Explain(jabra.ErrDeviceWriteFail); err != jabra.ErrDeviceWriteFail {
+		t.Errorf("unexplained error changed to %v", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.5.4", "1.3.8", 1},
+		{"1.10.0", "1.9.2", 1},
+		{"2.0", "2.0.0", 0},
+		{"1.3.8", "1.3.8.1", -1},
+	} {
+		if got := CompareVersions(test.a, test.b); got != test.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestRepository(t *testing.T) {
+	r := OpenRepository(filepath.Join(t.TempDir(), "firmware"))
+	uc := jabra.DeviceInfo{DeviceName: "Jabra Evolve2 85", ProductID: 0x24ba, Variant: "UC", SerialNumber: "HEADSET"}
+	ms := jabra.DeviceInfo{DeviceName: "Jabra Evolve2 85", ProductID: 0x24ba, Variant: "MS"}
+
+	newer := writePackage(t, t.TempDir(), "Jabra_Evolve2_85-v1.5.4-ev285t-vector.zip")
+	for _, add := range []struct {
+		path    string
+		variant string
+	}{
+		{newer, ""},
+		{newer, ""}, // adding twice is fine
+		{writePackage(t, t.TempDir(), "Jabra_Evolve2_85-v1.3.8.zip"), "UC"},
+	} {
+		if _, err := r.Add(add.path, 0x24ba, add.variant, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Another file with the same version is refused.
+	if _, err := r.Add(writePackage(t, t.TempDir(), "Jabra_Evolve2_85-v1.5.4.zip"), 0x24ba, "", ""); err == nil {
+		t.Error("added a second package of 1.5.4")
+	}
+
+	versions := func(device jabra.DeviceInfo) []string {
+		packages, err := r.Applicable(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var versions []string
+		for _, p := range packages {
+			versions = append(versions, p.Version)
+		}
+		return versions
+	}
+	if got := versions(uc); !slices.Equal(got, []string{"1.5.4", "1.3.8"}) {
+		t.Errorf("packages for UC %v", got)
+	}
+	if got := versions(ms); !slices.Equal(got, []string{"1.5.4"}) {
+		t.Errorf("packages for MS %v", got)
+	}
+
+	p, found, err := r.Identify(newer)
+	if err != nil || !found || p.Version != "1.5.4" {
+		t.Errorf("Identify = %+v, %v, %v", p, found, err)
+	}
+	if _, err := r.Find(ms, "1.3.8"); err == nil {
+		t.Error("found the UC package for MS")
+	}
+	var mismatch *MismatchError
+	if p, _ := r.Find(uc, "1.3.8"); !p.Fits(uc) || p.Fits(ms) {
+		t.Errorf("Fits of %+v", p)
+	} else if err := error(&MismatchError{Package: p, Device: ms}); !errors.As(err, &mismatch) || err.Error() != "Jabra_Evolve2_85-v1.3.8.zip is for product 24ba variant UC, Jabra Evolve2 85 is product 24ba variant MS" {
+		t.Errorf("mismatch error %q", err)
+	}
+
+	// Rolling back goes to the version before the last completed update.
+	for _, record := range []Record{
+		{Serial: "HEADSET", From: "1.1.0", To: "1.3.8", Result: "completed"},
+		{Serial: "HEADSET", From: "1.3.8", To: "1.5.4", Result: "completed"},
+		{Serial: "HEADSET", From: "1.5.4", To: "2.0.0", Result: "the device rejected the firmware update"},
+		{Serial: "OTHER", From: "1.0.0", To: "1.5.4", Result: "completed"},
+	} {
+		record.Package = newer
+		if err := r.Audit(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if previous, found, err := r.PreviousVersion("HEADSET", "1.5.4"); previous != "1.3.8" || !found || err != nil {
+		t.Errorf("PreviousVersion = %s, %v, %v", previous, found, err)
+	}
+	records, err := r.Records("HEADSET")
+	if err != nil || len(records) != 3 || records[0].SHA256 == "" || records[0].Host == "" {
+		t.Errorf("records %+v, %v", records, err)
+	}
+}
@@ -0,0 +1,311 @@
+package firmware
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+const catalogueName = "catalogue.json"
+
+// Package is a firmware package in a repository.
+type Package struct {
+	File      string `json:"file"` // relative to the repository
+	ProductID uint16 `json:"productId"`
+	// Variant is the DeviceInfo.Variant the package is for, empty for all
+	// variants of the product.
+	Variant string    `json:"variant,omitempty"`
+	Version string    `json:"version"`
+	SHA256  string    `json:"sha256"`
+	Added   time.Time `json:"added"`
+}
+
+// Fits reports whether the package is for the product and variant of deviceInfo.
+func (p Package) Fits(deviceInfo jabra.DeviceInfo) bool {
+	return p.ProductID == deviceInfo.ProductID && (p.Variant == "" || p.Variant == deviceInfo.Variant)
+}
+
+func (p Package) target() string {
+	if p.Variant == "" {
+		return fmt.Sprintf("product %04x", p.ProductID)
+	}
+	return fmt.Sprintf("product %04x variant %s", p.ProductID, p.Variant)
+}
+
+// MismatchError is a package offered to a device it is not for.
+type MismatchError struct {
+	Package Package
+	Device  jabra.DeviceInfo
+}
+
+func (e *MismatchError) Error() string {
+	device := Package{ProductID: e.Device.ProductID, Variant: e.Device.Variant}
+	return fmt.Sprintf("%s is for %s, %s is %s", e.Package.File, e.Package.target(), e.Device.DeviceName, device.target())
+}
+
+// DefaultRepository is $XDG_DATA_HOME/jlink/firmware, or ~/.local/share/jlink/firmware.
+func DefaultRepository() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "jlink", "firmware")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "jlink", "firmware")
+	}
+	return filepath.Join(home, ".local", "share", "jlink", "firmware")
+}
+
+// Repository is a directory of firmware packages for machines without
+// access to the Jabra cloud. catalogue.json indexes the packages by product,
+// variant and version, audit.jsonl records the updates made from it. It is
+// safe for concurrent use within a process.
+type Repository struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func OpenRepository(dir string) *Repository {
+	return &Repository{dir: dir}
+}
+
+func (r *Repository) Dir() string {
+	return r.dir
+}
+
+// Path returns where the file of p is.
+func (r *Repository) Path(p Package) string {
+	return filepath.Join(r.dir, p.File)
+}
+
+// Packages returns the catalogue ordered by product, variant and version,
+// newest first.
+func (r *Repository) Packages() ([]Package, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.read()
+}
+
+// read is Packages for callers holding r.mu.
+func (r *Repository) read() ([]Package, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, catalogueName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var catalogue struct {
+		Packages []Package `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &catalogue); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(r.dir, catalogueName), err)
+	}
+	slices.SortFunc(catalogue.Packages, func(a, b Package) int {
+		return cmp.Or(
+			cmp.Compare(a.ProductID, b.ProductID),
+			cmp.Compare(a.Variant, b.Variant),
+			CompareVersions(b.Version, a.Version),
+		)
+	})
+	return catalogue.Packages, nil
+}
+
+// write replaces the catalogue. The caller holds r.mu.
+func (r *Repository) write(packages []Package) error {
+	data, err := json.MarshalIndent(struct {
+		Packages []Package `json:"packages"`
+	}{packages}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temporary := filepath.Join(r.dir, catalogueName+".tmp")
+	if err := os.WriteFile(temporary, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, filepath.Join(r.dir, catalogueName))
+}
+
+// Add copies the package at path into the repository. version defaults to
+// the one in the file name. Adding a package twice returns the one already
+// there, a different package for the same product, variant and version is
+// an error.
+func (r *Repository) Add(path string, productID uint16, variant, version string) (Package, error) {
+	if version == "" {
+		var known bool
+		if version, known = PackageVersion(path); !known {
+			return Package{}, fmt.Errorf("%s has no version in its name, give it with --version", filepath.Base(path))
+		}
+	}
+	if _, err := parseVersion(version); err != nil {
+		return Package{}, err
+	}
+	if err := CheckPackage(path); err != nil {
+		return Package{}, err
+	}
+	sum, err := checksum(path)
+	if err != nil {
+		return Package{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	packages, err := r.read()
+	if err != nil {
+		return Package{}, err
+	}
+	for _, p := range packages {
+		if p.SHA256 == sum && p.ProductID == productID && p.Variant == variant && p.Version == version {
+			return p, nil
+		}
+		if p.ProductID == productID && p.Variant == variant && p.Version == version {
+			return Package{}, fmt.Errorf("the repository already has a different package of %s for %s", version, p.target())
+		}
+	}
+
+	p := Package{
+		File:      filepath.Base(path),
+		ProductID: productID,
+		Variant:   variant,
+		Version:   version,
+		SHA256:    sum,
+		Added:     time.Now().UTC().Truncate(time.Second),
+	}
+	if slices.ContainsFunc(packages, func(other Package) bool { return other.File == p.File }) {
+		p.File = fmt.Sprintf("%04x-%s", productID, p.File)
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return Package{}, err
+	}
+	if err := copyFile(path, r.Path(p)); err != nil {
+		return Package{}, err
+	}
+	if err := r.write(append(packages, p)); err != nil {
+		return Package{}, err
+	}
+	return p, nil
+}
+
+// Applicable returns the packages for deviceInfo, newest first.
+func (r *Repository) Applicable(deviceInfo jabra.DeviceInfo) ([]Package, error) {
+	packages, err := r.Packages()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(packages, func(p Package) bool { return !p.Fits(deviceInfo) }), nil
+}
+
+// Find returns the package of version for deviceInfo.
+func (r *Repository) Find(deviceInfo jabra.DeviceInfo, version string) (Package, error) {
+	packages, err := r.Applicable(deviceInfo)
+	if err != nil {
+		return Package{}, err
+	}
+	for _, p := range packages {
+		if p.Version == version {
+			return p, nil
+		}
+	}
+	return Package{}, fmt.Errorf("the repository in %s has no firmware %s for %s", r.dir, version, deviceInfo.DeviceName)
+}
+
+// Identify looks up the package at path by its checksum, wherever it is.
+func (r *Repository) Identify(path string) (Package, bool, error) {
+	packages, err := r.Packages()
+	if err != nil || len(packages) == 0 {
+		return Package{}, false, err
+	}
+	sum, err := checksum(path)
+	if err != nil {
+		return Package{}, false, Explain(fmt.Errorf("%w: %w", jabra.ErrFileNotAccessible, err))
+	}
+	for _, p := range packages {
+		if p.SHA256 == sum {
+			return p, true, nil
+		}
+	}
+	return Package{}, false, nil
+}
+
+func checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func copyFile(from, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+/****************************************************************************/
+/*                                VERSIONS                                  */
+/****************************************************************************/
+
+func parseVersion(version string) ([]int, error) {
+	fields := strings.Split(version, ".")
+	numbers := make([]int, len(fields))
+	for i, field := range fields {
+		number, err := strconv.Atoi(field)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("%q is not a firmware version", version)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// CompareVersions compares dotted firmware versions number by number, so
+// 1.10.0 is after 1.9.2. Versions that do not parse compare as strings.
+func CompareVersions(a, b string) int {
+	x, errA := parseVersion(a)
+	y, errB := parseVersion(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	for len(x) < len(y) {
+		x = append(x, 0)
+	}
+	for len(y) < len(x) {
+		y = append(y, 0)
+	}
+	return slices.Compare(x, y)
+}
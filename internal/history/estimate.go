@@ -0,0 +1,155 @@
+package history
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// maxGap is the longest time between two samples that still counts
+	// towards a rate. Longer gaps mean the device was off or not in use.
+	maxGap = 4 * time.Hour
+	// minObserved is how much charging or discharging a rate needs.
+	minObserved = 15 * time.Minute
+)
+
+// Rates are in percent per hour, zero without enough history.
+type Rates struct {
+	Discharge float64
+	Charge    float64
+}
+
+// RatesOf computes the rates from the samples of one device, oldest first.
+func RatesOf(samples []Sample) Rates {
+	var (
+		rates                     Rates
+		discharged, charged       float64
+		dischargeTime, chargeTime time.Duration
+	)
+	for i := 1; i < len(samples); i++ {
+		previous, sample := samples[i-1], samples[i]
+		elapsed := sample.Time.Sub(previous.Time)
+		if elapsed <= 0 || elapsed > maxGap || previous.Charging != sample.Charging {
+			continue
+		}
+		delta := float64(sample.Level) - float64(previous.Level)
+		if sample.Charging {
+			charged += delta
+			chargeTime += elapsed
+		} else {
+			discharged -= delta
+			dischargeTime += elapsed
+		}
+	}
+
+	if dischargeTime >= minObserved && discharged > 0 {
+		rates.Discharge = discharged / dischargeTime.Hours()
+	}
+	if chargeTime >= minObserved && charged > 0 {
+		rates.Charge = charged / chargeTime.Hours()
+	}
+	return rates
+}
+
+// Estimate is the expected time until the battery is empty, or full while
+// it is charging.
+type Estimate struct {
+	Level    uint8
+	Charging bool
+	// Rate is in percent per hour.
+	Rate      float64
+	Remaining time.Duration
+}
+
+// EstimateOf estimates from the samples of one device, oldest first, using
+// the last sample as the current state. It reports false when there is not
+// enough history for the current direction.
+func EstimateOf(samples []Sample) (Estimate, bool) {
+	if len(samples) == 0 {
+		return Estimate{}, false
+	}
+	last := samples[len(samples)-1]
+	rates := RatesOf(samples)
+
+	estimate := Estimate{Level: last.Level, Charging: last.Charging, Rate: rates.Discharge}
+	remaining := float64(last.Level)
+	if last.Charging {
+		estimate.Rate = rates.Charge
+		remaining = 100 - float64(last.Level)
+	}
+	if estimate.Rate == 0 {
+		return Estimate{}, false
+	}
+	estimate.Remaining = time.Duration(remaining / estimate.Rate * float64(time.Hour)).Round(time.Minute)
+
+	return estimate, true
+}
+
+func (e Estimate) String() string {
+	if e.Charging {
+		return "full in " + formatDuration(e.Remaining)
+	}
+	return formatDuration(e.Remaining) + " left"
+}
+
+// formatDuration formats d as 10h05m, or 45m under an hour.
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// Day holds the battery level in effect at the end of every hour of a day,
+// -1 for the hours without a recent sample.
+type Day struct {
+	Date  time.Time
+	Hours [24]int
+}
+
+// Days lays out the samples of one device, oldest first, over the days
+// from the day of from up to and including the day of to, in the location
+// of from.
+func Days(samples []Sample, from, to time.Time) []Day {
+	var days []Day
+	loc := from.Location()
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+
+	for date := start; !date.After(to); date = date.AddDate(0, 0, 1) {
+		day := Day{Date: date}
+		for hour := range day.Hours {
+			day.Hours[hour] = -1
+			hourStart := time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, loc)
+			hourEnd := hourStart.Add(time.Hour)
+			if hourStart.After(to) {
+				continue
+			}
+			for _, sample := range samples {
+				if !sample.Time.Before(hourEnd) {
+					break
+				}
+				if hourStart.Sub(sample.Time) <= maxGap {
+					day.Hours[hour] = int(sample.Level)
+				}
+			}
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws levels from 0 to 100, -1 as a blank.
+func Sparkline(levels []int) string {
+	line := make([]rune, 0, len(levels))
+	for _, level := range levels {
+		if level < 0 {
+			line = append(line, ' ')
+			continue
+		}
+		line = append(line, sparks[min(level*len(sparks)/101, len(sparks)-1)])
+	}
+	return string(line)
+}
@@ -0,0 +1,187 @@
+// Package history records battery changes to a CSV file under the XDG state
+// directory and estimates from them how long a battery lasts.
+package history
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	fileName = "battery.csv"
+	// DefaultMaxSize is the size at which the file is rotated. One rotated
+	// file is kept, together they hold months of samples.
+	DefaultMaxSize = 1 << 20
+)
+
+var header = []string{"time", "serial", "name", "level", "charging", "batteryLow"}
+
+// Sample is the battery state of a device at one point in time.
+type Sample struct {
+	Time       time.Time
+	Serial     string
+	Name       string
+	Level      uint8
+	Charging   bool
+	BatteryLow bool
+}
+
+// DefaultDir is $XDG_STATE_HOME/jlink, or ~/.local/state/jlink.
+func DefaultDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "jlink")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "jlink")
+	}
+	return filepath.Join(home, ".local", "state", "jlink")
+}
+
+// Store is the battery history on disk. It is safe for concurrent use
+// within a process.
+type Store struct {
+	// MaxSize is the file size in bytes at which the file is rotated.
+	MaxSize int64
+
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) *Store {
+	return &Store{MaxSize: DefaultMaxSize, dir: dir}
+}
+
+func (s *Store) path() string {
+	return filepath.Join(s.dir, fileName)
+}
+
+// Append adds sample to the file, rotating it first when it is full.
+func (s *Store) Append(sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path()); err == nil && info.Size() >= s.MaxSize {
+		if err := os.Rename(s.path(), s.path()+".1"); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(s.path(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		w.Write(header)
+	}
+	w.Write([]string{
+		sample.Time.UTC().Format(time.RFC3339),
+		sample.Serial,
+		sample.Name,
+		strconv.Itoa(int(sample.Level)),
+		strconv.FormatBool(sample.Charging),
+		strconv.FormatBool(sample.BatteryLow),
+	})
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// Samples returns the recorded samples, oldest first. An empty serial
+// returns the samples of all devices.
+func (s *Store) Samples(serial string) ([]Sample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var samples []Sample
+	for _, path := range []string{s.path() + ".1", s.path()} {
+		read, err := readFile(path, serial)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, read...)
+	}
+	return samples, nil
+}
+
+func readFile(path, serial string) ([]Sample, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = len(header)
+
+	var samples []Sample
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && record[0] == header[0] {
+			continue
+		}
+		if serial != "" && record[1] != serial {
+			continue
+		}
+
+		sample, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		samples = append(samples, sample)
+	}
+}
+
+func parseRecord(record []string) (Sample, error) {
+	t, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return Sample{}, err
+	}
+	level, err := strconv.ParseUint(record[3], 10, 8)
+	if err != nil {
+		return Sample{}, err
+	}
+	charging, err := strconv.ParseBool(record[4])
+	if err != nil {
+		return Sample{}, err
+	}
+	batteryLow, err := strconv.ParseBool(record[5])
+	if err != nil {
+		return Sample{}, err
+	}
+
+	return Sample{
+		Time:       t,
+		Serial:     record[1],
+		Name:       record[2],
+		Level:      uint8(level),
+		Charging:   charging,
+		BatteryLow: batteryLow,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+func sample(minutes int, level uint8, charging bool) Sample {
+	return Sample{
+		Time:     start.Add(time.Duration(minutes) * time.Minute),
+		Serial:   "HEADSET",
+		Name:     "Jabra Evolve2 85",
+		Level:    level,
+		Charging: charging,
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(t.TempDir())
+	store.MaxSize = 200
+
+	var want []Sample
+	for i := range 10 {
+		s := sample(i*10, uint8(100-i), false)
+		want = append(want, s)
+		if err := store.Append(s); err != nil {
+			t.Fatal(err)
+		}
+		other := s
+		other.Serial = "OTHER"
+		if err := store.Append(other); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rotation keeps one old file, the oldest samples are gone.
+	samples, err := store.Samples("HEADSET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) == 0 || len(samples) == len(want) {
+		t.Fatalf("%d samples after rotation", len(samples))
+	}
+	want = want[len(want)-len(samples):]
+	for i := range samples {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d = %+v, want %+v", i, samples[i], want[i])
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	samples := []Sample{
+		// 10% per hour charging
+		sample(0, 50, true),
+		sample(60, 60, true),
+		sample(120, 70, true),
+		// The night in between does not count.
+		sample(24*60, 100, false),
+		// 5% per hour discharging
+		sample(24*60+60, 95, false),
+		sample(24*60+120, 90, false),
+		sample(24*60+240, 80, false),
+	}
+
+	rates := RatesOf(samples)
+	if rates.Charge != 10 || rates.Discharge != 5 {
+		t.Errorf("rates %+v", rates)
+	}
+
+	estimate, ok := EstimateOf(samples)
+	if !ok || estimate.Remaining != 16*time.Hour || estimate.String() != "16h00m left" {
+		t.Errorf("discharging estimate %+v %v", estimate, ok)
+	}
+
+	estimate, ok = EstimateOf(append(samples, sample(24*60+250, 80, true)))
+	if !ok || estimate.Remaining != 2*time.Hour || estimate.String() != "full in 2h00m" {
+		t.Errorf("charging estimate %+v %v", estimate, ok)
+	}
+
+	if _, ok := EstimateOf([]Sample{sample(0, 50, true), sample(5, 51, true)}); ok {
+		t.Error("estimate from five minutes of charging")
+	}
+	if _, ok := EstimateOf(samples[:1]); ok {
+		t.Error("estimate from a single sample")
+	}
+}
+
+func TestDays(t *testing.T) {
+	samples := []Sample{
+		sample(0, 100, false),   // 08:00
+		sample(90, 80, false),   // 09:30
+		sample(150, 70, false),  // 10:30
+		sample(600, 0, false),   // 18:00
+		sample(1500, 50, false), // 09:00 the next day
+	}
+
+	days := Days(samples, start, start.Add(26*time.Hour))
+	if len(days) != 2 {
+		t.Fatalf("%d days", len(days))
+	}
+	if got := Sparkline(days[0].Hours[:]); got != "        █▇▆▆▆▆▆   ▁▁▁▁▁ " {
+		t.Errorf("first day %q", got)
+	}
+	if got := Sparkline(days[1].Hours[:]); got != "         ▄▄             " {
+		t.Errorf("second day %q", got)
+	}
+}
@@ -0,0 +1,135 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+// Recorder follows the battery events of a registry, appends them to the
+// store and keeps the samples in memory for estimates. Without a store the
+// samples are only kept in memory.
+type Recorder struct {
+	// ReadOnly makes the recorder reload the store on battery events instead
+	// of writing to it, for when another process (jlinkd) records.
+	ReadOnly bool
+	// Now is the clock the samples are stamped with.
+	Now func() time.Time
+
+	store *Store
+
+	mu      sync.Mutex
+	samples map[string][]Sample
+}
+
+// NewRecorder loads the history of store, which may be nil.
+func NewRecorder(store *Store) (*Recorder, error) {
+	r := &Recorder{
+		Now:     time.Now,
+		store:   store,
+		samples: make(map[string][]Sample),
+	}
+	if store == nil {
+		return r, nil
+	}
+
+	samples, err := store.Samples("")
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		r.samples[sample.Serial] = append(r.samples[sample.Serial], sample)
+	}
+	return r, nil
+}
+
+// Run records the battery changes delivered on subscription until ctx is
+// done or the subscription is closed.
+func (r *Recorder) Run(ctx context.Context, subscription *registry.Subscription) {
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			if event.Type != registry.Attached && event.Type != registry.BatteryChanged {
+				continue
+			}
+			if event.Device.BatteryStatus == nil || event.Device.SerialNumber == "" {
+				continue
+			}
+			if err := r.record(Sample{
+				Time:       r.Now(),
+				Serial:     event.Device.SerialNumber,
+				Name:       event.Device.DeviceName,
+				Level:      event.Device.BatteryStatus.LevelInPercent,
+				Charging:   event.Device.BatteryStatus.Charging,
+				BatteryLow: event.Device.BatteryStatus.BatteryLow,
+			}); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+// record adds sample unless it only repeats the last one of the device, as
+// happens when a headset reconnects.
+func (r *Recorder) record(sample Sample) error {
+	if r.ReadOnly {
+		return r.reload(sample.Serial)
+	}
+
+	r.mu.Lock()
+	samples := r.samples[sample.Serial]
+	if n := len(samples); n > 0 && samples[n-1].Level == sample.Level &&
+		samples[n-1].Charging == sample.Charging && samples[n-1].BatteryLow == sample.BatteryLow {
+		r.mu.Unlock()
+		return nil
+	}
+	r.samples[sample.Serial] = append(samples, sample)
+	r.mu.Unlock()
+
+	if r.store == nil {
+		return nil
+	}
+	return r.store.Append(sample)
+}
+
+func (r *Recorder) reload(serial string) error {
+	if r.store == nil {
+		return nil
+	}
+	samples, err := r.store.Samples(serial)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[serial] = samples
+	return nil
+}
+
+// Samples returns the samples of the device with serial, oldest first.
+func (r *Recorder) Samples(serial string) []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Sample(nil), r.samples[serial]...)
+}
+
+// Estimate estimates the battery of the device with serial.
+func (r *Recorder) Estimate(serial string) (Estimate, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return EstimateOf(r.samples[serial])
+}
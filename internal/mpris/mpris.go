@@ -0,0 +1,99 @@
+// Package mpris lets the buttons of a headset play, pause and skip the music
+// of the media players on the session bus through MPRIS,
+// org.mpris.MediaPlayer2.
+package mpris
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	namePrefix = "org.mpris.MediaPlayer2."
+	// Path is the object every player serves.
+	Path = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	// PlayerInterface has the playback methods and properties.
+	PlayerInterface = "org.mpris.MediaPlayer2.Player"
+)
+
+// Methods of PlayerInterface the buttons call.
+const (
+	PlayPause = "PlayPause"
+	Next      = "Next"
+	Previous  = "Previous"
+)
+
+// PlaybackStatus values.
+const (
+	Playing = "Playing"
+	Paused  = "Paused"
+	Stopped = "Stopped"
+)
+
+var ErrNoPlayer = errors.New("no media player is running")
+
+// Players are the media players on a bus.
+type Players struct {
+	conn *dbus.Conn
+}
+
+func New(conn *dbus.Conn) *Players {
+	return &Players{conn: conn}
+}
+
+// List returns the bus names of the players, sorted.
+func (p *Players) List() ([]string, error) {
+	var names []string
+	if err := p.conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return nil, err
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return !strings.HasPrefix(name, namePrefix) })
+	slices.Sort(names)
+	return names, nil
+}
+
+// Status returns the PlaybackStatus of the player with name.
+func (p *Players) Status(name string) (string, error) {
+	variant, err := p.conn.Object(name, Path).GetProperty(PlayerInterface + ".PlaybackStatus")
+	if err != nil {
+		return "", err
+	}
+	status, _ := variant.Value().(string)
+	return status, nil
+}
+
+// Active returns the player the buttons control: the first one playing,
+// else the first one paused, else the first one.
+func (p *Players) Active() (string, error) {
+	names, err := p.List()
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", ErrNoPlayer
+	}
+	statuses := make(map[string]string, len(names))
+	for _, name := range names {
+		statuses[name], _ = p.Status(name)
+	}
+	for _, want := range []string{Playing, Paused} {
+		for _, name := range names {
+			if statuses[name] == want {
+				return name, nil
+			}
+		}
+	}
+	return names[0], nil
+}
+
+// Call calls method, e.g. PlayPause, on the active player.
+func (p *Players) Call(method string) error {
+	name, err := p.Active()
+	if err != nil {
+		return err
+	}
+	return p.conn.Object(name, Path).Call(PlayerInterface+"."+method, 0).Err
+}
@@ -0,0 +1,111 @@
+package mpris
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/Watchdog0x/jLink/internal/bustest"
+)
+
+// player is a mock MPRIS player, PlayPause plays and pauses it.
+type player struct {
+	props *prop.Properties
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// newPlayer serves a player named org.mpris.MediaPlayer2.<name> on its own
+// connection to the bus at address, stopped.
+func newPlayer(t *testing.T, address, name string) *player {
+	t.Helper()
+
+	conn := bustest.Connect(t, address)
+	p := &player{}
+	if err := conn.Export(p, Path, PlayerInterface); err != nil {
+		t.Fatal(err)
+	}
+	props, err := prop.Export(conn, Path, prop.Map{
+		PlayerInterface: {"PlaybackStatus": {Value: Stopped, Emit: prop.EmitTrue}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.props = props
+	if reply, err := conn.RequestName(namePrefix+name, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName: %v, %v", reply, err)
+	}
+	return p
+}
+
+func (p *player) called(method string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls = append(p.calls, method)
+}
+
+func (p *player) PlayPause() *dbus.Error {
+	p.called(PlayPause)
+	if p.props.GetMust(PlayerInterface, "PlaybackStatus") == Playing {
+		p.props.SetMust(PlayerInterface, "PlaybackStatus", Paused)
+	} else {
+		p.props.SetMust(PlayerInterface, "PlaybackStatus", Playing)
+	}
+	return nil
+}
+
+func (p *player) Next() *dbus.Error {
+	p.called(Next)
+	return nil
+}
+
+func (p *player) Previous() *dbus.Error {
+	p.called(Previous)
+	return nil
+}
+
+func (p *player) Calls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.calls)
+}
+
+func TestPlayers(t *testing.T) {
+	address := bustest.PrivateBus(t)
+	players := New(bustest.Connect(t, address))
+
+	if err := players.Call(PlayPause); err != ErrNoPlayer {
+		t.Errorf("Call without players = %v, want %v", err, ErrNoPlayer)
+	}
+
+	browser := newPlayer(t, address, "browser")
+	spotify := newPlayer(t, address, "spotify")
+	if names, err := players.List(); err != nil || !slices.Equal(names, []string{namePrefix + "browser", namePrefix + "spotify"}) {
+		t.Fatalf("List() = %v, %v", names, err)
+	}
+
+	// Nothing plays, the first player is controlled.
+	if err := players.Call(PlayPause); err != nil {
+		t.Fatal(err)
+	}
+	// The playing one is controlled, even after another one starts.
+	spotify.props.SetMust(PlayerInterface, "PlaybackStatus", Paused)
+	if err := players.Call(Next); err != nil {
+		t.Fatal(err)
+	}
+	if err := players.Call(PlayPause); err != nil {
+		t.Fatal(err)
+	}
+	if calls := browser.Calls(); !slices.Equal(calls, []string{PlayPause, Next, PlayPause}) {
+		t.Errorf("browser calls %v", calls)
+	}
+	if calls := spotify.Calls(); len(calls) != 0 {
+		t.Errorf("spotify calls %v", calls)
+	}
+}
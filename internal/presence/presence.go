@@ -0,0 +1,275 @@
+// Package presence works out whether the user is busy, for the busylight to
+// show it, from sources scripts and the desktop can drive: a file, lines
+// written to a Unix socket, and audio streams that are playing or
+// recording.
+package presence
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Watchdog0x/jLink/internal/unixsock"
+)
+
+// Update is the state of a source, or for Merge the combined state and the
+// source that changed it.
+type Update struct {
+	Source string
+	Busy   bool
+}
+
+// Source reports its state on updates when it starts and every time the
+// state changes, until ctx is done or it fails.
+type Source interface {
+	Watch(ctx context.Context, updates chan<- Update) error
+}
+
+// Parse reads a presence word. busy, on, 1 and true are busy; available,
+// free, off, 0, false and nothing are not. Case and surrounding space do not
+// matter.
+func Parse(word string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(word)) {
+	case "busy", "on", "1", "true":
+		return true, nil
+	case "available", "free", "off", "0", "false", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%q is not busy or available", strings.TrimSpace(word))
+	}
+}
+
+func word(busy bool) string {
+	if busy {
+		return "busy"
+	}
+	return "available"
+}
+
+// Merge runs sources until ctx is done or one of them fails, sending on
+// updates the combined state, busy while any source is busy, first once
+// every source reported and after that every time it changes.
+func Merge(ctx context.Context, sources map[string]Source, updates chan<- Update) error {
+	ctx, cancel := context.WithCancel(ctx)
+	states := make(chan Update)
+	errs := make(chan error, len(sources))
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	for name, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sourceUpdates := make(chan Update)
+			go func() {
+				for update := range sourceUpdates {
+					update.Source = name
+					select {
+					case states <- update:
+					case <-ctx.Done():
+					}
+				}
+			}()
+			err := source.Watch(ctx, sourceUpdates)
+			close(sourceUpdates)
+			if err != nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}()
+	}
+
+	busy := make(map[string]bool)
+	reported := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case update := <-states:
+			was := anyBusy(busy)
+			busy[update.Source] = update.Busy
+			if len(busy) < len(sources) {
+				continue
+			}
+			if is := anyBusy(busy); !reported || is != was {
+				reported = true
+				select {
+				case updates <- Update{Source: update.Source, Busy: is}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func anyBusy(busy map[string]bool) bool {
+	for _, is := range busy {
+		if is {
+			return true
+		}
+	}
+	return false
+}
+
+// send reports busy on updates when it differs from last, the first state
+// is always sent.
+func send(ctx context.Context, updates chan<- Update, busy bool, last *bool) {
+	if last != nil && *last == busy {
+		return
+	}
+	select {
+	case updates <- Update{Busy: busy}:
+	case <-ctx.Done():
+	}
+}
+
+// File is busy or available as the word in the file at Path says, a
+// missing file is available. The file is read every Interval.
+type File struct {
+	Path     string
+	Interval time.Duration
+}
+
+func (f File) Watch(ctx context.Context, updates chan<- Update) error {
+	var last *bool
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+	for {
+		data, err := os.ReadFile(f.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			data, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+		busy, err := Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+		send(ctx, updates, busy, last)
+		last = &busy
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Socket listens on a Unix socket at Path for lines with a presence word or
+// toggle, and answers each with the resulting state, busy or available. It
+// starts available.
+type Socket struct {
+	Path string
+}
+
+func (s Socket) Watch(ctx context.Context, updates chan<- Update) error {
+	// Only the user may turn the busylight
+	listener, err := unixsock.Listen(s.Path)
+	if errors.Is(err, unixsock.ErrInUse) {
+		return fmt.Errorf("a presence socket is already listening on %s", s.Path)
+	} else if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var (
+		mu   sync.Mutex
+		busy bool
+	)
+	send(ctx, updates, false, nil)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				mu.Lock()
+				is, err := Parse(line)
+				if strings.EqualFold(line, "toggle") {
+					is, err = !busy, nil
+				}
+				if err != nil {
+					mu.Unlock()
+					fmt.Fprintf(conn, "error: %s\n", err)
+					continue
+				}
+				was := busy
+				busy = is
+				send(ctx, updates, is, &was)
+				mu.Unlock()
+				fmt.Fprintln(conn, word(is))
+			}
+		}()
+	}
+}
+
+// Audio is busy while a sound card plays or records, as the ALSA status
+// files under Dir, usually /proc/asound, say. It is read every Interval.
+type Audio struct {
+	Dir      string
+	Interval time.Duration
+}
+
+func (a Audio) Watch(ctx context.Context, updates chan<- Update) error {
+	var last *bool
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		busy, err := a.running()
+		if err != nil {
+			return err
+		}
+		send(ctx, updates, busy, last)
+		last = &busy
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// running reports whether a substream of any card is running.
+func (a Audio) running() (bool, error) {
+	paths, err := filepath.Glob(filepath.Join(a.Dir, "card*", "pcm*", "sub*", "status"))
+	if err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // the card went away
+		}
+		if strings.Contains(string(data), "state: RUNNING") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
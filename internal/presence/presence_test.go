@@ -0,0 +1,168 @@
+package presence
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func next(t *testing.T, updates <-chan Update) Update {
+	t.Helper()
+	select {
+	case update := <-updates:
+		return update
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update")
+		return Update{}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for word, want := range map[string]bool{"busy": true, " ON\n": true, "1": true, "available": false, "free": false, "": false, "Off": false} {
+		if busy, err := Parse(word); err != nil || busy != want {
+			t.Errorf("%q: %v, %v", word, busy, err)
+		}
+	}
+	if _, err := Parse("lunch"); err == nil {
+		t.Error("lunch parsed")
+	}
+}
+
+func TestFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "presence")
+	updates := make(chan Update)
+	go File{Path: path, Interval: 10 * time.Millisecond}.Watch(ctx, updates)
+
+	if update := next(t, updates); update.Busy {
+		t.Error("missing file is busy")
+	}
+	os.WriteFile(path, []byte("busy\n"), 0o644)
+	if update := next(t, updates); !update.Busy {
+		t.Error("busy file is available")
+	}
+	os.WriteFile(path, []byte("available\n"), 0o644)
+	if update := next(t, updates); update.Busy {
+		t.Error("available file is busy")
+	}
+}
+
+func TestSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "presence.sock")
+	updates := make(chan Update, 10)
+	go Socket{Path: path}.Watch(ctx, updates)
+	if update := next(t, updates); update.Busy {
+		t.Error("starts busy")
+	}
+
+	var conn net.Conn
+	for range 100 {
+		var err error
+		if conn, err = net.Dial("unix", path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatal("socket not listening")
+	}
+	defer conn.Close()
+	if info, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode %v, want 0600", info.Mode().Perm())
+	}
+	if err := (Socket{Path: path}).Watch(ctx, make(chan Update, 10)); err == nil {
+		t.Error("second watch took over the socket")
+	}
+	replies := bufio.NewScanner(conn)
+	for _, step := range []struct{ line, reply string }{
+		{"busy", "busy"},
+		{"busy", "busy"},
+		{"toggle", "available"},
+		{"lunch", `error: "lunch" is not busy or available`},
+		{"toggle", "busy"},
+	} {
+		fmt.Fprintln(conn, step.line)
+		if !replies.Scan() || replies.Text() != step.reply {
+			t.Fatalf("%s: reply %q, want %q", step.line, replies.Text(), step.reply)
+		}
+	}
+	for _, want := range []bool{true, false, true} {
+		if update := next(t, updates); update.Busy != want {
+			t.Fatalf("busy %v, want %v", update.Busy, want)
+		}
+	}
+	select {
+	case update := <-updates:
+		t.Errorf("unchanged state sent: %+v", update)
+	default:
+	}
+}
+
+func TestAudio(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	status := filepath.Join(dir, "card1", "pcm0p", "sub0", "status")
+	os.MkdirAll(filepath.Dir(status), 0o755)
+	os.WriteFile(status, []byte("closed\n"), 0o644)
+	updates := make(chan Update)
+	go Audio{Dir: dir, Interval: 10 * time.Millisecond}.Watch(ctx, updates)
+
+	if update := next(t, updates); update.Busy {
+		t.Error("closed stream is busy")
+	}
+	os.WriteFile(status, []byte("state: RUNNING\nowner_pid   : 4242\n"), 0o644)
+	if update := next(t, updates); !update.Busy {
+		t.Error("running stream is available")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	calendar, softphone := filepath.Join(dir, "calendar"), filepath.Join(dir, "softphone")
+	updates := make(chan Update)
+	done := make(chan error)
+	go func() {
+		done <- Merge(ctx, map[string]Source{
+			"calendar":  File{Path: calendar, Interval: 10 * time.Millisecond},
+			"softphone": File{Path: softphone, Interval: 10 * time.Millisecond},
+		}, updates)
+	}()
+
+	if update := next(t, updates); update.Busy {
+		t.Error("starts busy")
+	}
+	os.WriteFile(calendar, []byte("busy"), 0o644)
+	if update := next(t, updates); !update.Busy || update.Source != "calendar" {
+		t.Errorf("calendar busy: %+v", update)
+	}
+	os.WriteFile(softphone, []byte("busy"), 0o644)
+	time.Sleep(50 * time.Millisecond)
+	os.WriteFile(calendar, []byte("available"), 0o644)
+	os.WriteFile(softphone, []byte("available"), 0o644)
+	if update := next(t, updates); update.Busy {
+		t.Errorf("both available: %+v", update)
+	}
+
+	os.WriteFile(calendar, []byte("lunch"), 0o644)
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("bad word ignored")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("merge still running")
+	}
+}
@@ -0,0 +1,258 @@
+// Package settings keeps the dynamic settings of a device in a YAML file a
+// person can read and edit, and works out what it takes to bring a device
+// in line with such a file.
+package settings
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// File is a settings file. Device, serial and firmware say where the
+// settings come from, they do not restrict where they are imported.
+type File struct {
+	Device   string  `yaml:"device,omitempty"`
+	Serial   string  `yaml:"serial,omitempty"`
+	Firmware string  `yaml:"firmware,omitempty"`
+	Settings []Entry `yaml:"settings"`
+}
+
+// Entry is one setting. It is matched by GUID, or by name when the GUID is
+// left out. Value is the name of an option, or the text of a text setting.
+type Entry struct {
+	GUID  string `yaml:"guid,omitempty"`
+	Name  string `yaml:"name,omitempty"`
+	Group string `yaml:"group,omitempty"`
+	Value string `yaml:"value"`
+
+	options []string // written as a comment, for whoever edits the file
+}
+
+// FromDevice collects the settings of a device that hold a value. Passwords
+// are left out, they are not read back in clear.
+func FromDevice(device jabra.DeviceInfo, firmware string, settings []jabra.Setting) File {
+	file := File{Device: device.DeviceName, Serial: device.SerialNumber, Firmware: firmware, Settings: []Entry{}}
+	for _, setting := range settings {
+		if setting.Kind() == "" || setting.Control == jabra.ControlPasswordTextBox {
+			continue
+		}
+		entry := Entry{GUID: setting.GUID, Name: setting.Name, Group: setting.Group, Value: setting.Value()}
+		for _, option := range setting.Options {
+			entry.options = append(entry.options, option.Value)
+		}
+		file.Settings = append(file.Settings, entry)
+	}
+	return file
+}
+
+// Read parses the settings file at path.
+func Read(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, entry := range file.Settings {
+		if entry.GUID == "" && entry.Name == "" {
+			return File{}, fmt.Errorf("%s: setting %d has neither a guid nor a name", path, i+1)
+		}
+	}
+	return file, nil
+}
+
+// Marshal encodes file as YAML, with the options of a setting as a comment
+// next to its value.
+func (f File) Marshal() ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(f); err != nil {
+		return nil, err
+	}
+	if entries := mappingValue(&node, "settings"); entries != nil {
+		for i, entry := range entries.Content {
+			if value := mappingValue(entry, "value"); value != nil && len(f.Settings[i].options) > 0 {
+				value.LineComment = strings.Join(f.Settings[i].options, " | ")
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Write saves file at path.
+func (f File) Write(path string) error {
+	data, err := f.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Change is a setting a file gives another value than the device has.
+type Change struct {
+	Setting jabra.Setting // with the value of the file
+	From    string
+}
+
+// Plan compares file with the current settings of a device. It returns the
+// settings to write and the entries of the file the device cannot take,
+// like Jabra_GetInvalidSettings does for the SDK's settings files.
+func Plan(file File, current []jabra.Setting) ([]Change, []jabra.InvalidSetting) {
+	var (
+		changes []Change
+		invalid []jabra.InvalidSetting
+	)
+	for _, entry := range file.Settings {
+		index := slices.IndexFunc(current, func(setting jabra.Setting) bool {
+			return entry.matches(Entry{GUID: setting.GUID, Name: setting.Name})
+		})
+		if index == -1 {
+			invalid = append(invalid, jabra.InvalidSetting{GUID: entry.GUID, Name: entry.Name, Message: "the device has no such setting"})
+			continue
+		}
+
+		setting := current[index]
+		fail := func(message string) {
+			invalid = append(invalid, jabra.InvalidSetting{GUID: setting.GUID, Name: setting.Name, Message: message})
+		}
+		target := setting
+		switch setting.Kind() {
+		case "toggle", "list":
+			option, ok := findOption(setting, entry.Value)
+			if !ok {
+				fail(fmt.Sprintf("%q is not one of %s", entry.Value, optionNames(setting)))
+				continue
+			}
+			target.Key = option.Key
+		case "text":
+			target.Text = entry.Value
+		default:
+			fail("the setting holds no value")
+			continue
+		}
+		if target.Key == setting.Key && target.Text == setting.Text {
+			continue
+		}
+		if err := setting.Validate(target.Key, target.Text); err != nil {
+			fail(err.Error())
+			continue
+		}
+		if setting.WriteProtected() {
+			fail("the setting is protected")
+			continue
+		}
+		changes = append(changes, Change{Setting: target, From: setting.Value()})
+	}
+	return changes, invalid
+}
+
+// Canonical returns file with the GUIDs and option names the device uses,
+// so it compares with FromDevice. Entries the device cannot take stay as
+// they are.
+func (f File) Canonical(current []jabra.Setting) File {
+	f.Settings = slices.Clone(f.Settings)
+	for i, entry := range f.Settings {
+		index := slices.IndexFunc(current, func(setting jabra.Setting) bool {
+			return entry.matches(Entry{GUID: setting.GUID, Name: setting.Name})
+		})
+		if index == -1 {
+			continue
+		}
+		setting := current[index]
+		f.Settings[i].GUID, f.Settings[i].Name = setting.GUID, setting.Name
+		if option, ok := findOption(setting, entry.Value); ok && setting.DataType == jabra.SettingByte {
+			f.Settings[i].Value = option.Value
+		}
+	}
+	return f
+}
+
+// findOption finds an option by name, ignoring case, or by key.
+func findOption(setting jabra.Setting, value string) (jabra.SettingOption, bool) {
+	for _, option := range setting.Options {
+		if strings.EqualFold(option.Value, value) {
+			return option, true
+		}
+	}
+	if key, err := strconv.ParseUint(value, 10, 16); err == nil {
+		return setting.Option(uint16(key))
+	}
+	return jabra.SettingOption{}, false
+}
+
+func optionNames(setting jabra.Setting) string {
+	names := make([]string, 0, len(setting.Options))
+	for _, option := range setting.Options {
+		names = append(names, option.Value)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Difference is a setting two files disagree on, InA and InB tell whether
+// each of them has the setting at all.
+type Difference struct {
+	GUID     string
+	Name     string
+	A, B     string
+	InA, InB bool
+}
+
+// Diff lists the settings a and b give different values, in the order of a
+// followed by the settings only b has.
+func Diff(a, b File) []Difference {
+	var differences []Difference
+	matched := make([]bool, len(b.Settings))
+	for _, entry := range a.Settings {
+		index := slices.IndexFunc(b.Settings, entry.matches)
+		switch {
+		case index == -1:
+			differences = append(differences, Difference{GUID: entry.GUID, Name: entry.Name, A: entry.Value, InA: true})
+			continue
+		case b.Settings[index].Value != entry.Value:
+			differences = append(differences, Difference{GUID: entry.GUID, Name: entry.Name, A: entry.Value, B: b.Settings[index].Value, InA: true, InB: true})
+		}
+		matched[index] = true
+	}
+	for i, entry := range b.Settings {
+		if !matched[i] {
+			differences = append(differences, Difference{GUID: entry.GUID, Name: entry.Name, B: entry.Value, InB: true})
+		}
+	}
+	return differences
+}
+
+// matches compares GUIDs when both entries have one, names otherwise.
+func (e Entry) matches(other Entry) bool {
+	if e.GUID != "" && other.GUID != "" {
+		return e.GUID == other.GUID
+	}
+	return strings.EqualFold(e.Name, other.Name)
+}
@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+var device = []jabra.Setting{
+	{
+		GUID: "ringtone", Name: "Ringtone", Group: "Calls", Control: jabra.ControlDropDown, Key: 1,
+		Options: []jabra.SettingOption{{Key: 0, Value: "Tone 1"}, {Key: 1, Value: "Tone 2"}},
+	},
+	{
+		GUID: "name", Name: "Headset name", Control: jabra.ControlTextBox, DataType: jabra.SettingString, Text: "Evolve",
+		Validation: &jabra.ValidationRule{MaxLength: 8},
+	},
+	{
+		GUID: "auto-answer", Name: "Auto-answer", Control: jabra.ControlToggle, Protected: true, ProtectionEnabled: true,
+		Options: []jabra.SettingOption{{Key: 0, Value: "Off"}, {Key: 1, Value: "On"}},
+	},
+	{GUID: "pin", Name: "PIN", Control: jabra.ControlPasswordTextBox, DataType: jabra.SettingString, Text: "1234"},
+	{GUID: "ruler", Control: jabra.ControlHorizontalRuler},
+}
+
+func TestWriteAndRead(t *testing.T) {
+	file := FromDevice(jabra.DeviceInfo{DeviceName: "Jabra Evolve2 85", SerialNumber: "HEADSET"}, "1.5.4", device)
+	data, err := file.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "value: Tone 2 # Tone 1 | Tone 2\n") || strings.Contains(string(data), "1234") {
+		t.Errorf("unexpected file:\n%s", data)
+	}
+
+	path := filepath.Join(t.TempDir(), "settings.yaml")
+	if err := file.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Settings) != 3 || read.Serial != "HEADSET" || len(Diff(file, read)) != 0 {
+		t.Errorf("read back %+v", read)
+	}
+
+	if err := os.WriteFile(path, []byte("settings: [{value: x}]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Error("read a setting without guid and name")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	changes, invalid := Plan(File{Settings: []Entry{
+		{Name: "ringtone", Value: "tone 1"},
+		{GUID: "name", Value: "Evolve"},
+		{GUID: "auto-answer", Value: "On"},
+		{GUID: "volume", Name: "Volume", Value: "7"},
+	}}, device)
+	if len(changes) != 1 || changes[0].Setting.GUID != "ringtone" || changes[0].Setting.Key != 0 || changes[0].From != "Tone 2" {
+		t.Errorf("changes %+v", changes)
+	}
+	want := []jabra.InvalidSetting{
+		{GUID: "auto-answer", Name: "Auto-answer", Message: "the setting is protected"},
+		{GUID: "volume", Name: "Volume", Message: "the device has no such setting"},
+	}
+	if !reflect.DeepEqual(invalid, want) {
+		t.Errorf("invalid %+v, want %+v", invalid, want)
+	}
+
+	_, invalid = Plan(File{Settings: []Entry{{GUID: "name", Value: "Much too long"}, {GUID: "ringtone", Value: "Tone 9"}}}, device)
+	if len(invalid) != 2 || invalid[0].Message != "Headset name: at most 8 characters" || invalid[1].Message != `"Tone 9" is not one of Tone 1, Tone 2` {
+		t.Errorf("invalid values %+v", invalid)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := File{Settings: []Entry{{GUID: "ringtone", Name: "Ringtone", Value: "Tone 2"}, {GUID: "name", Name: "Headset name", Value: ""}}}
+	b := File{Settings: []Entry{{Name: "ringtone", Value: "tone 1"}, {GUID: "volume", Name: "Volume", Value: "7"}}}
+
+	want := []Difference{
+		{GUID: "ringtone", Name: "Ringtone", A: "Tone 2", B: "tone 1", InA: true, InB: true},
+		{GUID: "name", Name: "Headset name", InA: true},
+		{GUID: "volume", Name: "Volume", B: "7", InB: true},
+	}
+	if got := Diff(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %+v, want %+v", got, want)
+	}
+
+	// Compared as the device takes it, only the value differs.
+	if got := Diff(a, b.Canonical(device)); len(got) != 3 || got[0].B != "Tone 1" || got[0].Name != "Ringtone" {
+		t.Errorf("Diff with canonical b = %+v", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Package unixsock creates the Unix sockets jLink listens on, readable and
+// writable only by the current user from the moment they appear.
+package unixsock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ErrInUse is returned by Listen when another process answers on the path.
+var ErrInUse = errors.New("socket is in use")
+
+// Listen creates the Unix socket at path, mode 0600, and the directories
+// leading to it, mode 0700. A socket left behind by a process that is no
+// longer running is replaced, one still answering is not, nor is a file
+// that is no socket. Closing the listener removes the socket.
+//
+// The socket is bound and made private in a directory only the user can
+// enter, then renamed to path, so it is never reachable with the mode the
+// umask gives it.
+func Listen(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", path, ErrInUse)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() != fs.ModeSocket {
+		return nil, fmt.Errorf("%s exists and is no socket", path)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	private, err := os.MkdirTemp(dir, ".jlink-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(private)
+
+	staged := filepath.Join(private, "sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: staged, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The staged name is gone after the rename, path is removed instead
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(staged, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(staged, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &socketListener{UnixListener: listener, path: path}, nil
+}
+
+// socketListener removes its socket when it is closed.
+type socketListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *socketListener) Close() error {
+	err := l.UnixListener.Close()
+	if err == nil {
+		os.Remove(l.path)
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package jabra
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AmbienceMode mirrors Jabra_AmbienceMode.
+type AmbienceMode int
+
+const (
+	AmbienceOff AmbienceMode = iota
+	AmbienceHearThrough
+	AmbienceANC
+)
+
+func (m AmbienceMode) String() string {
+	switch m {
+	case AmbienceOff:
+		return "off"
+	case AmbienceHearThrough:
+		return "hearThrough"
+	case AmbienceANC:
+		return "anc"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseAmbienceMode parses the String form of a mode, ignoring case.
+func ParseAmbienceMode(mode string) (AmbienceMode, error) {
+	for m := AmbienceOff; m <= AmbienceANC; m++ {
+		if strings.EqualFold(m.String(), mode) {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown ambience mode %q, expected off, hearThrough or anc", mode)
+}
+
+// AmbienceEvent mirrors Jabra_AmbienceModeChangeEvent, it names what changed
+// but not the new value.
+type AmbienceEvent int
+
+const (
+	AmbienceModeChanged AmbienceEvent = iota
+	AmbienceANCLevelChanged
+	AmbienceHearThroughLevelChanged
+	AmbienceANCSettingsChanged
+	AmbienceHearThroughSettingsChanged
+	AmbienceANCBalanceChanged
+)
+
+func (e AmbienceEvent) String() string {
+	switch e {
+	case AmbienceModeChanged:
+		return "mode"
+	case AmbienceANCLevelChanged:
+		return "ancLevel"
+	case AmbienceHearThroughLevelChanged:
+		return "hearThroughLevel"
+	case AmbienceANCSettingsChanged:
+		return "ancSettings"
+	case AmbienceHearThroughSettingsChanged:
+		return "hearThroughSettings"
+	case AmbienceANCBalanceChanged:
+		return "ancBalance"
+	default:
+		return "unknown"
+	}
+}
+
+// EqualizerBand mirrors Jabra_EqualizerBand. Gains are in dB, a band takes
+// gains from -MaxGain to MaxGain.
+type EqualizerBand struct {
+	MaxGain         float32
+	CenterFrequency int // Hz
+	Gain            float32
+}
@@ -0,0 +1,177 @@
+// Package jabra holds the Go types for the Jabra SDK and the Backend
+// interface every consumer (TUI, CLI, daemon) talks to. The cgo binding to
+// libjabra lives in the sdk subpackage so this package builds without it.
+package jabra
+
+// Callbacks are invoked by the backend from its own goroutines (for the SDK,
+// from libjabra's callback threads). Nil callbacks are skipped.
+type Callbacks struct {
+	// FirstScanDone fires once the devices present at Initialize have been reported.
+	FirstScanDone  func()
+	DeviceAttached func(deviceInfo DeviceInfo)
+	DeviceRemoved  func(deviceID uint16)
+	// BatteryStatusChanged reports battery changes pushed by the device. The
+	// SDK reports the charging state promptly but levelInPercent can lag
+	// behind, so consumers should not rely on it alone.
+	BatteryStatusChanged func(deviceID uint16, batteryStatus *BatteryStatus)
+	// FirmwareProgress reports the progress of UpdateFirmware. The device
+	// usually detaches and attaches again while it is updated.
+	FirmwareProgress func(deviceID uint16, progress FirmwareProgress)
+	// SettingsChanged reports settings changed on a device listened to with
+	// ListenSettings, by its user, another application or jLink itself.
+	// Only the changed settings are given, with their new values.
+	SettingsChanged func(deviceID uint16, settings []Setting)
+	// AmbienceChanged reports that the ambience mode, a level or a balance
+	// of a device listened to with ListenAmbience changed, e.g. by its
+	// button. The new value is read with the ambience methods.
+	AmbienceChanged func(deviceID uint16, event AmbienceEvent)
+	// BusylightChanged reports the busylight of a device listened to with
+	// ListenBusylight turning on or off, by its user, a softphone or
+	// another application.
+	BusylightChanged func(deviceID uint16, on bool)
+	// HidInput reports the telephony buttons of a device as the SDK
+	// translates them. For HidOffHook value is the hook state the user asks
+	// for, true to take or make a call and false to end it; for the other
+	// inputs true is a press and false a release.
+	HidInput func(deviceID uint16, input HidInput, value bool)
+	// RawHidInput reports the HID usages of a device's buttons as they are,
+	// including those the SDK has no HidInput for. usagePage and usage are
+	// the ones of the HID usage tables, value is true for a press.
+	RawHidInput func(deviceID uint16, usagePage, usage uint16, value bool)
+}
+
+// Backend is the set of SDK operations jLink relies on. Device IDs are the
+// ones handed out in DeviceInfo and are only valid until the device detaches.
+type Backend interface {
+	// Initialize starts the session and begins reporting devices through cb.
+	Initialize(appID string, cb Callbacks) error
+	Uninitialize() error
+	// Version returns the version of the underlying SDK.
+	Version() (string, error)
+
+	// Device
+	FactoryReset(deviceID uint16) error
+	FirmwareVersion(deviceID uint16) (string, error)
+	// PlayRingtone plays ringtone type at volume level on the device, for
+	// devices with the PlayRingtone feature.
+	PlayRingtone(deviceID uint16, level, ringtoneType uint8) error
+
+	// Firmware
+	// FirmwareVersionBundle returns the versions of a parent device and its child.
+	FirmwareVersionBundle(deviceID uint16) (*FirmwareVersionBundle, error)
+	// CheckForFirmwareUpdate asks the Jabra cloud whether newer firmware
+	// exists, it needs network access and an authorization ID.
+	CheckForFirmwareUpdate(deviceID uint16, authorizationID string) (bool, error)
+	LatestFirmwareInformation(deviceID uint16, authorizationID string) (*FirmwareInfo, error)
+	// UpdateFirmware starts flashing the firmware package at path, an
+	// absolute path to a zip file. It returns once the update has started,
+	// the result is reported through Callbacks.FirmwareProgress.
+	UpdateFirmware(deviceID uint16, path string) error
+	// FirmwareLock reports whether the device refuses firmware other than
+	// the version it runs, whoever tries to install it.
+	FirmwareLock(deviceID uint16) (bool, error)
+	SetFirmwareLock(deviceID uint16, enable bool) error
+
+	// Audio
+	// AmbienceModes returns the modes a device with the AmbienceModes
+	// feature supports.
+	AmbienceModes(deviceID uint16) ([]AmbienceMode, error)
+	AmbienceMode(deviceID uint16) (AmbienceMode, error)
+	SetAmbienceMode(deviceID uint16, mode AmbienceMode) error
+	// AmbienceLevels returns the highest level of mode, the levels go from
+	// 0, the strongest, to it. Modes without levels such as off return
+	// ErrReturnParameterFail.
+	AmbienceLevels(deviceID uint16, mode AmbienceMode) (uint8, error)
+	AmbienceLevel(deviceID uint16, mode AmbienceMode) (uint8, error)
+	SetAmbienceLevel(deviceID uint16, mode AmbienceMode, level uint8) error
+	// AmbienceBalanceRange returns N, the left-right balance of mode goes
+	// from -N, all left, to N, all right.
+	AmbienceBalanceRange(deviceID uint16, mode AmbienceMode) (uint8, error)
+	AmbienceBalance(deviceID uint16, mode AmbienceMode) (int8, error)
+	SetAmbienceBalance(deviceID uint16, mode AmbienceMode, balance int8) error
+	// AmbienceLoop returns the modes the button of a device with the
+	// AmbienceModesLoop feature steps through, in order.
+	AmbienceLoop(deviceID uint16) ([]AmbienceMode, error)
+	SetAmbienceLoop(deviceID uint16, modes []AmbienceMode) error
+	// ListenAmbience starts or stops reporting ambience changes of the
+	// device through Callbacks.AmbienceChanged. Listening ends when the
+	// device detaches.
+	ListenAmbience(deviceID uint16, listen bool) error
+	// Busylight and SetBusylight return ErrNotSupported for devices without
+	// a busylight. Devices with the ManualBusyLight feature have theirs
+	// read and set as the manual busylight.
+	Busylight(deviceID uint16) (bool, error)
+	SetBusylight(deviceID uint16, on bool) error
+	// ListenBusylight starts or stops reporting busylight changes of the
+	// device through Callbacks.BusylightChanged. Listening ends when the
+	// device detaches.
+	ListenBusylight(deviceID uint16, listen bool) error
+	// EqualizerEnabled and the other equalizer methods return
+	// ErrNotSupported for devices without an equalizer.
+	EqualizerEnabled(deviceID uint16) (bool, error)
+	EnableEqualizer(deviceID uint16, enable bool) error
+	EqualizerBands(deviceID uint16) ([]EqualizerBand, error)
+	// SetEqualizerGains sets the gain of every band, in the order of
+	// EqualizerBands.
+	SetEqualizerGains(deviceID uint16, gains []float32) error
+
+	// Telephony
+	// AcquireCallLock takes the call control of a device for this process,
+	// and turns on the HID events of devices that can switch them off. It
+	// returns ErrDeviceLock while another application holds it.
+	AcquireCallLock(deviceID uint16) error
+	ReleaseCallLock(deviceID uint16) error
+	// SetOffHook, SetRinger, SetMute, SetHold and SetOnline tell the device
+	// the state of the call, for it to show and act on. Devices without HID
+	// telephony return ErrNotSupported.
+	SetOffHook(deviceID uint16, offHook bool) error
+	SetRinger(deviceID uint16, ringing bool) error
+	SetMute(deviceID uint16, mute bool) error
+	SetHold(deviceID uint16, hold bool) error
+	// SetOnline opens the audio link of a wireless device before a call,
+	// and closes it after.
+	SetOnline(deviceID uint16, online bool) error
+
+	// Battery Status
+	BatteryStatus(deviceID uint16) (*BatteryStatus, error)
+
+	// Bluetooth
+	SetBTPairing(deviceID uint16) error
+	StopBTPairing(deviceID uint16) error
+	// SearchNewDevices starts a search on the dongle, it takes about 20 seconds.
+	// Results are read with SearchDeviceList while the search runs.
+	SearchNewDevices(deviceID uint16) error
+	SearchDeviceList(deviceID uint16) *PairingList
+	PairingList(deviceID uint16) *PairingList
+	ConnectNewDevice(deviceID uint16, device PairedDevice) error
+	ConnectPairedDevice(deviceID uint16, device PairedDevice) error
+	DisconnectPairedDevice(deviceID uint16, device PairedDevice) error
+	ClearPairedDevice(deviceID uint16, device PairedDevice) error
+	ClearPairingList(deviceID uint16) error
+	ConnectBTDevice(deviceID uint16) error
+	DisconnectBTDevice(deviceID uint16) error
+
+	// Settings
+	AutoPairing(deviceID uint16) (bool, error)
+	SetAutoPairing(deviceID uint16, enable bool) error
+	// Settings returns the dynamic settings of the device, described by the
+	// device itself: names, groups, options and current values.
+	Settings(deviceID uint16) ([]Setting, error)
+	// SetSettings writes the values of settings, matched by GUID. When some
+	// could not be written it returns an error and FailedSettingNames names them.
+	SetSettings(deviceID uint16, settings []Setting) error
+	FailedSettingNames(deviceID uint16) []string
+	// ListenSettings starts or stops reporting changes of the settings of
+	// the device through Callbacks.SettingsChanged, for devices with the
+	// SettingsChangeNotification feature. Listening ends when the device
+	// detaches.
+	ListenSettings(deviceID uint16, listen bool) error
+	// SaveSettingsToFile and LoadSettingsFromFile use the SDK's own settings
+	// file format. Recent versions of libjabra no longer implement them and
+	// return ErrNotSupported.
+	SaveSettingsToFile(deviceID uint16, path string) error
+	LoadSettingsFromFile(deviceID uint16, path string, mode SettingsLoadMode) ([]Setting, error)
+	// InvalidSettings names the settings of the last file loaded that did
+	// not apply.
+	InvalidSettings(deviceID uint16) (InvalidSettings, error)
+}
@@ -1,8 +1,9 @@
-package main
+package jabra
 
 import "fmt"
 
-type errorStatusCode int
+// ErrorStatusCode mirrors Jabra_ErrorStatus as reported in Jabra_DeviceInfo.
+type ErrorStatusCode int
 
 type ReturnCodeError struct {
 	code    int
@@ -10,7 +11,7 @@ type ReturnCodeError struct {
 }
 
 type JabraErrorStatusCode struct {
-	code    errorStatusCode
+	code    ErrorStatusCode
 	message string
 }
 
@@ -22,6 +23,16 @@ func (e *ReturnCodeError) Error() string {
 	return fmt.Sprintf("Error %d: %s", e.code, e.message)
 }
 
+// Code returns the Jabra_ReturnCode value.
+func (e *ReturnCodeError) Code() int {
+	return e.code
+}
+
+// Code returns the Jabra_ErrorStatus value.
+func (e *JabraErrorStatusCode) Code() ErrorStatusCode {
+	return e.code
+}
+
 var (
 	ErrReturnOk                        = &ReturnCodeError{0, "Success"}
 	ErrDeviceUnknown                   = &ReturnCodeError{1, "The device is not known"}
@@ -81,7 +92,8 @@ var (
 	ErrUpdateIsNotReady          = &JabraErrorStatusCode{21, "The resource is not yet ready to be updated"}
 )
 
-func returnCode(code int) error {
+// ReturnCode maps a Jabra_ReturnCode to its error value. Return_Ok maps to nil.
+func ReturnCode(code int) error {
 	switch code {
 	case 0:
 		return nil
@@ -154,7 +166,8 @@ func returnCode(code int) error {
 	}
 }
 
-func checkErrorStatus(code errorStatusCode) error {
+// CheckErrorStatus maps a Jabra_ErrorStatus to its error value. NoError maps to nil.
+func CheckErrorStatus(code ErrorStatusCode) error {
 	switch code {
 	case 0:
 		return nil
@@ -173,7 +186,7 @@ func checkErrorStatus(code errorStatusCode) error {
 	case 7:
 		return ErrDeviceInfoError
 	case 8:
-		return ErrFileNotAccessible
+		return ErrFileNotAccessibleStatus
 	case 9:
 		return ErrFileNotCompatible
 	case 10:
@@ -0,0 +1,31 @@
+package jabra
+
+import "testing"
+
+func TestCheckErrorStatus(t *testing.T) {
+	if err := CheckErrorStatus(0); err != nil {
+		t.Errorf("CheckErrorStatus(0) = %v", err)
+	}
+	if err := CheckErrorStatus(8); err != ErrFileNotAccessibleStatus {
+		t.Errorf("CheckErrorStatus(8) = %v, want %v", err, ErrFileNotAccessibleStatus)
+	}
+	// Every status maps to the error with its code, unknown ones too.
+	for code := ErrorStatusCode(1); code <= 22; code++ {
+		err, ok := CheckErrorStatus(code).(*JabraErrorStatusCode)
+		if !ok || err.Code() != code {
+			t.Errorf("CheckErrorStatus(%d) = %v", code, err)
+		}
+	}
+}
+
+func TestReturnCode(t *testing.T) {
+	if err := ReturnCode(0); err != nil {
+		t.Errorf("ReturnCode(0) = %v", err)
+	}
+	for code := 1; code <= 33; code++ {
+		err, ok := ReturnCode(code).(*ReturnCodeError)
+		if !ok || err.Code() != code {
+			t.Errorf("ReturnCode(%d) = %v", code, err)
+		}
+	}
+}
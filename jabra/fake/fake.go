@@ -0,0 +1,1651 @@
+// Package fake implements jabra.Backend in memory from a Scenario, so jLink
+// can run and be tested without libjabra or a physical device.
+package fake
+
+import (
+	"cmp"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+type device struct {
+	spec         DeviceSpec
+	info         jabra.DeviceInfo
+	attached     bool
+	autoPairing  bool
+	firmwareLock bool
+	battery      *battery
+	pairingList  []pairedEntry
+	searchResult []pairedEntry
+	searchUntil  time.Time
+	searching    bool
+	ringtones    int
+	updating     bool
+	// settings are in the order of spec.Settings
+	settings       []jabra.Setting
+	failedSettings []string
+	// listening is set by ListenSettings until the device detaches.
+	listening bool
+
+	ambienceModes   []jabra.AmbienceMode
+	ambience        jabra.AmbienceMode
+	ambienceLevel   map[jabra.AmbienceMode]uint8
+	ambienceBalance map[jabra.AmbienceMode]int8
+	ambienceLoop    []jabra.AmbienceMode
+	// listeningAmbience is set by ListenAmbience until the device detaches.
+	listeningAmbience bool
+	busylight         bool
+	// listeningBusylight is set by ListenBusylight until the device detaches.
+	listeningBusylight bool
+	equalizerOn        bool
+	equalizer          []jabra.EqualizerBand
+	// call is set by the telephony methods and cleared when the device
+	// detaches.
+	call TelephonyState
+}
+
+type pairedEntry struct {
+	jabra.PairedDevice
+	device *uint16
+}
+
+type battery struct {
+	level         float64
+	charging      bool
+	drainPerHour  float64
+	chargePerHour float64
+	lowAt         float64
+	extraUnits    []unit
+	updated       time.Time
+}
+
+type unit struct {
+	component jabra.BatteryComponent
+	level     float64
+}
+
+// Backend is an in-memory jabra.Backend. It is safe for concurrent use.
+type Backend struct {
+	// Now is the clock used for battery drain and search timeouts. Tests
+	// replace it to control time, it defaults to time.Now.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	scenario  *Scenario
+	devices   map[uint16]*device
+	order     []uint16
+	callbacks jabra.Callbacks
+	stop      chan struct{}
+}
+
+func New(scenario *Scenario) *Backend {
+	b := &Backend{
+		Now:      time.Now,
+		scenario: scenario,
+		devices:  make(map[uint16]*device),
+	}
+
+	for _, spec := range scenario.Devices {
+		connection, _ := parseConnection(spec.Connection)
+		featureFlags, _ := parseFeatures(spec.Features)
+		vendorID := spec.VendorID
+		if vendorID == 0 {
+			vendorID = 0x0B0E
+		}
+
+		d := &device{
+			spec:         spec,
+			autoPairing:  spec.AutoPairing,
+			firmwareLock: spec.FirmwareLock,
+			info: jabra.DeviceInfo{
+				DeviceID:         spec.ID,
+				ProductID:        spec.ProductID,
+				VendorID:         vendorID,
+				DeviceName:       spec.Name,
+				IsDongle:         spec.Dongle,
+				Variant:          spec.Variant,
+				SerialNumber:     spec.Serial,
+				DeviceConnection: connection,
+				ParentDeviceID:   spec.Parent,
+				FeatureFlags:     featureFlags,
+
+				IsInFirmwareUpdateMode: spec.FirmwareUpdateMode,
+			},
+			pairingList:  toEntries(spec.PairingList),
+			searchResult: toEntries(spec.SearchResults),
+			settings:     toSettings(spec.Settings),
+		}
+		if spec.Dongle {
+			d.info.DongleName = spec.Name
+		}
+		d.resetAudio()
+		if spec.Battery != nil {
+			d.battery = &battery{
+				level:         spec.Battery.Level,
+				charging:      spec.Battery.Charging,
+				drainPerHour:  spec.Battery.DrainPerHour,
+				chargePerHour: spec.Battery.ChargePerHour,
+				lowAt:         spec.Battery.LowAt,
+			}
+			if d.battery.lowAt == 0 {
+				d.battery.lowAt = 10
+			}
+			for _, u := range spec.Battery.ExtraUnits {
+				component, _ := parseComponent(u.Component)
+				d.battery.extraUnits = append(d.battery.extraUnits, unit{component: component, level: u.Level})
+			}
+		}
+
+		b.devices[spec.ID] = d
+		b.order = append(b.order, spec.ID)
+	}
+
+	return b
+}
+
+func toSettings(specs []SettingSpec) []jabra.Setting {
+	settings := make([]jabra.Setting, 0, len(specs))
+	for _, spec := range specs {
+		setting, _ := parseSetting(spec)
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+func toEntries(specs []PairedSpec) []pairedEntry {
+	entries := make([]pairedEntry, 0, len(specs))
+	for _, spec := range specs {
+		btAddr, _ := jabra.ParseBTAddr(spec.Address)
+		entries = append(entries, pairedEntry{
+			PairedDevice: jabra.PairedDevice{
+				DeviceName:   spec.Name,
+				DeviceBTAddr: btAddr,
+				IsConnected:  spec.Connected,
+			},
+			device: spec.Device,
+		})
+	}
+	return entries
+}
+
+/****************************************************************************/
+/*                              SIMULATION                                  */
+/****************************************************************************/
+
+// Attach reports deviceID as attached, as if it was plugged in.
+func (b *Backend) Attach(deviceID uint16) {
+	b.mu.Lock()
+	d, exists := b.devices[deviceID]
+	if !exists || d.attached {
+		b.mu.Unlock()
+		return
+	}
+	d.attached = true
+	if d.battery != nil {
+		d.battery.updated = b.Now()
+	}
+	info := d.info
+	attached := b.callbacks.DeviceAttached
+	b.mu.Unlock()
+
+	if attached != nil {
+		attached(info)
+	}
+}
+
+// Detach reports deviceID as removed, as if it was unplugged.
+func (b *Backend) Detach(deviceID uint16) {
+	b.mu.Lock()
+	d, exists := b.devices[deviceID]
+	if !exists || !d.attached {
+		b.mu.Unlock()
+		return
+	}
+	d.attached = false
+	d.listening = false
+	d.listeningAmbience = false
+	d.listeningBusylight = false
+	d.call = TelephonyState{}
+	removed := b.callbacks.DeviceRemoved
+	b.mu.Unlock()
+
+	if removed != nil {
+		removed(deviceID)
+	}
+}
+
+// SetCharging starts or stops charging the battery of deviceID.
+func (b *Backend) SetCharging(deviceID uint16, charging bool) {
+	b.changeBattery(deviceID, func(bat *battery) {
+		bat.charging = charging
+	})
+}
+
+// SetBatteryLevel sets the battery of deviceID to level percent.
+func (b *Backend) SetBatteryLevel(deviceID uint16, level float64) {
+	b.changeBattery(deviceID, func(bat *battery) {
+		delta := level - bat.level
+		bat.level = level
+		for i := range bat.extraUnits {
+			bat.extraUnits[i].level = clamp(bat.extraUnits[i].level + delta)
+		}
+	})
+}
+
+// changeBattery applies change to the battery of deviceID and reports the
+// result through the battery callback while the device is attached.
+func (b *Backend) changeBattery(deviceID uint16, change func(bat *battery)) {
+	b.mu.Lock()
+	d, exists := b.devices[deviceID]
+	if !exists || d.battery == nil {
+		b.mu.Unlock()
+		return
+	}
+	b.drain(d.battery)
+	change(d.battery)
+
+	batteryChanged := b.callbacks.BatteryStatusChanged
+	if !d.attached || d.spec.Battery.NoCallback || batteryChanged == nil {
+		b.mu.Unlock()
+		return
+	}
+	batteryStatus := d.batteryStatus()
+	delay := d.spec.Battery.CallbackDelay
+	b.mu.Unlock()
+
+	if delay == 0 {
+		batteryChanged(deviceID, batteryStatus)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		b.mu.Lock()
+		current := b.callbacks.BatteryStatusChanged
+		attached := d.attached
+		b.mu.Unlock()
+
+		if current != nil && attached {
+			current(deviceID, batteryStatus)
+		}
+	})
+}
+
+// drain brings the battery level up to date with the clock.
+func (b *Backend) drain(bat *battery) {
+	now := b.Now()
+	if bat.updated.IsZero() {
+		bat.updated = now
+		return
+	}
+
+	hours := now.Sub(bat.updated).Hours()
+	bat.updated = now
+
+	delta := -bat.drainPerHour * hours
+	if bat.charging {
+		delta = bat.chargePerHour * hours
+	}
+	bat.level = clamp(bat.level + delta)
+	for i := range bat.extraUnits {
+		bat.extraUnits[i].level = clamp(bat.extraUnits[i].level + delta)
+	}
+}
+
+func clamp(level float64) float64 {
+	return math.Max(0, math.Min(100, level))
+}
+
+func (b *Backend) run(stop chan struct{}) {
+	start := b.Now()
+
+	b.mu.Lock()
+	initial := make([]uint16, 0, len(b.order))
+	for _, id := range b.order {
+		if !b.devices[id].spec.Detached {
+			initial = append(initial, id)
+		}
+	}
+	events := slices.Clone(b.scenario.Events)
+	b.mu.Unlock()
+
+	for _, id := range initial {
+		b.Attach(id)
+	}
+
+	b.mu.Lock()
+	firstScanDone := b.callbacks.FirstScanDone
+	b.mu.Unlock()
+	if firstScanDone != nil {
+		firstScanDone()
+	}
+
+	slices.SortStableFunc(events, func(a, b Event) int { return cmp.Compare(a.At, b.At) })
+	for _, event := range events {
+		select {
+		case <-stop:
+			return
+		case <-time.After(event.At - b.Now().Sub(start)):
+		}
+
+		switch event.Action {
+		case "attach":
+			b.Attach(event.Device)
+		case "detach":
+			b.Detach(event.Device)
+		case "charge":
+			b.SetCharging(event.Device, true)
+		case "discharge":
+			b.SetCharging(event.Device, false)
+		case "level":
+			b.SetBatteryLevel(event.Device, event.Level)
+		case "setting":
+			b.SetSetting(event.Device, event.Setting, event.Value)
+		case "ambience":
+			b.SetAmbience(event.Device, event.Value)
+		case "busylight":
+			b.PressBusylight(event.Device, event.Value)
+		case "button":
+			input, _ := jabra.ParseHidInput(event.Value)
+			b.PressButton(event.Device, input)
+		}
+	}
+}
+
+// SetSetting changes the setting guid of deviceID to the option named value,
+// or to the text value, as if it was changed on the device itself.
+func (b *Backend) SetSetting(deviceID uint16, guid, value string) {
+	b.mu.Lock()
+	d, exists := b.devices[deviceID]
+	if !exists {
+		b.mu.Unlock()
+		return
+	}
+	index := slices.IndexFunc(d.settings, func(setting jabra.Setting) bool { return setting.GUID == guid })
+	if index == -1 {
+		b.mu.Unlock()
+		return
+	}
+	setting := &d.settings[index]
+	if setting.DataType == jabra.SettingString {
+		setting.Text = value
+	} else {
+		for _, option := range setting.Options {
+			if option.Value == value {
+				setting.Key = option.Key
+			}
+		}
+	}
+	changed := b.settingsChanged(d, []jabra.Setting{*setting})
+	b.mu.Unlock()
+
+	changed()
+}
+
+// settingsChanged returns the call of the SettingsChanged callback for
+// settings of d, to make once b.mu is released. It does nothing when no one
+// listens to d.
+func (b *Backend) settingsChanged(d *device, settings []jabra.Setting) func() {
+	callback := b.callbacks.SettingsChanged
+	if !d.listening || !d.attached || callback == nil || len(settings) == 0 {
+		return func() {}
+	}
+	id := d.info.DeviceID
+	return func() { callback(id, settings) }
+}
+
+/****************************************************************************/
+/*                           GENERAL UTILITES                               */
+/****************************************************************************/
+
+func (b *Backend) Initialize(appID string, cb jabra.Callbacks) error {
+	b.mu.Lock()
+	b.callbacks = cb
+	b.stop = make(chan struct{})
+	stop := b.stop
+	b.mu.Unlock()
+
+	go b.run(stop)
+
+	return nil
+}
+
+func (b *Backend) Uninitialize() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+	b.callbacks = jabra.Callbacks{}
+
+	return nil
+}
+
+func (b *Backend) Version() (string, error) {
+	if b.scenario.SDKVersion == "" {
+		return "simulated", nil
+	}
+	return b.scenario.SDKVersion, nil
+}
+
+// attached returns the attached device with deviceID. The caller holds b.mu.
+func (b *Backend) attached(deviceID uint16) (*device, error) {
+	d, exists := b.devices[deviceID]
+	if !exists || !d.attached {
+		return nil, jabra.ErrDeviceUnknown
+	}
+	return d, nil
+}
+
+func (b *Backend) FactoryReset(deviceID uint16) error {
+	b.mu.Lock()
+	d, err := b.attached(deviceID)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	if !d.info.FeatureFlags.FactoryReset {
+		b.mu.Unlock()
+		return jabra.ErrNoFactorySupported
+	}
+	d.autoPairing = d.spec.AutoPairing
+	d.pairingList = nil
+	d.settings = toSettings(d.spec.Settings)
+	d.resetAudio()
+	b.mu.Unlock()
+
+	// The device reboots after a factory reset.
+	b.Detach(deviceID)
+	go func() {
+		time.Sleep(2 * time.Second)
+		b.Attach(deviceID)
+	}()
+
+	return nil
+}
+
+func (b *Backend) FirmwareVersion(deviceID uint16) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return "", err
+	}
+	if d.spec.Firmware == "" {
+		return "", jabra.ErrNoInformation
+	}
+	return d.spec.Firmware, nil
+}
+
+func (b *Backend) PlayRingtone(deviceID uint16, level, ringtoneType uint8) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	if !d.info.FeatureFlags.PlayRingtone {
+		return jabra.ErrNotSupported
+	}
+	d.ringtones++
+	return nil
+}
+
+// Ringtones returns how often a ringtone was played on deviceID.
+func (b *Backend) Ringtones(deviceID uint16) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d, exists := b.devices[deviceID]; exists {
+		return d.ringtones
+	}
+	return 0
+}
+
+/****************************************************************************/
+/*                                FIRMWARE                                  */
+/****************************************************************************/
+
+// FirmwareVersionBundle reports the first attached headset connected
+// through the dongle deviceID as its child.
+func (b *Backend) FirmwareVersionBundle(deviceID uint16) (*jabra.FirmwareVersionBundle, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if !d.info.IsDongle {
+		return nil, jabra.ErrNotSupported
+	}
+	for _, id := range b.order {
+		child := b.devices[id]
+		if child.attached && !child.info.IsDongle && child.info.ParentDeviceID == deviceID && child.info.DeviceConnection != jabra.ConnectionUSB {
+			return &jabra.FirmwareVersionBundle{Parent: d.spec.Firmware, Child: child.spec.Firmware}, nil
+		}
+	}
+	return nil, jabra.ErrNoInformation
+}
+
+func (b *Backend) CheckForFirmwareUpdate(deviceID uint16, authorizationID string) (bool, error) {
+	info, err := b.LatestFirmwareInformation(deviceID, authorizationID)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return info.Version != b.devices[deviceID].spec.Firmware, nil
+}
+
+func (b *Backend) LatestFirmwareInformation(deviceID uint16, authorizationID string) (*jabra.FirmwareInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if authorizationID == "" {
+		return nil, jabra.ErrReturnParameterFail
+	}
+	if d.spec.LatestFirmware == "" {
+		return nil, jabra.ErrNoInformation
+	}
+	return &jabra.FirmwareInfo{Version: d.spec.LatestFirmware, Stage: "Production"}, nil
+}
+
+// UpdateFirmware reports progress in steps of 10%, then the device
+// reattaches with the new version, or in firmware update mode when the
+// scenario lets the update fail.
+func (b *Backend) UpdateFirmware(deviceID uint16, path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	if d.spec.FirmwareUpdate == nil {
+		return jabra.ErrNotSupported
+	}
+	if d.updating {
+		return jabra.ErrDeviceBadState
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return jabra.ErrFileNotAccessible
+	}
+	if d.firmwareLock {
+		// Like the SDK, the lock is only reported once the update started.
+		go b.firmwareProgress(deviceID, jabra.FirmwareNotAllowed, 0)
+		return nil
+	}
+	d.updating = true
+
+	go b.updateFirmware(deviceID, *d.spec.FirmwareUpdate)
+	return nil
+}
+
+func (b *Backend) firmwareProgress(deviceID uint16, status jabra.FirmwareEventStatus, percentage uint16) {
+	b.mu.Lock()
+	callback := b.callbacks.FirmwareProgress
+	b.mu.Unlock()
+	if callback != nil {
+		callback(deviceID, jabra.FirmwareProgress{Type: jabra.FirmwareUpdate, Status: status, Percentage: percentage})
+	}
+}
+
+func (b *Backend) updateFirmware(deviceID uint16, spec FirmwareUpdateSpec) {
+	duration := spec.Duration
+	if duration == 0 {
+		duration = 2 * time.Second
+	}
+	progress := func(status jabra.FirmwareEventStatus, percentage uint16) {
+		b.firmwareProgress(deviceID, status, percentage)
+	}
+
+	progress(jabra.FirmwareInitiating, 0)
+	for percentage := uint16(0); percentage < 100; percentage += 10 {
+		progress(jabra.FirmwareInProgress, percentage)
+		time.Sleep(duration / 10)
+		// The device restarts into its bootloader half way.
+		if percentage == 50 {
+			b.Detach(deviceID)
+		}
+	}
+
+	failure, _ := parseFirmwareStatus(spec.Fail)
+	b.mu.Lock()
+	d := b.devices[deviceID]
+	d.updating = false
+	d.info.IsInFirmwareUpdateMode = spec.Fail != ""
+	if spec.Fail == "" && spec.Version != "" {
+		d.spec.Firmware = spec.Version
+	}
+	b.mu.Unlock()
+
+	b.Attach(deviceID)
+	if spec.Fail != "" {
+		progress(failure, 90)
+		return
+	}
+	progress(jabra.FirmwareCompleted, 100)
+}
+
+// FirmwareLock reports devices without a lock as unlocked, like
+// Jabra_IsFirmwareLockEnabled, only SetFirmwareLock refuses them.
+func (b *Backend) FirmwareLock(deviceID uint16) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return false, err
+	}
+	return d.firmwareLock, nil
+}
+
+func (b *Backend) SetFirmwareLock(deviceID uint16, enable bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	if d.spec.FirmwareUpdate == nil {
+		return jabra.ErrNotSupported
+	}
+	d.firmwareLock = enable
+	return nil
+}
+
+/****************************************************************************/
+/*                                  AUDIO                                   */
+/****************************************************************************/
+
+// resetAudio sets ambience, busylight and equalizer to the way the device
+// starts, and their feature flags.
+func (d *device) resetAudio() {
+	d.ambienceModes, d.ambience, _ = parseAmbience(d.spec.Ambience)
+	d.ambienceLoop, _ = parseAmbienceLoop(d.spec.Ambience)
+	d.ambienceLevel = make(map[jabra.AmbienceMode]uint8)
+	d.ambienceBalance = make(map[jabra.AmbienceMode]int8)
+	d.busylight = d.spec.Busylight != nil && d.spec.Busylight.On
+	d.equalizerOn = d.spec.Equalizer != nil && d.spec.Equalizer.Enabled
+	d.equalizer = toBands(d.spec.Equalizer)
+
+	d.info.FeatureFlags.AmbienceModes = d.info.FeatureFlags.AmbienceModes || d.spec.Ambience != nil
+	d.info.FeatureFlags.AmbienceModesLoop = d.info.FeatureFlags.AmbienceModesLoop || d.ambienceLoop != nil
+	if d.spec.Busylight != nil && d.spec.Busylight.Manual {
+		d.info.FeatureFlags.ManualBusyLight = true
+	} else {
+		d.info.FeatureFlags.BusyLight = d.info.FeatureFlags.BusyLight || d.spec.Busylight != nil
+	}
+	d.info.FeatureFlags.MusicEqualizer = d.info.FeatureFlags.MusicEqualizer || d.spec.Equalizer != nil
+}
+
+// audio returns the attached device deviceID, or ErrNotSupported when has
+// finds the feature missing from its spec.
+func (b *Backend) audio(deviceID uint16, has func(spec DeviceSpec) bool) (*device, error) {
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if !has(d.spec) {
+		return nil, jabra.ErrNotSupported
+	}
+	return d, nil
+}
+
+func hasAmbience(spec DeviceSpec) bool  { return spec.Ambience != nil }
+func hasBusylight(spec DeviceSpec) bool { return spec.Busylight != nil }
+func hasEqualizer(spec DeviceSpec) bool { return spec.Equalizer != nil }
+
+func (b *Backend) AmbienceModes(deviceID uint16) ([]jabra.AmbienceMode, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.ambienceModes), nil
+}
+
+func (b *Backend) AmbienceMode(deviceID uint16) (jabra.AmbienceMode, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return 0, err
+	}
+	return d.ambience, nil
+}
+
+func (b *Backend) SetAmbienceMode(deviceID uint16, mode jabra.AmbienceMode) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(d.ambienceModes, mode) {
+		return jabra.ErrReturnParameterFail
+	}
+	d.ambience = mode
+	return nil
+}
+
+// ambienceRanges returns the highest level and the balance range of mode,
+// modes without them fail with Return_ParameterFail like in the SDK.
+func (d *device) ambienceRanges(mode jabra.AmbienceMode) (levels, balance uint8, err error) {
+	if mode == jabra.AmbienceOff || !slices.Contains(d.ambienceModes, mode) {
+		return 0, 0, jabra.ErrReturnParameterFail
+	}
+	levels, balance = 5, 3
+	if spec := d.spec.Ambience; spec.Levels != 0 {
+		levels = spec.Levels
+	}
+	if spec := d.spec.Ambience; spec.Balance != 0 {
+		balance = spec.Balance
+	}
+	return levels, balance, nil
+}
+
+func (b *Backend) AmbienceLevels(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return 0, err
+	}
+	levels, _, err := d.ambienceRanges(mode)
+	return levels, err
+}
+
+func (b *Backend) AmbienceLevel(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return 0, err
+	}
+	if _, _, err := d.ambienceRanges(mode); err != nil {
+		return 0, err
+	}
+	return d.ambienceLevel[mode], nil
+}
+
+func (b *Backend) SetAmbienceLevel(deviceID uint16, mode jabra.AmbienceMode, level uint8) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return err
+	}
+	levels, _, err := d.ambienceRanges(mode)
+	if err != nil {
+		return err
+	}
+	if level > levels {
+		return jabra.ErrReturnParameterFail
+	}
+	d.ambienceLevel[mode] = level
+	return nil
+}
+
+func (b *Backend) AmbienceBalanceRange(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return 0, err
+	}
+	_, balance, err := d.ambienceRanges(mode)
+	return balance, err
+}
+
+func (b *Backend) AmbienceBalance(deviceID uint16, mode jabra.AmbienceMode) (int8, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return 0, err
+	}
+	if _, _, err := d.ambienceRanges(mode); err != nil {
+		return 0, err
+	}
+	return d.ambienceBalance[mode], nil
+}
+
+func (b *Backend) SetAmbienceBalance(deviceID uint16, mode jabra.AmbienceMode, balance int8) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return err
+	}
+	_, limit, err := d.ambienceRanges(mode)
+	if err != nil {
+		return err
+	}
+	if balance > int8(limit) || balance < -int8(limit) {
+		return jabra.ErrReturnParameterFail
+	}
+	d.ambienceBalance[mode] = balance
+	return nil
+}
+
+func (b *Backend) AmbienceLoop(deviceID uint16) ([]jabra.AmbienceMode, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return nil, err
+	}
+	if !d.info.FeatureFlags.AmbienceModesLoop {
+		return nil, jabra.ErrNotSupported
+	}
+	return slices.Clone(d.ambienceLoop), nil
+}
+
+// SetAmbienceLoop fails with Device_WriteFail for a loop longer than the
+// modes of the device or with a mode it does not have.
+func (b *Backend) SetAmbienceLoop(deviceID uint16, modes []jabra.AmbienceMode) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return err
+	}
+	if !d.info.FeatureFlags.AmbienceModesLoop {
+		return jabra.ErrNotSupported
+	}
+	if len(modes) > len(d.ambienceModes) {
+		return jabra.ErrDeviceWriteFail
+	}
+	for _, mode := range modes {
+		if !slices.Contains(d.ambienceModes, mode) {
+			return jabra.ErrDeviceWriteFail
+		}
+	}
+	d.ambienceLoop = slices.Clone(modes)
+	return nil
+}
+
+func (b *Backend) ListenAmbience(deviceID uint16, listen bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasAmbience)
+	if err != nil {
+		return err
+	}
+	d.listeningAmbience = listen
+	return nil
+}
+
+// SetAmbience changes the ambience mode of deviceID to the mode named
+// value, or without one to the next mode of its loop, as if the button of
+// the device was pressed.
+func (b *Backend) SetAmbience(deviceID uint16, value string) {
+	b.mu.Lock()
+	d, exists := b.devices[deviceID]
+	if !exists || len(d.ambienceModes) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	if value != "" {
+		d.ambience, _ = jabra.ParseAmbienceMode(value)
+	} else {
+		loop := d.ambienceLoop
+		if len(loop) == 0 {
+			loop = d.ambienceModes
+		}
+		next := (slices.Index(loop, d.ambience) + 1) % len(loop)
+		d.ambience = loop[next]
+	}
+	callback := b.callbacks.AmbienceChanged
+	notify := d.listeningAmbience && d.attached && callback != nil
+	b.mu.Unlock()
+
+	if notify {
+		callback(deviceID, jabra.AmbienceModeChanged)
+	}
+}
+
+func (b *Backend) Busylight(deviceID uint16) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasBusylight)
+	if err != nil {
+		return false, err
+	}
+	return d.busylight, nil
+}
+
+func (b *Backend) SetBusylight(deviceID uint16, on bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasBusylight)
+	if err != nil {
+		return err
+	}
+	d.busylight = on
+	return nil
+}
+
+func (b *Backend) ListenBusylight(deviceID uint16, listen bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasBusylight)
+	if err != nil {
+		return err
+	}
+	d.listeningBusylight = listen
+	return nil
+}
+
+// PressBusylight turns the busylight of deviceID on or off as value says,
+// or without one toggles it, as if its button was pressed or a softphone
+// changed it.
+func (b *Backend) PressBusylight(deviceID uint16, value string) {
+	b.mu.Lock()
+	d, exists := b.devices[deviceID]
+	if !exists || d.spec.Busylight == nil {
+		b.mu.Unlock()
+		return
+	}
+	switch value {
+	case "on":
+		d.busylight = true
+	case "off":
+		d.busylight = false
+	default:
+		d.busylight = !d.busylight
+	}
+	on := d.busylight
+	callback := b.callbacks.BusylightChanged
+	notify := d.listeningBusylight && d.attached && callback != nil
+	b.mu.Unlock()
+
+	if notify {
+		callback(deviceID, on)
+	}
+}
+
+func (b *Backend) EqualizerEnabled(deviceID uint16) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasEqualizer)
+	if err != nil {
+		return false, err
+	}
+	return d.equalizerOn, nil
+}
+
+func (b *Backend) EnableEqualizer(deviceID uint16, enable bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasEqualizer)
+	if err != nil {
+		return err
+	}
+	d.equalizerOn = enable
+	return nil
+}
+
+func (b *Backend) EqualizerBands(deviceID uint16) ([]jabra.EqualizerBand, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasEqualizer)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.equalizer), nil
+}
+
+// SetEqualizerGains fails with Return_ParameterFail for a wrong number of
+// gains or a gain out of range, like the SDK.
+func (b *Backend) SetEqualizerGains(deviceID uint16, gains []float32) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasEqualizer)
+	if err != nil {
+		return err
+	}
+	if len(gains) != len(d.equalizer) {
+		return jabra.ErrReturnParameterFail
+	}
+	for i, gain := range gains {
+		if gain > d.equalizer[i].MaxGain || gain < -d.equalizer[i].MaxGain {
+			return jabra.ErrReturnParameterFail
+		}
+	}
+	for i, gain := range gains {
+		d.equalizer[i].Gain = gain
+	}
+	return nil
+}
+
+/****************************************************************************/
+/*                                TELEPHONY                                 */
+/****************************************************************************/
+
+// TelephonyState is what the telephony methods told a device, Locked is
+// whether the backend holds its call lock.
+type TelephonyState struct {
+	Locked  bool
+	OffHook bool
+	Ringer  bool
+	Mute    bool
+	Hold    bool
+	Online  bool
+}
+
+// Telephony returns the call state of deviceID.
+func (b *Backend) Telephony(deviceID uint16) (TelephonyState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasTelephony)
+	if err != nil {
+		return TelephonyState{}, err
+	}
+	return d.call, nil
+}
+
+func hasTelephony(spec DeviceSpec) bool { return spec.Telephony != nil }
+
+func (b *Backend) AcquireCallLock(deviceID uint16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasTelephony)
+	if err != nil {
+		return err
+	}
+	if d.spec.Telephony.Locked {
+		return jabra.ErrDeviceLock
+	}
+	d.call.Locked = true
+	return nil
+}
+
+func (b *Backend) ReleaseCallLock(deviceID uint16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasTelephony)
+	if err != nil {
+		return err
+	}
+	if !d.call.Locked {
+		return jabra.ErrDeviceNotLock
+	}
+	d.call.Locked = false
+	return nil
+}
+
+// setCall sets a field of the call state of deviceID, which needs the call
+// lock.
+func (b *Backend) setCall(deviceID uint16, set func(call *TelephonyState)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.audio(deviceID, hasTelephony)
+	if err != nil {
+		return err
+	}
+	if !d.call.Locked {
+		return jabra.ErrDeviceNotLock
+	}
+	set(&d.call)
+	return nil
+}
+
+func (b *Backend) SetOffHook(deviceID uint16, offHook bool) error {
+	return b.setCall(deviceID, func(call *TelephonyState) { call.OffHook = offHook })
+}
+
+func (b *Backend) SetRinger(deviceID uint16, ringing bool) error {
+	return b.setCall(deviceID, func(call *TelephonyState) { call.Ringer = ringing })
+}
+
+func (b *Backend) SetMute(deviceID uint16, mute bool) error {
+	return b.setCall(deviceID, func(call *TelephonyState) { call.Mute = mute })
+}
+
+func (b *Backend) SetHold(deviceID uint16, hold bool) error {
+	return b.setCall(deviceID, func(call *TelephonyState) { call.Hold = hold })
+}
+
+func (b *Backend) SetOnline(deviceID uint16, online bool) error {
+	return b.setCall(deviceID, func(call *TelephonyState) { call.Online = online })
+}
+
+// rawUsages are the usage pages and usages of the HID usage tables the
+// inputs are reported with raw. Inputs missing here are only translated.
+var rawUsages = map[jabra.HidInput][2]uint16{
+	jabra.HidOffHook:    {0x0b, 0x20},
+	jabra.HidFlash:      {0x0b, 0x21},
+	jabra.HidRedial:     {0x0b, 0x24},
+	jabra.HidMute:       {0x0b, 0x2f},
+	jabra.HidSpeedDial:  {0x0b, 0x50},
+	jabra.HidVoiceMail:  {0x0b, 0x70},
+	jabra.HidButton1:    {0x09, 0x01},
+	jabra.HidButton2:    {0x09, 0x02},
+	jabra.HidButton3:    {0x09, 0x03},
+	jabra.HidVolumeUp:   {0x0c, 0xe9},
+	jabra.HidVolumeDown: {0x0c, 0xea},
+}
+
+// PressButton reports input as the user pressing it on deviceID, translated
+// and, when it has a usage, raw. offHook asks for the other hook state than
+// the one the device was told, the other inputs are reported pressed.
+func (b *Backend) PressButton(deviceID uint16, input jabra.HidInput) {
+	b.mu.Lock()
+	d, exists := b.devices[deviceID]
+	if !exists || !d.attached || d.spec.Telephony == nil {
+		b.mu.Unlock()
+		return
+	}
+	value := true
+	if input == jabra.HidOffHook {
+		value = !d.call.OffHook
+	}
+	callback, rawCallback := b.callbacks.HidInput, b.callbacks.RawHidInput
+	b.mu.Unlock()
+
+	if callback != nil {
+		callback(deviceID, input, value)
+	}
+	if usage, ok := rawUsages[input]; ok && rawCallback != nil {
+		rawCallback(deviceID, usage[0], usage[1], value)
+	}
+}
+
+/****************************************************************************/
+/*                             BATTERY STATUS                               */
+/****************************************************************************/
+
+func (b *Backend) BatteryStatus(deviceID uint16) (*jabra.BatteryStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d.battery == nil {
+		return nil, jabra.ErrNotSupported
+	}
+	b.drain(d.battery)
+
+	return d.batteryStatus(), nil
+}
+
+// batteryStatus reports the battery of d as it is. The caller holds b.mu.
+func (d *device) batteryStatus() *jabra.BatteryStatus {
+	status := &jabra.BatteryStatus{
+		LevelInPercent:  uint8(math.Round(d.battery.level)),
+		Charging:        d.battery.charging,
+		BatteryLow:      d.battery.level <= d.battery.lowAt,
+		Component:       jabra.ComponentHeadband,
+		ExtraUnitsCount: uint32(len(d.battery.extraUnits)),
+	}
+	if len(d.battery.extraUnits) > 0 {
+		status.Component = jabra.ComponentCombined
+	}
+	for _, u := range d.battery.extraUnits {
+		status.ExtraUnits = append(status.ExtraUnits, jabra.BatteryStatusUnit{
+			LevelInPercent: uint8(math.Round(u.level)),
+			Component:      u.component,
+		})
+	}
+
+	return status
+}
+
+/****************************************************************************/
+/*                               BLUETOOTH                                  */
+/****************************************************************************/
+
+func (b *Backend) SetBTPairing(deviceID uint16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, err := b.attached(deviceID)
+	return err
+}
+
+func (b *Backend) StopBTPairing(deviceID uint16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	d.searching = false
+	return nil
+}
+
+func (b *Backend) SearchNewDevices(deviceID uint16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	if !d.info.IsDongle {
+		return jabra.ErrNotSupported
+	}
+
+	duration := b.scenario.SearchDuration
+	if duration == 0 {
+		duration = 20 * time.Second
+	}
+	d.searching = true
+	d.searchUntil = b.Now().Add(duration)
+
+	return nil
+}
+
+func (b *Backend) SearchDeviceList(deviceID uint16) *jabra.PairingList {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil || !d.searching {
+		return nil
+	}
+
+	listType := jabra.SearchResult
+	if b.Now().After(d.searchUntil) {
+		listType = jabra.SearchComplete
+	}
+	return toPairingList(d.searchResult, listType)
+}
+
+func (b *Backend) PairingList(deviceID uint16) *jabra.PairingList {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil || !d.info.FeatureFlags.PairingList {
+		return &jabra.PairingList{
+			Count:         0,
+			ListType:      -1,
+			PairedDevices: make([]jabra.PairedDevice, 0),
+		}
+	}
+	return toPairingList(d.pairingList, jabra.PairedDevices)
+}
+
+func toPairingList(entries []pairedEntry, listType jabra.DeviceListType) *jabra.PairingList {
+	pairingList := &jabra.PairingList{
+		Count:         uint16(len(entries)),
+		ListType:      listType,
+		PairedDevices: make([]jabra.PairedDevice, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		pairingList.PairedDevices = append(pairingList.PairedDevices, entry.PairedDevice)
+	}
+	return pairingList
+}
+
+func (b *Backend) ConnectNewDevice(deviceID uint16, device jabra.PairedDevice) error {
+	b.mu.Lock()
+	d, err := b.attached(deviceID)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+
+	index := slices.IndexFunc(d.searchResult, func(e pairedEntry) bool { return e.DeviceBTAddr == device.DeviceBTAddr })
+	if index == -1 {
+		b.mu.Unlock()
+		return jabra.ErrReturnParameterFail
+	}
+	entry := d.searchResult[index]
+	d.searchResult = slices.Delete(d.searchResult, index, index+1)
+	d.pairingList = slices.DeleteFunc(d.pairingList, func(e pairedEntry) bool { return e.DeviceBTAddr == device.DeviceBTAddr })
+	d.pairingList = append([]pairedEntry{entry}, d.pairingList...)
+	b.mu.Unlock()
+
+	return b.connect(deviceID, device.DeviceBTAddr)
+}
+
+func (b *Backend) ConnectPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	return b.connect(deviceID, device.DeviceBTAddr)
+}
+
+// connect marks the entry with btAddr connected, disconnecting whatever was
+// connected before, and attaches the linked headsets accordingly.
+func (b *Backend) connect(deviceID uint16, btAddr [6]byte) error {
+	b.mu.Lock()
+	d, err := b.attached(deviceID)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+
+	index := slices.IndexFunc(d.pairingList, func(e pairedEntry) bool { return e.DeviceBTAddr == btAddr })
+	if index == -1 {
+		b.mu.Unlock()
+		return jabra.ErrReturnParameterFail
+	}
+	if d.pairingList[index].IsConnected {
+		b.mu.Unlock()
+		return jabra.ErrDeviceAlreadyConnected
+	}
+
+	var detach, attach []uint16
+	for i := range d.pairingList {
+		entry := &d.pairingList[i]
+		if entry.IsConnected && entry.device != nil {
+			detach = append(detach, *entry.device)
+		}
+		entry.IsConnected = i == index
+	}
+	if linked := d.pairingList[index].device; linked != nil {
+		attach = append(attach, *linked)
+	}
+	b.mu.Unlock()
+
+	for _, id := range detach {
+		b.Detach(id)
+	}
+	for _, id := range attach {
+		b.Attach(id)
+	}
+
+	return nil
+}
+
+func (b *Backend) DisconnectPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	b.mu.Lock()
+	d, err := b.attached(deviceID)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+
+	index := slices.IndexFunc(d.pairingList, func(e pairedEntry) bool { return e.DeviceBTAddr == device.DeviceBTAddr })
+	if index == -1 {
+		b.mu.Unlock()
+		return jabra.ErrReturnParameterFail
+	}
+	if !d.pairingList[index].IsConnected {
+		b.mu.Unlock()
+		return jabra.ErrDeviceNotConnected
+	}
+	d.pairingList[index].IsConnected = false
+	linked := d.pairingList[index].device
+	b.mu.Unlock()
+
+	if linked != nil {
+		b.Detach(*linked)
+	}
+
+	return nil
+}
+
+func (b *Backend) ClearPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(d.pairingList, func(e pairedEntry) bool { return e.DeviceBTAddr == device.DeviceBTAddr })
+	if index == -1 {
+		return jabra.ErrReturnParameterFail
+	}
+	if d.pairingList[index].IsConnected {
+		return jabra.ErrCannotClearDeviceConnected
+	}
+	d.pairingList = slices.Delete(d.pairingList, index, index+1)
+
+	return nil
+}
+
+func (b *Backend) ClearPairingList(deviceID uint16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(d.pairingList, func(e pairedEntry) bool { return e.IsConnected }) {
+		return jabra.ErrCannotClearDeviceConnected
+	}
+	d.pairingList = nil
+
+	return nil
+}
+
+func (b *Backend) ConnectBTDevice(deviceID uint16) error {
+	b.mu.Lock()
+	d, err := b.attached(deviceID)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	if len(d.pairingList) == 0 {
+		b.mu.Unlock()
+		return jabra.ErrNoInformation
+	}
+	btAddr := d.pairingList[0].DeviceBTAddr
+	b.mu.Unlock()
+
+	return b.connect(deviceID, btAddr)
+}
+
+func (b *Backend) DisconnectBTDevice(deviceID uint16) error {
+	b.mu.Lock()
+	d, err := b.attached(deviceID)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	index := slices.IndexFunc(d.pairingList, func(e pairedEntry) bool { return e.IsConnected })
+	if index == -1 {
+		b.mu.Unlock()
+		return jabra.ErrDeviceNotConnected
+	}
+	device := d.pairingList[index].PairedDevice
+	b.mu.Unlock()
+
+	return b.DisconnectPairedDevice(deviceID, device)
+}
+
+/****************************************************************************/
+/*                                SETTINGS                                  */
+/****************************************************************************/
+
+func (b *Backend) AutoPairing(deviceID uint16) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return false, err
+	}
+	return d.autoPairing, nil
+}
+
+func (b *Backend) SetAutoPairing(deviceID uint16, enable bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	if !d.info.IsDongle {
+		return jabra.ErrNotSupported
+	}
+	d.autoPairing = enable
+	return nil
+}
+
+func (b *Backend) Settings(deviceID uint16) ([]jabra.Setting, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.settings) == 0 {
+		return nil, jabra.ErrNotSupported
+	}
+	return slices.Clone(d.settings), nil
+}
+
+// SetSettings writes the settings it can and fails like the SDK for the
+// others: ProtectedSetting_Write when one of them is protected,
+// Device_WriteFail otherwise. A device restarts when a setting that needs a
+// restart changed.
+func (b *Backend) SetSettings(deviceID uint16, settings []jabra.Setting) error {
+	b.mu.Lock()
+	d, err := b.attached(deviceID)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	if len(d.settings) == 0 {
+		b.mu.Unlock()
+		return jabra.ErrNotSupported
+	}
+
+	d.failedSettings = nil
+	protected, restart := false, false
+	var changed []jabra.Setting
+	for _, setting := range settings {
+		index := slices.IndexFunc(d.settings, func(s jabra.Setting) bool { return s.GUID == setting.GUID })
+		if index == -1 {
+			d.failedSettings = append(d.failedSettings, cmp.Or(setting.Name, setting.GUID))
+			continue
+		}
+		current := &d.settings[index]
+		switch {
+		case current.WriteProtected():
+			protected = true
+			d.failedSettings = append(d.failedSettings, current.Name)
+		case d.spec.Settings[index].Fail, current.Validate(setting.Key, setting.Text) != nil:
+			d.failedSettings = append(d.failedSettings, current.Name)
+		case current.DataType == jabra.SettingByte && current.Key != setting.Key,
+			current.DataType == jabra.SettingString && current.Text != setting.Text:
+			current.Key, current.Text = setting.Key, setting.Text
+			restart = restart || current.NeedsRestart
+			changed = append(changed, *current)
+		}
+	}
+	failed := len(d.failedSettings) > 0
+	notify := b.settingsChanged(d, changed)
+	b.mu.Unlock()
+
+	notify()
+
+	if restart {
+		b.Detach(deviceID)
+		go func() {
+			time.Sleep(2 * time.Second)
+			b.Attach(deviceID)
+		}()
+	}
+	switch {
+	case protected:
+		return jabra.ErrProtectedSettingWrite
+	case failed:
+		return jabra.ErrDeviceWriteFail
+	}
+	return nil
+}
+
+func (b *Backend) ListenSettings(deviceID uint16, listen bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d, err := b.attached(deviceID)
+	if err != nil {
+		return err
+	}
+	if !d.info.FeatureFlags.SettingsChangeNotification {
+		return jabra.ErrNotSupported
+	}
+	d.listening = listen
+	return nil
+}
+
+func (b *Backend) FailedSettingNames(deviceID uint16) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d, ok := b.devices[deviceID]; ok {
+		return slices.Clone(d.failedSettings)
+	}
+	return nil
+}
+
+// The settings file functions behave like those of current libjabra,
+// which keeps them only as stubs.
+
+func (b *Backend) SaveSettingsToFile(deviceID uint16, path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.attached(deviceID); err != nil {
+		return err
+	}
+	return jabra.ErrNotSupported
+}
+
+func (b *Backend) LoadSettingsFromFile(deviceID uint16, path string, mode jabra.SettingsLoadMode) ([]jabra.Setting, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.attached(deviceID); err != nil {
+		return nil, err
+	}
+	return nil, jabra.ErrOtherError
+}
+
+func (b *Backend) InvalidSettings(deviceID uint16) (jabra.InvalidSettings, error) {
+	return jabra.InvalidSettings{}, jabra.ErrOtherError
+}
+
+var _ jabra.Backend = (*Backend)(nil)
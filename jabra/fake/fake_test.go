@@ -0,0 +1,616 @@
+package fake
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+const testScenario = `
+searchDuration: 10s
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: DONGLE
+    dongle: true
+    features: [pairingList, FactoryReset]
+    pairingList:
+      - name: Jabra Evolve2 85
+        address: 70:BF:92:4A:10:01
+        device: 1
+    searchResults:
+      - name: Jabra Elite 85t
+        address: 50:C2:ED:11:22:33
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: bt
+    detached: true
+    battery:
+      level: 50
+      drainPerHour: 10
+      chargePerHour: 60
+      extraUnits:
+        - component: left
+          level: 40
+`
+
+// clock is a manual clock for Backend.Now.
+type clock struct{ now time.Time }
+
+func newClock() *clock                   { return &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)} }
+func (c *clock) Now() time.Time          { return c.now }
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func waitFor(t *testing.T, ch <-chan uint16) uint16 {
+	t.Helper()
+	select {
+	case id := <-ch:
+		return id
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for callback")
+		return 0
+	}
+}
+
+func newBackend(t *testing.T) (*Backend, *clock, chan uint16, chan uint16) {
+	t.Helper()
+
+	scenario, err := Parse([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClock()
+	b := New(scenario)
+	b.Now = c.Now
+
+	attached, removed := make(chan uint16, 8), make(chan uint16, 8)
+	if err := b.Initialize("test", jabra.Callbacks{
+		DeviceAttached: func(deviceInfo jabra.DeviceInfo) { attached <- deviceInfo.DeviceID },
+		DeviceRemoved:  func(deviceID uint16) { removed <- deviceID },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Uninitialize() })
+
+	if id := waitFor(t, attached); id != 0 {
+		t.Fatalf("first attached device = %d, want dongle 0", id)
+	}
+
+	return b, c, attached, removed
+}
+
+func TestParseRejectsInvalidScenario(t *testing.T) {
+	for name, scenario := range map[string]string{
+		"duplicate id":    "devices: [{id: 1}, {id: 1}]",
+		"feature":         "devices: [{id: 1, features: [teleport]}]",
+		"connection":      "devices: [{id: 1, connection: serial}]",
+		"address":         "devices: [{id: 1, pairingList: [{address: nope}]}]",
+		"event device":    "devices: [{id: 1}]\nevents: [{device: 2, action: attach}]",
+		"event action":    "devices: [{id: 1}]\nevents: [{device: 1, action: explode}]",
+		"battery unit":    "devices: [{id: 1, battery: {extraUnits: [{component: tail}]}}]",
+		"malformed input": "devices: [",
+	} {
+		if _, err := Parse([]byte(scenario)); err == nil {
+			t.Errorf("%s: Parse succeeded, want error", name)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	scenario, err := Parse([]byte(`{"devices": [{"id": 3, "name": "Speak 750", "features": ["busyLight"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenario.Devices) != 1 || scenario.Devices[0].Name != "Speak 750" {
+		t.Fatalf("unexpected scenario %+v", scenario)
+	}
+}
+
+func TestConnectPairedDeviceAttachesHeadset(t *testing.T) {
+	b, _, attached, removed := newBackend(t)
+
+	pairingList := b.PairingList(0)
+	if pairingList.Count != 1 || pairingList.ListType != jabra.PairedDevices {
+		t.Fatalf("unexpected pairing list %+v", pairingList)
+	}
+
+	if err := b.ConnectPairedDevice(0, pairingList.PairedDevices[0]); err != nil {
+		t.Fatal(err)
+	}
+	if id := waitFor(t, attached); id != 1 {
+		t.Fatalf("attached device = %d, want 1", id)
+	}
+	if !b.PairingList(0).PairedDevices[0].IsConnected {
+		t.Fatal("paired device is not marked connected")
+	}
+	if err := b.ConnectPairedDevice(0, pairingList.PairedDevices[0]); !errors.Is(err, jabra.ErrDeviceAlreadyConnected) {
+		t.Fatalf("second connect err = %v, want ErrDeviceAlreadyConnected", err)
+	}
+	if err := b.ClearPairingList(0); !errors.Is(err, jabra.ErrCannotClearDeviceConnected) {
+		t.Fatalf("clear err = %v, want ErrCannotClearDeviceConnected", err)
+	}
+
+	if err := b.DisconnectBTDevice(0); err != nil {
+		t.Fatal(err)
+	}
+	if id := waitFor(t, removed); id != 1 {
+		t.Fatalf("removed device = %d, want 1", id)
+	}
+	if _, err := b.BatteryStatus(1); !errors.Is(err, jabra.ErrDeviceUnknown) {
+		t.Fatalf("battery of detached device err = %v, want ErrDeviceUnknown", err)
+	}
+}
+
+func TestBatteryDrainAndCharge(t *testing.T) {
+	b, c, attached, _ := newBackend(t)
+
+	b.Attach(1)
+	waitFor(t, attached)
+
+	c.Advance(2 * time.Hour)
+	battery, err := b.BatteryStatus(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if battery.LevelInPercent != 30 || battery.Charging || battery.BatteryLow {
+		t.Fatalf("after draining got %+v, want 30%% not charging", battery)
+	}
+	if battery.ExtraUnitsCount != 1 || battery.ExtraUnits[0].Component != jabra.ComponentLeft || battery.ExtraUnits[0].LevelInPercent != 20 {
+		t.Fatalf("unexpected extra units %+v", battery.ExtraUnits)
+	}
+
+	b.SetBatteryLevel(1, 8)
+	if battery, _ = b.BatteryStatus(1); !battery.BatteryLow {
+		t.Fatalf("battery at 8%% is not low: %+v", battery)
+	}
+
+	b.SetCharging(1, true)
+	c.Advance(3 * time.Hour)
+	if battery, _ = b.BatteryStatus(1); battery.LevelInPercent != 100 || !battery.Charging {
+		t.Fatalf("after charging got %+v, want 100%% charging", battery)
+	}
+}
+
+func TestSearchAndConnectNewDevice(t *testing.T) {
+	b, c, _, _ := newBackend(t)
+
+	if list := b.SearchDeviceList(0); list != nil {
+		t.Fatalf("search list before searching = %+v, want nil", list)
+	}
+	if err := b.SearchNewDevices(0); err != nil {
+		t.Fatal(err)
+	}
+	list := b.SearchDeviceList(0)
+	if list == nil || list.ListType != jabra.SearchResult || list.Count != 1 {
+		t.Fatalf("unexpected search list %+v", list)
+	}
+
+	c.Advance(11 * time.Second)
+	if list = b.SearchDeviceList(0); list.ListType != jabra.SearchComplete {
+		t.Fatalf("search list type = %v, want SearchComplete", list.ListType)
+	}
+
+	if err := b.ConnectNewDevice(0, list.PairedDevices[0]); err != nil {
+		t.Fatal(err)
+	}
+	pairingList := b.PairingList(0)
+	if pairingList.Count != 2 || pairingList.PairedDevices[0].Address() != "50:C2:ED:11:22:33" || !pairingList.PairedDevices[0].IsConnected {
+		t.Fatalf("unexpected pairing list after connect %+v", pairingList)
+	}
+}
+
+func TestFeatureFlagsAndAutoPairing(t *testing.T) {
+	b, _, _, _ := newBackend(t)
+
+	if err := b.SetAutoPairing(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _ := b.AutoPairing(0); !enabled {
+		t.Fatal("auto pairing not enabled")
+	}
+	if _, err := b.FirmwareVersion(0); !errors.Is(err, jabra.ErrNoInformation) {
+		t.Fatalf("firmware version err = %v, want ErrNoInformation", err)
+	}
+	if _, err := b.BatteryStatus(0); !errors.Is(err, jabra.ErrNotSupported) {
+		t.Fatalf("dongle battery err = %v, want ErrNotSupported", err)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	scenario, err := Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    connection: usb
+    settings:
+      - guid: sidetone
+        name: Sidetone
+        type: toggle
+        value: "On"
+        options:
+          - {key: 0, value: "Off", disables: [level]}
+          - {key: 1, value: "On"}
+      - guid: level
+        name: Sidetone level
+        type: list
+        value: Low
+        options: [{key: 0, value: Low}, {key: 1, value: High}]
+      - guid: name
+        name: Headset name
+        type: text
+        value: Evolve
+        validation: {maxLength: 8, regExp: "^[a-z ]*$", message: lower case letters}
+      - guid: auto-answer
+        name: Auto-answer
+        type: toggle
+        protected: true
+      - guid: protection
+        name: Hearing protection
+        type: list
+        fail: true
+        options: [{key: 0, value: Standard}, {key: 1, value: NIOSH}]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(scenario)
+	attached := make(chan uint16, 1)
+	if err := b.Initialize("test", jabra.Callbacks{
+		DeviceAttached: func(deviceInfo jabra.DeviceInfo) { attached <- deviceInfo.DeviceID },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Uninitialize() })
+	waitFor(t, attached)
+
+	settings, err := b.Settings(1)
+	if err != nil || len(settings) != 5 {
+		t.Fatalf("Settings = %+v, %v", settings, err)
+	}
+	sidetone, level, name := settings[0], settings[1], settings[2]
+	if sidetone.Kind() != "toggle" || sidetone.Value() != "On" || level.Kind() != "list" || name.Kind() != "text" || name.Value() != "Evolve" {
+		t.Fatalf("unexpected settings %+v", settings[:3])
+	}
+	if err := name.Validate(0, "evolve"); err != nil {
+		t.Errorf("valid name: %v", err)
+	}
+	if err := name.Validate(0, "Evolve"); err == nil || err.Error() != "Headset name: lower case letters" {
+		t.Errorf("invalid name: %v", err)
+	}
+
+	sidetone.Key = 0
+	if err := b.SetSettings(1, []jabra.Setting{sidetone}); err != nil {
+		t.Fatal(err)
+	}
+	settings, _ = b.Settings(1)
+	if disabled := jabra.DisabledSettings(settings); !disabled["level"] || len(disabled) != 1 {
+		t.Errorf("disabled settings %v", disabled)
+	}
+
+	// Valid changes are applied even when others fail.
+	level.Key = 1
+	name.Text = "Not Valid"
+	protection := settings[4]
+	protection.Key = 1
+	if err := b.SetSettings(1, []jabra.Setting{level, name, protection}); !errors.Is(err, jabra.ErrDeviceWriteFail) {
+		t.Errorf("partly failing SetSettings = %v, want ErrDeviceWriteFail", err)
+	}
+	if failed := b.FailedSettingNames(1); len(failed) != 2 || failed[0] != "Headset name" || failed[1] != "Hearing protection" {
+		t.Errorf("failed settings %v", failed)
+	}
+	if settings, _ = b.Settings(1); settings[1].Value() != "High" || settings[2].Value() != "Evolve" {
+		t.Errorf("settings after partial failure %+v", settings[1:3])
+	}
+
+	if err := b.SetSettings(1, settings[3:4]); !errors.Is(err, jabra.ErrProtectedSettingWrite) {
+		t.Errorf("writing a protected setting = %v, want ErrProtectedSettingWrite", err)
+	}
+	if _, err := b.Settings(0); !errors.Is(err, jabra.ErrDeviceUnknown) {
+		t.Errorf("settings of a missing device = %v, want ErrDeviceUnknown", err)
+	}
+}
+
+func TestAudio(t *testing.T) {
+	scenario, err := Parse([]byte(`
+devices:
+  - id: 0
+    name: Jabra Link 380
+    dongle: true
+  - id: 1
+    name: Jabra Evolve2 85
+    connection: usb
+    ambience: {modes: [off, anc], mode: anc}
+    busylight: {}
+    equalizer:
+      bands: [{frequency: 100, maxGain: 3}, {frequency: 1000}]
+    settings:
+      - guid: ringtone
+        name: Ringtone
+        type: list
+        options: [{key: 0, value: Tone 1}, {key: 1, value: Tone 2}]
+events:
+  - at: 10ms
+    device: 1
+    action: setting
+    setting: ringtone
+    value: Tone 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(scenario)
+	attached := make(chan uint16, 2)
+	if err := b.Initialize("test", jabra.Callbacks{
+		DeviceAttached: func(deviceInfo jabra.DeviceInfo) { attached <- deviceInfo.DeviceID },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Uninitialize() })
+	waitFor(t, attached)
+	waitFor(t, attached)
+
+	if modes, err := b.AmbienceModes(1); err != nil || len(modes) != 2 || modes[1] != jabra.AmbienceANC {
+		t.Errorf("AmbienceModes = %v, %v", modes, err)
+	}
+	if err := b.SetAmbienceMode(1, jabra.AmbienceHearThrough); !errors.Is(err, jabra.ErrReturnParameterFail) {
+		t.Errorf("setting a mode the device lacks = %v, want ErrReturnParameterFail", err)
+	}
+	if err := b.SetAmbienceMode(1, jabra.AmbienceOff); err != nil {
+		t.Fatal(err)
+	}
+	if mode, _ := b.AmbienceMode(1); mode != jabra.AmbienceOff {
+		t.Errorf("ambience mode %s, want off", mode)
+	}
+	if _, err := b.AmbienceMode(0); !errors.Is(err, jabra.ErrNotSupported) {
+		t.Errorf("ambience of a dongle = %v, want ErrNotSupported", err)
+	}
+
+	if err := b.SetBusylight(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if on, _ := b.Busylight(1); !on {
+		t.Error("busylight not on")
+	}
+
+	if err := b.SetEqualizerGains(1, []float32{4, 0}); !errors.Is(err, jabra.ErrReturnParameterFail) {
+		t.Errorf("gain above the maximum = %v, want ErrReturnParameterFail", err)
+	}
+	if err := b.SetEqualizerGains(1, []float32{-3, 6}); err != nil {
+		t.Fatal(err)
+	}
+	if bands, _ := b.EqualizerBands(1); len(bands) != 2 || bands[0].Gain != -3 || bands[1].MaxGain != 6 || bands[1].CenterFrequency != 1000 {
+		t.Errorf("equalizer bands %+v", bands)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if settings, _ := b.Settings(1); settings[0].Value() != "Tone 2" {
+		t.Errorf("ringtone %q after the setting event, want Tone 2", settings[0].Value())
+	}
+}
+
+func TestAmbience(t *testing.T) {
+	scenario, err := Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    connection: usb
+    ambience: {mode: anc, levels: 3, balance: 2, loop: [anc, hearThrough]}
+events:
+  - at: 50ms
+    device: 1
+    action: ambience
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(scenario)
+	attached := make(chan uint16, 1)
+	changed := make(chan jabra.AmbienceEvent, 1)
+	if err := b.Initialize("test", jabra.Callbacks{
+		DeviceAttached:  func(deviceInfo jabra.DeviceInfo) { attached <- deviceInfo.DeviceID },
+		AmbienceChanged: func(deviceID uint16, event jabra.AmbienceEvent) { changed <- event },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Uninitialize() })
+	waitFor(t, attached)
+	if err := b.ListenAmbience(1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if levels, err := b.AmbienceLevels(1, jabra.AmbienceHearThrough); err != nil || levels != 3 {
+		t.Errorf("AmbienceLevels = %d, %v", levels, err)
+	}
+	if _, err := b.AmbienceLevels(1, jabra.AmbienceOff); !errors.Is(err, jabra.ErrReturnParameterFail) {
+		t.Errorf("levels of off = %v, want ErrReturnParameterFail", err)
+	}
+	if err := b.SetAmbienceLevel(1, jabra.AmbienceHearThrough, 4); !errors.Is(err, jabra.ErrReturnParameterFail) {
+		t.Errorf("level above the highest = %v, want ErrReturnParameterFail", err)
+	}
+	if err := b.SetAmbienceLevel(1, jabra.AmbienceHearThrough, 2); err != nil {
+		t.Fatal(err)
+	}
+	if level, _ := b.AmbienceLevel(1, jabra.AmbienceHearThrough); level != 2 {
+		t.Errorf("hearThrough level %d, want 2", level)
+	}
+	if err := b.SetAmbienceBalance(1, jabra.AmbienceANC, -3); !errors.Is(err, jabra.ErrReturnParameterFail) {
+		t.Errorf("balance out of range = %v, want ErrReturnParameterFail", err)
+	}
+	if err := b.SetAmbienceBalance(1, jabra.AmbienceANC, -2); err != nil {
+		t.Fatal(err)
+	}
+	if balance, _ := b.AmbienceBalance(1, jabra.AmbienceANC); balance != -2 {
+		t.Errorf("anc balance %d, want -2", balance)
+	}
+
+	// The button steps from anc to the next mode of the loop.
+	select {
+	case event := <-changed:
+		if event != jabra.AmbienceModeChanged {
+			t.Errorf("ambience event %s", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no ambience callback")
+	}
+	if mode, _ := b.AmbienceMode(1); mode != jabra.AmbienceHearThrough {
+		t.Errorf("ambience mode %s after the button, want hearThrough", mode)
+	}
+
+	if err := b.SetAmbienceLoop(1, []jabra.AmbienceMode{jabra.AmbienceOff, jabra.AmbienceANC, jabra.AmbienceHearThrough, jabra.AmbienceOff}); !errors.Is(err, jabra.ErrDeviceWriteFail) {
+		t.Errorf("loop longer than the modes = %v, want ErrDeviceWriteFail", err)
+	}
+	if err := b.SetAmbienceLoop(1, []jabra.AmbienceMode{jabra.AmbienceOff, jabra.AmbienceANC}); err != nil {
+		t.Fatal(err)
+	}
+	if loop, _ := b.AmbienceLoop(1); len(loop) != 2 || loop[0] != jabra.AmbienceOff {
+		t.Errorf("AmbienceLoop = %v", loop)
+	}
+}
+
+func TestBusylightEvent(t *testing.T) {
+	scenario, err := Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    connection: usb
+    busylight: {manual: true}
+events:
+  - at: 50ms
+    device: 1
+    action: busylight
+  - at: 60ms
+    device: 1
+    action: busylight
+    value: "off"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(scenario)
+	attached := make(chan jabra.DeviceInfo, 1)
+	changed := make(chan bool, 2)
+	if err := b.Initialize("test", jabra.Callbacks{
+		DeviceAttached:   func(deviceInfo jabra.DeviceInfo) { attached <- deviceInfo },
+		BusylightChanged: func(deviceID uint16, on bool) { changed <- on },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Uninitialize() })
+	var device jabra.DeviceInfo
+	select {
+	case device = <-attached:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for callback")
+	}
+	if !device.FeatureFlags.ManualBusyLight || device.FeatureFlags.BusyLight {
+		t.Errorf("feature flags %+v", device.FeatureFlags)
+	}
+	if err := b.ListenBusylight(1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first event toggles the busylight on, the second turns it off.
+	for _, want := range []bool{true, false} {
+		select {
+		case on := <-changed:
+			if on != want {
+				t.Errorf("busylight %t, want %t", on, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no busylight callback")
+		}
+	}
+}
+
+func TestTelephony(t *testing.T) {
+	scenario, err := Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    connection: usb
+    telephony: {}
+  - id: 2
+    name: Jabra Evolve2 65
+    connection: usb
+    telephony: {locked: true}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(scenario)
+	type press struct {
+		input jabra.HidInput
+		value bool
+	}
+	pressed := make(chan press, 10)
+	raw := make(chan [3]uint16, 10)
+	scanned := make(chan struct{})
+	if err := b.Initialize("test", jabra.Callbacks{
+		FirstScanDone: func() { close(scanned) },
+		HidInput:      func(deviceID uint16, input jabra.HidInput, value bool) { pressed <- press{input, value} },
+		RawHidInput: func(deviceID uint16, usagePage, usage uint16, value bool) {
+			if value {
+				raw <- [3]uint16{usagePage, usage, 1}
+			} else {
+				raw <- [3]uint16{usagePage, usage, 0}
+			}
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Uninitialize() })
+	<-scanned
+
+	if err := b.SetRinger(1, true); !errors.Is(err, jabra.ErrDeviceNotLock) {
+		t.Errorf("SetRinger without the lock = %v", err)
+	}
+	if err := b.AcquireCallLock(2); !errors.Is(err, jabra.ErrDeviceLock) {
+		t.Errorf("AcquireCallLock of a locked device = %v", err)
+	}
+	if err := b.AcquireCallLock(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetRinger(1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Off hook asks for the other hook state than the device was told.
+	b.PressButton(1, jabra.HidOffHook)
+	b.SetOffHook(1, true)
+	b.PressButton(1, jabra.HidOffHook)
+	b.PressButton(1, jabra.HidMute)
+	for _, want := range []press{{jabra.HidOffHook, true}, {jabra.HidOffHook, false}, {jabra.HidMute, true}} {
+		if got := <-pressed; got != want {
+			t.Errorf("pressed %s %t, want %s %t", got.input, got.value, want.input, want.value)
+		}
+	}
+	// Raw the same presses come with their usages, reject call has none.
+	b.PressButton(1, jabra.HidRejectCall)
+	for _, want := range [][3]uint16{{0x0b, 0x20, 1}, {0x0b, 0x20, 0}, {0x0b, 0x2f, 1}} {
+		if got := <-raw; got != want {
+			t.Errorf("raw %#x, want %#x", got, want)
+		}
+	}
+	if got := <-pressed; got.input != jabra.HidRejectCall {
+		t.Errorf("pressed %s", got.input)
+	}
+	select {
+	case got := <-raw:
+		t.Errorf("raw %#x for reject call", got)
+	default:
+	}
+
+	b.Detach(1)
+	b.Attach(1)
+	if call, _ := b.Telephony(1); call != (TelephonyState{}) {
+		t.Errorf("call state after reattaching %+v", call)
+	}
+
+	if _, err := Parse([]byte("devices: [{id: 1, telephony: {}}]\nevents: [{at: 1s, device: 1, action: button, value: sneeze}]")); err == nil {
+		t.Error("unknown button accepted")
+	}
+}
@@ -0,0 +1,523 @@
+package fake
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario describes the simulated devices and a timeline of events. It is
+// read from YAML, and since JSON is valid YAML a JSON file works as well.
+type Scenario struct {
+	SDKVersion string `yaml:"sdkVersion"`
+	// SearchDuration is how long SearchNewDevices reports results before the
+	// search completes. The real SDK takes about 20 seconds.
+	SearchDuration time.Duration `yaml:"searchDuration"`
+	Devices        []DeviceSpec  `yaml:"devices"`
+	Events         []Event       `yaml:"events"`
+}
+
+type DeviceSpec struct {
+	ID         uint16 `yaml:"id"`
+	Name       string `yaml:"name"`
+	ProductID  uint16 `yaml:"productID"`
+	VendorID   uint16 `yaml:"vendorID"`
+	Serial     string `yaml:"serial"`
+	Variant    string `yaml:"variant"`
+	Dongle     bool   `yaml:"dongle"`
+	Connection string `yaml:"connection"` // usb, bt or dect
+	Parent     uint16 `yaml:"parent"`
+	// Detached devices are not reported on Initialize, only through an
+	// attach event or by connecting a paired entry pointing to them.
+	Detached bool   `yaml:"detached"`
+	Firmware string `yaml:"firmware"`
+	// FirmwareUpdateMode attaches the device in firmware update mode, as
+	// after an update that did not finish.
+	FirmwareUpdateMode bool `yaml:"firmwareUpdateMode"`
+	// LatestFirmware is the version CheckForFirmwareUpdate finds in the cloud.
+	LatestFirmware string              `yaml:"latestFirmware"`
+	FirmwareUpdate *FirmwareUpdateSpec `yaml:"firmwareUpdate"`
+	// FirmwareLock attaches the device with its firmware locked. Devices
+	// without FirmwareUpdate have no lock: it reads off and cannot be set.
+	FirmwareLock bool `yaml:"firmwareLock"`
+	// Features are FeatureFlags field names, matched case-insensitively.
+	Features    []string `yaml:"features"`
+	AutoPairing bool     `yaml:"autoPairing"`
+	// Settings are the dynamic settings of the device, in display order.
+	Settings []SettingSpec `yaml:"settings"`
+	// Ambience, Busylight and Equalizer give the device these features,
+	// with their FeatureFlags set.
+	Ambience  *AmbienceSpec  `yaml:"ambience"`
+	Busylight *BusylightSpec `yaml:"busylight"`
+	Equalizer *EqualizerSpec `yaml:"equalizer"`
+	// Telephony gives the device HID telephony: call control and buttons.
+	Telephony     *TelephonySpec `yaml:"telephony"`
+	Battery       *BatterySpec   `yaml:"battery"`
+	PairingList   []PairedSpec   `yaml:"pairingList"`
+	SearchResults []PairedSpec   `yaml:"searchResults"`
+}
+
+type BatterySpec struct {
+	Level         float64 `yaml:"level"`
+	Charging      bool    `yaml:"charging"`
+	DrainPerHour  float64 `yaml:"drainPerHour"`
+	ChargePerHour float64 `yaml:"chargePerHour"`
+	// LowAt is the level at or below which batteryLow is reported, default 10.
+	LowAt      float64    `yaml:"lowAt"`
+	ExtraUnits []UnitSpec `yaml:"extraUnits"`
+	// Charge, discharge and level events are reported through the battery
+	// callback CallbackDelay later, with the state from when they happened,
+	// like the SDK's late levelInPercent. NoCallback turns the callback off.
+	CallbackDelay time.Duration `yaml:"callbackDelay"`
+	NoCallback    bool          `yaml:"noCallback"`
+}
+
+// FirmwareUpdateSpec is how UpdateFirmware behaves. Without it the device
+// does not support firmware updates.
+type FirmwareUpdateSpec struct {
+	// Version is installed by a successful update, default the current one.
+	Version string `yaml:"version"`
+	// Duration is how long the update takes, default 2s.
+	Duration time.Duration `yaml:"duration"`
+	// Fail ends the update with this Jabra_FirmwareEventStatus, e.g.
+	// updateError, and leaves the device in firmware update mode.
+	Fail string `yaml:"fail"`
+}
+
+// SettingSpec is one of the dynamic settings of a device.
+type SettingSpec struct {
+	GUID  string `yaml:"guid"`
+	Name  string `yaml:"name"`
+	Group string `yaml:"group"`
+	Help  string `yaml:"help"`
+	// Type is toggle (options Off and On unless given), list, text or password.
+	Type    string       `yaml:"type"`
+	Options []OptionSpec `yaml:"options"`
+	// Value is the name of the current option, or the text.
+	Value      string          `yaml:"value"`
+	Validation *ValidationSpec `yaml:"validation"`
+	Restart    bool            `yaml:"restart"`
+	// Protected settings are write protected, writing them fails with
+	// ProtectedSetting_Write.
+	Protected bool `yaml:"protected"`
+	// Fail makes writes of the setting fail, SetSettings then returns
+	// Device_WriteFail and FailedSettingNames names it.
+	Fail bool `yaml:"fail"`
+}
+
+type OptionSpec struct {
+	Key   uint16 `yaml:"key"`
+	Value string `yaml:"value"`
+	// Enables and Disables are GUIDs of the settings this option turns on or off.
+	Enables  []string `yaml:"enables"`
+	Disables []string `yaml:"disables"`
+}
+
+type ValidationSpec struct {
+	MinLength int    `yaml:"minLength"`
+	MaxLength int    `yaml:"maxLength"`
+	RegExp    string `yaml:"regExp"`
+	Message   string `yaml:"message"`
+}
+
+// AmbienceSpec lists the ambience modes of a device, all three by default,
+// and the one it starts in. HearThrough and ANC take levels from 0 to
+// Levels, default 5, and a left-right balance from -Balance to Balance,
+// default 3. Loop gives the device the AmbienceModesLoop feature, the
+// modes its button steps through.
+type AmbienceSpec struct {
+	Modes   []string `yaml:"modes"`
+	Mode    string   `yaml:"mode"`
+	Levels  uint8    `yaml:"levels"`
+	Balance uint8    `yaml:"balance"`
+	Loop    []string `yaml:"loop"`
+}
+
+// TelephonySpec describes the call control of a device, Locked has another
+// application hold its call lock.
+type TelephonySpec struct {
+	Locked bool `yaml:"locked"`
+}
+
+// BusylightSpec describes the busylight, Manual gives the device the
+// ManualBusyLight feature instead of BusyLight.
+type BusylightSpec struct {
+	On     bool `yaml:"on"`
+	Manual bool `yaml:"manual"`
+}
+
+// EqualizerSpec describes the bands of the equalizer, five bands from 250
+// Hz to 4 kHz by default.
+type EqualizerSpec struct {
+	Enabled bool       `yaml:"enabled"`
+	Bands   []BandSpec `yaml:"bands"`
+}
+
+// BandSpec is a band of the equalizer, MaxGain defaults to 6 dB.
+type BandSpec struct {
+	Frequency int     `yaml:"frequency"`
+	MaxGain   float32 `yaml:"maxGain"`
+	Gain      float32 `yaml:"gain"`
+}
+
+type UnitSpec struct {
+	Component string  `yaml:"component"`
+	Level     float64 `yaml:"level"`
+}
+
+type PairedSpec struct {
+	Name      string `yaml:"name"`
+	Address   string `yaml:"address"`
+	Connected bool   `yaml:"connected"`
+	// Device is the simulated headset that attaches while this entry is connected.
+	Device *uint16 `yaml:"device"`
+}
+
+// Event is applied At after Initialize. Action is one of attach, detach,
+// charge, discharge, level (which sets the battery to Level), setting
+// (which sets the setting with GUID Setting to Value, as if changed on the
+// device), ambience (which sets the ambience mode to Value, or without one
+// presses the button of the device's loop), busylight (which turns the
+// busylight on or off as Value says, or without one toggles it) or button
+// (which presses the telephony button named by Value, e.g. offHook or mute).
+type Event struct {
+	At      time.Duration `yaml:"at"`
+	Device  uint16        `yaml:"device"`
+	Action  string        `yaml:"action"`
+	Level   float64       `yaml:"level"`
+	Setting string        `yaml:"setting"`
+	Value   string        `yaml:"value"`
+}
+
+// Load reads and validates a scenario file.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes and validates a scenario from YAML or JSON.
+func Parse(data []byte) (*Scenario, error) {
+	var scenario Scenario
+
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("scenario: %w", err)
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, fmt.Errorf("scenario: %w", err)
+	}
+
+	return &scenario, nil
+}
+
+func (s *Scenario) validate() error {
+	ids := make(map[uint16]bool)
+	for _, device := range s.Devices {
+		if ids[device.ID] {
+			return fmt.Errorf("duplicate device id %d", device.ID)
+		}
+		ids[device.ID] = true
+
+		if _, err := parseConnection(device.Connection); err != nil {
+			return fmt.Errorf("device %d: %w", device.ID, err)
+		}
+		if _, err := parseFeatures(device.Features); err != nil {
+			return fmt.Errorf("device %d: %w", device.ID, err)
+		}
+		if device.FirmwareUpdate != nil && device.FirmwareUpdate.Fail != "" {
+			if _, err := parseFirmwareStatus(device.FirmwareUpdate.Fail); err != nil {
+				return fmt.Errorf("device %d: %w", device.ID, err)
+			}
+		}
+		if device.Battery != nil {
+			for _, unit := range device.Battery.ExtraUnits {
+				if _, err := parseComponent(unit.Component); err != nil {
+					return fmt.Errorf("device %d: %w", device.ID, err)
+				}
+			}
+		}
+		guids := make(map[string]bool)
+		for _, spec := range device.Settings {
+			if guids[spec.GUID] {
+				return fmt.Errorf("device %d: duplicate setting %q", device.ID, spec.GUID)
+			}
+			guids[spec.GUID] = true
+			if _, err := parseSetting(spec); err != nil {
+				return fmt.Errorf("device %d: %w", device.ID, err)
+			}
+		}
+		if _, _, err := parseAmbience(device.Ambience); err != nil {
+			return fmt.Errorf("device %d: %w", device.ID, err)
+		}
+		if _, err := parseAmbienceLoop(device.Ambience); err != nil {
+			return fmt.Errorf("device %d: %w", device.ID, err)
+		}
+		for _, entry := range append(device.PairingList, device.SearchResults...) {
+			if _, err := jabra.ParseBTAddr(entry.Address); err != nil {
+				return fmt.Errorf("device %d: %w", device.ID, err)
+			}
+		}
+	}
+
+	for _, event := range s.Events {
+		if !ids[event.Device] {
+			return fmt.Errorf("event at %s: unknown device %d", event.At, event.Device)
+		}
+		switch event.Action {
+		case "attach", "detach", "charge", "discharge", "level":
+		case "setting":
+			device := s.Devices[slices.IndexFunc(s.Devices, func(device DeviceSpec) bool { return device.ID == event.Device })]
+			if !slices.ContainsFunc(device.Settings, func(spec SettingSpec) bool { return spec.GUID == event.Setting }) {
+				return fmt.Errorf("event at %s: device %d has no setting %q", event.At, event.Device, event.Setting)
+			}
+		case "ambience":
+			device := s.Devices[slices.IndexFunc(s.Devices, func(device DeviceSpec) bool { return device.ID == event.Device })]
+			modes, _, _ := parseAmbience(device.Ambience)
+			if len(modes) == 0 {
+				return fmt.Errorf("event at %s: device %d has no ambience modes", event.At, event.Device)
+			}
+			if event.Value != "" {
+				mode, err := jabra.ParseAmbienceMode(event.Value)
+				if err != nil {
+					return fmt.Errorf("event at %s: %w", event.At, err)
+				}
+				if !slices.Contains(modes, mode) {
+					return fmt.Errorf("event at %s: device %d has no ambience mode %s", event.At, event.Device, mode)
+				}
+			}
+		case "busylight":
+			device := s.Devices[slices.IndexFunc(s.Devices, func(device DeviceSpec) bool { return device.ID == event.Device })]
+			if device.Busylight == nil {
+				return fmt.Errorf("event at %s: device %d has no busylight", event.At, event.Device)
+			}
+			if event.Value != "" && event.Value != "on" && event.Value != "off" {
+				return fmt.Errorf("event at %s: busylight value %q is not on or off", event.At, event.Value)
+			}
+		case "button":
+			device := s.Devices[slices.IndexFunc(s.Devices, func(device DeviceSpec) bool { return device.ID == event.Device })]
+			if device.Telephony == nil {
+				return fmt.Errorf("event at %s: device %d has no telephony", event.At, event.Device)
+			}
+			if _, err := jabra.ParseHidInput(event.Value); err != nil {
+				return fmt.Errorf("event at %s: %w", event.At, err)
+			}
+		default:
+			return fmt.Errorf("event at %s: unknown action %q", event.At, event.Action)
+		}
+	}
+
+	return nil
+}
+
+func parseConnection(connection string) (jabra.DeviceConnectionType, error) {
+	if connection == "" {
+		return jabra.ConnectionUSB, nil
+	}
+	for _, c := range []jabra.DeviceConnectionType{jabra.ConnectionUSB, jabra.ConnectionBT, jabra.ConnectionDECT} {
+		if strings.EqualFold(c.String(), connection) {
+			return c, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown connection %q", connection)
+}
+
+func parseComponent(component string) (jabra.BatteryComponent, error) {
+	for c := jabra.ComponentUnknown; c <= jabra.ComponentRemoteControl; c++ {
+		if strings.EqualFold(c.String(), component) {
+			return c, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown battery component %q", component)
+}
+
+func parseFirmwareStatus(status string) (jabra.FirmwareEventStatus, error) {
+	for s := jabra.FirmwareCancelled; s <= jabra.FirmwareNotAllowed; s++ {
+		if strings.EqualFold(s.String(), status) && s.Err() != nil {
+			return s, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown firmware failure %q", status)
+}
+
+// parseAmbience returns the modes of spec and the one the device starts in.
+func parseAmbience(spec *AmbienceSpec) ([]jabra.AmbienceMode, jabra.AmbienceMode, error) {
+	if spec == nil {
+		return nil, 0, nil
+	}
+	modes := []jabra.AmbienceMode{jabra.AmbienceOff, jabra.AmbienceHearThrough, jabra.AmbienceANC}
+	if len(spec.Modes) > 0 {
+		var err error
+		if modes, err = parseAmbienceModes(spec.Modes); err != nil {
+			return nil, 0, err
+		}
+	}
+	current := modes[0]
+	if spec.Mode != "" {
+		mode, err := jabra.ParseAmbienceMode(spec.Mode)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !slices.Contains(modes, mode) {
+			return nil, 0, fmt.Errorf("ambience mode %s is not one of the modes", mode)
+		}
+		current = mode
+	}
+	return modes, current, nil
+}
+
+// parseAmbienceLoop returns the button loop of spec, nil for a device
+// without one.
+func parseAmbienceLoop(spec *AmbienceSpec) ([]jabra.AmbienceMode, error) {
+	if spec == nil || len(spec.Loop) == 0 {
+		return nil, nil
+	}
+	modes, _, err := parseAmbience(spec)
+	if err != nil {
+		return nil, err
+	}
+	loop, err := parseAmbienceModes(spec.Loop)
+	if err != nil {
+		return nil, err
+	}
+	for _, mode := range loop {
+		if !slices.Contains(modes, mode) {
+			return nil, fmt.Errorf("ambience loop mode %s is not one of the modes", mode)
+		}
+	}
+	return loop, nil
+}
+
+func parseAmbienceModes(names []string) ([]jabra.AmbienceMode, error) {
+	modes := make([]jabra.AmbienceMode, 0, len(names))
+	for _, name := range names {
+		mode, err := jabra.ParseAmbienceMode(name)
+		if err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+// toBands builds the bands of an equalizer.
+func toBands(spec *EqualizerSpec) []jabra.EqualizerBand {
+	if spec == nil {
+		return nil
+	}
+	specs := spec.Bands
+	if len(specs) == 0 {
+		specs = []BandSpec{{Frequency: 250}, {Frequency: 500}, {Frequency: 1000}, {Frequency: 2000}, {Frequency: 4000}}
+	}
+	bands := make([]jabra.EqualizerBand, 0, len(specs))
+	for _, band := range specs {
+		maxGain := band.MaxGain
+		if maxGain == 0 {
+			maxGain = 6
+		}
+		bands = append(bands, jabra.EqualizerBand{MaxGain: maxGain, CenterFrequency: band.Frequency, Gain: band.Gain})
+	}
+	return bands
+}
+
+// parseFeatures sets the FeatureFlags fields named in features.
+func parseFeatures(features []string) (*jabra.FeatureFlags, error) {
+	featureFlags := jabra.NewFeatureFlags(nil)
+	flags := reflect.ValueOf(featureFlags).Elem()
+
+	for _, feature := range features {
+		field := flags.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, feature) })
+		if !field.IsValid() {
+			return nil, fmt.Errorf("unknown feature %q", feature)
+		}
+		field.SetBool(true)
+	}
+
+	return featureFlags, nil
+}
+
+// parseSetting builds the setting a SettingSpec describes.
+func parseSetting(spec SettingSpec) (jabra.Setting, error) {
+	setting := jabra.Setting{
+		GUID:              spec.GUID,
+		Name:              spec.Name,
+		HelpText:          spec.Help,
+		Group:             spec.Group,
+		NeedsRestart:      spec.Restart,
+		Protected:         spec.Protected,
+		ProtectionEnabled: spec.Protected,
+	}
+	if spec.GUID == "" {
+		return setting, fmt.Errorf("setting %q has no guid", spec.Name)
+	}
+
+	options := spec.Options
+	switch spec.Type {
+	case "toggle":
+		setting.Control, setting.DataType = jabra.ControlToggle, jabra.SettingByte
+		if len(options) == 0 {
+			options = []OptionSpec{{Key: 0, Value: "Off"}, {Key: 1, Value: "On"}}
+		}
+	case "list":
+		setting.Control, setting.DataType = jabra.ControlDropDown, jabra.SettingByte
+		if len(options) == 0 {
+			return setting, fmt.Errorf("setting %s: a list needs options", spec.GUID)
+		}
+	case "text", "password":
+		setting.Control, setting.DataType = jabra.ControlTextBox, jabra.SettingString
+		if spec.Type == "password" {
+			setting.Control = jabra.ControlPasswordTextBox
+		}
+		setting.Text = spec.Value
+	default:
+		return setting, fmt.Errorf("setting %s: unknown type %q", spec.GUID, spec.Type)
+	}
+
+	for _, option := range options {
+		settingOption := jabra.SettingOption{Key: option.Key, Value: option.Value}
+		for _, guid := range option.Enables {
+			settingOption.Dependents = append(settingOption.Dependents, jabra.SettingDependency{GUID: guid, Enable: true})
+		}
+		for _, guid := range option.Disables {
+			settingOption.Dependents = append(settingOption.Dependents, jabra.SettingDependency{GUID: guid, Enable: false})
+		}
+		setting.HasDependents = setting.HasDependents || len(settingOption.Dependents) > 0
+		setting.Options = append(setting.Options, settingOption)
+	}
+	if setting.DataType == jabra.SettingByte {
+		index := slices.IndexFunc(setting.Options, func(option jabra.SettingOption) bool { return option.Value == spec.Value })
+		switch {
+		case index != -1:
+			setting.Key = setting.Options[index].Key
+		case spec.Value == "":
+			setting.Key = setting.Options[0].Key
+		default:
+			return setting, fmt.Errorf("setting %s: %q is not one of its options", spec.GUID, spec.Value)
+		}
+	}
+
+	if spec.Validation != nil {
+		setting.Validation = &jabra.ValidationRule{
+			MinLength:    spec.Validation.MinLength,
+			MaxLength:    spec.Validation.MaxLength,
+			RegExp:       spec.Validation.RegExp,
+			ErrorMessage: spec.Validation.Message,
+		}
+		if _, err := regexp.Compile(spec.Validation.RegExp); err != nil {
+			return setting, fmt.Errorf("setting %s: %w", spec.GUID, err)
+		}
+	}
+	return setting, nil
+}
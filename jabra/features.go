@@ -0,0 +1,175 @@
+package jabra
+
+// FeatureFlags lists the DeviceFeature values reported by
+// Jabra_GetSupportedFeatures for a device.
+type FeatureFlags struct {
+	BusyLight                         bool
+	FactoryReset                      bool
+	PairingList                       bool
+	RemoteMMI                         bool
+	MusicEqualizer                    bool
+	EarbudInterconnectionStatus       bool
+	StepRate                          bool
+	HeartRate                         bool
+	RrInterval                        bool
+	RingtoneUpload                    bool
+	ImageUpload                       bool
+	NeedsExplicitRebootAfterOta       bool
+	NeedsToBePutInCradleToCompleteFwu bool
+	RemoteMMIv2                       bool
+	Logging                           bool
+	PreferredSoftphoneListInDevice    bool
+	VoiceAssistant                    bool
+	PlayRingtone                      bool
+	SetDateTime                       bool
+	FullWizardMode                    bool
+	LimitedWizardMode                 bool
+	OnHeadDetection                   bool
+	SettingsChangeNotification        bool
+	AudioStreaming                    bool
+	CustomerSupport                   bool
+	MySound                           bool
+	UiConfigurableButtons             bool
+	ManualBusyLight                   bool
+	Whiteboard                        bool
+	Video                             bool
+	AmbienceModes                     bool
+	SealingTest                       bool
+	AMASupport                        bool
+	AmbienceModesLoop                 bool
+	FFANC                             bool
+	GoogleBisto                       bool
+	VirtualDirector                   bool
+	PictureInPicture                  bool
+	DateTimeIsUTC                     bool
+	RemoteControl                     bool
+	UserConfigurableHDR               bool
+	DectBasicPairing                  bool
+	DectSecurePairing                 bool
+	DectOtaFwuSupported               bool
+	XpressURL                         bool
+	PasswordProvisioning              bool
+	Ethernet                          bool
+	WLAN                              bool
+	EthernetAuthenticationCertificate bool
+	EthernetAuthenticationMSCHAPv2    bool
+	WLANAuthenticationCertificate     bool
+	WLANAuthenticationMSCHAPv2        bool
+}
+
+// NewFeatureFlags builds FeatureFlags from the raw DeviceFeature values.
+// Unknown values are ignored.
+func NewFeatureFlags(features []uint32) *FeatureFlags {
+	var featureFlag FeatureFlags
+
+	for _, feature := range features {
+		switch feature {
+		case 1000:
+			featureFlag.BusyLight = true
+		case 1001:
+			featureFlag.FactoryReset = true
+		case 1002:
+			featureFlag.PairingList = true
+		case 1003:
+			featureFlag.RemoteMMI = true
+		case 1004:
+			featureFlag.MusicEqualizer = true
+		case 1005:
+			featureFlag.EarbudInterconnectionStatus = true
+		case 1006:
+			featureFlag.StepRate = true
+		case 1007:
+			featureFlag.HeartRate = true
+		case 1008:
+			featureFlag.RrInterval = true
+		case 1009:
+			featureFlag.RingtoneUpload = true
+		case 1010:
+			featureFlag.ImageUpload = true
+		case 1011:
+			featureFlag.NeedsExplicitRebootAfterOta = true
+		case 1012:
+			featureFlag.NeedsToBePutInCradleToCompleteFwu = true
+		case 1013:
+			featureFlag.RemoteMMIv2 = true
+		case 1014:
+			featureFlag.Logging = true
+		case 1015:
+			featureFlag.PreferredSoftphoneListInDevice = true
+		case 1016:
+			featureFlag.VoiceAssistant = true
+		case 1017:
+			featureFlag.PlayRingtone = true
+		case 1018:
+			featureFlag.SetDateTime = true
+		case 1019:
+			featureFlag.FullWizardMode = true
+		case 1020:
+			featureFlag.LimitedWizardMode = true
+		case 1021:
+			featureFlag.OnHeadDetection = true
+		case 1022:
+			featureFlag.SettingsChangeNotification = true
+		case 1023:
+			featureFlag.AudioStreaming = true
+		case 1024:
+			featureFlag.CustomerSupport = true
+		case 1025:
+			featureFlag.MySound = true
+		case 1026:
+			featureFlag.UiConfigurableButtons = true
+		case 1027:
+			featureFlag.ManualBusyLight = true
+		case 1028:
+			featureFlag.Whiteboard = true
+		case 1029:
+			featureFlag.Video = true
+		case 1030:
+			featureFlag.AmbienceModes = true
+		case 1031:
+			featureFlag.SealingTest = true
+		case 1032:
+			featureFlag.AMASupport = true
+		case 1033:
+			featureFlag.AmbienceModesLoop = true
+		case 1034:
+			featureFlag.FFANC = true
+		case 1035:
+			featureFlag.GoogleBisto = true
+		case 1036:
+			featureFlag.VirtualDirector = true
+		case 1037:
+			featureFlag.PictureInPicture = true
+		case 1038:
+			featureFlag.DateTimeIsUTC = true
+		case 1039:
+			featureFlag.RemoteControl = true
+		case 1040:
+			featureFlag.UserConfigurableHDR = true
+		case 1041:
+			featureFlag.DectBasicPairing = true
+		case 1042:
+			featureFlag.DectSecurePairing = true
+		case 1043:
+			featureFlag.DectOtaFwuSupported = true
+		case 1044:
+			featureFlag.XpressURL = true
+		case 1045:
+			featureFlag.PasswordProvisioning = true
+		case 1046:
+			featureFlag.Ethernet = true
+		case 1047:
+			featureFlag.WLAN = true
+		case 1048:
+			featureFlag.EthernetAuthenticationCertificate = true
+		case 1049:
+			featureFlag.EthernetAuthenticationMSCHAPv2 = true
+		case 1050:
+			featureFlag.WLANAuthenticationCertificate = true
+		case 1051:
+			featureFlag.WLANAuthenticationMSCHAPv2 = true
+		}
+	}
+
+	return &featureFlag
+}
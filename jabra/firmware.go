@@ -0,0 +1,142 @@
+package jabra
+
+import "fmt"
+
+// FirmwareVersionBundle holds the firmware versions of a parent device and
+// its child, e.g. a base station and its headset.
+type FirmwareVersionBundle struct {
+	Parent string
+	Child  string
+}
+
+// FirmwareInfo describes a firmware release offered by the Jabra cloud.
+type FirmwareInfo struct {
+	Version      string
+	FileSize     string
+	ReleaseDate  string
+	Stage        string
+	ReleaseNotes string
+}
+
+// FirmwareEventType mirrors Jabra_FirmwareEventType.
+type FirmwareEventType int
+
+const (
+	FirmwareDownload FirmwareEventType = iota
+	FirmwareUpdate
+)
+
+// FirmwareEventStatus mirrors Jabra_FirmwareEventStatus.
+type FirmwareEventStatus int
+
+const (
+	FirmwareInitiating FirmwareEventStatus = iota
+	FirmwareInProgress
+	FirmwareCompleted
+	FirmwareCancelled
+	FirmwareFileNotAvailable
+	FirmwareFileNotAccessible
+	FirmwareFileAlreadyPresent
+	FirmwareNetworkError
+	FirmwareSSLError
+	FirmwareDownloadError
+	FirmwareUpdateError
+	FirmwareInvalidAuthentication
+	FirmwareFileUnderDownload
+	FirmwareNotAllowed
+)
+
+// FirmwareProgress is reported through Callbacks.FirmwareProgress while a
+// firmware download or update runs.
+type FirmwareProgress struct {
+	Type       FirmwareEventType
+	Status     FirmwareEventStatus
+	Percentage uint16
+}
+
+func (t FirmwareEventType) String() string {
+	switch t {
+	case FirmwareDownload:
+		return "download"
+	case FirmwareUpdate:
+		return "update"
+	default:
+		return "unknown"
+	}
+}
+
+func (s FirmwareEventStatus) String() string {
+	switch s {
+	case FirmwareInitiating:
+		return "initiating"
+	case FirmwareInProgress:
+		return "inProgress"
+	case FirmwareCompleted:
+		return "completed"
+	case FirmwareCancelled:
+		return "cancelled"
+	case FirmwareFileNotAvailable:
+		return "fileNotAvailable"
+	case FirmwareFileNotAccessible:
+		return "fileNotAccessible"
+	case FirmwareFileAlreadyPresent:
+		return "fileAlreadyPresent"
+	case FirmwareNetworkError:
+		return "networkError"
+	case FirmwareSSLError:
+		return "sslError"
+	case FirmwareDownloadError:
+		return "downloadError"
+	case FirmwareUpdateError:
+		return "updateError"
+	case FirmwareInvalidAuthentication:
+		return "invalidAuthentication"
+	case FirmwareFileUnderDownload:
+		return "fileUnderDownload"
+	case FirmwareNotAllowed:
+		return "notAllowed"
+	default:
+		return "unknown"
+	}
+}
+
+// Done reports whether s ends the download or update, successfully or not.
+func (s FirmwareEventStatus) Done() bool {
+	return s != FirmwareInitiating && s != FirmwareInProgress && s != FirmwareFileUnderDownload
+}
+
+// FirmwareStatusError is a firmware download or update that ended with a
+// status other than FirmwareCompleted.
+type FirmwareStatusError struct {
+	Status FirmwareEventStatus
+}
+
+func (e *FirmwareStatusError) Error() string {
+	switch e.Status {
+	case FirmwareCancelled:
+		return "the firmware update was cancelled"
+	case FirmwareFileNotAvailable:
+		return "the firmware file is not available"
+	case FirmwareFileNotAccessible:
+		return "the firmware file is not accessible"
+	case FirmwareNetworkError, FirmwareSSLError, FirmwareInvalidAuthentication:
+		return fmt.Sprintf("the firmware download failed (%s)", e.Status)
+	case FirmwareDownloadError:
+		return "the firmware download failed"
+	case FirmwareUpdateError:
+		return "the device rejected the firmware update"
+	case FirmwareNotAllowed:
+		return "the firmware update is not allowed"
+	default:
+		return fmt.Sprintf("firmware %s", e.Status)
+	}
+}
+
+// Err returns nil for the statuses of a download or update that is running
+// or completed, and a *FirmwareStatusError for the others.
+func (s FirmwareEventStatus) Err() error {
+	if !s.Done() || s == FirmwareCompleted || s == FirmwareFileAlreadyPresent {
+		return nil
+	}
+	return &FirmwareStatusError{Status: s}
+}
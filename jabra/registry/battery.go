@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// monitor is the battery bookkeeping of one device. The battery callback is
+// the fast path, polling reconciles it: the SDK reports the charging state
+// promptly but levelInPercent can arrive late or not at all.
+type monitor struct {
+	// polled is when the battery was last read, zero to read it on the next
+	// poll.
+	polled time.Time
+	// staleUntil is set when a read found a change the callback had not
+	// reported, the battery is read every PollInterval until then.
+	staleUntil time.Time
+}
+
+// batteryDue reports whether the battery of deviceInfo is to be read now.
+// Charging batteries and stale callbacks are read every PollInterval, the
+// others every BatteryInterval.
+func (r *Registry) batteryDue(deviceInfo jabra.DeviceInfo) bool {
+	if deviceInfo.IsDongle {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, exists := r.monitors[KeyOf(deviceInfo)]
+	if !exists {
+		return false
+	}
+
+	now := time.Now()
+	interval := r.BatteryInterval
+	if (deviceInfo.BatteryStatus != nil && deviceInfo.BatteryStatus.Charging) || now.Before(m.staleUntil) {
+		interval = r.PollInterval
+	}
+	if now.Sub(m.polled) < interval {
+		return false
+	}
+	m.polled = now
+	return true
+}
+
+// batteryChanged is the battery callback. The level it carries may be
+// behind, so the battery is read again on the next poll to confirm it.
+func (r *Registry) batteryChanged(deviceID uint16, batteryStatus *jabra.BatteryStatus) {
+	if batteryStatus == nil {
+		return
+	}
+	r.setBattery(deviceID, batteryStatus, true)
+}
+
+// setBattery stores batteryStatus and publishes BatteryChanged if it differs
+// from what is known, so the callback and the polling never report the same
+// state twice.
+func (r *Registry) setBattery(deviceID uint16, batteryStatus *jabra.BatteryStatus, fromCallback bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, exists := r.monitors[r.keys[deviceID]]
+	if !exists {
+		return
+	}
+	now := time.Now()
+
+	if fromCallback {
+		m.polled = time.Time{}
+		if now.Before(m.staleUntil) {
+			// The callback is behind the polling, it would only move
+			// the level back. The next poll has the current state.
+			return
+		}
+	}
+
+	changed := r.updateLocked(deviceID, BatteryChanged, func(deviceInfo *jabra.DeviceInfo) bool {
+		if reflect.DeepEqual(deviceInfo.BatteryStatus, batteryStatus) {
+			return false
+		}
+		deviceInfo.BatteryStatus = batteryStatus
+		return true
+	})
+	if changed && !fromCallback {
+		m.staleUntil = now.Add(r.StaleFor)
+	}
+}
@@ -0,0 +1,397 @@
+// Package registry keeps track of the devices of a jabra.Backend session.
+// It owns the backend callbacks, follows battery and pairing state in one
+// place and publishes typed events to any number of subscribers, so the UI
+// and the services built on it do not keep device maps or polling loops of
+// their own.
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// Key identifies a device across reconnects: its serial number and
+// connection type. The same headset on USB and through a dongle are two
+// devices. Devices without a serial number are keyed by device ID.
+type Key string
+
+func KeyOf(deviceInfo jabra.DeviceInfo) Key {
+	if deviceInfo.SerialNumber == "" {
+		return Key(fmt.Sprintf("device%d", deviceInfo.DeviceID))
+	}
+	return Key(deviceInfo.SerialNumber + "/" + deviceInfo.DeviceConnection.String())
+}
+
+type EventType int
+
+const (
+	Attached EventType = iota
+	Removed
+	BatteryChanged
+	PairingListChanged
+	FirmwareProgress
+	SettingsChanged
+	AmbienceChanged
+	BusylightChanged
+	HidInput
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Attached:
+		return "attached"
+	case Removed:
+		return "removed"
+	case BatteryChanged:
+		return "batteryChanged"
+	case PairingListChanged:
+		return "pairingListChanged"
+	case FirmwareProgress:
+		return "firmwareProgress"
+	case SettingsChanged:
+		return "settingsChanged"
+	case AmbienceChanged:
+		return "ambienceChanged"
+	case BusylightChanged:
+		return "busylightChanged"
+	case HidInput:
+		return "hidInput"
+	default:
+		return "unknown"
+	}
+}
+
+// Event carries the device as it was when the event happened. For Removed it
+// is the last known state. Firmware is set for FirmwareProgress, whose device
+// may already be detached for the update; Device then only has its ID.
+// Settings is set for SettingsChanged, Ambience for AmbienceChanged,
+// Busylight for BusylightChanged, and Input and Value for HidInput, meaning
+// what they mean for jabra.Callbacks.HidInput.
+type Event struct {
+	Type      EventType
+	Key       Key
+	Device    jabra.DeviceInfo
+	Firmware  *jabra.FirmwareProgress
+	Settings  []jabra.SettingChange
+	Ambience  jabra.AmbienceEvent
+	Busylight bool
+	Input     jabra.HidInput
+	Value     bool
+}
+
+// Registry is safe for concurrent use. The DeviceInfo values it hands out
+// share their BatteryStatus, PairingList and FeatureFlags with the registry
+// and must be treated as read-only; updates replace them instead of
+// changing them in place.
+type Registry struct {
+	// PollInterval is how often pairing lists are read, and batteries that
+	// are charging or whose callback has fallen behind. Set the intervals
+	// before Start.
+	PollInterval time.Duration
+	// BatteryInterval is how often the other batteries are read to catch
+	// what the battery callback missed.
+	BatteryInterval time.Duration
+	// StaleFor is how long a battery is read every PollInterval after a
+	// read found a change the callback had not reported.
+	StaleFor time.Duration
+
+	backend jabra.Backend
+
+	mu          sync.Mutex
+	devices     map[Key]jabra.DeviceInfo
+	keys        map[uint16]Key
+	monitors    map[Key]*monitor
+	settings    map[Key][]jabra.Setting
+	settingsLog map[Key][]SettingsLogEntry
+	subscribers map[*Subscription]bool
+	scanned     chan struct{}
+	scanOnce    sync.Once
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+func New(backend jabra.Backend) *Registry {
+	return &Registry{
+		PollInterval:    time.Second,
+		BatteryInterval: 30 * time.Second,
+		StaleFor:        2 * time.Minute,
+		backend:         backend,
+		devices:         make(map[Key]jabra.DeviceInfo),
+		keys:            make(map[uint16]Key),
+		monitors:        make(map[Key]*monitor),
+		settings:        make(map[Key][]jabra.Setting),
+		settingsLog:     make(map[Key][]SettingsLogEntry),
+		subscribers:     make(map[*Subscription]bool),
+		scanned:         make(chan struct{}),
+	}
+}
+
+// Start initializes the backend session and begins tracking devices.
+func (r *Registry) Start(appID string) error {
+	if err := r.backend.Initialize(appID, jabra.Callbacks{
+		FirstScanDone:        r.firstScanDone,
+		DeviceAttached:       r.attached,
+		DeviceRemoved:        r.removed,
+		BatteryStatusChanged: r.batteryChanged,
+		FirmwareProgress:     r.firmwareProgress,
+		SettingsChanged:      r.settingsChanged,
+		AmbienceChanged:      r.ambienceChanged,
+		BusylightChanged:     r.busylightChanged,
+		HidInput:             r.hidInput,
+	}); err != nil {
+		return err
+	}
+
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+	go r.poll(r.stop, r.stopped)
+
+	return nil
+}
+
+// Stop ends the backend session and closes all subscriptions.
+func (r *Registry) Stop() error {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.stopped
+		r.stop = nil
+	}
+	err := r.backend.Uninitialize()
+
+	r.mu.Lock()
+	subscribers := make([]*Subscription, 0, len(r.subscribers))
+	for subscription := range r.subscribers {
+		subscribers = append(subscribers, subscription)
+	}
+	r.mu.Unlock()
+	for _, subscription := range subscribers {
+		subscription.Close()
+	}
+
+	return err
+}
+
+// Backend returns the backend the registry tracks.
+func (r *Registry) Backend() jabra.Backend {
+	return r.backend
+}
+
+// Scanned is closed once the devices present at Start have been reported.
+func (r *Registry) Scanned() <-chan struct{} {
+	return r.scanned
+}
+
+// Devices returns the attached devices ordered by device ID.
+func (r *Registry) Devices() []jabra.DeviceInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.list()
+}
+
+// list is Devices for callers holding r.mu.
+func (r *Registry) list() []jabra.DeviceInfo {
+	devices := make([]jabra.DeviceInfo, 0, len(r.devices))
+	for _, deviceInfo := range r.devices {
+		devices = append(devices, deviceInfo)
+	}
+	slices.SortFunc(devices, func(a, b jabra.DeviceInfo) int { return int(a.DeviceID) - int(b.DeviceID) })
+	return devices
+}
+
+func (r *Registry) Get(key Key) (jabra.DeviceInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deviceInfo, exists := r.devices[key]
+	return deviceInfo, exists
+}
+
+/****************************************************************************/
+/*                            BACKEND CALLBACKS                             */
+/****************************************************************************/
+
+func (r *Registry) firstScanDone() {
+	r.scanOnce.Do(func() { close(r.scanned) })
+}
+
+func (r *Registry) attached(deviceInfo jabra.DeviceInfo) {
+	// Read the state before taking the lock, the backend may be slow.
+	deviceInfo.BatteryStatus = r.batteryStatus(deviceInfo)
+	deviceInfo.PairingList = r.pairingList(deviceInfo)
+	settings := r.listenSettings(deviceInfo)
+	r.listenAmbience(deviceInfo)
+	r.listenBusylight(deviceInfo)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := KeyOf(deviceInfo)
+	if old, exists := r.devices[key]; exists && old.DeviceID != deviceInfo.DeviceID {
+		// Came back without being reported as removed.
+		delete(r.keys, old.DeviceID)
+	}
+	r.devices[key] = deviceInfo
+	r.keys[deviceInfo.DeviceID] = key
+	r.monitors[key] = &monitor{polled: time.Now()}
+	r.settings[key] = settings
+	r.publish(Event{Type: Attached, Key: key, Device: deviceInfo})
+}
+
+func (r *Registry) removed(deviceID uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.keys[deviceID]
+	if !exists {
+		return
+	}
+	deviceInfo := r.devices[key]
+	delete(r.keys, deviceID)
+	delete(r.devices, key)
+	delete(r.monitors, key)
+	delete(r.settings, key)
+	r.publish(Event{Type: Removed, Key: key, Device: deviceInfo})
+}
+
+// listenAmbience starts listening to the ambience changes of a device with
+// ambience modes, made with its button or by another application.
+func (r *Registry) listenAmbience(deviceInfo jabra.DeviceInfo) {
+	if deviceInfo.IsInFirmwareUpdateMode || deviceInfo.FeatureFlags == nil || !deviceInfo.FeatureFlags.AmbienceModes {
+		return
+	}
+	r.backend.ListenAmbience(deviceInfo.DeviceID, true)
+}
+
+func (r *Registry) ambienceChanged(deviceID uint16, event jabra.AmbienceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, exists := r.keys[deviceID]; exists {
+		r.publish(Event{Type: AmbienceChanged, Key: key, Device: r.devices[key], Ambience: event})
+	}
+}
+
+// listenBusylight starts listening to the busylight of a device that has
+// one, turned on or off by its user, a softphone or another application.
+func (r *Registry) listenBusylight(deviceInfo jabra.DeviceInfo) {
+	if deviceInfo.IsInFirmwareUpdateMode || deviceInfo.FeatureFlags == nil {
+		return
+	}
+	if deviceInfo.FeatureFlags.BusyLight || deviceInfo.FeatureFlags.ManualBusyLight {
+		r.backend.ListenBusylight(deviceInfo.DeviceID, true)
+	}
+}
+
+func (r *Registry) busylightChanged(deviceID uint16, on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, exists := r.keys[deviceID]; exists {
+		r.publish(Event{Type: BusylightChanged, Key: key, Device: r.devices[key], Busylight: on})
+	}
+}
+
+func (r *Registry) hidInput(deviceID uint16, input jabra.HidInput, value bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, exists := r.keys[deviceID]; exists {
+		r.publish(Event{Type: HidInput, Key: key, Device: r.devices[key], Input: input, Value: value})
+	}
+}
+
+func (r *Registry) firmwareProgress(deviceID uint16, progress jabra.FirmwareProgress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event := Event{Type: FirmwareProgress, Device: jabra.DeviceInfo{DeviceID: deviceID}, Firmware: &progress}
+	if key, exists := r.keys[deviceID]; exists {
+		event.Key, event.Device = key, r.devices[key]
+	}
+	r.publish(event)
+}
+
+/****************************************************************************/
+/*                                 POLLING                                  */
+/****************************************************************************/
+
+// poll reads the pairing lists, and the batteries that are due.
+func (r *Registry) poll(stop, stopped chan struct{}) {
+	defer close(stopped)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(r.PollInterval):
+		}
+
+		for _, deviceInfo := range r.Devices() {
+			if r.batteryDue(deviceInfo) {
+				if batteryStatus := r.batteryStatus(deviceInfo); batteryStatus != nil {
+					r.setBattery(deviceInfo.DeviceID, batteryStatus, false)
+				}
+			}
+			if pairingList := r.pairingList(deviceInfo); pairingList != nil {
+				r.update(deviceInfo.DeviceID, PairingListChanged, func(deviceInfo *jabra.DeviceInfo) bool {
+					if reflect.DeepEqual(deviceInfo.PairingList, pairingList) {
+						return false
+					}
+					deviceInfo.PairingList = pairingList
+					return true
+				})
+			}
+		}
+	}
+}
+
+// update applies change to the device with deviceID if it is still attached
+// and publishes eventType when change reports a difference.
+func (r *Registry) update(deviceID uint16, eventType EventType, change func(deviceInfo *jabra.DeviceInfo) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.updateLocked(deviceID, eventType, change)
+}
+
+// updateLocked is update for callers holding r.mu. It reports whether the
+// device changed.
+func (r *Registry) updateLocked(deviceID uint16, eventType EventType, change func(deviceInfo *jabra.DeviceInfo) bool) bool {
+	key, exists := r.keys[deviceID]
+	if !exists {
+		return false
+	}
+	deviceInfo := r.devices[key]
+	if !change(&deviceInfo) {
+		return false
+	}
+	r.devices[key] = deviceInfo
+	r.publish(Event{Type: eventType, Key: key, Device: deviceInfo})
+	return true
+}
+
+// batteryStatus and pairingList leave devices in firmware update mode alone,
+// they only answer the updater.
+func (r *Registry) batteryStatus(deviceInfo jabra.DeviceInfo) *jabra.BatteryStatus {
+	if deviceInfo.IsDongle || deviceInfo.IsInFirmwareUpdateMode {
+		return nil
+	}
+	batteryStatus, err := r.backend.BatteryStatus(deviceInfo.DeviceID)
+	if err != nil {
+		return nil
+	}
+	return batteryStatus
+}
+
+func (r *Registry) pairingList(deviceInfo jabra.DeviceInfo) *jabra.PairingList {
+	if !deviceInfo.IsDongle || deviceInfo.IsInFirmwareUpdateMode || deviceInfo.FeatureFlags == nil || !deviceInfo.FeatureFlags.PairingList {
+		return nil
+	}
+	return r.backend.PairingList(deviceInfo.DeviceID)
+}
@@ -0,0 +1,531 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+)
+
+// stormScenario has a dongle and count headsets, the headsets start detached.
+func stormScenario(t *testing.T, count int) *fake.Backend {
+	t.Helper()
+
+	var yaml strings.Builder
+	yaml.WriteString(`
+devices:
+  - id: 0
+    name: Jabra Link 380
+    serial: DONGLE
+    dongle: true
+    features: [pairingList]
+    pairingList:
+      - name: Jabra Evolve2 85
+        address: 70:BF:92:4A:10:01
+`)
+	for i := 1; i <= count; i++ {
+		fmt.Fprintf(&yaml, `
+  - id: %d
+    name: Headset %d
+    serial: HEADSET%d
+    connection: bt
+    detached: true
+    battery:
+      level: 50
+`, i, i, i)
+	}
+
+	scenario, err := fake.Parse([]byte(yaml.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake.New(scenario)
+}
+
+func next(t *testing.T, subscription *Subscription) Event {
+	t.Helper()
+	select {
+	case event := <-subscription.C:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	backend := stormScenario(t, 1)
+	r := New(backend)
+	r.PollInterval = 10 * time.Millisecond
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	subscription := r.Subscribe()
+	defer subscription.Close()
+
+	// The dongle is replayed to the new subscriber.
+	if event := next(t, subscription); event.Type != Attached || event.Key != "DONGLE/usb" || event.Device.PairingList == nil {
+		t.Fatalf("first event %v %s %+v", event.Type, event.Key, event.Device)
+	}
+
+	backend.Attach(1)
+	event := next(t, subscription)
+	if event.Type != Attached || event.Key != "HEADSET1/bt" || event.Device.BatteryStatus == nil || event.Device.BatteryStatus.LevelInPercent != 50 {
+		t.Fatalf("attach event %v %s %+v", event.Type, event.Key, event.Device)
+	}
+
+	backend.SetBatteryLevel(1, 40)
+	if event := next(t, subscription); event.Type != BatteryChanged || event.Device.BatteryStatus.LevelInPercent != 40 {
+		t.Fatalf("battery event %v %+v", event.Type, event.Device.BatteryStatus)
+	}
+	if deviceInfo, _ := r.Get("HEADSET1/bt"); deviceInfo.BatteryStatus.LevelInPercent != 40 {
+		t.Errorf("Get after battery change: %+v", deviceInfo.BatteryStatus)
+	}
+
+	pairedDevice := r.Devices()[0].PairingList.PairedDevices[0]
+	if err := backend.ClearPairedDevice(0, pairedDevice); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(t, subscription); event.Type != PairingListChanged || len(event.Device.PairingList.PairedDevices) != 0 {
+		t.Fatalf("pairing list event %v %+v", event.Type, event.Device.PairingList)
+	}
+
+	backend.Detach(1)
+	if event := next(t, subscription); event.Type != Removed || event.Key != "HEADSET1/bt" {
+		t.Fatalf("remove event %v %s", event.Type, event.Key)
+	}
+	if _, exists := r.Get("HEADSET1/bt"); exists {
+		t.Error("removed headset is still registered")
+	}
+}
+
+// TestStorm attaches and detaches headsets from many goroutines while
+// readers and subscribers come and go. Run it with -race.
+func TestStorm(t *testing.T) {
+	const (
+		headsets = 20
+		rounds   = 50
+	)
+
+	backend := stormScenario(t, headsets)
+	r := New(backend)
+	r.PollInterval = time.Millisecond
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	// A subscriber following every event must end up with the registry's view.
+	follower := r.Subscribe()
+	var (
+		seenMu sync.Mutex
+		seen   = make(map[Key]bool)
+	)
+	go func() {
+		for event := range follower.C {
+			seenMu.Lock()
+			switch event.Type {
+			case Attached:
+				seen[event.Key] = true
+			case Removed:
+				delete(seen, event.Key)
+			}
+			seenMu.Unlock()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for id := uint16(1); id <= headsets; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				backend.Attach(id)
+				backend.SetBatteryLevel(id, float64(id))
+				backend.Detach(id)
+			}
+			if id%2 == 0 {
+				backend.Attach(id)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range rounds {
+			for _, deviceInfo := range r.Devices() {
+				if deviceInfo.BatteryStatus != nil {
+					_ = deviceInfo.BatteryStatus.LevelInPercent
+				}
+			}
+			subscription := r.Subscribe()
+			<-subscription.C // at least the dongle
+			subscription.Close()
+		}
+	}()
+	wg.Wait()
+
+	want := map[Key]bool{"DONGLE/usb": true}
+	for id := 2; id <= headsets; id += 2 {
+		want[Key(fmt.Sprintf("HEADSET%d/bt", id))] = true
+	}
+	devices := r.Devices()
+	if len(devices) != len(want) {
+		t.Fatalf("%d devices registered, want %d", len(devices), len(want))
+	}
+	for _, deviceInfo := range devices {
+		if !want[KeyOf(deviceInfo)] {
+			t.Errorf("unexpected device %s", KeyOf(deviceInfo))
+		}
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		seenMu.Lock()
+		equal := reflect.DeepEqual(seen, want)
+		seenMu.Unlock()
+		if equal {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the follower did not end up with the registered devices")
+		}
+	}
+	follower.Close()
+}
+
+func TestBattery(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Elite 85t
+    serial: PUSHED
+    connection: bt
+    battery:
+      level: 80
+      extraUnits:
+        - component: left
+          level: 80
+        - component: right
+          level: 70
+  - id: 2
+    name: Jabra Evolve2 65
+    serial: POLLED
+    connection: bt
+    battery:
+      level: 80
+      charging: true
+      noCallback: true
+  - id: 3
+    name: Jabra Evolve2 85
+    serial: LATE
+    connection: bt
+    battery:
+      level: 80
+      charging: true
+      callbackDelay: 100ms
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	r := New(backend)
+	r.PollInterval = 10 * time.Millisecond
+	r.BatteryInterval = time.Hour
+	r.StaleFor = time.Hour
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	subscription := r.Subscribe()
+	defer subscription.Close()
+	for range 3 {
+		next(t, subscription)
+	}
+
+	// The callback is reported at once, the confirming read is not reported again.
+	backend.SetBatteryLevel(1, 60)
+	event := next(t, subscription)
+	if event.Type != BatteryChanged || event.Key != "PUSHED/bt" || event.Device.BatteryStatus.LevelInPercent != 60 {
+		t.Fatalf("callback event %v %s %+v", event.Type, event.Key, event.Device.BatteryStatus)
+	}
+	levels := event.Device.BatteryStatus.Levels()
+	if levels[jabra.ComponentLeft] != 60 || levels[jabra.ComponentRight] != 50 || levels[jabra.ComponentCombined] != 60 {
+		t.Errorf("levels %v", levels)
+	}
+	select {
+	case event := <-subscription.C:
+		t.Fatalf("duplicate event %v %s %+v", event.Type, event.Key, event.Device.BatteryStatus)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Without a callback a charging battery is polled.
+	backend.SetBatteryLevel(2, 90)
+	event = next(t, subscription)
+	if event.Type != BatteryChanged || event.Key != "POLLED/bt" || event.Device.BatteryStatus.LevelInPercent != 90 {
+		t.Fatalf("polled event %v %s %+v", event.Type, event.Key, event.Device.BatteryStatus)
+	}
+
+	// A late callback does not move the level back to what polling already passed.
+	backend.SetBatteryLevel(3, 90)
+	if event := next(t, subscription); event.Key != "LATE/bt" || event.Device.BatteryStatus.LevelInPercent != 90 {
+		t.Fatalf("first level %s %+v", event.Key, event.Device.BatteryStatus)
+	}
+	backend.SetBatteryLevel(3, 95)
+	if event := next(t, subscription); event.Key != "LATE/bt" || event.Device.BatteryStatus.LevelInPercent != 95 {
+		t.Fatalf("second level %s %+v", event.Key, event.Device.BatteryStatus)
+	}
+	select {
+	case event := <-subscription.C:
+		t.Fatalf("late callback reported %v %s %+v", event.Type, event.Key, event.Device.BatteryStatus)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestFirmwareProgress(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    firmware: 1.3.8
+    firmwareUpdate:
+      duration: 50ms
+      fail: updateError
+    battery:
+      level: 80
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	r := New(backend)
+	r.PollInterval = 10 * time.Millisecond
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	subscription := r.Subscribe()
+	defer subscription.Close()
+	next(t, subscription)
+
+	path := t.TempDir() + "/firmware.zip"
+	if err := os.WriteFile(path, []byte("PK"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.UpdateFirmware(1, path); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for {
+		event := next(t, subscription)
+		if event.Type != FirmwareProgress {
+			events = append(events, fmt.Sprintf("%v %s", event.Type, event.Key))
+			continue
+		}
+		if event.Device.DeviceID != 1 {
+			t.Fatalf("progress for device %d", event.Device.DeviceID)
+		}
+		// The progress of a detached device has no key.
+		if detached := len(events) == 1; detached != (event.Key == "") {
+			t.Fatalf("progress %+v with key %q after %v", event.Firmware, event.Key, events)
+		}
+		if event.Firmware.Status.Done() {
+			if event.Firmware.Status != jabra.FirmwareUpdateError || event.Key != "HEADSET/usb" || !event.Device.IsInFirmwareUpdateMode {
+				t.Fatalf("last progress %s %+v in %+v", event.Key, event.Firmware, event.Device)
+			}
+			break
+		}
+	}
+	if want := []string{"removed HEADSET/usb", "attached HEADSET/usb"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events %v, want %v", events, want)
+	}
+
+	// The battery of a device in firmware update mode is not read.
+	deviceInfo, _ := r.Get("HEADSET/usb")
+	if deviceInfo.BatteryStatus != nil {
+		t.Errorf("battery %+v read in firmware update mode", deviceInfo.BatteryStatus)
+	}
+}
+
+func TestSettingsChanged(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    features: [settingsChangeNotification]
+    settings:
+      - guid: ringtone
+        name: Ringtone
+        type: list
+        options: [{key: 0, value: Tone 1}, {key: 1, value: Tone 2}]
+      - guid: name
+        name: Headset name
+        type: text
+        value: Evolve
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	r := New(backend)
+	r.PollInterval = 10 * time.Millisecond
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	subscription := r.Subscribe()
+	defer subscription.Close()
+	next(t, subscription)
+
+	// A change on the headset itself, and one written through the backend.
+	backend.SetSetting(1, "ringtone", "Tone 2")
+	event := next(t, subscription)
+	want := []jabra.SettingChange{{GUID: "ringtone", Name: "Ringtone", From: "Tone 1", To: "Tone 2"}}
+	if event.Type != SettingsChanged || event.Key != "HEADSET/usb" || !reflect.DeepEqual(event.Settings, want) {
+		t.Fatalf("event %v %s %+v", event.Type, event.Key, event.Settings)
+	}
+	settings, _ := backend.Settings(1)
+	settings[1].Text = "Evolve 2"
+	if err := backend.SetSettings(1, settings[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(t, subscription); event.Type != SettingsChanged || event.Settings[0].From != "Evolve" || event.Settings[0].To != "Evolve 2" {
+		t.Fatalf("event %v %+v", event.Type, event.Settings)
+	}
+
+	// The log outlives a reconnect, and listening starts again.
+	backend.Detach(1)
+	backend.Attach(1)
+	next(t, subscription)
+	next(t, subscription)
+	backend.SetSetting(1, "ringtone", "Tone 1")
+	next(t, subscription)
+
+	var log []string
+	for _, entry := range r.SettingsLog("HEADSET/usb") {
+		log = append(log, entry.Name+": "+entry.From+" -> "+entry.To)
+	}
+	if want := []string{"Ringtone: Tone 1 -> Tone 2", "Headset name: Evolve -> Evolve 2", "Ringtone: Tone 2 -> Tone 1"}; !reflect.DeepEqual(log, want) {
+		t.Errorf("log %v, want %v", log, want)
+	}
+}
+
+func TestAmbienceChanged(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    ambience: {mode: anc}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	r := New(backend)
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	subscription := r.Subscribe()
+	defer subscription.Close()
+	next(t, subscription)
+
+	// Listening starts on attach, and again after a reconnect.
+	for range 2 {
+		backend.SetAmbience(1, "")
+		if event := next(t, subscription); event.Type != AmbienceChanged || event.Key != "HEADSET/usb" || event.Ambience != jabra.AmbienceModeChanged {
+			t.Fatalf("event %v %s %s", event.Type, event.Key, event.Ambience)
+		}
+		backend.Detach(1)
+		backend.Attach(1)
+		next(t, subscription)
+		next(t, subscription)
+	}
+}
+
+func TestBusylightChanged(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    busylight: {manual: true}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	r := New(backend)
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	subscription := r.Subscribe()
+	defer subscription.Close()
+	next(t, subscription)
+
+	for _, want := range []bool{true, false} {
+		backend.PressBusylight(1, "")
+		if event := next(t, subscription); event.Type != BusylightChanged || event.Key != "HEADSET/usb" || event.Busylight != want {
+			t.Fatalf("event %v %s %t, want busylight %t", event.Type, event.Key, event.Busylight, want)
+		}
+	}
+}
+
+func TestHidInput(t *testing.T) {
+	scenario, err := fake.Parse([]byte(`
+devices:
+  - id: 1
+    name: Jabra Evolve2 85
+    serial: HEADSET
+    connection: usb
+    telephony: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := fake.New(scenario)
+	r := New(backend)
+	if err := r.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	<-r.Scanned()
+
+	subscription := r.Subscribe()
+	defer subscription.Close()
+	next(t, subscription)
+
+	backend.PressButton(1, jabra.HidButton1)
+	if event := next(t, subscription); event.Type != HidInput || event.Key != "HEADSET/usb" || event.Input != jabra.HidButton1 || !event.Value {
+		t.Fatalf("event %v %s %s %t, want button1 pressed", event.Type, event.Key, event.Input, event.Value)
+	}
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// settingsLogSize is how many setting changes are kept per device.
+const settingsLogSize = 100
+
+// SettingsLogEntry is a change of a setting and when it was reported.
+type SettingsLogEntry struct {
+	Time time.Time
+	jabra.SettingChange
+}
+
+// listenSettings reads the settings of a device that reports their changes
+// and starts listening to them. It returns nil for other devices.
+func (r *Registry) listenSettings(deviceInfo jabra.DeviceInfo) []jabra.Setting {
+	if deviceInfo.IsInFirmwareUpdateMode || deviceInfo.FeatureFlags == nil || !deviceInfo.FeatureFlags.SettingsChangeNotification {
+		return nil
+	}
+	settings, err := r.backend.Settings(deviceInfo.DeviceID)
+	if err != nil {
+		return nil
+	}
+	if err := r.backend.ListenSettings(deviceInfo.DeviceID, true); err != nil {
+		return nil
+	}
+	return settings
+}
+
+// settingsChanged is the settings callback. It logs and publishes the
+// settings whose value differs from what is known.
+func (r *Registry) settingsChanged(deviceID uint16, settings []jabra.Setting) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.keys[deviceID]
+	if !exists {
+		return
+	}
+	var changes []jabra.SettingChange
+	r.settings[key], changes = jabra.UpdateSettings(r.settings[key], settings)
+	if len(changes) == 0 {
+		return
+	}
+
+	now := time.Now()
+	log := r.settingsLog[key]
+	for _, change := range changes {
+		log = append(log, SettingsLogEntry{Time: now, SettingChange: change})
+	}
+	if len(log) > settingsLogSize {
+		log = slices.Clone(log[len(log)-settingsLogSize:])
+	}
+	r.settingsLog[key] = log
+	r.publish(Event{Type: SettingsChanged, Key: key, Device: r.devices[key], Settings: changes})
+}
+
+// SettingsLog returns the setting changes reported for the device with key,
+// oldest first. The log outlives reconnects of the device.
+func (r *Registry) SettingsLog(key Key) []SettingsLogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.settingsLog[key])
+}
@@ -0,0 +1,100 @@
+package registry
+
+import "sync"
+
+// Subscription delivers events in the order they happened on C. Events are
+// queued without limit, a slow subscriber never holds up the backend
+// callbacks or other subscribers.
+type Subscription struct {
+	// C is closed after Close.
+	C <-chan Event
+
+	registry *Registry
+	c        chan Event
+
+	mu    sync.Mutex
+	queue []Event
+	wake  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Subscribe starts a subscription. It begins with an Attached event for
+// every device already attached, so the subscriber sees a consistent
+// picture without calling Devices first.
+func (r *Registry) Subscribe() *Subscription {
+	c := make(chan Event)
+	s := &Subscription{
+		C:        c,
+		registry: r,
+		c:        c,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go s.deliver()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, deviceInfo := range r.list() {
+		s.push(Event{Type: Attached, Key: KeyOf(deviceInfo), Device: deviceInfo})
+	}
+	r.subscribers[s] = true
+
+	return s
+}
+
+// Close ends the subscription. Events still queued are dropped.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.registry.mu.Lock()
+		delete(s.registry.subscribers, s)
+		s.registry.mu.Unlock()
+
+		close(s.done)
+	})
+}
+
+// publish queues event for every subscriber. The caller holds r.mu.
+func (r *Registry) publish(event Event) {
+	for s := range r.subscribers {
+		s.push(event)
+	}
+}
+
+func (s *Subscription) push(event Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) deliver() {
+	defer close(s.c)
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.c <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
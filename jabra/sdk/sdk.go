@@ -0,0 +1,1001 @@
+// Package sdk implements jabra.Backend on top of libjabra through cgo.
+package sdk
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../headers
+#cgo LDFLAGS: -L${SRCDIR}/../../lib -ljabra
+
+#include "Common.h"
+#include "JabraDeviceConfig.h"
+#include "Interface_AmbienceModes.h"
+#include "JabraNativeHid.h"
+#include "GoWrapper.h"
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// The SDK only supports a single session per process, so the callbacks
+// registered by Initialize are package state shared with the C callbacks.
+var callbacks jabra.Callbacks
+
+// Backend is the libjabra implementation of jabra.Backend.
+type Backend struct{}
+
+func New() *Backend {
+	return &Backend{}
+}
+
+/****************************************************************************/
+/*                             C CALLBACKS	                                */
+/****************************************************************************/
+
+//export firstScanForDevicesDone
+func firstScanForDevicesDone() {
+	if callbacks.FirstScanDone != nil {
+		callbacks.FirstScanDone()
+	}
+}
+
+//export deviceAttachedFunc
+func deviceAttachedFunc(deviceInfo C.Jabra_DeviceInfo) {
+
+	goDeviceInfo := jabra.DeviceInfo{
+		DeviceID:               uint16(deviceInfo.deviceID),
+		ProductID:              uint16(deviceInfo.productID),
+		VendorID:               uint16(deviceInfo.vendorID),
+		DeviceName:             C.GoString(deviceInfo.deviceName),
+		USBDevicePath:          C.GoString(deviceInfo.usbDevicePath),
+		ParentInstanceID:       C.GoString(deviceInfo.parentInstanceId),
+		ErrStatus:              jabra.ErrorStatusCode(deviceInfo.errStatus),
+		IsDongle:               bool(deviceInfo.isDongle),
+		DongleName:             C.GoString(deviceInfo.dongleName),
+		Variant:                C.GoString(deviceInfo.variant),
+		SerialNumber:           C.GoString(deviceInfo.serialNumber),
+		IsInFirmwareUpdateMode: bool(deviceInfo.isInFirmwareUpdateMode),
+		DeviceConnection:       jabra.DeviceConnectionType(deviceInfo.deviceconnection),
+		ConnectionID:           uint32(deviceInfo.connectionId),
+		ParentDeviceID:         uint16(deviceInfo.parentDeviceId),
+	}
+	goDeviceInfo.DeviceEventsMask = getDeviceEventsMask(goDeviceInfo.DeviceID)
+	goDeviceInfo.FeatureFlags = getSupportedFeature(goDeviceInfo.DeviceID)
+	C.Jabra_FreeDeviceInfo(deviceInfo)
+
+	if callbacks.DeviceAttached != nil {
+		callbacks.DeviceAttached(goDeviceInfo)
+	}
+}
+
+//export deviceRemovedFunc
+func deviceRemovedFunc(deviceID uint16) {
+	busylightMu.Lock()
+	delete(busylightListened, deviceID)
+	busylightMu.Unlock()
+
+	if callbacks.DeviceRemoved != nil {
+		callbacks.DeviceRemoved(deviceID)
+	}
+}
+
+//export buttonInDataRawHidFunc
+func buttonInDataRawHidFunc(deviceID C.ushort, usagePage C.ushort, usage C.ushort, buttonInData C.bool) {
+	if callbacks.RawHidInput != nil {
+		callbacks.RawHidInput(uint16(deviceID), uint16(usagePage), uint16(usage), bool(buttonInData))
+	}
+}
+
+//export buttonInDataTranslatedFunc
+func buttonInDataTranslatedFunc(deviceID C.ushort, translatedInData C.Jabra_HidInput, buttonInData C.bool) {
+	if callbacks.HidInput != nil {
+		callbacks.HidInput(uint16(deviceID), jabra.HidInput(translatedInData), bool(buttonInData))
+	}
+}
+
+// The current callback behavior is inconsistent. While the charging status updates as expected,
+// the `levelInPercent` callback is sometimes delayed.
+//
+//export batteryStatusUpdate
+func batteryStatusUpdate(deviceID C.ushort, cBatteryStatus *C.Jabra_BatteryStatus) {
+	if cBatteryStatus == nil {
+		return
+	}
+	batteryStatus := toBatteryStatus(cBatteryStatus)
+	C.Jabra_FreeBatteryStatus(cBatteryStatus)
+
+	if callbacks.BatteryStatusChanged != nil {
+		callbacks.BatteryStatusChanged(uint16(deviceID), batteryStatus)
+	}
+}
+
+//export firmwareProgress
+func firmwareProgress(deviceID C.ushort, eventType C.Jabra_FirmwareEventType, status C.Jabra_FirmwareEventStatus, percentage C.ushort) {
+	if callbacks.FirmwareProgress != nil {
+		callbacks.FirmwareProgress(uint16(deviceID), jabra.FirmwareProgress{
+			Type:       jabra.FirmwareEventType(eventType),
+			Status:     jabra.FirmwareEventStatus(status),
+			Percentage: uint16(percentage),
+		})
+	}
+}
+
+//export settingsChanged
+func settingsChanged(deviceID C.ushort, cSettings *C.DeviceSettings) {
+	if cSettings == nil {
+		return
+	}
+	settings := toSettings(cSettings)
+	C.Jabra_FreeDeviceSettings(cSettings)
+
+	if callbacks.SettingsChanged != nil {
+		callbacks.SettingsChanged(uint16(deviceID), settings)
+	}
+}
+
+//export ambienceChanged
+func ambienceChanged(deviceID C.ushort, event C.Jabra_AmbienceModeChangeEvent) {
+	if callbacks.AmbienceChanged != nil {
+		callbacks.AmbienceChanged(uint16(deviceID), jabra.AmbienceEvent(event))
+	}
+}
+
+// busylightChanged is both the busylight event of every device and the
+// manual busylight listener of a device, only devices listened to are
+// reported.
+//
+//export busylightChanged
+func busylightChanged(deviceID C.ushort, on C.bool) {
+	busylightMu.Lock()
+	listening := busylightListened[uint16(deviceID)]
+	busylightMu.Unlock()
+
+	if listening && callbacks.BusylightChanged != nil {
+		callbacks.BusylightChanged(uint16(deviceID), bool(on))
+	}
+}
+
+/****************************************************************************/
+/*                           GENERAL UTILITES                               */
+/****************************************************************************/
+
+func (b *Backend) Initialize(appID string, cb jabra.Callbacks) error {
+	callbacks = cb
+
+	cAppID := C.CString(appID)
+	C.Jabra_SetAppID(cAppID)
+	defer C.free(unsafe.Pointer(cAppID))
+
+	// Callback parameters: FirstScanForDevicesDoneFunc, DeviceAttachedFunc, DeviceRemovedFunc,
+	// ButtonInDataRawHidFunc, ButtonInDataTranslatedFunc, nonJabraDeviceDetection, configParams
+	if init := C.Jabra_InitializeV2(
+		(*[0]byte)(C.firstScanForDevicesDone),    // Callback for when the initial scan is done
+		(*[0]byte)(C.deviceAttachedFunc),         // Callback for when a device is attached
+		(*[0]byte)(C.deviceRemovedFunc),          // Callback for when a device is removed
+		(*[0]byte)(C.buttonInDataRawHidFunc),     // Callback for raw HID button input
+		(*[0]byte)(C.buttonInDataTranslatedFunc), // Callback for translated button input
+		false,                                    // nonJabraDeviceDetection (not used here)
+		nil,                                      // Additional configuration parameters (not used here)
+	); !init {
+		return fmt.Errorf("failed to initialize Jabra SDK")
+	}
+	C.Jabra_RegisterBatteryStatusUpdateCallbackV2((*[0]byte)(C.batteryStatusUpdate))
+	C.Jabra_RegisterFirmwareProgressCallBack((*[0]byte)(C.firmwareProgress))
+	C.Jabra_RegisterBusylightEvent((*[0]byte)(C.busylightChanged))
+
+	return nil
+}
+
+func (b *Backend) Uninitialize() error {
+	if uninit := C.Jabra_Uninitialize(); !uninit {
+		return fmt.Errorf("failed to uninitialize Jabra SDK")
+	}
+	return nil
+}
+
+func (b *Backend) Version() (string, error) {
+	const bufferSize = 16
+
+	buffer := make([]byte, bufferSize)
+	cBuffer := (*C.char)(unsafe.Pointer(&buffer[0]))
+	if err := jabra.ReturnCode(int(C.Jabra_GetVersion(cBuffer, C.int(bufferSize)))); err != nil {
+		return "", err
+	}
+
+	return C.GoString(cBuffer), nil
+}
+
+func (b *Backend) FactoryReset(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_FactoryReset(C.ushort(deviceID))))
+}
+
+func (b *Backend) FirmwareVersion(deviceID uint16) (string, error) {
+	const bufferSize = 64
+
+	buffer := make([]byte, bufferSize)
+	cBuffer := (*C.char)(unsafe.Pointer(&buffer[0]))
+	if err := jabra.ReturnCode(int(C.Jabra_GetFirmwareVersion(C.ushort(deviceID), cBuffer, C.int(bufferSize)))); err != nil {
+		return "", err
+	}
+
+	return C.GoString(cBuffer), nil
+}
+
+func (b *Backend) PlayRingtone(deviceID uint16, level, ringtoneType uint8) error {
+	return jabra.ReturnCode(int(C.Jabra_PlayRingtone(C.ushort(deviceID), C.uint8_t(level), C.uint8_t(ringtoneType))))
+}
+
+func getSupportedFeature(deviceID uint16) *jabra.FeatureFlags {
+	var count C.uint32_t
+
+	cFeatures := C.Jabra_GetSupportedFeatures(C.ushort(deviceID), &count)
+	if cFeatures == nil {
+		return jabra.NewFeatureFlags(nil)
+	}
+	features := (*[1 << 30]uint32)(unsafe.Pointer(cFeatures))[:count:count]
+	featureFlags := jabra.NewFeatureFlags(features)
+
+	// Free features array
+	C.Jabra_FreeSupportedFeatures(cFeatures)
+
+	return featureFlags
+}
+
+func getDeviceEventsMask(deviceID uint16) uint32 {
+	return uint32(C.Jabra_GetSupportedDeviceEvents(C.ushort(deviceID)))
+}
+
+/****************************************************************************/
+/*                                FIRMWARE                                  */
+/****************************************************************************/
+
+func (b *Backend) FirmwareVersionBundle(deviceID uint16) (*jabra.FirmwareVersionBundle, error) {
+	const bufferSize = C.FIRMWARE_VERSION_MAX_LENGTH
+
+	parent := make([]byte, bufferSize)
+	child := make([]byte, bufferSize)
+	cParent := (*C.char)(unsafe.Pointer(&parent[0]))
+	cChild := (*C.char)(unsafe.Pointer(&child[0]))
+	if err := jabra.ReturnCode(int(C.Jabra_GetFirmwareVersionBundle(C.ushort(deviceID), cParent, cChild, C.int(bufferSize)))); err != nil {
+		return nil, err
+	}
+
+	return &jabra.FirmwareVersionBundle{Parent: C.GoString(cParent), Child: C.GoString(cChild)}, nil
+}
+
+// CheckForFirmwareUpdate maps Firmware_Available and Firmware_UpToDate to
+// the result, they are not errors here.
+func (b *Backend) CheckForFirmwareUpdate(deviceID uint16, authorizationID string) (bool, error) {
+	cAuthorizationID := C.CString(authorizationID)
+	defer C.free(unsafe.Pointer(cAuthorizationID))
+
+	switch err := jabra.ReturnCode(int(C.Jabra_CheckForFirmwareUpdate(C.ushort(deviceID), cAuthorizationID))); err {
+	case jabra.ErrFirmwareAvailable:
+		return true, nil
+	case jabra.ErrFirmwareUpToDate, nil:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (b *Backend) LatestFirmwareInformation(deviceID uint16, authorizationID string) (*jabra.FirmwareInfo, error) {
+	cAuthorizationID := C.CString(authorizationID)
+	defer C.free(unsafe.Pointer(cAuthorizationID))
+
+	cFirmwareInfo := C.Jabra_GetLatestFirmwareInformation(C.ushort(deviceID), cAuthorizationID)
+	if cFirmwareInfo == nil {
+		return nil, jabra.ErrNoInformation
+	}
+	defer C.Jabra_FreeFirmwareInfo(cFirmwareInfo)
+
+	return &jabra.FirmwareInfo{
+		Version:      C.GoString(cFirmwareInfo.version),
+		FileSize:     C.GoString(cFirmwareInfo.fileSize),
+		ReleaseDate:  C.GoString(cFirmwareInfo.releaseDate),
+		Stage:        C.GoString(cFirmwareInfo.stage),
+		ReleaseNotes: goWideString(cFirmwareInfo.releaseNotes),
+	}, nil
+}
+
+// UpdateFirmware maps Return_Async, the update running in the background, to nil.
+func (b *Backend) UpdateFirmware(deviceID uint16, path string) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	if err := jabra.ReturnCode(int(C.Jabra_UpdateFirmware(C.ushort(deviceID), cPath))); err != nil && err != jabra.ErrReturnAsync {
+		return err
+	}
+	return nil
+}
+
+// FirmwareLock has no error to report, Jabra_IsFirmwareLockEnabled reads
+// devices without a lock as unlocked. SetFirmwareLock refuses them.
+func (b *Backend) FirmwareLock(deviceID uint16) (bool, error) {
+	return bool(C.Jabra_IsFirmwareLockEnabled(C.ushort(deviceID))), nil
+}
+
+func (b *Backend) SetFirmwareLock(deviceID uint16, enable bool) error {
+	return jabra.ReturnCode(int(C.Jabra_EnableFirmwareLock(C.ushort(deviceID), C.bool(enable))))
+}
+
+// goWideString copies a NUL terminated wchar_t string, UTF-32 on Linux.
+func goWideString(cString *C.wchar_t) string {
+	if cString == nil {
+		return ""
+	}
+	var runes []rune
+	for p := unsafe.Pointer(cString); *(*C.wchar_t)(p) != 0; p = unsafe.Add(p, C.sizeof_wchar_t) {
+		runes = append(runes, rune(*(*C.wchar_t)(p)))
+	}
+	return string(runes)
+}
+
+/****************************************************************************/
+/*                               BLUETOOTH                                  */
+/****************************************************************************/
+
+func (b *Backend) SetBTPairing(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_SetBTPairing(C.ushort(deviceID))))
+}
+
+func (b *Backend) StopBTPairing(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_StopBTPairing(C.ushort(deviceID))))
+}
+
+func (b *Backend) SearchNewDevices(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_SearchNewDevices(C.ushort(deviceID))))
+}
+
+func (b *Backend) SearchDeviceList(deviceID uint16) *jabra.PairingList {
+	cPairingList := C.Jabra_GetSearchDeviceList(C.ushort(deviceID))
+	if cPairingList == nil {
+		return nil
+	}
+	defer C.Jabra_FreePairingList(cPairingList)
+
+	return toPairingList(cPairingList)
+}
+
+func (b *Backend) PairingList(deviceID uint16) *jabra.PairingList {
+	cPairingList := C.Jabra_GetPairingList(C.ushort(deviceID))
+	if cPairingList == nil {
+		return &jabra.PairingList{
+			Count:         0,
+			ListType:      -1,
+			PairedDevices: make([]jabra.PairedDevice, 0),
+		}
+	}
+	defer C.Jabra_FreePairingList(cPairingList)
+
+	return toPairingList(cPairingList)
+}
+
+func (b *Backend) ConnectNewDevice(deviceID uint16, device jabra.PairedDevice) error {
+	cDevice := toCPairedDevice(device)
+	defer C.free(unsafe.Pointer(cDevice.deviceName))
+
+	return jabra.ReturnCode(int(C.Jabra_ConnectNewDevice(C.ushort(deviceID), &cDevice)))
+}
+
+func (b *Backend) ConnectPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	cDevice := toCPairedDevice(device)
+	defer C.free(unsafe.Pointer(cDevice.deviceName))
+
+	return jabra.ReturnCode(int(C.Jabra_ConnectPairedDevice(C.ushort(deviceID), &cDevice)))
+}
+
+func (b *Backend) DisconnectPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	cDevice := toCPairedDevice(device)
+	defer C.free(unsafe.Pointer(cDevice.deviceName))
+
+	return jabra.ReturnCode(int(C.Jabra_DisConnectPairedDevice(C.ushort(deviceID), &cDevice)))
+}
+
+func (b *Backend) ClearPairedDevice(deviceID uint16, device jabra.PairedDevice) error {
+	cDevice := toCPairedDevice(device)
+	defer C.free(unsafe.Pointer(cDevice.deviceName))
+
+	return jabra.ReturnCode(int(C.Jabra_ClearPairedDevice(C.ushort(deviceID), &cDevice)))
+}
+
+func (b *Backend) ClearPairingList(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_ClearPairingList(C.ushort(deviceID))))
+}
+
+func (b *Backend) ConnectBTDevice(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_ConnectBTDevice(C.ushort(deviceID))))
+}
+
+func (b *Backend) DisconnectBTDevice(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_DisconnectBTDevice(C.ushort(deviceID))))
+}
+
+// toPairingList copies a Jabra_PairingList into Go memory. The caller still
+// owns cPairingList and has to free it.
+func toPairingList(cPairingList *C.Jabra_PairingList) *jabra.PairingList {
+	pairingList := &jabra.PairingList{
+		Count:         uint16(cPairingList.count),
+		ListType:      jabra.DeviceListType(cPairingList.listType),
+		PairedDevices: make([]jabra.PairedDevice, 0, cPairingList.count),
+	}
+	if cPairingList.count == 0 || cPairingList.pairedDevice == nil {
+		return pairingList
+	}
+
+	// safely cast a pointer to an array to a slice of a potentially unknown or large size
+	// with a length and capacity limited to the actual number of items.
+	// Similar to how in Go you might do: arr := [100]int{}; slice := arr[:10:10]
+	// This creates a slice that references the first 10 elements with a capacity of 10
+	cPairedDevices := (*[1 << 30]C.Jabra_PairedDevice)(unsafe.Pointer(cPairingList.pairedDevice))[:cPairingList.count:cPairingList.count]
+	for _, cDevice := range cPairedDevices {
+		bTDevice := jabra.PairedDevice{
+			DeviceName:  C.GoString(cDevice.deviceName),
+			IsConnected: bool(cDevice.isConnected),
+		}
+		copy(bTDevice.DeviceBTAddr[:], C.GoBytes(unsafe.Pointer(&cDevice.deviceBTAddr[0]), 6))
+		pairingList.PairedDevices = append(pairingList.PairedDevices, bTDevice)
+	}
+
+	return pairingList
+}
+
+// toCPairedDevice builds a Jabra_PairedDevice for the SDK. deviceName is
+// allocated with C.CString and must be freed by the caller.
+func toCPairedDevice(device jabra.PairedDevice) C.Jabra_PairedDevice {
+	var cDevice C.Jabra_PairedDevice
+
+	cDevice.deviceName = C.CString(device.DeviceName)
+	cDevice.isConnected = C.bool(device.IsConnected)
+	for j := 0; j < 6; j++ {
+		cDevice.deviceBTAddr[j] = C.uint8_t(device.DeviceBTAddr[j])
+	}
+
+	return cDevice
+}
+
+/****************************************************************************/
+/*                                SETTINGS                                  */
+/****************************************************************************/
+
+// Settings maps a NULL result, a device the SDK has no settings for, to
+// ErrNotSupported.
+func (b *Backend) Settings(deviceID uint16) ([]jabra.Setting, error) {
+	cSettings := C.Jabra_GetSettings(C.ushort(deviceID))
+	if cSettings == nil {
+		return nil, jabra.ErrNotSupported
+	}
+	defer C.Jabra_FreeDeviceSettings(cSettings)
+
+	if err := jabra.CheckErrorStatus(jabra.ErrorStatusCode(cSettings.errStatus)); err != nil {
+		return nil, err
+	}
+	return toSettings(cSettings), nil
+}
+
+// SetSettings writes only the settings given. Device_Rebooted, the device
+// restarting to apply them, maps to nil.
+func (b *Backend) SetSettings(deviceID uint16, settings []jabra.Setting) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	cSettings := toCDeviceSettings(settings)
+	defer freeCDeviceSettings(cSettings)
+
+	err := jabra.ReturnCode(int(C.Jabra_SetSettings(C.ushort(deviceID), cSettings)))
+	if err == jabra.ErrDeviceRebooted {
+		return nil
+	}
+	return err
+}
+
+func (b *Backend) FailedSettingNames(deviceID uint16) []string {
+	cFailed := C.Jabra_GetFailedSettingNames(C.ushort(deviceID))
+	if cFailed == nil {
+		return nil
+	}
+	defer C.Jabra_FreeFailedSettings(cFailed)
+
+	count := int(cFailed.count)
+	if count == 0 || cFailed.settingNames == nil {
+		return nil
+	}
+	names := make([]string, 0, count)
+	for _, cName := range unsafe.Slice(cFailed.settingNames, count) {
+		names = append(names, C.GoString(cName))
+	}
+	return names
+}
+
+// listened holds the settings each device listened to was registered with,
+// they stay owned by jLink until the listener is cancelled.
+var (
+	listenedMu sync.Mutex
+	listened   = make(map[uint16]*C.DeviceSettings)
+)
+
+// ListenSettings listens to all the settings of the device. The SDK only
+// reports the settings it was registered with.
+func (b *Backend) ListenSettings(deviceID uint16, listen bool) error {
+	listenedMu.Lock()
+	defer listenedMu.Unlock()
+
+	if cSettings, ok := listened[deviceID]; ok {
+		C.Jabra_SetSettingsChangeListener(C.ushort(deviceID), nil, nil)
+		C.Jabra_FreeDeviceSettings(cSettings)
+		delete(listened, deviceID)
+	}
+	if !listen {
+		return nil
+	}
+
+	cSettings := C.Jabra_GetSettings(C.ushort(deviceID))
+	if cSettings == nil {
+		return jabra.ErrNotSupported
+	}
+	if err := jabra.CheckErrorStatus(jabra.ErrorStatusCode(cSettings.errStatus)); err != nil {
+		C.Jabra_FreeDeviceSettings(cSettings)
+		return err
+	}
+	if err := jabra.ReturnCode(int(C.Jabra_SetSettingsChangeListener(C.ushort(deviceID), (*[0]byte)(C.settingsChanged), cSettings))); err != nil {
+		C.Jabra_FreeDeviceSettings(cSettings)
+		return err
+	}
+	listened[deviceID] = cSettings
+	return nil
+}
+
+func (b *Backend) SaveSettingsToFile(deviceID uint16, path string) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	return jabra.ReturnCode(int(C.Jabra_SaveSettingsToFile(C.ushort(deviceID), cPath)))
+}
+
+// LoadSettingsFromFile treats FilePartiallyCompatible as success, the
+// settings that did not apply are read with InvalidSettings.
+func (b *Backend) LoadSettingsFromFile(deviceID uint16, path string, mode jabra.SettingsLoadMode) ([]jabra.Setting, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	cSettings := C.Jabra_LoadSettingsFromFile(C.ushort(deviceID), cPath, C.SettingsLoadMode(mode))
+	if cSettings == nil {
+		return nil, jabra.ErrNotSupported
+	}
+	defer C.Jabra_FreeDeviceSettings(cSettings)
+
+	err := jabra.CheckErrorStatus(jabra.ErrorStatusCode(cSettings.errStatus))
+	if err != nil && err != jabra.ErrFilePartiallyCompatible {
+		return nil, err
+	}
+	return toSettings(cSettings), nil
+}
+
+func (b *Backend) InvalidSettings(deviceID uint16) (jabra.InvalidSettings, error) {
+	cInvalid := C.Jabra_GetInvalidSettings(C.ushort(deviceID))
+	if cInvalid == nil {
+		return jabra.InvalidSettings{}, nil
+	}
+	defer C.Jabra_FreeInvalidList(cInvalid)
+
+	if err := jabra.CheckErrorStatus(jabra.ErrorStatusCode(cInvalid.errStatus)); err != nil {
+		return jabra.InvalidSettings{}, err
+	}
+	invalid := jabra.InvalidSettings{FileDeviceName: C.GoString(cInvalid.fileDeviceName)}
+	if cInvalid.invalidCount == 0 || cInvalid.invalidinfo == nil {
+		return invalid, nil
+	}
+	for _, cInfo := range unsafe.Slice(cInvalid.invalidinfo, int(cInvalid.invalidCount)) {
+		invalid.Settings = append(invalid.Settings, jabra.InvalidSetting{
+			GUID:    C.GoString(cInfo.guid),
+			Name:    C.GoString(cInfo.settingName),
+			Message: C.GoString(cInfo.failMessage),
+		})
+	}
+	return invalid, nil
+}
+
+// toSettings copies the settings of a DeviceSettings into Go memory.
+func toSettings(cSettings *C.DeviceSettings) []jabra.Setting {
+	count := int(cSettings.settingCount)
+	settings := make([]jabra.Setting, 0, count)
+	if count == 0 || cSettings.settingInfo == nil {
+		return settings
+	}
+	for _, cSetting := range unsafe.Slice(cSettings.settingInfo, count) {
+		settings = append(settings, toSetting(&cSetting))
+	}
+	return settings
+}
+
+// toSetting copies a SettingInfo into Go memory. Byte values are a single
+// byte behind currValue, string values a NUL terminated string.
+func toSetting(cSetting *C.SettingInfo) jabra.Setting {
+	setting := jabra.Setting{
+		GUID:              C.GoString(cSetting.guid),
+		Name:              C.GoString(cSetting.name),
+		HelpText:          C.GoString(cSetting.helpText),
+		Group:             C.GoString(cSetting.groupName),
+		GroupHelpText:     C.GoString(cSetting.groupHelpText),
+		Control:           jabra.ControlType(cSetting.cntrlType),
+		DataType:          jabra.SettingDataType(cSetting.settingDataType),
+		NeedsRestart:      bool(cSetting.isDeviceRestart),
+		Protected:         bool(cSetting.isSettingProtected),
+		ProtectionEnabled: bool(cSetting.isSettingProtectionEnabled),
+		WirelessConnect:   bool(cSetting.isWirelessConnect),
+		HasDependents:     bool(cSetting.isDepedentsetting),
+		ChildDevice:       bool(cSetting.isChildDeviceSetting),
+	}
+	if cSetting.currValue != nil {
+		switch setting.DataType {
+		case jabra.SettingByte:
+			setting.Key = uint16(*(*C.uint8_t)(cSetting.currValue))
+		case jabra.SettingString:
+			setting.Text = C.GoString((*C.char)(cSetting.currValue))
+		}
+	}
+	if cSetting.listSize > 0 && cSetting.listKeyValue != nil {
+		for _, cOption := range unsafe.Slice(cSetting.listKeyValue, int(cSetting.listSize)) {
+			option := jabra.SettingOption{Key: uint16(cOption.key), Value: C.GoString(cOption.value)}
+			if cOption.dependentcount > 0 && cOption.dependents != nil {
+				for _, cDependent := range unsafe.Slice(cOption.dependents, int(cOption.dependentcount)) {
+					option.Dependents = append(option.Dependents, jabra.SettingDependency{
+						GUID:   C.GoString(cDependent.GUID),
+						Enable: bool(cDependent.enableFlag),
+					})
+				}
+			}
+			setting.Options = append(setting.Options, option)
+		}
+	}
+	if cSetting.isValidationSupport && cSetting.validationRule != nil {
+		setting.Validation = &jabra.ValidationRule{
+			MinLength:    int(cSetting.validationRule.minLength),
+			MaxLength:    int(cSetting.validationRule.maxLength),
+			RegExp:       C.GoString(cSetting.validationRule.regExp),
+			ErrorMessage: C.GoString(cSetting.validationRule.errorMessage),
+		}
+	}
+	return setting
+}
+
+// toCDeviceSettings builds a DeviceSettings for Jabra_SetSettings in C
+// memory, freed with freeCDeviceSettings.
+func toCDeviceSettings(settings []jabra.Setting) *C.DeviceSettings {
+	cSettings := (*C.DeviceSettings)(C.calloc(1, C.sizeof_DeviceSettings))
+	cSettings.settingCount = C.uint(len(settings))
+	cSettings.settingInfo = (*C.SettingInfo)(C.calloc(C.size_t(len(settings)), C.sizeof_SettingInfo))
+
+	cSettingInfos := unsafe.Slice(cSettings.settingInfo, len(settings))
+	for i, setting := range settings {
+		cSetting := &cSettingInfos[i]
+		cSetting.guid = C.CString(setting.GUID)
+		cSetting.name = C.CString(setting.Name)
+		cSetting.groupName = C.CString(setting.Group)
+		cSetting.cntrlType = C.ControlType(setting.Control)
+		cSetting.settingDataType = C.DataType(setting.DataType)
+		cSetting.isChildDeviceSetting = C.bool(setting.ChildDevice)
+		switch setting.DataType {
+		case jabra.SettingByte:
+			value := (*C.uint8_t)(C.malloc(1))
+			*value = C.uint8_t(setting.Key)
+			cSetting.currValue = unsafe.Pointer(value)
+		case jabra.SettingString:
+			cSetting.currValue = unsafe.Pointer(C.CString(setting.Text))
+		}
+	}
+	return cSettings
+}
+
+func freeCDeviceSettings(cSettings *C.DeviceSettings) {
+	for _, cSetting := range unsafe.Slice(cSettings.settingInfo, int(cSettings.settingCount)) {
+		C.free(unsafe.Pointer(cSetting.guid))
+		C.free(unsafe.Pointer(cSetting.name))
+		C.free(unsafe.Pointer(cSetting.groupName))
+		C.free(cSetting.currValue)
+	}
+	C.free(unsafe.Pointer(cSettings.settingInfo))
+	C.free(unsafe.Pointer(cSettings))
+}
+
+func (b *Backend) AutoPairing(deviceID uint16) (bool, error) {
+	return bool(C.Jabra_GetAutoPairing(C.ushort(deviceID))), nil
+}
+
+func (b *Backend) SetAutoPairing(deviceID uint16, enable bool) error {
+	return jabra.ReturnCode(int(C.Jabra_SetAutoPairing(C.ushort(deviceID), C.bool(enable))))
+}
+
+/****************************************************************************/
+/*                                  AUDIO                                   */
+/****************************************************************************/
+
+// maxEqualizerBands is the room given to Jabra_GetEqualizerParameters,
+// devices have five bands.
+const maxEqualizerBands = 16
+
+func (b *Backend) AmbienceModes(deviceID uint16) ([]jabra.AmbienceMode, error) {
+	var cModes [8]C.Jabra_AmbienceMode
+	length := C.size_t(len(cModes))
+	if err := jabra.ReturnCode(int(C.Jabra_GetSupportedAmbienceModes(C.ushort(deviceID), &cModes[0], &length))); err != nil {
+		return nil, err
+	}
+	modes := make([]jabra.AmbienceMode, 0, int(length))
+	for _, cMode := range cModes[:length] {
+		modes = append(modes, jabra.AmbienceMode(cMode))
+	}
+	return modes, nil
+}
+
+func (b *Backend) AmbienceMode(deviceID uint16) (jabra.AmbienceMode, error) {
+	var cMode C.Jabra_AmbienceMode
+	if err := jabra.ReturnCode(int(C.Jabra_GetAmbienceMode(C.ushort(deviceID), &cMode))); err != nil {
+		return 0, err
+	}
+	return jabra.AmbienceMode(cMode), nil
+}
+
+func (b *Backend) SetAmbienceMode(deviceID uint16, mode jabra.AmbienceMode) error {
+	return jabra.ReturnCode(int(C.Jabra_SetAmbienceMode(C.ushort(deviceID), C.Jabra_AmbienceMode(mode))))
+}
+
+func (b *Backend) AmbienceLevels(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	var levels C.uint8_t
+	if err := jabra.ReturnCode(int(C.Jabra_GetSupportedAmbienceModeLevels(C.ushort(deviceID), C.Jabra_AmbienceMode(mode), &levels))); err != nil {
+		return 0, err
+	}
+	return uint8(levels), nil
+}
+
+func (b *Backend) AmbienceLevel(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	var level C.uint8_t
+	if err := jabra.ReturnCode(int(C.Jabra_GetAmbienceModeLevel(C.ushort(deviceID), C.Jabra_AmbienceMode(mode), &level))); err != nil {
+		return 0, err
+	}
+	return uint8(level), nil
+}
+
+func (b *Backend) SetAmbienceLevel(deviceID uint16, mode jabra.AmbienceMode, level uint8) error {
+	return jabra.ReturnCode(int(C.Jabra_SetAmbienceModeLevel(C.ushort(deviceID), C.Jabra_AmbienceMode(mode), C.uint8_t(level))))
+}
+
+func (b *Backend) AmbienceBalanceRange(deviceID uint16, mode jabra.AmbienceMode) (uint8, error) {
+	var balance C.uint8_t
+	if err := jabra.ReturnCode(int(C.Jabra_GetSupportedAmbienceModeBalance(C.ushort(deviceID), C.Jabra_AmbienceMode(mode), &balance))); err != nil {
+		return 0, err
+	}
+	return uint8(balance), nil
+}
+
+func (b *Backend) AmbienceBalance(deviceID uint16, mode jabra.AmbienceMode) (int8, error) {
+	var balance C.int8_t
+	if err := jabra.ReturnCode(int(C.Jabra_GetAmbienceModeBalance(C.ushort(deviceID), C.Jabra_AmbienceMode(mode), &balance))); err != nil {
+		return 0, err
+	}
+	return int8(balance), nil
+}
+
+func (b *Backend) SetAmbienceBalance(deviceID uint16, mode jabra.AmbienceMode, balance int8) error {
+	return jabra.ReturnCode(int(C.Jabra_SetAmbienceModeBalance(C.ushort(deviceID), C.Jabra_AmbienceMode(mode), C.int8_t(balance))))
+}
+
+func (b *Backend) AmbienceLoop(deviceID uint16) ([]jabra.AmbienceMode, error) {
+	var cModes [8]C.Jabra_AmbienceMode
+	length := C.size_t(len(cModes))
+	if err := jabra.ReturnCode(int(C.Jabra_GetAmbienceModeLoop(C.ushort(deviceID), &cModes[0], &length))); err != nil {
+		return nil, err
+	}
+	modes := make([]jabra.AmbienceMode, 0, int(length))
+	for _, cMode := range cModes[:length] {
+		modes = append(modes, jabra.AmbienceMode(cMode))
+	}
+	return modes, nil
+}
+
+// SetAmbienceLoop passes an empty loop as NULL, as the SDK asks.
+func (b *Backend) SetAmbienceLoop(deviceID uint16, modes []jabra.AmbienceMode) error {
+	if len(modes) == 0 {
+		return jabra.ReturnCode(int(C.Jabra_SetAmbienceModeLoop(C.ushort(deviceID), nil, 0)))
+	}
+	cModes := make([]C.Jabra_AmbienceMode, len(modes))
+	for i, mode := range modes {
+		cModes[i] = C.Jabra_AmbienceMode(mode)
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetAmbienceModeLoop(C.ushort(deviceID), &cModes[0], C.size_t(len(cModes)))))
+}
+
+func (b *Backend) ListenAmbience(deviceID uint16, listen bool) error {
+	if !listen {
+		return jabra.ReturnCode(int(C.Jabra_SetAmbienceModeChangeListener(C.ushort(deviceID), nil)))
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetAmbienceModeChangeListener(C.ushort(deviceID), (*[0]byte)(C.ambienceChanged))))
+}
+
+// busylightListened holds the devices whose busylight changes are reported.
+var (
+	busylightMu       sync.Mutex
+	busylightListened = make(map[uint16]bool)
+)
+
+func (b *Backend) Busylight(deviceID uint16) (bool, error) {
+	if C.Jabra_IsManualBusylightSupported(C.ushort(deviceID)) {
+		return bool(C.Jabra_GetManualBusylightStatus(C.ushort(deviceID))), nil
+	}
+	if !C.Jabra_IsBusylightSupported(C.ushort(deviceID)) {
+		return false, jabra.ErrNotSupported
+	}
+	return bool(C.Jabra_GetBusylightStatus(C.ushort(deviceID))), nil
+}
+
+func (b *Backend) SetBusylight(deviceID uint16, on bool) error {
+	if C.Jabra_IsManualBusylightSupported(C.ushort(deviceID)) {
+		value := C.BusyLightValue(C.BUSYLIGHT_OFF)
+		if on {
+			value = C.BUSYLIGHT_ON
+		}
+		return jabra.ReturnCode(int(C.Jabra_SetManualBusylightStatus(C.ushort(deviceID), value)))
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetBusylightStatus(C.ushort(deviceID), C.bool(on))))
+}
+
+// ListenBusylight registers the manual busylight listener of devices that
+// have one, the busylight event registered by Initialize covers the others.
+func (b *Backend) ListenBusylight(deviceID uint16, listen bool) error {
+	busylightMu.Lock()
+	defer busylightMu.Unlock()
+
+	manual := bool(C.Jabra_IsManualBusylightSupported(C.ushort(deviceID)))
+	if !manual && !bool(C.Jabra_IsBusylightSupported(C.ushort(deviceID))) {
+		return jabra.ErrNotSupported
+	}
+	if !listen {
+		delete(busylightListened, deviceID)
+		if manual {
+			return jabra.ReturnCode(int(C.Jabra_RegisterManualBusylightEvent(C.ushort(deviceID), nil)))
+		}
+		return nil
+	}
+	if manual {
+		if err := jabra.ReturnCode(int(C.Jabra_RegisterManualBusylightEvent(C.ushort(deviceID), (*[0]byte)(C.busylightChanged)))); err != nil {
+			return err
+		}
+	}
+	busylightListened[deviceID] = true
+	return nil
+}
+
+func (b *Backend) EqualizerEnabled(deviceID uint16) (bool, error) {
+	if !C.Jabra_IsEqualizerSupported(C.ushort(deviceID)) {
+		return false, jabra.ErrNotSupported
+	}
+	return bool(C.Jabra_IsEqualizerEnabled(C.ushort(deviceID))), nil
+}
+
+func (b *Backend) EnableEqualizer(deviceID uint16, enable bool) error {
+	return jabra.ReturnCode(int(C.Jabra_EnableEqualizer(C.ushort(deviceID), C.bool(enable))))
+}
+
+func (b *Backend) EqualizerBands(deviceID uint16) ([]jabra.EqualizerBand, error) {
+	var cBands [maxEqualizerBands]C.Jabra_EqualizerBand
+	count := C.uint(len(cBands))
+	if err := jabra.ReturnCode(int(C.Jabra_GetEqualizerParameters(C.ushort(deviceID), &cBands[0], &count))); err != nil {
+		return nil, err
+	}
+	bands := make([]jabra.EqualizerBand, 0, int(count))
+	for _, cBand := range cBands[:count] {
+		bands = append(bands, jabra.EqualizerBand{
+			MaxGain:         float32(cBand.max_gain),
+			CenterFrequency: int(cBand.centerFrequency),
+			Gain:            float32(cBand.currentGain),
+		})
+	}
+	return bands, nil
+}
+
+func (b *Backend) SetEqualizerGains(deviceID uint16, gains []float32) error {
+	if len(gains) == 0 {
+		return jabra.ErrReturnParameterFail
+	}
+	cGains := make([]C.float, len(gains))
+	for i, gain := range gains {
+		cGains[i] = C.float(gain)
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetEqualizerParameters(C.ushort(deviceID), &cGains[0], C.uint(len(cGains)))))
+}
+
+/****************************************************************************/
+/*                                TELEPHONY                                 */
+/****************************************************************************/
+
+func (b *Backend) AcquireCallLock(deviceID uint16) error {
+	if err := jabra.ReturnCode(int(C.Jabra_GetLock(C.ushort(deviceID)))); err != nil {
+		return err
+	}
+	// Devices that speak standard HID as well only send events in GN HID.
+	if C.Jabra_IsGnHidStdHidSupported(C.ushort(deviceID)) {
+		return jabra.ReturnCode(int(C.Jabra_SetHidWorkingState(C.ushort(deviceID), C.GN_HID)))
+	}
+	return nil
+}
+
+func (b *Backend) ReleaseCallLock(deviceID uint16) error {
+	return jabra.ReturnCode(int(C.Jabra_ReleaseLock(C.ushort(deviceID))))
+}
+
+func (b *Backend) SetOffHook(deviceID uint16, offHook bool) error {
+	if !C.Jabra_IsOffHookSupported(C.ushort(deviceID)) {
+		return jabra.ErrNotSupported
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetOffHook(C.ushort(deviceID), C.bool(offHook))))
+}
+
+func (b *Backend) SetRinger(deviceID uint16, ringing bool) error {
+	if !C.Jabra_IsRingerSupported(C.ushort(deviceID)) {
+		return jabra.ErrNotSupported
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetRinger(C.ushort(deviceID), C.bool(ringing))))
+}
+
+func (b *Backend) SetMute(deviceID uint16, mute bool) error {
+	if !C.Jabra_IsMuteSupported(C.ushort(deviceID)) {
+		return jabra.ErrNotSupported
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetMute(C.ushort(deviceID), C.bool(mute))))
+}
+
+func (b *Backend) SetHold(deviceID uint16, hold bool) error {
+	if !C.Jabra_IsHoldSupported(C.ushort(deviceID)) {
+		return jabra.ErrNotSupported
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetHold(C.ushort(deviceID), C.bool(hold))))
+}
+
+func (b *Backend) SetOnline(deviceID uint16, online bool) error {
+	if !C.Jabra_IsOnlineSupported(C.ushort(deviceID)) {
+		return jabra.ErrNotSupported
+	}
+	return jabra.ReturnCode(int(C.Jabra_SetOnline(C.ushort(deviceID), C.bool(online))))
+}
+
+/****************************************************************************/
+/*                             BATTERY STATUS                               */
+/****************************************************************************/
+
+func (b *Backend) BatteryStatus(deviceID uint16) (*jabra.BatteryStatus, error) {
+	var cBatteryStatus *C.Jabra_BatteryStatus
+
+	if err := jabra.ReturnCode(int(C.Jabra_GetBatteryStatusV2(C.ushort(deviceID), &cBatteryStatus))); err != nil {
+		return nil, err
+	}
+	defer C.Jabra_FreeBatteryStatus(cBatteryStatus)
+
+	return toBatteryStatus(cBatteryStatus), nil
+}
+
+func toBatteryStatus(cBatteryStatus *C.Jabra_BatteryStatus) *jabra.BatteryStatus {
+	goBatteryStatus := &jabra.BatteryStatus{
+		LevelInPercent:  uint8(cBatteryStatus.levelInPercent),
+		Charging:        bool(cBatteryStatus.charging),
+		BatteryLow:      bool(cBatteryStatus.batteryLow),
+		Component:       jabra.BatteryComponent(cBatteryStatus.component),
+		ExtraUnitsCount: uint32(cBatteryStatus.extraUnitsCount),
+	}
+
+	if cBatteryStatus.extraUnitsCount > 0 && cBatteryStatus.extraUnits != nil {
+		extraUnits := (*[1 << 30]C.Jabra_BatteryStatusUnit)(unsafe.Pointer(cBatteryStatus.extraUnits))[:cBatteryStatus.extraUnitsCount:cBatteryStatus.extraUnitsCount]
+		for _, unit := range extraUnits {
+			goBatteryStatus.ExtraUnits = append(goBatteryStatus.ExtraUnits, jabra.BatteryStatusUnit{
+				LevelInPercent: uint8(unit.levelInPercent),
+				Component:      jabra.BatteryComponent(unit.component),
+			})
+		}
+	}
+
+	return goBatteryStatus
+}
+
+var _ jabra.Backend = (*Backend)(nil)
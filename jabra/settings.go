@@ -0,0 +1,268 @@
+package jabra
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+)
+
+// ControlType mirrors the SDK's ControlType, how a setting is edited.
+type ControlType int
+
+const (
+	ControlRadio ControlType = iota
+	ControlToggle
+	ControlComboBox
+	ControlDropDown
+	ControlLabel
+	ControlTextBox
+	ControlButton
+	ControlEditButton
+	ControlHorizontalRuler
+	ControlPasswordTextBox
+	ControlUnknown
+)
+
+func (c ControlType) String() string {
+	switch c {
+	case ControlRadio:
+		return "radio"
+	case ControlToggle:
+		return "toggle"
+	case ControlComboBox:
+		return "comboBox"
+	case ControlDropDown:
+		return "dropDown"
+	case ControlLabel:
+		return "label"
+	case ControlTextBox:
+		return "textBox"
+	case ControlButton:
+		return "button"
+	case ControlEditButton:
+		return "editButton"
+	case ControlHorizontalRuler:
+		return "horizontalRuler"
+	case ControlPasswordTextBox:
+		return "passwordTextBox"
+	default:
+		return "unknown"
+	}
+}
+
+// SettingDataType mirrors the SDK's DataType, what the value of a setting is.
+type SettingDataType int
+
+const (
+	SettingByte   SettingDataType = iota // the key of one of the Options
+	SettingString                        // free text, see Validation
+)
+
+// ValidationRule restricts the text of a string setting.
+type ValidationRule struct {
+	MinLength    int
+	MaxLength    int
+	RegExp       string
+	ErrorMessage string
+}
+
+// SettingDependency is another setting an option turns on or off.
+type SettingDependency struct {
+	GUID   string
+	Enable bool
+}
+
+// SettingOption is one of the values of a byte setting.
+type SettingOption struct {
+	Key        uint16
+	Value      string
+	Dependents []SettingDependency
+}
+
+// Setting is the Go side of the SDK's SettingInfo, one entry of the
+// dynamic settings of a device.
+type Setting struct {
+	GUID          string
+	Name          string
+	HelpText      string
+	Group         string
+	GroupHelpText string
+	Control       ControlType
+	DataType      SettingDataType
+	// Key is the value of a byte setting, Text the value of a string setting.
+	Key        uint16
+	Text       string
+	Options    []SettingOption
+	Validation *ValidationRule
+	// NeedsRestart is set for settings the device restarts to apply.
+	NeedsRestart bool
+	// Protected settings can only be written while the protection of the
+	// device is off, ProtectionEnabled tells whether it is on.
+	Protected         bool
+	ProtectionEnabled bool
+	WirelessConnect   bool
+	HasDependents     bool
+	ChildDevice       bool
+}
+
+// Kind is how a setting is presented: toggle, list or text, or "" for
+// labels, buttons and rulers, which hold no value.
+func (s Setting) Kind() string {
+	switch {
+	case s.Control == ControlToggle:
+		return "toggle"
+	case s.DataType == SettingString && (s.Control == ControlTextBox || s.Control == ControlPasswordTextBox || s.Control == ControlEditButton):
+		return "text"
+	case s.DataType == SettingByte && len(s.Options) > 0:
+		return "list"
+	default:
+		return ""
+	}
+}
+
+// WriteProtected reports whether writing the setting fails with
+// ErrProtectedSettingWrite.
+func (s Setting) WriteProtected() bool {
+	return s.Protected && s.ProtectionEnabled
+}
+
+// Option returns the option with key.
+func (s Setting) Option(key uint16) (SettingOption, bool) {
+	index := slices.IndexFunc(s.Options, func(option SettingOption) bool { return option.Key == key })
+	if index == -1 {
+		return SettingOption{}, false
+	}
+	return s.Options[index], true
+}
+
+// Value is the current value as shown to the user: the text of a string
+// setting, the name of the option of a byte setting.
+func (s Setting) Value() string {
+	if s.DataType == SettingString {
+		if s.Control == ControlPasswordTextBox && s.Text != "" {
+			return "********"
+		}
+		return s.Text
+	}
+	if option, ok := s.Option(s.Key); ok {
+		return option.Value
+	}
+	return fmt.Sprint(s.Key)
+}
+
+// Validate checks a new value: text against the validation rule of a
+// string setting, or that key is one of the options of a byte setting.
+func (s Setting) Validate(key uint16, text string) error {
+	if s.DataType == SettingByte {
+		if _, ok := s.Option(key); !ok {
+			return fmt.Errorf("%s has no option %d", s.Name, key)
+		}
+		return nil
+	}
+
+	rule := s.Validation
+	if rule == nil {
+		return nil
+	}
+	invalid := func(reason string) error {
+		if rule.ErrorMessage != "" {
+			return fmt.Errorf("%s: %s", s.Name, rule.ErrorMessage)
+		}
+		return fmt.Errorf("%s: %s", s.Name, reason)
+	}
+	length := utf8.RuneCountInString(text)
+	if length < rule.MinLength {
+		return invalid(fmt.Sprintf("at least %d characters", rule.MinLength))
+	}
+	if rule.MaxLength > 0 && length > rule.MaxLength {
+		return invalid(fmt.Sprintf("at most %d characters", rule.MaxLength))
+	}
+	if rule.RegExp != "" {
+		expression, err := regexp.Compile(rule.RegExp)
+		if err != nil {
+			return nil // the device's rule, not ours to enforce
+		}
+		if !expression.MatchString(text) {
+			return invalid(fmt.Sprintf("does not match %s", rule.RegExp))
+		}
+	}
+	return nil
+}
+
+// DisabledSettings returns the GUIDs of the settings the current values of
+// settings turn off.
+func DisabledSettings(settings []Setting) map[string]bool {
+	disabled := make(map[string]bool)
+	for _, setting := range settings {
+		if setting.DataType != SettingByte {
+			continue
+		}
+		option, ok := setting.Option(setting.Key)
+		if !ok {
+			continue
+		}
+		for _, dependent := range option.Dependents {
+			if !dependent.Enable {
+				disabled[dependent.GUID] = true
+			}
+		}
+	}
+	return disabled
+}
+
+// SettingChange is a setting whose value changed, From and To as
+// Setting.Value gives them.
+type SettingChange struct {
+	GUID string
+	Name string
+	From string
+	To   string
+}
+
+// UpdateSettings writes the values of changed, as Callbacks.SettingsChanged
+// reports them, into current and returns the changes. Values are named by
+// the options of current, which a reported setting may lack. Settings that
+// current does not have yet are added.
+func UpdateSettings(current, changed []Setting) ([]Setting, []SettingChange) {
+	var changes []SettingChange
+	for _, setting := range changed {
+		index := slices.IndexFunc(current, func(s Setting) bool { return s.GUID == setting.GUID })
+		if index == -1 {
+			current = append(current, setting)
+			changes = append(changes, SettingChange{GUID: setting.GUID, Name: setting.Name, To: setting.Value()})
+			continue
+		}
+		known := &current[index]
+		from := known.Value()
+		known.Key, known.Text = setting.Key, setting.Text
+		if to := known.Value(); to != from {
+			changes = append(changes, SettingChange{GUID: known.GUID, Name: known.Name, From: from, To: to})
+		}
+	}
+	return current, changes
+}
+
+// SettingsLoadMode mirrors the SDK's SettingsLoadMode, what
+// LoadSettingsFromFile does with the settings of the file.
+type SettingsLoadMode int
+
+const (
+	LoadExpress  SettingsLoadMode = iota // write them to the device
+	LoadRetrieve                         // only return them
+)
+
+// InvalidSetting is a setting of a settings file the device did not take.
+type InvalidSetting struct {
+	GUID    string
+	Name    string
+	Message string
+}
+
+// InvalidSettings is the SDK's InvalidList, the settings of the last file
+// loaded that did not apply.
+type InvalidSettings struct {
+	// FileDeviceName is the device the file was saved from.
+	FileDeviceName string
+	Settings       []InvalidSetting
+}
@@ -0,0 +1,60 @@
+package jabra
+
+import (
+	"fmt"
+	"strings"
+)
+
+var hidInputNames = [...]string{
+	HidUndefined:         "undefined",
+	HidOffHook:           "offHook",
+	HidMute:              "mute",
+	HidFlash:             "flash",
+	HidRedial:            "redial",
+	HidKey0:              "key0",
+	HidKey1:              "key1",
+	HidKey2:              "key2",
+	HidKey3:              "key3",
+	HidKey4:              "key4",
+	HidKey5:              "key5",
+	HidKey6:              "key6",
+	HidKey7:              "key7",
+	HidKey8:              "key8",
+	HidKey9:              "key9",
+	HidKeyStar:           "keyStar",
+	HidKeyPound:          "keyPound",
+	HidKeyClear:          "keyClear",
+	HidOnline:            "online",
+	HidSpeedDial:         "speedDial",
+	HidVoiceMail:         "voiceMail",
+	HidLineBusy:          "lineBusy",
+	HidRejectCall:        "rejectCall",
+	HidOutOfRange:        "outOfRange",
+	HidPseudoOffHook:     "pseudoOffHook",
+	HidButton1:           "button1",
+	HidButton2:           "button2",
+	HidButton3:           "button3",
+	HidVolumeUp:          "volumeUp",
+	HidVolumeDown:        "volumeDown",
+	HidFireAlarm:         "fireAlarm",
+	HidJackConnection:    "jackConnection",
+	HidQdConnection:      "qdConnection",
+	HidHeadsetConnection: "headsetConnection",
+}
+
+func (i HidInput) String() string {
+	if i < 0 || int(i) >= len(hidInputNames) {
+		return "unknown"
+	}
+	return hidInputNames[i]
+}
+
+// ParseHidInput parses the String form of an input, ignoring case.
+func ParseHidInput(input string) (HidInput, error) {
+	for i, name := range hidInputNames {
+		if strings.EqualFold(name, input) {
+			return HidInput(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown HID input %q, expected e.g. offHook, mute, flash or rejectCall", input)
+}
@@ -0,0 +1,216 @@
+package jabra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DeviceInfo is the Go side of Jabra_DeviceInfo. FeatureFlags and
+// DeviceEventsMask are filled in by the backend when the device attaches,
+// BatteryStatus and PairingList are owned by whoever consumes the device.
+type DeviceInfo struct {
+	DeviceID               uint16
+	ProductID              uint16
+	VendorID               uint16
+	DeviceName             string
+	USBDevicePath          string
+	ParentInstanceID       string
+	ErrStatus              ErrorStatusCode
+	IsDongle               bool
+	DongleName             string
+	Variant                string
+	SerialNumber           string
+	IsInFirmwareUpdateMode bool
+	DeviceConnection       DeviceConnectionType
+	ConnectionID           uint32
+	ParentDeviceID         uint16
+	DeviceEventsMask       uint32
+	FeatureFlags           *FeatureFlags
+	BatteryStatus          *BatteryStatus
+	PairingList            *PairingList
+}
+
+type DeviceConnectionType int
+
+const (
+	ConnectionUSB DeviceConnectionType = iota
+	ConnectionBT
+	ConnectionDECT
+)
+
+type BatteryComponent int
+
+const (
+	ComponentUnknown       BatteryComponent = iota // Unable to determine the component.
+	ComponentHeadband                              // Generally applies to headsets with headband that only contains one battery.
+	ComponentCombined                              // For headsets that contains multiple batteries but is not capable of sending each individual state.
+	ComponentRight                                 // The battery in the right unit
+	ComponentLeft                                  // The battery in the left unit
+	ComponentCradle                                // The battery in the cradle
+	ComponentRemoteControl                         // The battery in the remote control
+)
+
+type BatteryStatusUnit struct {
+	LevelInPercent uint8
+	Component      BatteryComponent
+}
+
+type BatteryStatus struct {
+	LevelInPercent  uint8
+	Charging        bool
+	BatteryLow      bool
+	Component       BatteryComponent
+	ExtraUnitsCount uint32 // count of extra units
+	ExtraUnits      []BatteryStatusUnit
+}
+
+// Levels returns the level of every battery the device reports: the main
+// battery under its Component and the extra units (earbuds, cradle, remote
+// control) under theirs.
+func (s *BatteryStatus) Levels() map[BatteryComponent]uint8 {
+	levels := make(map[BatteryComponent]uint8, len(s.ExtraUnits)+1)
+	levels[s.Component] = s.LevelInPercent
+	for _, unit := range s.ExtraUnits {
+		levels[unit.Component] = unit.LevelInPercent
+	}
+	return levels
+}
+
+type DeviceListType int
+
+const (
+	SearchResult DeviceListType = iota
+	PairedDevices
+	SearchComplete
+)
+
+type PairedDevice struct {
+	DeviceName   string
+	DeviceBTAddr [6]byte
+	IsConnected  bool
+}
+
+type PairingList struct {
+	Count         uint16
+	ListType      DeviceListType
+	PairedDevices []PairedDevice
+}
+
+type SecureConnectionMode int
+
+const (
+	LegacyMode     SecureConnectionMode = iota // Normal pairing allowed
+	SecureMode                                 // Device is allowed to connect a audio gateway eg. a mobile phone
+	RestrictedMode                             // Pairing not allowed
+)
+
+type HidInput int
+
+const (
+	HidUndefined HidInput = iota
+	HidOffHook
+	HidMute
+	HidFlash
+	HidRedial
+	HidKey0
+	HidKey1
+	HidKey2
+	HidKey3
+	HidKey4
+	HidKey5
+	HidKey6
+	HidKey7
+	HidKey8
+	HidKey9
+	HidKeyStar
+	HidKeyPound
+	HidKeyClear
+	HidOnline
+	HidSpeedDial
+	HidVoiceMail
+	HidLineBusy
+	HidRejectCall
+	HidOutOfRange
+	HidPseudoOffHook
+	HidButton1
+	HidButton2
+	HidButton3
+	HidVolumeUp
+	HidVolumeDown
+	HidFireAlarm
+	HidJackConnection
+	HidQdConnection
+	HidHeadsetConnection
+)
+
+func (c DeviceConnectionType) String() string {
+	switch c {
+	case ConnectionUSB:
+		return "usb"
+	case ConnectionBT:
+		return "bt"
+	case ConnectionDECT:
+		return "dect"
+	default:
+		return "unknown"
+	}
+}
+
+func (c BatteryComponent) String() string {
+	switch c {
+	case ComponentHeadband:
+		return "headband"
+	case ComponentCombined:
+		return "combined"
+	case ComponentRight:
+		return "right"
+	case ComponentLeft:
+		return "left"
+	case ComponentCradle:
+		return "cradle"
+	case ComponentRemoteControl:
+		return "remoteControl"
+	default:
+		return "unknown"
+	}
+}
+
+func (t DeviceListType) String() string {
+	switch t {
+	case SearchResult:
+		return "searchResult"
+	case PairedDevices:
+		return "pairedDevices"
+	case SearchComplete:
+		return "searchComplete"
+	default:
+		return "unknown"
+	}
+}
+
+// Address formats DeviceBTAddr the way it is printed on the device, e.g. 70:BF:92:12:34:56.
+func (p PairedDevice) Address() string {
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X",
+		p.DeviceBTAddr[0], p.DeviceBTAddr[1], p.DeviceBTAddr[2],
+		p.DeviceBTAddr[3], p.DeviceBTAddr[4], p.DeviceBTAddr[5])
+}
+
+// ParseBTAddr parses a Bluetooth address written as six hex bytes separated by ':' or '-'.
+func ParseBTAddr(addr string) ([6]byte, error) {
+	var btAddr [6]byte
+
+	parts := strings.FieldsFunc(addr, func(r rune) bool { return r == ':' || r == '-' })
+	if len(parts) != len(btAddr) {
+		return btAddr, fmt.Errorf("invalid bluetooth address %q", addr)
+	}
+	for i, part := range parts {
+		b, err := strconv.ParseUint(part, 16, 8)
+		if err != nil || len(part) != 2 {
+			return btAddr, fmt.Errorf("invalid bluetooth address %q", addr)
+		}
+		btAddr[i] = byte(b)
+	}
+
+	return btAddr, nil
+}
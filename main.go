@@ -1,23 +1,90 @@
 package main
 
-/*
-#cgo CFLAGS: -Iheaders
-#cgo LDFLAGS: -Llib -ljabra
-
-#include "Common.h"
-#include "GoWrapper.h"
-#include <stdlib.h>
-*/
-import "C"
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"unsafe"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/Watchdog0x/jLink/daemon"
+	"github.com/Watchdog0x/jLink/internal/alert"
+	"github.com/Watchdog0x/jLink/internal/bus"
+	"github.com/Watchdog0x/jLink/internal/buttons"
+	"github.com/Watchdog0x/jLink/internal/cli"
+	"github.com/Watchdog0x/jLink/internal/config"
+	"github.com/Watchdog0x/jLink/internal/history"
+	"github.com/Watchdog0x/jLink/internal/mpris"
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/fake"
+	"github.com/Watchdog0x/jLink/jabra/registry"
 )
 
 // sudo apt install libasound2 libcurl4
 func main() {
+	simulate := flag.String("simulate", "", "run against simulated devices described by a YAML/JSON scenario file")
+	runDaemon := flag.Bool("daemon", filepath.Base(os.Args[0]) == "jlinkd", "run as jlinkd, serving the devices to other jlink processes")
+	socket := flag.String("socket", daemon.DefaultSocket(), "unix socket of jlinkd")
+	runDBus := flag.Bool("dbus", false, "publish the devices on the D-Bus session bus as "+bus.BusName)
+	configPath := flag.String("config", config.DefaultPath(), "configuration file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: jlink [flags] [command]\n\nWithout a command the interactive UI starts.\n"+
+			"When jlinkd is running jlink uses it instead of opening the devices itself.\n\nFlags:\n")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		cli.Usage(flag.CommandLine.Output())
+	}
+	flag.Parse()
+
+	var (
+		err       error
+		viaDaemon bool
+	)
+	if appConfig, err = config.Load(*configPath); err != nil {
+		log.Fatalln(err)
+	}
+	if *simulate != "" {
+		scenario, err := fake.Load(*simulate)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		backend = fake.New(scenario)
+	} else if client := dialDaemon(*socket, *runDaemon); client != nil {
+		backend = client
+		viaDaemon = true
+	} else if backend, err = newSDKBackend(); err != nil {
+		log.Fatalln(err)
+	}
+
+	if *runDaemon {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := serve(ctx, backend, *socket, *runDBus, openRecorder(*simulate != "", false), appConfig); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	if *runDBus {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := serveDBus(ctx, backend); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := cli.Run(ctx, backend, flag.Args(), os.Stdout, os.Stderr)
+		stop()
+		os.Exit(code)
+	}
 
 	oldSettings, err := enableRawMode()
 	if err != nil {
@@ -27,31 +94,32 @@ func main() {
 	defer restoreTerminal(oldSettings)
 	go startKeysPressedListener()
 
-	appId := C.CString("JabraLink")
-	C.Jabra_SetAppID(appId)
-	defer C.free(unsafe.Pointer(appId))
-
-	// Callback parameters: FirstScanForDevicesDoneFunc, DeviceAttachedFunc, DeviceRemovedFunc,
-	// ButtonInDataRawHidFunc, ButtonInDataTranslatedFunc, nonJabraDeviceDetection, configParams
-	if init := C.Jabra_InitializeV2(
-		nil,                              // FirstScanForDevicesDoneFunc (not used here)
-		(*[0]byte)(C.deviceAttachedFunc), // Callback for when a device is attached
-		(*[0]byte)(C.deviceRemovedFunc),  // Callback for when a device is removed
-		nil,                              // Callback for raw HID button input (not used here)
-		nil,                              // Callback for translated button input (not used here)
-		false,                            // nonJabraDeviceDetection (not used here)
-		nil,                              // Additional configuration parameters (not used here)
-	); !init {
-		log.Fatalln("Failed to initialize Jabra SDK")
-	}
-	defer uninitialize()
-
-	// The current callback behavior is inconsistent. While the charging status updates as expected,
-	// the `levelInPercent` callback is sometimes delayed. This causes issues with timely updates.
-	// We need to ensure that the callback is triggered in a more predictable and consistent manner.
-	// C.Jabra_RegisterBatteryStatusUpdateCallbackV2((*[0]byte)(unsafe.Pointer(C.batteryStatusUpdate)))
-	defer close(stopUpdateBattery)
-	defer close(stopUpdatePairingList)
+	deviceManager = registry.New(backend)
+	go watchDevices(deviceManager.Subscribe())
+	// With jlinkd running the daemon records the history
+	batteryHistory = openRecorder(*simulate != "", viaDaemon)
+	go batteryHistory.Run(context.Background(), deviceManager.Subscribe())
+	// and raises the alerts and does the buttons, here the start menu does
+	// them
+	if !viaDaemon {
+		go raiseAlerts(context.Background(), backend, deviceManager.Subscribe(), appConfig.Alerts, alertFailed)
+		if len(appConfig.Buttons) > 0 {
+			buttonRunner = buttons.New(appConfig.Buttons, backend)
+			// Without a session bus, e.g. over SSH, the media actions
+			// fail, the other buttons work
+			if conn, err := dbus.ConnectSessionBus(); err == nil {
+				buttonRunner.Media = mpris.New(conn)
+			}
+		}
+	}
+	if err := deviceManager.Start("JabraLink"); err != nil {
+		log.Fatalln(err)
+	}
+	defer func() {
+		if err := deviceManager.Stop(); err != nil {
+			fmt.Println(err)
+		}
+	}()
 
 	fmt.Print("\x1b[?25l")       // Hide cursor
 	defer fmt.Print("\x1b[?25h") // Show cursor again
@@ -61,3 +129,200 @@ func main() {
 	fmt.Println("\n\nThank you for using jlink! (ʘ‿ʘ)╯")
 
 }
+
+// dialDaemon connects to a running jlinkd, unless this process is to become jlinkd itself.
+func dialDaemon(socket string, runDaemon bool) *daemon.Client {
+	if runDaemon {
+		return nil
+	}
+	client, err := daemon.Dial(socket)
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// serve runs jlinkd on socket until ctx is done. The daemon records the
+// battery history with recorder, raises the battery alerts of cfg, does its
+// buttons and with withDBus also publishes the devices on the session bus
+// and hands the Bluetooth batteries to BlueZ, all as a client of itself.
+func serve(ctx context.Context, backend jabra.Backend, socket string, withDBus bool, recorder *history.Recorder, cfg *config.Config) error {
+	listener, err := daemon.Listen(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	server := daemon.NewServer(backend)
+	if err := server.Start(); err != nil {
+		listener.Close()
+		return err
+	}
+	defer server.Stop()
+
+	go func() {
+		client, err := daemon.Dial(socket)
+		if err == nil {
+			err = recordHistory(ctx, client, recorder)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	go func() {
+		client, err := daemon.Dial(socket)
+		if err == nil {
+			err = watchAlerts(ctx, client, cfg.Alerts)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if len(cfg.Buttons) > 0 {
+		go func() {
+			client, err := daemon.Dial(socket)
+			if err == nil {
+				err = pressButtons(ctx, client, cfg.Buttons)
+			}
+			if err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	if withDBus {
+		go func() {
+			client, err := daemon.Dial(socket)
+			if err == nil {
+				err = serveDBus(ctx, client)
+			}
+			if err != nil {
+				log.Println(err)
+			}
+		}()
+		go func() {
+			client, err := daemon.Dial(socket)
+			if err == nil {
+				err = provideBatteries(ctx, client)
+			}
+			if err != nil {
+				log.Println("Bluetooth batteries:", err)
+			}
+		}()
+	}
+
+	log.Printf("jlinkd listening on %s", socket)
+	return server.Serve(ctx, listener)
+}
+
+// serveDBus publishes the devices on the session bus until ctx is done.
+func serveDBus(ctx context.Context, backend jabra.Backend) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return bus.New(conn, backend).Serve(ctx)
+}
+
+// provideBatteries hands the batteries of the headsets connected to the
+// computer's Bluetooth adapter to BlueZ on the system bus until ctx is done.
+func provideBatteries(ctx context.Context, backend jabra.Backend) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return bus.NewBatteryProvider(conn, backend).Serve(ctx)
+}
+
+// openRecorder opens the battery history. Simulated devices are only kept in
+// memory, readOnly follows a history another process writes.
+func openRecorder(simulated, readOnly bool) *history.Recorder {
+	var store *history.Store
+	if !simulated {
+		store = history.NewStore(history.DefaultDir())
+	}
+
+	recorder, err := history.NewRecorder(store)
+	if err != nil {
+		log.Println(err)
+		recorder, _ = history.NewRecorder(nil)
+	}
+	recorder.ReadOnly = readOnly
+	return recorder
+}
+
+// recordHistory records the battery changes of backend until ctx is done.
+func recordHistory(ctx context.Context, backend jabra.Backend, recorder *history.Recorder) error {
+	devices := registry.New(backend)
+	subscription := devices.Subscribe()
+	if err := devices.Start("JabraLink"); err != nil {
+		subscription.Close()
+		return err
+	}
+	defer devices.Stop()
+
+	recorder.Run(ctx, subscription)
+	return nil
+}
+
+// watchAlerts raises the battery alerts of cfg for the devices of backend
+// until ctx is done.
+func watchAlerts(ctx context.Context, backend jabra.Backend, cfg config.Alerts) error {
+	devices := registry.New(backend)
+	subscription := devices.Subscribe()
+	if err := devices.Start("JabraLink"); err != nil {
+		subscription.Close()
+		return err
+	}
+	defer devices.Stop()
+
+	raiseAlerts(ctx, backend, subscription, cfg, func(err error) { log.Println("battery alerts:", err) })
+	return nil
+}
+
+// pressButtons does what cfg maps the buttons of the devices of backend to
+// until ctx is done.
+func pressButtons(ctx context.Context, backend jabra.Backend, cfg map[string]config.Button) error {
+	devices := registry.New(backend)
+	subscription := devices.Subscribe()
+	if err := devices.Start("JabraLink"); err != nil {
+		subscription.Close()
+		return err
+	}
+	defer devices.Stop()
+
+	runner := buttons.New(cfg, backend)
+	// The media actions fail without a session bus, the others work
+	if conn, err := dbus.ConnectSessionBus(); err == nil {
+		defer conn.Close()
+		runner.Media = mpris.New(conn)
+	}
+	runner.Run(ctx, subscription)
+	return nil
+}
+
+// raiseAlerts raises the battery alerts of cfg for the events of subscription
+// until ctx is done, onError is given what failed. Notifications go to the
+// desktop over the session bus; without one, e.g. over SSH, the other alerts
+// are still raised.
+func raiseAlerts(ctx context.Context, backend jabra.Backend, subscription *registry.Subscription, cfg config.Alerts, onError func(error)) {
+	var notifier alert.Notifier
+	if cfg.Notifications {
+		if conn, err := dbus.ConnectSessionBus(); err != nil {
+			onError(fmt.Errorf("no desktop notifications: %w", err))
+		} else {
+			defer conn.Close()
+			notifier = alert.NewDesktopNotifier(conn)
+		}
+	}
+
+	monitor := alert.New(cfg, notifier, backend)
+	monitor.OnError = onError
+	monitor.Run(ctx, subscription)
+}
@@ -0,0 +1,523 @@
+// Package schema defines the JSON documents jlink prints with --output json
+// and streams with --output ndjson --watch. Field names and meanings only
+// change together with Version.
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Watchdog0x/jLink/jabra"
+)
+
+// Version is the schema version written to every document.
+const Version = 1
+
+// Device describes an attached dongle or headset.
+type Device struct {
+	ID                 uint16   `json:"id"`
+	Name               string   `json:"name"`
+	Serial             string   `json:"serial"`
+	VendorID           uint16   `json:"vendorId"`
+	ProductID          uint16   `json:"productId"`
+	Variant            string   `json:"variant,omitempty"`
+	Dongle             bool     `json:"dongle"`
+	Connection         string   `json:"connection"` // usb, bt or dect
+	FirmwareUpdateMode bool     `json:"firmwareUpdateMode"`
+	FirmwareVersion    string   `json:"firmwareVersion,omitempty"`
+	Features           []string `json:"features"` // FeatureFlags set on the device, in lowerCamelCase
+}
+
+// DeviceRef identifies the device another document is about.
+type DeviceRef struct {
+	ID     uint16 `json:"id"`
+	Name   string `json:"name"`
+	Serial string `json:"serial"`
+}
+
+type Battery struct {
+	Device         DeviceRef     `json:"device"`
+	LevelInPercent uint8         `json:"levelInPercent"`
+	Charging       bool          `json:"charging"`
+	BatteryLow     bool          `json:"batteryLow"`
+	Component      string        `json:"component"`
+	ExtraUnits     []BatteryUnit `json:"extraUnits"`
+}
+
+type BatteryUnit struct {
+	Component      string `json:"component"`
+	LevelInPercent uint8  `json:"levelInPercent"`
+}
+
+type PairedDevice struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+}
+
+type PairingList struct {
+	Dongle   DeviceRef      `json:"dongle"`
+	ListType string         `json:"listType"` // pairedDevices, searchResult or searchComplete
+	Devices  []PairedDevice `json:"devices"`
+}
+
+// Documents printed by the read commands.
+
+type DeviceList struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Devices       []Device `json:"devices"`
+}
+
+type BatteryList struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Batteries     []Battery `json:"batteries"`
+}
+
+// BatteryHistory is printed by `battery --history`.
+type BatteryHistory struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Devices       []DeviceHistory `json:"devices"`
+}
+
+// DeviceHistory is the recorded battery history of one headset. Rates are
+// in percent per hour and zero until enough has been recorded.
+type DeviceHistory struct {
+	Name           string  `json:"name"`
+	Serial         string  `json:"serial"`
+	LevelInPercent uint8   `json:"levelInPercent"` // last recorded
+	Charging       bool    `json:"charging"`
+	DischargeRate  float64 `json:"dischargeRate"`
+	ChargeRate     float64 `json:"chargeRate"`
+	// RemainingMinutes is the estimated time until empty, or full while
+	// charging, when there is a rate for it.
+	RemainingMinutes *int         `json:"remainingMinutes,omitempty"`
+	Days             []HistoryDay `json:"days"`
+}
+
+// HistoryDay has the level at the end of every hour, -1 when unknown.
+type HistoryDay struct {
+	Date  string  `json:"date"` // YYYY-MM-DD
+	Hours [24]int `json:"hours"`
+}
+
+type PairingListDocument struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	PairingList   PairingList `json:"pairingList"`
+}
+
+// SearchResult is streamed by `pair search --output ndjson` for every device found.
+type SearchResult struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Dongle        DeviceRef    `json:"dongle"`
+	Device        PairedDevice `json:"device"`
+}
+
+// Firmware is the firmware of one device, printed by `firmware info`.
+type Firmware struct {
+	Device  DeviceRef `json:"device"`
+	Version string    `json:"version"`
+	// ChildVersion is the firmware of the headset connected to a dongle or
+	// base station, when the SDK reports it.
+	ChildVersion string `json:"childVersion,omitempty"`
+	UpdateMode   bool   `json:"updateMode"`
+	// An update of the device is finished by turning it off and on again,
+	// or by putting it in its cradle.
+	NeedsPowerCycle bool `json:"needsPowerCycle"`
+	NeedsCradle     bool `json:"needsCradle"`
+}
+
+type FirmwareList struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	Devices       []Firmware `json:"devices"`
+}
+
+// FirmwareRelease is the latest firmware of a device, printed by `firmware check`.
+type FirmwareRelease struct {
+	Device          DeviceRef `json:"device"`
+	Version         string    `json:"version"`
+	Latest          string    `json:"latest"`
+	UpdateAvailable bool      `json:"updateAvailable"`
+	ReleaseDate     string    `json:"releaseDate,omitempty"`
+	Stage           string    `json:"stage,omitempty"`
+	ReleaseNotes    string    `json:"releaseNotes,omitempty"`
+}
+
+type FirmwareReleaseList struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Releases      []FirmwareRelease `json:"releases"`
+}
+
+// FirmwareProgress is streamed by `firmware update --output ndjson`.
+type FirmwareProgress struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Device        DeviceRef `json:"device"`
+	Status        string    `json:"status"` // initiating, inProgress, completed, or the failure
+	Percentage    uint16    `json:"percentage"`
+}
+
+// FirmwareUpdate is printed once `firmware update` completes.
+type FirmwareUpdate struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Device        DeviceRef `json:"device"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	Downgrade     bool      `json:"downgrade"`
+	FollowUps     []string  `json:"followUps"`
+}
+
+// FirmwarePackage is a package of the offline firmware repository.
+type FirmwarePackage struct {
+	File      string `json:"file"`
+	ProductID uint16 `json:"productId"`
+	Variant   string `json:"variant,omitempty"`
+	Version   string `json:"version"`
+	// Status compares the package with the installed firmware: newer,
+	// installed or older. Empty when no device is involved.
+	Status string `json:"status,omitempty"`
+}
+
+// DevicePackages are the packages of the repository that fit a device,
+// printed by `firmware packages`.
+type DevicePackages struct {
+	Device   DeviceRef         `json:"device"`
+	Version  string            `json:"version"`
+	Packages []FirmwarePackage `json:"packages"`
+}
+
+type FirmwarePackageList struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Repository    string           `json:"repository"`
+	Devices       []DevicePackages `json:"devices"`
+}
+
+// FirmwarePackageAdded is printed by `firmware add`.
+type FirmwarePackageAdded struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Repository    string          `json:"repository"`
+	Package       FirmwarePackage `json:"package"`
+}
+
+// FirmwareLock is whether a device takes other firmware, printed by
+// `firmware lock status`.
+type FirmwareLock struct {
+	Device DeviceRef `json:"device"`
+	Locked bool      `json:"locked"`
+}
+
+type FirmwareLockList struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Devices       []FirmwareLock `json:"devices"`
+}
+
+// SettingChange is a setting `settings import` changed, or would change.
+type SettingChange struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// InvalidSetting is a setting of a file the device cannot take.
+type InvalidSetting struct {
+	GUID    string `json:"guid,omitempty"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// SettingsExport is printed by `settings export`.
+type SettingsExport struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Device        DeviceRef `json:"device"`
+	File          string    `json:"file"`
+	Format        string    `json:"format"`   // yaml or sdk
+	Settings      int       `json:"settings"` // settings written, 0 for the sdk format
+}
+
+// SettingsImport is printed by `settings import`. In retrieve mode the
+// changes are not written.
+type SettingsImport struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Device        DeviceRef        `json:"device"`
+	File          string           `json:"file"`
+	Mode          string           `json:"mode"` // express or retrieve
+	Changes       []SettingChange  `json:"changes"`
+	Invalid       []InvalidSetting `json:"invalid"`
+	Failed        []string         `json:"failed"` // names of settings the device refused to write
+}
+
+// SettingDifference is a setting two sides of `settings diff` disagree on,
+// A or B is null when that side does not have the setting.
+type SettingDifference struct {
+	GUID string  `json:"guid,omitempty"`
+	Name string  `json:"name"`
+	A    *string `json:"a"`
+	B    *string `json:"b"`
+}
+
+// SettingsDiff is printed by `settings diff`. A and B are the serial number
+// of a device or the path of a file, Invalid lists the settings of a file
+// the device on the other side cannot take.
+type SettingsDiff struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	A             string              `json:"a"`
+	B             string              `json:"b"`
+	Differences   []SettingDifference `json:"differences"`
+	Invalid       []InvalidSetting    `json:"invalid"`
+}
+
+// SettingChanged is streamed by `settings watch` for every setting that
+// changes on a device.
+type SettingChanged struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Device        DeviceRef `json:"device"`
+	GUID          string    `json:"guid"`
+	Name          string    `json:"name"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+}
+
+// StateChange is a property of a device that differs from jlink.yaml.
+type StateChange struct {
+	Property string `json:"property"` // autoPairing, ambience, busylight, equalizer, equalizerGains or setting
+	Name     string `json:"name"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Error    string `json:"error,omitempty"` // why apply could not make the change
+}
+
+// DevicePlan are the changes that bring a device to its desired state,
+// Invalid what of that state the device cannot take.
+type DevicePlan struct {
+	Device  DeviceRef        `json:"device"`
+	Changes []StateChange    `json:"changes"`
+	Invalid []InvalidSetting `json:"invalid"`
+}
+
+// Plan is printed by `plan`, and by `apply` with Applied set.
+type Plan struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Config        string       `json:"config"`
+	Applied       bool         `json:"applied"`
+	Devices       []DevicePlan `json:"devices"`
+}
+
+// Drift is streamed by `apply --watch` when an attached device is brought
+// to its desired state. Action is applied for a device seen for the first
+// time, reverted or reported for one that drifted away from it. Invalid is
+// only set the first time.
+type Drift struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Time          time.Time        `json:"time"`
+	Device        DeviceRef        `json:"device"`
+	Action        string           `json:"action"`
+	Changes       []StateChange    `json:"changes"`
+	Invalid       []InvalidSetting `json:"invalid"`
+}
+
+// AmbienceModeState is a mode of a device with its level and left-right
+// balance, null for modes without them. Level goes from 0, the strongest,
+// to MaxLevel, Balance from -MaxBalance, all left, to MaxBalance.
+type AmbienceModeState struct {
+	Mode       string `json:"mode"`
+	Level      *int   `json:"level"`
+	MaxLevel   *int   `json:"maxLevel"`
+	Balance    *int   `json:"balance"`
+	MaxBalance *int   `json:"maxBalance"`
+}
+
+// Ambience is printed by `anc get`, and streamed by `anc get --output
+// ndjson --watch` every time the device reports a change. Loop is null for
+// devices without a button loop.
+type Ambience struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	Time          time.Time           `json:"time"`
+	Device        DeviceRef           `json:"device"`
+	Mode          string              `json:"mode"`
+	Modes         []AmbienceModeState `json:"modes"`
+	Loop          []string            `json:"loop"`
+}
+
+// EqualizerBand is a band of an equalizer, or of a preset, which leaves
+// MaxGain out. Gains are in dB, a band takes -MaxGain to MaxGain.
+type EqualizerBand struct {
+	Frequency int      `json:"frequency"` // Hz
+	Gain      float32  `json:"gain"`
+	MaxGain   *float32 `json:"maxGain,omitempty"`
+}
+
+// Equalizer is printed by `equalizer get`.
+type Equalizer struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Device        DeviceRef       `json:"device"`
+	Enabled       bool            `json:"enabled"`
+	Bands         []EqualizerBand `json:"bands"`
+}
+
+type EqualizerPreset struct {
+	Name  string          `json:"name"`
+	Bands []EqualizerBand `json:"bands"`
+}
+
+// EqualizerPresets is printed by `equalizer presets`.
+type EqualizerPresets struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	File          string            `json:"file"`
+	Presets       []EqualizerPreset `json:"presets"`
+}
+
+// Busylight is printed by `busylight status`, streamed by `busylight status
+// --output ndjson --watch` every time the busylight changes, and by
+// `busylight auto` every time it turns the busylight on or off. Source is the
+// presence source that made auto turn it, and left out otherwise.
+type Busylight struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Device        DeviceRef `json:"device"`
+	On            bool      `json:"on"`
+	Source        string    `json:"source,omitempty"`
+}
+
+// CallState is streamed by `call bridge` every time the call changes. Event
+// is what changed it, Button is set when the button of the device asked for
+// it rather than the softphone.
+type CallState struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Device        DeviceRef `json:"device"`
+	Event         string    `json:"event"`
+	State         string    `json:"state"`
+	Button        bool      `json:"button"`
+}
+
+// ButtonInput is streamed by `buttons watch` for every button pressed or
+// released on a device. Input is the hidInput name of the button, Value is
+// true for a press and for offHook the hook state asked for. Inputs printed
+// raw, with --raw, have the HID UsagePage and Usage instead of Input.
+type ButtonInput struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Device        DeviceRef `json:"device"`
+	Input         string    `json:"input,omitempty"`
+	UsagePage     uint16    `json:"usagePage,omitempty"`
+	Usage         uint16    `json:"usage,omitempty"`
+	Value         bool      `json:"value"`
+}
+
+type SDKVersion struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	SDKVersion    string `json:"sdkVersion"`
+}
+
+type EventType string
+
+const (
+	EventAttached    EventType = "attached"
+	EventRemoved     EventType = "removed"
+	EventBattery     EventType = "battery"
+	EventPairingList EventType = "pairingList"
+)
+
+// Event is one line of the --watch stream. Device is always set, Battery
+// and PairingList only for their event types.
+type Event struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Time          time.Time    `json:"time"`
+	Type          EventType    `json:"type"`
+	Device        Device       `json:"device"`
+	Battery       *Battery     `json:"battery,omitempty"`
+	PairingList   *PairingList `json:"pairingList,omitempty"`
+}
+
+func NewDevice(deviceInfo jabra.DeviceInfo, firmwareVersion string) Device {
+	return Device{
+		ID:                 deviceInfo.DeviceID,
+		Name:               deviceInfo.DeviceName,
+		Serial:             deviceInfo.SerialNumber,
+		VendorID:           deviceInfo.VendorID,
+		ProductID:          deviceInfo.ProductID,
+		Variant:            deviceInfo.Variant,
+		Dongle:             deviceInfo.IsDongle,
+		Connection:         deviceInfo.DeviceConnection.String(),
+		FirmwareUpdateMode: deviceInfo.IsInFirmwareUpdateMode,
+		FirmwareVersion:    firmwareVersion,
+		Features:           Features(deviceInfo.FeatureFlags),
+	}
+}
+
+func NewDeviceRef(deviceInfo jabra.DeviceInfo) DeviceRef {
+	return DeviceRef{
+		ID:     deviceInfo.DeviceID,
+		Name:   deviceInfo.DeviceName,
+		Serial: deviceInfo.SerialNumber,
+	}
+}
+
+func NewBattery(deviceInfo jabra.DeviceInfo, batteryStatus *jabra.BatteryStatus) Battery {
+	battery := Battery{
+		Device:         NewDeviceRef(deviceInfo),
+		LevelInPercent: batteryStatus.LevelInPercent,
+		Charging:       batteryStatus.Charging,
+		BatteryLow:     batteryStatus.BatteryLow,
+		Component:      batteryStatus.Component.String(),
+		ExtraUnits:     make([]BatteryUnit, 0, len(batteryStatus.ExtraUnits)),
+	}
+	for _, unit := range batteryStatus.ExtraUnits {
+		battery.ExtraUnits = append(battery.ExtraUnits, BatteryUnit{
+			Component:      unit.Component.String(),
+			LevelInPercent: unit.LevelInPercent,
+		})
+	}
+	return battery
+}
+
+func NewPairingList(dongle jabra.DeviceInfo, pairingList *jabra.PairingList) PairingList {
+	list := PairingList{
+		Dongle:   NewDeviceRef(dongle),
+		ListType: pairingList.ListType.String(),
+		Devices:  make([]PairedDevice, 0, len(pairingList.PairedDevices)),
+	}
+	for _, device := range pairingList.PairedDevices {
+		list.Devices = append(list.Devices, NewPairedDevice(device))
+	}
+	return list
+}
+
+func NewPairedDevice(device jabra.PairedDevice) PairedDevice {
+	return PairedDevice{
+		Name:      device.DeviceName,
+		Address:   device.Address(),
+		Connected: device.IsConnected,
+	}
+}
+
+// Features lists the names of the flags set in featureFlags, with the first
+// letter lower-cased (e.g. "pairingList").
+func Features(featureFlags *jabra.FeatureFlags) []string {
+	features := make([]string, 0)
+	if featureFlags == nil {
+		return features
+	}
+
+	flags := reflect.ValueOf(featureFlags).Elem()
+	for i := 0; i < flags.NumField(); i++ {
+		if flags.Field(i).Bool() {
+			features = append(features, lowerFirst(flags.Type().Field(i).Name))
+		}
+	}
+	return features
+}
+
+func lowerFirst(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	// Keep acronyms such as FFANC or WLAN readable: lower the whole leading run.
+	upper := size
+	for upper < len(name) && unicode.IsUpper(rune(name[upper])) &&
+		(upper+1 == len(name) || unicode.IsUpper(rune(name[upper+1]))) {
+		upper++
+	}
+	return string(unicode.ToLower(r)) + strings.ToLower(name[size:upper]) + name[upper:]
+}
@@ -0,0 +1,17 @@
+package schema
+
+import "testing"
+
+func TestLowerFirst(t *testing.T) {
+	for name, want := range map[string]string{
+		"PairingList":                 "pairingList",
+		"FFANC":                       "ffanc",
+		"AMASupport":                  "amaSupport",
+		"WLANAuthenticationMSCHAPv2":  "wlanAuthenticationMSCHAPv2",
+		"NeedsExplicitRebootAfterOta": "needsExplicitRebootAfterOta",
+	} {
+		if got := lowerFirst(name); got != want {
+			t.Errorf("lowerFirst(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
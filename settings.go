@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/Watchdog0x/jLink/jabra"
+	"github.com/Watchdog0x/jLink/jabra/registry"
+)
+
+// settingEdit is a change to a setting that is not applied yet: the option
+// being chosen for a list, or the text being typed.
+type settingEdit struct {
+	guid string
+	key  uint16
+	text []rune
+}
+
+var (
+	// The dynamic settings of the selected headset, read when its settings
+	// menu opens and after every change. Menu items of settings have the id
+	// index+1, group headings -1 and the firmware lock 0.
+	headsetSettingsMenu = []menuItem{}
+	headsetSettingsList []jabra.Setting
+	disabledSettings    map[string]bool
+
+	settingEditor *settingEdit
+	// settingsMessage is the outcome of the last change, shown under the
+	// list until the cursor moves
+	settingsMessage    string
+	settingsMessageFor int
+
+	// settingsStale is set when the selected headset reports a changed
+	// setting, the menu reads the settings again when it is drawn next
+	settingsStale atomic.Bool
+	// showSettingsLog shows the change log of the headset instead of the
+	// settings
+	showSettingsLog bool
+)
+
+/****************************************************************************/
+/*                             HEADSET SETTINGS                             */
+/****************************************************************************/
+
+// loadHeadsetSettings reads the settings of the selected headset. Reading
+// them can take a while, the SDK fetches their description on first use.
+func loadHeadsetSettings() {
+	headsetSettingsList, disabledSettings = nil, nil
+
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+	settings, err := backend.Settings(headset.DeviceID)
+	if err != nil && !errors.Is(err, jabra.ErrNotSupported) {
+		showSettingsMessage("Settings of %s: %s", headset.DeviceName, err)
+	}
+	headsetSettingsList = settings
+	disabledSettings = jabra.DisabledSettings(settings)
+}
+
+// settingsChanged handles a setting changed on a headset, by its user,
+// another application or this menu.
+func settingsChanged(event registry.Event) {
+	selectionMu.Lock()
+	selected := event.Key == selectedHeadset
+	selectionMu.Unlock()
+
+	if selected {
+		settingsStale.Store(true)
+	}
+}
+
+func updateHeadsetSettingsMenu() {
+	headsetSettingsMenu = []menuItem{}
+
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+	if item, supported := firmwareLockItem(0, headset); supported {
+		headsetSettingsMenu = append(headsetSettingsMenu, item)
+	}
+
+	// Settings of a group are listed together, groups in the order the
+	// device first names them
+	var groups []string
+	for _, setting := range headsetSettingsList {
+		if !slices.Contains(groups, setting.Group) {
+			groups = append(groups, setting.Group)
+		}
+	}
+	for _, group := range groups {
+		if group != "" {
+			headsetSettingsMenu = append(headsetSettingsMenu, menuItem{id: -1, label: "\033[1m" + group + "\033[22m"})
+		}
+		for i, setting := range headsetSettingsList {
+			if setting.Group == group && setting.Kind() != "" {
+				headsetSettingsMenu = append(headsetSettingsMenu, menuItem{id: i + 1, label: settingLabel(setting)})
+			}
+		}
+	}
+}
+
+// settingLabel shows the value of setting, its type and whatever keeps it
+// from being changed.
+func settingLabel(setting jabra.Setting) string {
+	label := fmt.Sprintf("  %s: %s  (%s", setting.Name, setting.Value(), setting.Kind())
+	if setting.WriteProtected() {
+		label += ", protected"
+	}
+	if disabledSettings[setting.GUID] {
+		label += ", turned off by another setting"
+	}
+	if setting.NeedsRestart {
+		label += ", restarts the headset"
+	}
+	return label + ")"
+}
+
+// selectedSetting returns the setting under the cursor.
+func selectedSetting() (jabra.Setting, bool) {
+	if currentSelection >= len(headsetSettingsMenu) {
+		return jabra.Setting{}, false
+	}
+	index := headsetSettingsMenu[currentSelection].id - 1
+	if index < 0 || index >= len(headsetSettingsList) {
+		return jabra.Setting{}, false
+	}
+	return headsetSettingsList[index], true
+}
+
+// editing returns the change to the setting under the cursor, moving the
+// cursor drops it.
+func editing() (*settingEdit, jabra.Setting, bool) {
+	setting, ok := selectedSetting()
+	if !ok || settingEditor == nil || settingEditor.guid != setting.GUID {
+		settingEditor = nil
+		return nil, jabra.Setting{}, false
+	}
+	return settingEditor, setting, true
+}
+
+func editingSettingText() bool {
+	edit, _, ok := editing()
+	return ok && edit.text != nil
+}
+
+// cancelSettingEdit drops the change being made, it reports whether there
+// was one.
+func cancelSettingEdit() bool {
+	_, _, ok := editing()
+	settingEditor = nil
+	return ok
+}
+
+// activateHeadsetSetting handles Enter: a toggle flips, a list starts or
+// ends choosing an option, a text starts being typed.
+func activateHeadsetSetting() {
+	if currentSelection < len(headsetSettingsMenu) && headsetSettingsMenu[currentSelection].id == 0 {
+		if headset, exists := getSelectedHeadset(); exists {
+			if err := toggleFirmwareLock(headset); err != nil {
+				showSettingsMessage("Firmware lock: %s", err)
+			}
+		}
+		updateHeadsetSettingsMenu()
+		return
+	}
+
+	setting, ok := selectedSetting()
+	if !ok {
+		return
+	}
+	if edit, _, editing := editing(); editing {
+		setting.Key = edit.key
+		if edit.text != nil {
+			setting.Text = string(edit.text)
+		}
+		if err := setting.Validate(setting.Key, setting.Text); err != nil {
+			showSettingsMessage("%s", err)
+			return
+		}
+		settingEditor = nil
+		applySetting(setting)
+		return
+	}
+
+	switch {
+	case setting.WriteProtected():
+		showSettingsMessage("%s is protected", setting.Name)
+	case disabledSettings[setting.GUID]:
+		showSettingsMessage("%s is turned off by another setting", setting.Name)
+	case setting.Kind() == "toggle":
+		setting.Key = nextOption(setting, setting.Key, 1)
+		applySetting(setting)
+	case setting.Kind() == "list":
+		settingEditor = &settingEdit{guid: setting.GUID, key: setting.Key}
+		showSettingsMessage("A/D or ◂ ▸ choose, Enter applies, Q cancels")
+	case setting.Kind() == "text":
+		settingEditor = &settingEdit{guid: setting.GUID, key: setting.Key, text: []rune(setting.Text)}
+		showSettingsMessage("Enter applies, Esc cancels")
+	}
+}
+
+// changeSettingOption moves the option being chosen by step.
+func changeSettingOption(step int) {
+	if edit, setting, ok := editing(); ok && edit.text == nil {
+		edit.key = nextOption(setting, edit.key, step)
+	}
+}
+
+func nextOption(setting jabra.Setting, key uint16, step int) uint16 {
+	if len(setting.Options) == 0 {
+		return key
+	}
+	index := 0
+	for i, option := range setting.Options {
+		if option.Key == key {
+			index = i
+		}
+	}
+	index = (index + step + len(setting.Options)) % len(setting.Options)
+	return setting.Options[index].Key
+}
+
+// editSettingText adds a typed character to the text being edited.
+func editSettingText(key byte) {
+	edit, _, ok := editing()
+	if !ok {
+		return
+	}
+	switch {
+	case key == '\r':
+		activateHeadsetSetting()
+	case key == 0x1B: // Escape
+		settingEditor = nil
+		settingsMessage = ""
+	case key == 0x7F || key == 0x08: // Backspace
+		if len(edit.text) > 0 {
+			edit.text = edit.text[:len(edit.text)-1]
+		}
+	case key >= 0x20 && key < 0x7F:
+		edit.text = append(edit.text, rune(key))
+	}
+}
+
+// applySetting writes setting to the selected headset and reads the
+// settings back, naming the settings the headset did not take.
+func applySetting(setting jabra.Setting) {
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		return
+	}
+
+	if err := backend.SetSettings(headset.DeviceID, []jabra.Setting{setting}); err != nil {
+		failed := backend.FailedSettingNames(headset.DeviceID)
+		if len(failed) == 0 {
+			failed = []string{setting.Name}
+		}
+		showSettingsMessage("Not applied: %s (%s)", strings.Join(failed, ", "), err)
+	} else if setting.NeedsRestart {
+		showSettingsMessage("%s set to %s, the headset restarts", setting.Name, setting.Value())
+	} else {
+		showSettingsMessage("%s set to %s", setting.Name, setting.Value())
+	}
+
+	loadHeadsetSettings()
+	updateHeadsetSettingsMenu()
+}
+
+func headsetSettings() {
+	if !resetCurrentSelection {
+		currentSelection = 0
+		resetCurrentSelection = true
+		settingEditor = nil
+		settingsMessage = ""
+		showSettingsLog = false
+		settingsStale.Store(false)
+		loadHeadsetSettings()
+		updateHeadsetSettingsMenu()
+	}
+	headset, exists := getSelectedHeadset()
+	if !exists {
+		startMenuSelected = -1
+		return
+	}
+	if settingsStale.Swap(false) {
+		loadHeadsetSettings()
+		updateHeadsetSettingsMenu()
+		if log := deviceManager.SettingsLog(registry.KeyOf(headset)); len(log) > 0 {
+			last := log[len(log)-1]
+			showSettingsMessage("%s changed to %s", last.Name, last.To)
+		}
+	}
+
+	drawingBox()
+	if showSettingsLog {
+		drawSettingsLog(headset)
+		return
+	}
+
+	// Scroll to keep the cursor inside the box
+	rows := height - 10
+	offset := 0
+	if currentSelection >= rows {
+		offset = currentSelection - rows + 1
+	}
+	edit, _, editing := editing()
+	for i, item := range headsetSettingsMenu {
+		if i < offset || i-offset >= rows {
+			continue
+		}
+		label := item.label
+		if editing && i == currentSelection {
+			label = editLabel(edit)
+		}
+
+		if i == currentSelection {
+			moveCursor(4+i-offset, 9)
+			fmt.Println("\033[42m", label, "\033[0m")
+		} else {
+			moveCursor(4+i-offset, 10)
+			fmt.Println(label)
+		}
+	}
+
+	moveCursor(height-5, 7)
+	if settingsMessage != "" && settingsMessageFor == currentSelection {
+		fmt.Printf("\033[33m%s\033[0m", truncate(settingsMessage, width-14))
+	} else if setting, ok := selectedSetting(); ok {
+		fmt.Print(truncate(setting.HelpText, width-14))
+	}
+
+	moveCursor(height-3, 7)
+	fmt.Println("\033[42m", "L Change log", "\033[0m", "\033[42m", "Q Back", "\033[0m")
+}
+
+// drawSettingsLog lists the setting changes of headset since jLink started,
+// the latest first.
+func drawSettingsLog(headset jabra.DeviceInfo) {
+	log := deviceManager.SettingsLog(registry.KeyOf(headset))
+	rows := height - 10
+	if len(log) == 0 {
+		moveCursor(4, 10)
+		fmt.Print("No setting of ", headset.DeviceName, " has changed yet")
+	}
+	for i := range min(len(log), rows) {
+		entry := log[len(log)-1-i]
+		moveCursor(4+i, 10)
+		line := fmt.Sprintf("%s  %s: %s → %s", entry.Time.Format("15:04:05"), entry.Name, entry.From, entry.To)
+		fmt.Print(truncate(line, width-14))
+	}
+
+	moveCursor(height-3, 7)
+	fmt.Println("\033[42m", "L Settings", "\033[0m", "\033[42m", "Q Back", "\033[0m")
+}
+
+// toggleSettingsLog switches between the settings and their change log.
+func toggleSettingsLog() {
+	showSettingsLog = !showSettingsLog
+	settingEditor = nil
+}
+
+// editLabel shows the option being chosen or the text being typed.
+func editLabel(edit *settingEdit) string {
+	setting, _ := selectedSetting()
+	if edit.text != nil {
+		return fmt.Sprintf("  %s: %s▏", setting.Name, string(edit.text))
+	}
+	setting.Key = edit.key
+	return fmt.Sprintf("  %s: ◂ %s ▸", setting.Name, setting.Value())
+}
+
+func showSettingsMessage(format string, a ...any) {
+	settingsMessage = fmt.Sprintf(format, a...)
+	settingsMessageFor = currentSelection
+}
+
+func truncate(text string, length int) string {
+	if length <= 0 || utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	return string([]rune(text)[:length-1]) + "…"
+}